@@ -0,0 +1,176 @@
+// Package apikey authenticates requests using API keys.
+//
+// Keys are typically loaded from a secret holding a JSON array of keys:
+//
+//	keys, err := apikey.ParseKeys([]byte(secrets.APIKeys))
+//	store, err := apikey.NewStore(apikey.Config{Keys: keys})
+//	cfg.AuthHandler = store.AuthHandler()
+//
+// Only hashes of the keys are kept in memory.
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+)
+
+// Key is an API key and its metadata.
+type Key struct {
+	// ID identifies the key in logs and metrics. It must be unique.
+	ID string `json:"id"`
+
+	// Key is the key itself. Either Key or Hash must be set.
+	Key string `json:"key,omitempty"`
+
+	// Hash is the hex-encoded SHA-256 hash of the key,
+	// for storing keys without their plaintext. See Hash.
+	Hash string `json:"hash,omitempty"`
+
+	Owner   string    `json:"owner"`             // the user id the key authenticates as
+	Scopes  []string  `json:"scopes,omitempty"`  // the scopes granted to the key
+	Expires time.Time `json:"expires,omitempty"` // when the key expires, or zero
+
+	// RateLimit, if set, limits the requests made with the key.
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+}
+
+// RateLimit is a per-key token bucket rate limit.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`  // requests per second
+	Burst int     `json:"burst"` // defaults to Rate, rounded up
+}
+
+// Info is the metadata of an authenticated key.
+// It is the auth data of requests authenticated by the store.
+type Info struct {
+	ID      string
+	Owner   string
+	Scopes  []string
+	Expires time.Time
+}
+
+// HasScope reports whether the key was granted the given scope.
+func (i *Info) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Hash returns the hex-encoded SHA-256 hash of key.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseKeys parses a JSON array of keys.
+func ParseKeys(data []byte) ([]Key, error) {
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("apikey: parse keys: %v", err)
+	}
+	return keys, nil
+}
+
+type Config struct {
+	Keys []Key
+
+	// Header is the request header holding the key.
+	// If empty it defaults to "X-API-Key".
+	Header string
+}
+
+// Store holds a set of API keys. It is safe for concurrent use.
+type Store struct {
+	header string
+	keys   map[[sha256.Size]byte]*entry
+
+	now func() time.Time // for testing
+}
+
+type entry struct {
+	info      Info
+	rateLimit *RateLimit
+}
+
+// NewStore creates a store holding cfg.Keys.
+func NewStore(cfg Config) (*Store, error) {
+	s := &Store{
+		header: cfg.Header,
+		keys:   make(map[[sha256.Size]byte]*entry, len(cfg.Keys)),
+		now:    time.Now,
+	}
+	if s.header == "" {
+		s.header = "X-API-Key"
+	}
+
+	ids := make(map[string]bool, len(cfg.Keys))
+	for i, k := range cfg.Keys {
+		if k.ID == "" {
+			return nil, fmt.Errorf("apikey: key %d: missing id", i)
+		} else if ids[k.ID] {
+			return nil, fmt.Errorf("apikey: duplicate key id %q", k.ID)
+		}
+		ids[k.ID] = true
+
+		var hash [sha256.Size]byte
+		switch {
+		case k.Key != "" && k.Hash != "":
+			return nil, fmt.Errorf("apikey: key %q: both key and hash set", k.ID)
+		case k.Key != "":
+			hash = sha256.Sum256([]byte(k.Key))
+		case k.Hash != "":
+			b, err := hex.DecodeString(k.Hash)
+			if err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("apikey: key %q: invalid hash", k.ID)
+			}
+			copy(hash[:], b)
+		default:
+			return nil, fmt.Errorf("apikey: key %q: missing key or hash", k.ID)
+		}
+		if _, dup := s.keys[hash]; dup {
+			return nil, fmt.Errorf("apikey: key %q: duplicate key", k.ID)
+		}
+
+		owner := k.Owner
+		if owner == "" {
+			owner = k.ID
+		}
+		s.keys[hash] = &entry{
+			info:      Info{ID: k.ID, Owner: owner, Scopes: k.Scopes, Expires: k.Expires},
+			rateLimit: k.RateLimit,
+		}
+	}
+	return s, nil
+}
+
+// Lookup looks up the given key. It returns an errs.Unauthenticated
+// error if the key is unknown or has expired.
+func (s *Store) Lookup(key string) (*Info, error) {
+	e, err := s.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	info := e.info
+	return &info, nil
+}
+
+func (s *Store) lookup(key string) (*entry, error) {
+	// Keys are looked up by their hash, so lookup times
+	// reveal nothing about the stored keys.
+	e, ok := s.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "invalid api key"}
+	}
+	if !e.info.Expires.IsZero() && !s.now().Before(e.info.Expires) {
+		return e, &errs.Error{Code: errs.Unauthenticated, Message: "api key expired"}
+	}
+	return e, nil
+}
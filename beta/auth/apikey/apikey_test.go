@@ -0,0 +1,75 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+)
+
+func TestStore(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys, err := ParseKeys([]byte(`[
+		{"id": "plain", "key": "secret-1", "owner": "alice", "scopes": ["read"]},
+		{"id": "hashed", "hash": "` + Hash("secret-2") + `"},
+		{"id": "expired", "key": "secret-3", "owner": "bob", "expires": "2020-12-31T00:00:00Z"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(Config{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+
+	tests := []struct {
+		key     string
+		wantID  string
+		wantUID string
+		wantErr bool
+	}{
+		{key: "secret-1", wantID: "plain", wantUID: "alice"},
+		{key: "secret-2", wantID: "hashed", wantUID: "hashed"},
+		{key: "secret-3", wantErr: true},
+		{key: "unknown", wantErr: true},
+	}
+	for _, test := range tests {
+		info, err := s.Lookup(test.key)
+		if test.wantErr {
+			if errs.Code(err) != errs.Unauthenticated {
+				t.Errorf("Lookup(%q): got err %v, want Unauthenticated", test.key, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", test.key, err)
+		} else if info.ID != test.wantID || info.Owner != test.wantUID {
+			t.Errorf("Lookup(%q) = %+v, want id %q and owner %q", test.key, info, test.wantID, test.wantUID)
+		}
+	}
+
+	info, _ := s.Lookup("secret-1")
+	if !info.HasScope("read") || info.HasScope("write") {
+		t.Errorf("got scopes %v, want [read]", info.Scopes)
+	}
+}
+
+func TestNewStore_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []Key
+	}{
+		{"missing id", []Key{{Key: "a"}}},
+		{"duplicate id", []Key{{ID: "a", Key: "a"}, {ID: "a", Key: "b"}}},
+		{"duplicate key", []Key{{ID: "a", Key: "a"}, {ID: "b", Hash: Hash("a")}}},
+		{"key and hash", []Key{{ID: "a", Key: "a", Hash: Hash("a")}}},
+		{"no key or hash", []Key{{ID: "a"}}},
+		{"invalid hash", []Key{{ID: "a", Hash: "abc"}}},
+	}
+	for _, test := range tests {
+		if _, err := NewStore(Config{Keys: test.keys}); err == nil {
+			t.Errorf("%s: got nil err", test.name)
+		}
+	}
+}
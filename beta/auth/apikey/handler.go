@@ -0,0 +1,39 @@
+package apikey
+
+import (
+	"net/http"
+
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/runtime/config"
+)
+
+// AuthHandler returns an auth handler that authenticates requests
+// with the key in the configured header. The user id is the key's
+// owner and the auth data is its *Info. Usage is reported
+// per key in the auth_api_key_requests_total metric.
+func (s *Store) AuthHandler() config.AuthHandler {
+	return func(req *http.Request) (*config.AuthResult, error) {
+		key := req.Header.Get(s.header)
+		if key == "" {
+			return nil, nil
+		}
+		e, err := s.lookup(key)
+		if err != nil {
+			if e != nil {
+				metrics.APIKeyRequest(e.info.ID, "expired")
+			} else {
+				metrics.APIKeyRequest("", "invalid")
+			}
+			return nil, err
+		}
+		metrics.APIKeyRequest(e.info.ID, "ok")
+
+		info := e.info
+		res := &config.AuthResult{UID: info.Owner, Data: &info, Scopes: info.Scopes}
+		if rl := e.rateLimit; rl != nil {
+			res.RateLimit = &config.RateLimit{Rate: rl.Rate, Burst: rl.Burst}
+			res.LimitKey = "apikey:" + info.ID
+		}
+		return res, nil
+	}
+}
@@ -0,0 +1,47 @@
+package introspect
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/runtime/config"
+)
+
+// AuthHandler returns an auth handler that authenticates requests
+// with a bearer token in the Authorization header. The user id is
+// taken from the configured UIDClaim, and the auth data is the *Response.
+//
+// If the introspection endpoint is unavailable requests
+// fail with errs.Unavailable.
+func (in *Introspector) AuthHandler() config.AuthHandler {
+	return func(req *http.Request) (*config.AuthResult, error) {
+		token := bearerToken(req)
+		if token == "" {
+			return nil, nil
+		}
+		resp, err := in.Introspect(req.Context(), token)
+		if errors.Is(err, ErrInactiveToken) {
+			return nil, &errs.Error{Code: errs.Unauthenticated, Message: "invalid token"}
+		} else if err != nil {
+			return nil, errs.WrapCode(err, errs.Unavailable, "token introspection failed")
+		}
+		uid, _ := resp.Claims[in.cfg.UIDClaim].(string)
+		if uid == "" {
+			return nil, &errs.Error{Code: errs.Unauthenticated, Message: "token has no " + in.cfg.UIDClaim}
+		}
+		return &config.AuthResult{UID: uid, Data: resp, Scopes: resp.Scopes()}, nil
+	}
+}
+
+// bearerToken returns the bearer token from the
+// request's Authorization header, or "".
+func bearerToken(req *http.Request) string {
+	const prefix = "bearer "
+	auth := req.Header.Get("Authorization")
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return strings.TrimSpace(auth[len(prefix):])
+	}
+	return ""
+}
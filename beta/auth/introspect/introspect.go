@@ -0,0 +1,261 @@
+// Package introspect validates opaque OAuth2 bearer tokens
+// using an RFC 7662 token introspection endpoint.
+//
+// Introspection results are cached, so repeated requests with the
+// same token do not hit the authorization server:
+//
+//	in := introspect.New(introspect.Config{
+//	    Endpoint:     "https://example.okta.com/oauth2/v1/introspect",
+//	    ClientID:     "my-api",
+//	    ClientSecret: secrets.IntrospectionSecret,
+//	})
+//	cfg.AuthHandler = in.AuthHandler()
+package introspect
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Endpoint is the URL of the introspection endpoint.
+	Endpoint string
+
+	// ClientID and ClientSecret are the credentials used to
+	// authenticate to the introspection endpoint with HTTP basic auth.
+	ClientID     string
+	ClientSecret string
+
+	// Issuer, if set, is the required "iss" of active tokens.
+	Issuer string
+
+	// Audience, if set, is required to be present in the "aud" of active tokens.
+	Audience string
+
+	// CacheTTL is how long to cache introspection results.
+	// Results for active tokens are never cached beyond the token's expiry.
+	// If zero it defaults to 1m; if negative results are not cached.
+	CacheTTL time.Duration
+
+	// MaxCacheSize is the maximum number of cached results.
+	// If zero it defaults to 10000.
+	MaxCacheSize int
+
+	// UIDClaim is the response field holding the user id, used by
+	// AuthHandler. If empty it defaults to "sub".
+	UIDClaim string
+
+	// HTTPClient is the client for calling the introspection endpoint.
+	// If nil it defaults to a client with a 10s timeout.
+	HTTPClient *http.Client
+}
+
+// Response is an introspection response for an active token.
+type Response struct {
+	Scope     string
+	ClientID  string
+	Username  string
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time // zero if the token does not expire
+
+	// Claims holds all fields of the response, including non-standard ones.
+	Claims map[string]interface{}
+}
+
+// Scopes reports the token's scopes.
+func (r *Response) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+// ErrInactiveToken is returned for tokens the authorization
+// server reports as inactive, or that fail validation.
+var ErrInactiveToken = errors.New("introspect: inactive token")
+
+// Introspector introspects tokens. It is safe for concurrent use.
+type Introspector struct {
+	cfg Config
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cacheEntry
+
+	now func() time.Time // for testing
+}
+
+type cacheEntry struct {
+	resp    *Response // nil if the token is inactive
+	expires time.Time
+}
+
+func New(cfg Config) *Introspector {
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = time.Minute
+	}
+	if cfg.MaxCacheSize <= 0 {
+		cfg.MaxCacheSize = 10000
+	}
+	if cfg.UIDClaim == "" {
+		cfg.UIDClaim = "sub"
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Introspector{
+		cfg:   cfg,
+		cache: make(map[[sha256.Size]byte]cacheEntry),
+		now:   time.Now,
+	}
+}
+
+// Introspect introspects the token, returning ErrInactiveToken
+// if it is not active. Other errors indicate the introspection
+// endpoint could not be queried.
+func (in *Introspector) Introspect(ctx context.Context, token string) (*Response, error) {
+	key := sha256.Sum256([]byte(token))
+	if resp, ok := in.cached(key); ok {
+		if resp == nil {
+			return nil, ErrInactiveToken
+		}
+		return resp, nil
+	}
+
+	resp, err := in.introspect(ctx, token)
+	if err != nil && !errors.Is(err, ErrInactiveToken) {
+		return nil, err
+	}
+	in.store(key, resp)
+	if resp == nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (in *Introspector) cached(key [sha256.Size]byte) (*Response, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	e, ok := in.cache[key]
+	if !ok {
+		return nil, false
+	} else if !in.now().Before(e.expires) {
+		delete(in.cache, key)
+		return nil, false
+	}
+	return e.resp, true
+}
+
+func (in *Introspector) store(key [sha256.Size]byte, resp *Response) {
+	if in.cfg.CacheTTL < 0 {
+		return
+	}
+	now := in.now()
+	expires := now.Add(in.cfg.CacheTTL)
+	if resp != nil && !resp.ExpiresAt.IsZero() && resp.ExpiresAt.Before(expires) {
+		expires = resp.ExpiresAt
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if len(in.cache) >= in.cfg.MaxCacheSize {
+		for k, e := range in.cache {
+			if !now.Before(e.expires) {
+				delete(in.cache, k)
+			}
+		}
+		// Still full: evict arbitrary entries to make room.
+		for k := range in.cache {
+			if len(in.cache) < in.cfg.MaxCacheSize {
+				break
+			}
+			delete(in.cache, k)
+		}
+	}
+	in.cache[key] = cacheEntry{resp: resp, expires: expires}
+}
+
+// introspect queries the introspection endpoint. It returns
+// a nil response and ErrInactiveToken for inactive tokens.
+func (in *Introspector) introspect(ctx context.Context, token string) (*Response, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, "POST", in.cfg.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if in.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(in.cfg.ClientID), url.QueryEscape(in.cfg.ClientSecret))
+	}
+
+	httpResp, err := in.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspect: %v", err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspect: got status %s", httpResp.Status)
+	}
+
+	var claims map[string]interface{}
+	dec := json.NewDecoder(httpResp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("introspect: decode response: %v", err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrInactiveToken
+	}
+
+	resp := &Response{Claims: claims}
+	resp.Scope, _ = claims["scope"].(string)
+	resp.ClientID, _ = claims["client_id"].(string)
+	resp.Username, _ = claims["username"].(string)
+	resp.Subject, _ = claims["sub"].(string)
+	resp.Issuer, _ = claims["iss"].(string)
+	switch aud := claims["aud"].(type) {
+	case string:
+		resp.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				resp.Audience = append(resp.Audience, s)
+			}
+		}
+	}
+	if exp, ok := claims["exp"].(json.Number); ok {
+		if sec, err := exp.Int64(); err == nil {
+			resp.ExpiresAt = time.Unix(sec, 0)
+		}
+	}
+
+	if err := in.validate(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (in *Introspector) validate(resp *Response) error {
+	if !resp.ExpiresAt.IsZero() && !in.now().Before(resp.ExpiresAt) {
+		return fmt.Errorf("%w: token expired", ErrInactiveToken)
+	}
+	if in.cfg.Issuer != "" && resp.Issuer != in.cfg.Issuer {
+		return fmt.Errorf("%w: invalid issuer", ErrInactiveToken)
+	}
+	if in.cfg.Audience != "" {
+		for _, aud := range resp.Audience {
+			if aud == in.cfg.Audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: invalid audience", ErrInactiveToken)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package introspect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// server is a fake introspection endpoint.
+type server struct {
+	*httptest.Server
+	calls int32
+}
+
+func newServer(t *testing.T, tokens map[string]map[string]interface{}) *server {
+	s := &server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+		if id, secret, ok := req.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp, ok := tokens[req.PostFormValue("token")]
+		if !ok {
+			resp = map[string]interface{}{"active": false}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestIntrospect(t *testing.T) {
+	now := time.Now()
+	srv := newServer(t, map[string]map[string]interface{}{
+		"good": {
+			"active": true, "sub": "alice", "scope": "read write",
+			"iss": "https://issuer/", "aud": []string{"api"},
+			"exp": now.Add(time.Hour).Unix(),
+		},
+		"wrong-aud": {"active": true, "sub": "bob", "iss": "https://issuer/", "aud": "other"},
+		"expired":   {"active": true, "sub": "bob", "iss": "https://issuer/", "aud": "api", "exp": now.Add(-time.Minute).Unix()},
+	})
+	in := New(Config{
+		Endpoint:     srv.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Issuer:       "https://issuer/",
+		Audience:     "api",
+	})
+	ctx := context.Background()
+
+	resp, err := in.Introspect(ctx, "good")
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if resp.Subject != "alice" || len(resp.Scopes()) != 2 {
+		t.Errorf("got %+v, want subject alice with 2 scopes", resp)
+	}
+	for _, token := range []string{"unknown", "wrong-aud", "expired"} {
+		if _, err := in.Introspect(ctx, token); !errors.Is(err, ErrInactiveToken) {
+			t.Errorf("Introspect(%q): got err %v, want ErrInactiveToken", token, err)
+		}
+	}
+}
+
+func TestIntrospect_Cache(t *testing.T) {
+	now := time.Now()
+	srv := newServer(t, map[string]map[string]interface{}{
+		"good":     {"active": true, "sub": "alice"},
+		"short":    {"active": true, "sub": "alice", "exp": now.Add(10 * time.Second).Unix()},
+		"inactive": {"active": false},
+	})
+	in := New(Config{Endpoint: srv.URL, ClientID: "client", ClientSecret: "secret", CacheTTL: time.Minute})
+	in.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		in.Introspect(ctx, "good")
+		in.Introspect(ctx, "short")
+		in.Introspect(ctx, "inactive")
+	}
+	if n := atomic.LoadInt32(&srv.calls); n != 3 {
+		t.Fatalf("got %d calls, want 3", n)
+	}
+
+	// The short-lived token's cache entry expires with the token.
+	now = now.Add(30 * time.Second)
+	in.Introspect(ctx, "good")
+	if _, err := in.Introspect(ctx, "short"); !errors.Is(err, ErrInactiveToken) {
+		t.Errorf("got err %v, want ErrInactiveToken", err)
+	}
+	if n := atomic.LoadInt32(&srv.calls); n != 4 {
+		t.Fatalf("got %d calls, want 4", n)
+	}
+
+	now = now.Add(time.Minute)
+	in.Introspect(ctx, "good")
+	if n := atomic.LoadInt32(&srv.calls); n != 5 {
+		t.Fatalf("got %d calls, want 5", n)
+	}
+}
+
+func TestIntrospect_Unavailable(t *testing.T) {
+	srv := newServer(t, nil)
+	in := New(Config{Endpoint: srv.URL, ClientID: "client", ClientSecret: "wrong"})
+	_, err := in.Introspect(context.Background(), "token")
+	if err == nil || errors.Is(err, ErrInactiveToken) {
+		t.Fatalf("got err %v, want endpoint error", err)
+	}
+	// Errors are not cached.
+	in.Introspect(context.Background(), "token")
+	if n := atomic.LoadInt32(&srv.calls); n != 2 {
+		t.Fatalf("got %d calls, want 2", n)
+	}
+}
@@ -0,0 +1,47 @@
+package jwt
+
+import (
+	"net/http"
+	"strings"
+
+	"runtime.encore.dev/runtime/config"
+)
+
+// AuthHandler returns an auth handler that authenticates requests
+// with a bearer token in the Authorization header. The user id is
+// taken from the configured UIDClaim, and the auth data is the token's Claims.
+// The caller's scopes and roles are taken from the claims reported by
+// Claims.Scopes and Claims.Roles.
+func (v *Verifier) AuthHandler() config.AuthHandler {
+	return func(req *http.Request) (*config.AuthResult, error) {
+		token := BearerToken(req)
+		if token == "" {
+			return nil, nil
+		}
+		claims, err := v.Verify(req.Context(), token)
+		if err != nil {
+			return nil, err
+		}
+		uid, _ := claims[v.cfg.UIDClaim].(string)
+		if uid == "" {
+			return nil, invalid("missing " + v.cfg.UIDClaim + " claim")
+		}
+		return &config.AuthResult{
+			UID:    uid,
+			Data:   claims,
+			Scopes: claims.Scopes(),
+			Roles:  claims.Roles(),
+		}, nil
+	}
+}
+
+// BearerToken returns the bearer token from the
+// request's Authorization header, or "".
+func BearerToken(req *http.Request) string {
+	const prefix = "bearer "
+	auth := req.Header.Get("Authorization")
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return strings.TrimSpace(auth[len(prefix):])
+	}
+	return ""
+}
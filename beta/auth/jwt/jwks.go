@@ -0,0 +1,195 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minRefetchInterval is the minimum time between refetching the key set
+// due to encountering an unknown key id, to avoid hammering the endpoint
+// with tokens signed by bogus keys.
+const minRefetchInterval = time.Minute
+
+// keySet is a cached JSON Web Key Set.
+type keySet struct {
+	url     string
+	client  *http.Client
+	refresh time.Duration
+
+	fetchMu sync.Mutex // serializes fetches
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// get returns the key with the given id, fetching the key set
+// if it is stale or does not contain the key.
+func (ks *keySet) get(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, fetchedAt, ok := ks.lookup(kid)
+	if ok && time.Since(fetchedAt) < ks.refresh {
+		return key, nil
+	}
+	if !ok && !fetchedAt.IsZero() && time.Since(fetchedAt) < minRefetchInterval {
+		return nil, invalid("unknown signing key")
+	}
+
+	if err := ks.fetch(ctx, fetchedAt); err != nil {
+		if ok {
+			// Keep using the stale key; the endpoint may be temporarily unavailable.
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, _, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, invalid("unknown signing key")
+}
+
+// lookup looks up a key in the cached key set. If kid is empty
+// it returns the only key in the set, if there is exactly one.
+func (ks *keySet) lookup(kid string) (key crypto.PublicKey, fetchedAt time.Time, ok bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, ks.fetchedAt, true
+		}
+	}
+	key, ok = ks.keys[kid]
+	return key, ks.fetchedAt, ok
+}
+
+// fetch fetches the key set, unless it has been fetched
+// by someone else since prevFetch.
+func (ks *keySet) fetch(ctx context.Context, prevFetch time.Time) error {
+	ks.fetchMu.Lock()
+	defer ks.fetchMu.Unlock()
+
+	ks.mu.RLock()
+	fetched := ks.fetchedAt.After(prevFetch)
+	ks.mu.RUnlock()
+	if fetched {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ks.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("jwt: fetch key set: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwt: fetch key set: got status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("jwt: decode key set: %v", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	ks.mu.Unlock()
+	return nil
+}
+
+// jwk is a JSON Web Key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid ec key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,319 @@
+// Package jwt validates JSON Web Tokens, with signing keys
+// fetched from a JWKS endpoint and rotated automatically.
+//
+// A Verifier can back the runtime's auth handler:
+//
+//	v := jwt.NewVerifier(jwt.Config{
+//	    JWKSURL:  "https://example.com/.well-known/jwks.json",
+//	    Issuer:   "https://example.com/",
+//	    Audience: "my-api",
+//	})
+//	cfg.AuthHandler = v.AuthHandler()
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // for crypto.SHA256
+	_ "crypto/sha512" // for crypto.SHA384 and crypto.SHA512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// JWKSURL is the URL of the JSON Web Key Set to verify signatures with.
+	JWKSURL string
+
+	// HMACSecret is the secret for verifying HMAC-signed tokens
+	// (HS256, HS384 and HS512). They are rejected if it is empty.
+	HMACSecret []byte
+
+	// Issuer, if set, is the required "iss" claim.
+	Issuer string
+
+	// Audience, if set, is required to be present in the "aud" claim.
+	Audience string
+
+	// Leeway is the allowed clock skew when validating
+	// the "exp", "nbf" and "iat" claims.
+	Leeway time.Duration
+
+	// RefreshInterval is how often to refresh the key set.
+	// If zero it defaults to 1h. The key set is also refreshed
+	// when a token is signed with an unknown key, to handle rotation.
+	RefreshInterval time.Duration
+
+	// UIDClaim is the claim holding the user id, used by AuthHandler.
+	// If empty it defaults to "sub".
+	UIDClaim string
+
+	// HTTPClient is the client for fetching the key set.
+	// If nil it defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Claims are the claims of a verified token.
+type Claims map[string]interface{}
+
+func (c Claims) Subject() string { s, _ := c["sub"].(string); return s }
+func (c Claims) Issuer() string  { s, _ := c["iss"].(string); return s }
+
+// Audience reports the "aud" claim, which may be a string or an array.
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		res := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// Scopes reports the token's scopes, from the space-separated
+// "scope" claim or the "scp" claim, which may also be an array.
+func (c Claims) Scopes() []string {
+	if s, ok := c["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	return c.strings("scp")
+}
+
+// Roles reports the "roles" claim, which may be a string or an array.
+func (c Claims) Roles() []string {
+	return c.strings("roles")
+}
+
+// strings reports a claim holding a space-separated string or an array of strings.
+func (c Claims) strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// Time reports the value of a NumericDate claim, such as "exp".
+// The second result is false if the claim is missing or invalid.
+func (c Claims) Time(name string) (time.Time, bool) {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec, frac := int64(f), f-float64(int64(f))
+	return time.Unix(sec, int64(frac*1e9)), true
+}
+
+// ErrInvalidToken is returned, possibly wrapped, for tokens
+// that fail validation.
+var ErrInvalidToken = errors.New("jwt: invalid token")
+
+// Verifier verifies tokens. It is safe for concurrent use.
+type Verifier struct {
+	cfg  Config
+	keys *keySet
+	now  func() time.Time // for testing
+}
+
+func NewVerifier(cfg Config) *Verifier {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Hour
+	}
+	if cfg.UIDClaim == "" {
+		cfg.UIDClaim = "sub"
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	v := &Verifier{cfg: cfg, now: time.Now}
+	if cfg.JWKSURL != "" {
+		v.keys = &keySet{url: cfg.JWKSURL, client: cfg.HTTPClient, refresh: cfg.RefreshInterval}
+	}
+	return v
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify verifies the token's signature and standard claims,
+// and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("malformed token")
+	}
+
+	var hdr header
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, invalid("malformed header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("malformed signature")
+	}
+	if err := v.verifySignature(ctx, hdr, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalid("malformed claims")
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, hdr header, signed string, sig []byte) error {
+	if strings.HasPrefix(hdr.Alg, "HS") {
+		h, ok := hashes[hdr.Alg[2:]]
+		if !ok || len(v.cfg.HMACSecret) == 0 {
+			return invalid("unsupported algorithm " + hdr.Alg)
+		}
+		mac := hmac.New(h.New, v.cfg.HMACSecret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return invalid("invalid signature")
+		}
+		return nil
+	}
+
+	if v.keys == nil {
+		return invalid("unsupported algorithm " + hdr.Alg)
+	}
+	key, err := v.keys.get(ctx, hdr.Kid)
+	if err != nil {
+		return err
+	}
+	return verifyAsymmetric(hdr.Alg, key, signed, sig)
+}
+
+var hashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+func verifyAsymmetric(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if alg == "EdDSA" {
+		k, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(k, []byte(signed), sig) {
+			return invalid("invalid signature")
+		}
+		return nil
+	}
+
+	if len(alg) != 5 {
+		return invalid("unsupported algorithm " + alg)
+	}
+	h, ok := hashes[alg[2:]]
+	if !ok {
+		return invalid("unsupported algorithm " + alg)
+	}
+	hh := h.New()
+	hh.Write([]byte(signed))
+	digest := hh.Sum(nil)
+
+	var valid bool
+	switch alg[:2] {
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		valid = ok && rsa.VerifyPKCS1v15(k, h, digest, sig) == nil
+	case "PS":
+		k, ok := key.(*rsa.PublicKey)
+		valid = ok && rsa.VerifyPSS(k, h, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if ok {
+			size := (k.Curve.Params().BitSize + 7) / 8
+			if len(sig) == 2*size {
+				r := new(big.Int).SetBytes(sig[:size])
+				s := new(big.Int).SetBytes(sig[size:])
+				valid = ecdsa.Verify(k, digest, r, s)
+			}
+		}
+	default:
+		return invalid("unsupported algorithm " + alg)
+	}
+	if !valid {
+		return invalid("invalid signature")
+	}
+	return nil
+}
+
+// validate validates the standard claims.
+func (v *Verifier) validate(c Claims) error {
+	now := v.now()
+	leeway := v.cfg.Leeway
+	if exp, ok := c.Time("exp"); ok && !now.Before(exp.Add(leeway)) {
+		return invalid("token expired")
+	} else if !ok && c["exp"] != nil {
+		return invalid("invalid exp claim")
+	}
+	if nbf, ok := c.Time("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return invalid("token not yet valid")
+	}
+	if iat, ok := c.Time("iat"); ok && now.Add(leeway).Before(iat) {
+		return invalid("token issued in the future")
+	}
+	if v.cfg.Issuer != "" && c.Issuer() != v.cfg.Issuer {
+		return invalid("invalid issuer")
+	}
+	if v.cfg.Audience != "" {
+		found := false
+		for _, aud := range c.Audience() {
+			if aud == v.cfg.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return invalid("invalid audience")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(seg string, dst interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	return dec.Decode(dst)
+}
+
+func invalid(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, reason)
+}
@@ -0,0 +1,276 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+func sign(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	hdr, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(hdr) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func jwkFor(kid string, key interface{}) map[string]string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return map[string]string{
+			"kty": "RSA", "kid": kid, "use": "sig",
+			"n": b64.EncodeToString(k.N.Bytes()),
+			"e": b64.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case *ecdsa.PrivateKey:
+		return map[string]string{
+			"kty": "EC", "kid": kid, "crv": "P-256",
+			"x": b64.EncodeToString(k.X.Bytes()),
+			"y": b64.EncodeToString(k.Y.Bytes()),
+		}
+	case ed25519.PrivateKey:
+		return map[string]string{
+			"kty": "OKP", "kid": kid, "crv": "Ed25519",
+			"x": b64.EncodeToString(k.Public().(ed25519.PublicKey)),
+		}
+	}
+	panic("unsupported key")
+}
+
+// jwksServer serves the key set returned by keys, counting fetches.
+func jwksServer(t *testing.T, keys func() []map[string]string) (*httptest.Server, *int32) {
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys()})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &fetches
+}
+
+func TestVerify_Algorithms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("secret")
+
+	srv, _ := jwksServer(t, func() []map[string]string {
+		return []map[string]string{jwkFor("rsa", rsaKey), jwkFor("ec", ecKey), jwkFor("ed", edKey)}
+	})
+	v := NewVerifier(Config{JWKSURL: srv.URL, HMACSecret: secret})
+
+	claims := map[string]interface{}{"sub": "alice"}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"RS256", sign(t, "RS256", "rsa", rsaKey, claims)},
+		{"ES256", sign(t, "ES256", "ec", ecKey, claims)},
+		{"EdDSA", sign(t, "EdDSA", "ed", edKey, claims)},
+		{"HS256", sign(t, "HS256", "", secret, claims)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := v.Verify(context.Background(), test.token)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if got.Subject() != "alice" {
+				t.Errorf("Subject() = %q, want alice", got.Subject())
+			}
+		})
+	}
+}
+
+func TestVerify_Invalid(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	srv, _ := jwksServer(t, func() []map[string]string {
+		return []map[string]string{jwkFor("rsa", rsaKey)}
+	})
+	v := NewVerifier(Config{JWKSURL: srv.URL})
+
+	claims := map[string]interface{}{"sub": "alice"}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"malformed", "not-a-token"},
+		{"wrong key", sign(t, "RS256", "rsa", otherKey, claims)},
+		{"unknown kid", sign(t, "RS256", "other", rsaKey, claims)},
+		{"alg none", b64.EncodeToString([]byte(`{"alg":"none"}`)) + "." + b64.EncodeToString([]byte(`{}`)) + "."},
+		{"hmac without secret", sign(t, "HS256", "rsa", []byte("x"), claims)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := v.Verify(context.Background(), test.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify: got err %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerify_Claims(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1600000000, 0)
+	v := NewVerifier(Config{
+		HMACSecret: secret,
+		Issuer:     "https://issuer/",
+		Audience:   "api",
+		Leeway:     30 * time.Second,
+	})
+	v.now = func() time.Time { return now }
+
+	base := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://issuer/",
+			"aud": []string{"other", "api"},
+			"exp": now.Add(time.Minute).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		valid  bool
+	}{
+		{"valid", base(nil), true},
+		{"string audience", base(map[string]interface{}{"aud": "api"}), true},
+		{"no exp", base(map[string]interface{}{"exp": nil}), true},
+		{"expired within leeway", base(map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}), true},
+		{"expired", base(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), false},
+		{"nbf within leeway", base(map[string]interface{}{"nbf": now.Add(10 * time.Second).Unix()}), true},
+		{"not yet valid", base(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}), false},
+		{"issued in future", base(map[string]interface{}{"iat": now.Add(time.Minute).Unix()}), false},
+		{"wrong issuer", base(map[string]interface{}{"iss": "https://evil/"}), false},
+		{"wrong audience", base(map[string]interface{}{"aud": "other"}), false},
+		{"missing audience", base(map[string]interface{}{"aud": nil}), false},
+		{"invalid exp", base(map[string]interface{}{"exp": "tomorrow"}), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), sign(t, "HS256", "", secret, test.claims))
+			if test.valid && err != nil {
+				t.Errorf("Verify: %v", err)
+			} else if !test.valid && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify: got err %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerify_KeyRotation(t *testing.T) {
+	key1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key2, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var rotated int32
+	srv, fetches := jwksServer(t, func() []map[string]string {
+		if atomic.LoadInt32(&rotated) == 1 {
+			return []map[string]string{jwkFor("k2", key2)}
+		}
+		return []map[string]string{jwkFor("k1", key1)}
+	})
+	v := NewVerifier(Config{JWKSURL: srv.URL})
+	ctx := context.Background()
+	claims := map[string]interface{}{"sub": "alice"}
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(ctx, sign(t, "RS256", "k1", key1, claims)); err != nil {
+			t.Fatalf("Verify k1: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Fatalf("got %d fetches, want 1", n)
+	}
+
+	// A token signed with a new key triggers a refetch,
+	// once the minimum refetch interval has passed.
+	atomic.StoreInt32(&rotated, 1)
+	token := sign(t, "RS256", "k2", key2, claims)
+	if _, err := v.Verify(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify k2 before refetch interval: got err %v, want ErrInvalidToken", err)
+	}
+	v.keys.mu.Lock()
+	v.keys.fetchedAt = v.keys.fetchedAt.Add(-minRefetchInterval)
+	v.keys.mu.Unlock()
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Fatalf("Verify k2: %v", err)
+	}
+	if n := atomic.LoadInt32(fetches); n != 2 {
+		t.Fatalf("got %d fetches, want 2", n)
+	}
+}
+
+func TestClaims_ScopesAndRoles(t *testing.T) {
+	tests := []struct {
+		claims string
+		scopes []string
+		roles  []string
+	}{
+		{`{"scope": "read write", "roles": ["admin"]}`, []string{"read", "write"}, []string{"admin"}},
+		{`{"scp": ["read"], "roles": "admin editor"}`, []string{"read"}, []string{"admin", "editor"}},
+		{`{}`, nil, nil},
+	}
+	for _, test := range tests {
+		var c Claims
+		if err := json.Unmarshal([]byte(test.claims), &c); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Scopes(); !reflect.DeepEqual(got, test.scopes) {
+			t.Errorf("%s: Scopes() = %v, want %v", test.claims, got, test.scopes)
+		}
+		if got := c.Roles(); !reflect.DeepEqual(got, test.roles) {
+			t.Errorf("%s: Roles() = %v, want %v", test.claims, got, test.roles)
+		}
+	}
+}
@@ -166,12 +166,18 @@ const (
 
 // String returns the string representation of c.
 func (c ErrCode) String() string {
+	if c < 0 || int(c) >= len(codeNames) {
+		return codeNames[Unknown]
+	}
 	return codeNames[c]
 }
 
-// HTTPStatus reports a suitable HTTP status code for an error, based on its code.
-// If err is nil it reports 200. If it's not an *Error it reports 500.
+// HTTPStatus reports a suitable HTTP status code for the error code.
+// It reports 500 for unrecognized codes.
 func (c ErrCode) HTTPStatus() int {
+	if c < 0 || int(c) >= len(codeStatus) {
+		return 500
+	}
 	return codeStatus[c]
 }
 
@@ -180,6 +186,28 @@ func (c ErrCode) MarshalJSON() ([]byte, error) {
 	return []byte("\"" + s + "\""), nil
 }
 
+// UnmarshalJSON decodes an error code from its string representation.
+// Unrecognized codes are decoded as Unknown.
+func (c *ErrCode) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*c = ParseCode(s)
+	return nil
+}
+
+// ParseCode returns the error code with the string representation s,
+// such as "not_found". If s is not a valid code it returns Unknown.
+func ParseCode(s string) ErrCode {
+	for c, name := range codeNames {
+		if name == s {
+			return ErrCode(c)
+		}
+	}
+	return Unknown
+}
+
 var codeNames = [...]string{
 	OK:                 "ok",
 	Canceled:           "canceled",
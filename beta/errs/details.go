@@ -1,5 +1,53 @@
 package errs
 
+import (
+	"strconv"
+	"time"
+)
+
 type ErrDetails interface {
 	ErrDetails() // marker method
 }
+
+// ValidationDetails are the details of an InvalidArgument
+// error, describing the invalid fields of a request.
+type ValidationDetails struct {
+	Fields []FieldViolation `json:"fields"`
+}
+
+// FieldViolation describes an invalid field of a request.
+type FieldViolation struct {
+	Field       string `json:"field"`       // path of the field, such as "address.zip"
+	Description string `json:"description"` // why the field is invalid
+}
+
+func (*ValidationDetails) ErrDetails() {}
+
+// RetryInfo are the details of an error for a request that may
+// be retried later, such as ResourceExhausted or Unavailable.
+// HTTPError reports it in the Retry-After header as well.
+type RetryInfo struct {
+	RetryAfter time.Duration
+}
+
+func (*RetryInfo) ErrDetails() {}
+
+func (r *RetryInfo) MarshalJSON() ([]byte, error) {
+	return []byte(`{"retry_after_secs":` + strconv.Itoa(r.seconds()) + `}`), nil
+}
+
+// seconds reports the delay in seconds, rounded up.
+func (r *RetryInfo) seconds() int {
+	return int((r.RetryAfter + time.Second - 1) / time.Second)
+}
+
+// ResourceInfo are the details of an error relating to
+// a specific resource, such as NotFound or AlreadyExists.
+type ResourceInfo struct {
+	Type        string `json:"resource_type"`         // such as "user"
+	Name        string `json:"resource_name"`         // such as the user's id
+	Owner       string `json:"owner,omitempty"`       // owner of the resource, if any
+	Description string `json:"description,omitempty"` // how the error relates to the resource
+}
+
+func (*ResourceInfo) ErrDetails() {}
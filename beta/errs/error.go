@@ -1,8 +1,10 @@
 package errs
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"unsafe"
 
@@ -75,6 +77,17 @@ func Convert(err error) error {
 	} else if e, ok := err.(*Error); ok {
 		return e
 	}
+	var e *Error
+	if errors.As(err, &e) {
+		// err wraps an *Error; keep its code and details.
+		return &Error{
+			Code:       e.Code,
+			Details:    e.Details,
+			Meta:       e.Meta,
+			underlying: err,
+			stack:      e.stack,
+		}
+	}
 	return &Error{
 		Code:       Unknown,
 		underlying: err,
@@ -82,24 +95,31 @@ func Convert(err error) error {
 	}
 }
 
+// Code reports the error code of err, which may wrap an *Error
+// as with fmt.Errorf("...: %w", err). If err is nil it reports OK,
+// and if it does not wrap an *Error it reports Unknown.
 func Code(err error) ErrCode {
 	if err == nil {
 		return OK
-	} else if e, ok := err.(*Error); ok {
+	}
+	var e *Error
+	if errors.As(err, &e) {
 		return e.Code
 	}
 	return Unknown
 }
 
 func Details(err error) ErrDetails {
-	if e, ok := err.(*Error); ok {
+	var e *Error
+	if errors.As(err, &e) {
 		return e.Details
 	}
 	return nil
 }
 
 func Meta(err error) Metadata {
-	if e, ok := err.(*Error); ok {
+	var e *Error
+	if errors.As(err, &e) {
 		return e.Meta
 	}
 	return nil
@@ -153,56 +173,29 @@ func HTTPError(w http.ResponseWriter, err error) {
 	}
 
 	e := Convert(err).(*Error)
-	data, err2 := json.MarshalIndent(e, "", "  ")
+	if ri, ok := e.Details.(*RetryInfo); ok && ri.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(ri.seconds()))
+	}
+	var data []byte
+	var err2 error
+	if d := debugResponse(e); d != nil {
+		data, err2 = json.MarshalIndent(d, "", "  ")
+	} else {
+		data, err2 = json.MarshalIndent(e, "", "  ")
+	}
 	if err2 != nil {
 		// Must be the details; drop them
 		e2 := &Error{Code: e.Code, Message: e.Message}
 		data, _ = json.MarshalIndent(e2, "", "  ")
 	}
 	w.WriteHeader(e.Code.HTTPStatus())
-	w.Write(data)
+	w.Write(append(data, '\n'))
 }
 
+// HTTPStatus reports a suitable HTTP status code for an error, based on its code.
+// If err is nil it reports 200. If it does not wrap an *Error it reports 500.
 func HTTPStatus(err error) int {
-	code := Code(err)
-	switch code {
-	case OK:
-		return 200
-	case Canceled:
-		return 499
-	case Unknown:
-		return 500
-	case InvalidArgument:
-		return 400
-	case DeadlineExceeded:
-		return 504
-	case NotFound:
-		return 404
-	case AlreadyExists:
-		return 409
-	case PermissionDenied:
-		return 403
-	case ResourceExhausted:
-		return 429
-	case FailedPrecondition:
-		return 400
-	case Aborted:
-		return 409
-	case OutOfRange:
-		return 400
-	case Unimplemented:
-		return 501
-	case Internal:
-		return 500
-	case Unavailable:
-		return 503
-	case DataLoss:
-		return 500
-	case Unauthenticated:
-		return 401
-	default:
-		return 500
-	}
+	return Code(err).HTTPStatus()
 }
 
 func mergeMeta(md Metadata, pairs []interface{}) Metadata {
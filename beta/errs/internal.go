@@ -3,11 +3,57 @@ package errs
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"log"
+	"sync/atomic"
 
 	"runtime.encore.dev/internal/stack"
 )
 
+// debugResponses is 1 if HTTPError includes debug information.
+var debugResponses int32
+
+// SetDebugResponses controls whether HTTPError includes the error
+// chain and stack trace of server errors (5xx) in responses.
+// It is set by the runtime based on the environment,
+// and must never be enabled in production.
+func SetDebugResponses(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&debugResponses, v)
+}
+
+// debugInfo is the debug information included in
+// error responses if enabled by SetDebugResponses.
+type debugInfo struct {
+	Chain []string `json:"chain"` // messages of the wrapped errors, outermost first
+	Stack []string `json:"stack"`
+}
+
+// debugResponse returns the debug response for e, or nil
+// if debug responses are disabled or e is not a server error.
+func debugResponse(e *Error) interface{} {
+	if atomic.LoadInt32(&debugResponses) == 0 || e.Code.HTTPStatus() < 500 {
+		return nil
+	}
+	info := &debugInfo{Stack: stack.Frames(e.stack)}
+	for err := error(e); err != nil; err = errors.Unwrap(err) {
+		if ee, ok := err.(*Error); ok {
+			info.Chain = append(info.Chain, ee.Code.String()+": "+ee.Message)
+		} else {
+			info.Chain = append(info.Chain, err.Error())
+		}
+	}
+	return struct {
+		Code    ErrCode    `json:"code"`
+		Message string     `json:"message"`
+		Details ErrDetails `json:"details"`
+		Debug   *debugInfo `json:"debug"`
+	}{e.Code, e.ErrorMessage(), e.Details, info}
+}
+
 func Stack(err error) stack.Stack {
 	if e, ok := err.(*Error); ok {
 		return e.stack
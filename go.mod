@@ -5,13 +5,16 @@ go 1.16
 require (
 	github.com/felixge/httpsnoop v1.0.1
 	github.com/golang/protobuf v1.4.3
-	github.com/jackc/pgx/v4 v4.10.1
+	github.com/jackc/pgx/v4 v4.11.0
 	github.com/json-iterator/go v1.1.10
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/prometheus/client_golang v1.9.0
 	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.18.0
 	github.com/rs/zerolog v1.20.0
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
+	golang.org/x/sys v0.0.0-20201214210602-f9fddec55a1e
 	google.golang.org/grpc v1.36.0
 	google.golang.org/protobuf v1.25.0
 )
@@ -0,0 +1,49 @@
+// Package health lets applications report the health
+// of their dependencies.
+//
+// The runtime serves the results at /__encore/healthz for liveness
+// checks and /__encore/readyz for readiness checks, alongside the
+// checks of its own subsystems such as database pools. A request
+// to either responds with 503 Service Unavailable if any check fails.
+package health
+
+import (
+	"runtime.encore.dev/internal/health"
+)
+
+// Check reports the health of a dependency.
+// It returns a non-nil error if the dependency is unhealthy.
+// It should respect the deadline of the context.
+type Check = health.Check
+
+// Register registers a readiness check, which reports whether
+// the application can serve requests, such as whether a
+// downstream dependency is reachable.
+// It replaces any previous check with the same name.
+func Register(name string, check Check) {
+	health.Register(name, health.Readiness, check)
+}
+
+// RegisterLiveness registers a liveness check, which reports
+// whether the process is working at all and should otherwise
+// be restarted, such as detecting a deadlock.
+// It replaces any previous check with the same name.
+func RegisterLiveness(name string, check Check) {
+	health.Register(name, health.Liveness, check)
+}
+
+// Unregister removes the check with the given name.
+func Unregister(name string) {
+	health.Unregister(name)
+}
+
+// Init initializes a dependency at startup.
+type Init = health.Init
+
+// RegisterStartup registers a task that must complete before the
+// application reports ready, such as fetching configuration.
+// Failing tasks are retried until the startup timeout.
+// It must be called during package initialization.
+func RegisterStartup(name string, init Init) {
+	health.RegisterStartup(name, init)
+}
@@ -0,0 +1,102 @@
+// Package bodylimit limits the size of request bodies, replacing
+// the error responses of handlers that fail reading a body that
+// exceeds its limit.
+package bodylimit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrTooLarge is returned when reading a body past its limit.
+var ErrTooLarge = errors.New("bodylimit: request body too large")
+
+// Body is a request body limited to a number of bytes.
+// Reading it past the limit fails with ErrTooLarge.
+type Body struct {
+	rc        io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+// NewBody returns rc limited to limit bytes.
+func NewBody(rc io.ReadCloser, limit int64) *Body {
+	return &Body{rc: rc, remaining: limit}
+}
+
+func (b *Body) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrTooLarge
+	}
+	// Read at most one byte past the limit, to detect exceeding it.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.rc.Read(p)
+	if b.remaining -= int64(n); b.remaining < 0 {
+		b.exceeded = true
+		return 0, ErrTooLarge
+	}
+	return n, err
+}
+
+func (b *Body) Close() error {
+	return b.rc.Close()
+}
+
+// Exceeded reports whether reading the body exceeded its limit.
+func (b *Body) Exceeded() bool {
+	return b.exceeded
+}
+
+// Writer replaces an error response to a request whose Body exceeded
+// its limit with the response written by TooLarge, so that clients
+// get the same response regardless of how the handler reports the
+// failed read.
+type Writer struct {
+	http.ResponseWriter
+	Body     *Body
+	TooLarge func(w http.ResponseWriter)
+
+	wroteHeader bool
+	replaced    bool
+}
+
+func (w *Writer) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if code >= 400 && w.Body.Exceeded() {
+			w.replaced = true
+			w.TooLarge(w.ResponseWriter)
+			return
+		}
+	}
+	if !w.replaced {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends any buffered data to the client,
+// unless the response has been replaced.
+func (w *Writer) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,81 @@
+package bodylimit
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newServer(limit int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body := NewBody(req.Body, limit)
+		lw := &Writer{ResponseWriter: w, Body: body, TooLarge: func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			io.WriteString(w, "too large")
+		}}
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			http.Error(lw, "could not read request body", http.StatusBadRequest)
+			return
+		}
+		lw.Write(data)
+	}))
+}
+
+// post posts body without a Content-Length, so it is sent chunked.
+func post(t *testing.T, srv *httptest.Server, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest("POST", srv.URL, ioutil.NopCloser(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestChunkedOverLimit(t *testing.T) {
+	srv := newServer(10)
+	defer srv.Close()
+	status, body := post(t, srv, strings.Repeat("x", 11))
+	if status != http.StatusRequestEntityTooLarge || body != "too large" {
+		t.Errorf("got %d %q, want 413 %q", status, body, "too large")
+	}
+}
+
+func TestChunkedWithinLimit(t *testing.T) {
+	srv := newServer(10)
+	defer srv.Close()
+	status, body := post(t, srv, strings.Repeat("x", 10))
+	if status != http.StatusOK || body != strings.Repeat("x", 10) {
+		t.Errorf("got %d %q, want 200 with the body echoed", status, body)
+	}
+}
+
+func TestBodyRead(t *testing.T) {
+	b := NewBody(ioutil.NopCloser(strings.NewReader("hello world")), 5)
+	buf := make([]byte, 3)
+	n, err := b.Read(buf)
+	if n != 3 || err != nil || b.Exceeded() {
+		t.Fatalf("first Read = %d, %v", n, err)
+	}
+	if _, err := ioutil.ReadAll(b); err != ErrTooLarge || !b.Exceeded() {
+		t.Errorf("ReadAll: got err %v, want ErrTooLarge", err)
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &Writer{ResponseWriter: rec, Body: NewBody(ioutil.NopCloser(strings.NewReader("")), 10)}
+	w.Flush()
+	if !rec.Flushed || rec.Code != http.StatusOK {
+		t.Errorf("got flushed %v, code %d; want flushed with 200", rec.Flushed, rec.Code)
+	}
+}
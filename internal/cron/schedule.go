@@ -0,0 +1,196 @@
+// Package cron parses cron schedules and stores the state of cron
+// jobs shared between instances.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron schedule.
+type Schedule struct {
+	// every is the interval of "@every" schedules, or zero.
+	every time.Duration
+
+	// Bit sets of the matching values of each field.
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar report whether the day of month
+	// and day of week fields are unrestricted.
+	domStar, dowStar bool
+}
+
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a schedule in the standard five-field cron format
+// "minute hour day-of-month month day-of-week", where each field is
+// "*", a value, a range "a-b", or a comma-separated list of these,
+// optionally followed by a step "/n". Months and days of the week
+// may be given by their three-letter names, and Sunday is 0 or 7.
+// As in standard cron, if both day fields are restricted a time
+// matches if either does. The macros "@hourly", "@daily" and so on,
+// and "@every <duration>" are also supported.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(expr[len("@every "):]))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("cron: invalid interval in %q", expr)
+		}
+		return &Schedule{every: d}, nil
+	}
+	if m, ok := macros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: invalid schedule %q: want 5 fields, got %d", expr, len(fields))
+	}
+	s := &Schedule{
+		domStar: fields[2] == "*" || strings.HasPrefix(fields[2], "*/"),
+		dowStar: fields[4] == "*" || strings.HasPrefix(fields[4], "*/"),
+	}
+	var err error
+	for i, p := range []struct {
+		bits *uint64
+		f    field
+	}{
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		if *p.bits, err = p.f.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("cron: invalid schedule %q: %v", expr, err)
+		}
+	}
+	// Sunday is both 0 and 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parse parses a field into a bit set of its matching values.
+func (f field) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			var err error
+			if i := strings.IndexByte(rng, '-'); i >= 0 {
+				if lo, err = f.value(rng[:i]); err == nil {
+					hi, err = f.value(rng[i+1:])
+				}
+			} else if lo, err = f.value(rng); err == nil {
+				hi = lo
+				if step > 1 {
+					hi = f.max // "a/n" means "a-max/n"
+				}
+			}
+			if err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single value of the field.
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// Next returns the first time matching the schedule after t,
+// in t's location, or the zero time if there is none within
+// five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Truncate(time.Second).Add(s.every)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the schedule.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
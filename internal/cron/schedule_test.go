@@ -0,0 +1,71 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	base := time.Date(2021, 3, 15, 10, 30, 20, 0, time.UTC) // a Monday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2021, 3, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2021, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2021, 3, 15, 13, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2021, 3, 16, 10, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * fri", time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, 3, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"5,10 12 * Jan-Mar *", time.Date(2021, 3, 15, 12, 5, 0, 0, time.UTC)},
+		// Both day fields restricted: either matches.
+		{"0 0 20 * mon", time.Date(2021, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2021, 3, 15, 10, 31, 50, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		s, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.expr, err)
+			continue
+		}
+		if got := s.Next(base); !got.Equal(test.want) {
+			t.Errorf("%q: Next = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestNextNone(t *testing.T) {
+	s, err := Parse("0 0 31 feb *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next = %v, want zero", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"x * * * *",
+		"@every 1ms",
+		"@every soon",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): got no error", expr)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package cron
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"runtime.encore.dev/internal/redis"
+)
+
+// Store stores the state of cron jobs, so that instances
+// sharing a store run each scheduled run of a job once.
+type Store interface {
+	// Claim claims key until ttl elapses, reporting whether
+	// it was claimed rather than already being claimed.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+
+	// Release releases the claim on key.
+	Release(ctx context.Context, key string) error
+
+	// LastRun returns the scheduled time of the last run of
+	// the job, or the zero time if it has not run.
+	LastRun(ctx context.Context, job string) (time.Time, error)
+
+	// SetLastRun records the scheduled time of the last run of the job.
+	SetLastRun(ctx context.Context, job string, t time.Time) error
+}
+
+// sweepInterval is how often MemoryStore removes expired claims.
+const sweepInterval = time.Minute
+
+// MemoryStore is an in-memory Store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	claims    map[string]time.Time // expiry by key
+	lastRun   map[string]time.Time
+	lastSweep time.Time
+
+	now func() time.Time // for testing
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		claims:  make(map[string]time.Time),
+		lastRun: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.lastSweep = now
+		for k, exp := range s.claims {
+			if !now.Before(exp) {
+				delete(s.claims, k)
+			}
+		}
+	}
+	if exp, ok := s.claims[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.claims[key] = now.Add(ttl)
+	return true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claims, key)
+	return nil
+}
+
+func (s *MemoryStore) LastRun(ctx context.Context, job string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastRun[job], nil
+}
+
+func (s *MemoryStore) SetLastRun(ctx context.Context, job string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun[job] = t
+	return nil
+}
+
+// RedisStore is a Store backed by Redis, for sharing
+// the state of cron jobs between multiple instances.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, keyPrefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: keyPrefix}
+}
+
+func (s *RedisStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	_, err := s.client.Do(ctx, "SET", s.prefix+"claim:"+key, "1", "NX", "PX", ttl.Milliseconds())
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	_, err := s.client.Do(ctx, "DEL", s.prefix+"claim:"+key)
+	return err
+}
+
+func (s *RedisStore) LastRun(ctx context.Context, job string) (time.Time, error) {
+	ms, err := redis.Int64(s.client.Do(ctx, "GET", s.prefix+"last:"+job))
+	if err == redis.Nil {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
+
+// setLastRunScript sets the last run to ARGV[1] unless it is later.
+const setLastRunScript = `
+local cur = tonumber(redis.call("GET", KEYS[1]))
+if not cur or cur < tonumber(ARGV[1]) then
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 1
+`
+
+func (s *RedisStore) SetLastRun(ctx context.Context, job string, t time.Time) error {
+	ms := strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	_, err := s.client.Do(ctx, "EVAL", setLastRunScript, 1, s.prefix+"last:"+job, ms)
+	return err
+}
@@ -0,0 +1,36 @@
+package cron
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	claim := func(key string, want bool) {
+		t.Helper()
+		if ok, err := s.Claim(ctx, key, time.Minute); err != nil || ok != want {
+			t.Fatalf("Claim(%q) = %v, %v, want %v", key, ok, err, want)
+		}
+	}
+	claim("a", true)
+	claim("a", false)
+	claim("b", true)
+	s.Release(ctx, "a")
+	claim("a", true)
+	now = now.Add(time.Minute)
+	claim("b", true) // expired
+
+	if last, _ := s.LastRun(ctx, "job"); !last.IsZero() {
+		t.Fatalf("got last run %v, want zero", last)
+	}
+	s.SetLastRun(ctx, "job", now)
+	if last, _ := s.LastRun(ctx, "job"); !last.Equal(now) {
+		t.Fatalf("got last run %v, want %v", last, now)
+	}
+}
@@ -0,0 +1,205 @@
+// Package errreport reports errors and panics to an
+// error tracking service, such as Sentry, or a webhook.
+package errreport
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"sync"
+	"time"
+
+	"runtime.encore.dev/internal/ratelimit"
+	"runtime.encore.dev/internal/redact"
+)
+
+// Event is an error or panic to report.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Panic   bool      `json:"panic"`
+	Message string    `json:"message"`
+	Code    string    `json:"code,omitempty"` // error code, if any
+	Stack   []Frame   `json:"stack,omitempty"`
+
+	Service   string            `json:"service,omitempty"`
+	Endpoint  string            `json:"endpoint,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	TraceID   string            `json:"trace_id,omitempty"`
+	UserID    string            `json:"user_id,omitempty"`
+	Method    string            `json:"method,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+}
+
+// Frame is a stack frame.
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Frames returns the frames of the program counters pcs,
+// as returned by runtime.Callers.
+func Frames(pcs []uintptr) []Frame {
+	if len(pcs) == 0 {
+		return nil
+	}
+	var out []Frame
+	cf := runtime.CallersFrames(pcs)
+	for {
+		f, more := cf.Next()
+		out = append(out, Frame{Function: f.Function, File: f.File, Line: f.Line})
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// Sender sends events to an error tracking service.
+type Sender interface {
+	Send(ctx context.Context, ev *Event) error
+}
+
+// Default reporting parameters.
+const (
+	defaultRate  = 1 // events per second
+	defaultBurst = 10
+	queueSize    = 100
+	sendTimeout  = 10 * time.Second
+)
+
+type Config struct {
+	// Sender sends the events.
+	Sender Sender
+
+	// Rate and Burst limit the number of events reported,
+	// as a token bucket. If zero they default to 1 event per
+	// second with bursts of 10.
+	Rate  float64
+	Burst int
+
+	// Scrub, if set, redacts personal and sensitive
+	// information from events before they are sent.
+	Scrub *redact.Rules
+
+	// OnError is called when sending fails. It may be nil.
+	OnError func(err error)
+}
+
+// Reporter reports events in the background, dropping events
+// when rate limited or when the queue is full.
+// It is safe for concurrent use.
+type Reporter struct {
+	cfg     Config
+	limiter *ratelimit.MemoryStore
+	limit   ratelimit.Limit
+	queue   chan *Event
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// New creates a reporter and starts its send loop.
+func New(cfg Config) *Reporter {
+	limit := ratelimit.Limit{Rate: cfg.Rate, Burst: cfg.Burst}
+	if limit.Rate <= 0 {
+		limit.Rate = defaultRate
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = defaultBurst
+	}
+	r := &Reporter{
+		cfg:     cfg,
+		limiter: ratelimit.NewMemoryStore(),
+		limit:   limit,
+		queue:   make(chan *Event, queueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// Report queues ev to be sent. It reports whether ev was queued.
+func (r *Reporter) Report(ev *Event) bool {
+	if r == nil {
+		return false
+	}
+	select {
+	case <-r.stop:
+		return false
+	default:
+	}
+	if res, _ := r.limiter.Take(context.Background(), "", r.limit); !res.Allowed {
+		return false
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	select {
+	case r.queue <- ev:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *Reporter) loop() {
+	defer close(r.done)
+	for {
+		select {
+		case ev := <-r.queue:
+			r.send(ev)
+		case <-r.stop:
+			for {
+				select {
+				case ev := <-r.queue:
+					r.send(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Reporter) send(ev *Event) {
+	if r.cfg.Scrub != nil {
+		ev = scrub(r.cfg.Scrub, ev)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	if err := r.cfg.Sender.Send(ctx, ev); err != nil && r.cfg.OnError != nil {
+		r.cfg.OnError(err)
+	}
+}
+
+// scrub returns a copy of ev redacted by rules.
+func scrub(rules *redact.Rules, ev *Event) *Event {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return ev
+	}
+	var out Event
+	if err := json.Unmarshal(rules.JSON(data), &out); err != nil {
+		return ev
+	}
+	return &out
+}
+
+// Shutdown sends any queued events and stops the reporter.
+func (r *Reporter) Shutdown(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.stopOnce.Do(func() { close(r.stop) })
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,116 @@
+package errreport
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"runtime.encore.dev/internal/redact"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func (r *recorder) Send(ctx context.Context, ev *Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func TestReporterRateLimit(t *testing.T) {
+	rec := &recorder{}
+	r := New(Config{Sender: rec, Rate: 0.001, Burst: 2})
+	for i := 0; i < 5; i++ {
+		r.Report(&Event{Message: "boom"})
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.events) != 2 {
+		t.Errorf("got %d events, want 2", len(rec.events))
+	}
+	if r.Report(&Event{Message: "late"}) {
+		t.Errorf("Report after Shutdown: got true")
+	}
+}
+
+func TestReporterScrub(t *testing.T) {
+	rec := &recorder{}
+	r := New(Config{Sender: rec, Scrub: &redact.Rules{Fields: redact.NewFields("cookie"), CardNumbers: true}})
+	r.Report(&Event{
+		Message: "charge 4242 4242 4242 4242 failed",
+		Headers: map[string]string{"Authorization": "Bearer x", "Cookie": "s=1", "Accept": "*/*"},
+	})
+	r.Shutdown(context.Background())
+
+	ev := rec.events[0]
+	if want := "charge [REDACTED] failed"; ev.Message != want {
+		t.Errorf("Message = %q, want %q", ev.Message, want)
+	}
+	want := map[string]string{"Authorization": "[REDACTED]", "Cookie": "[REDACTED]", "Accept": "*/*"}
+	for k, v := range want {
+		if ev.Headers[k] != v {
+			t.Errorf("Headers[%q] = %q, want %q", k, ev.Headers[k], v)
+		}
+	}
+}
+
+func TestSentry(t *testing.T) {
+	var (
+		gotPath, gotAuth string
+		got              map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotPath, gotAuth = req.URL.Path, req.Header.Get("X-Sentry-Auth")
+		body, _ := ioutil.ReadAll(req.Body)
+		json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	s, err := NewSentry("http://pubkey@" + srv.Listener.Addr().String() + "/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Send(context.Background(), &Event{
+		Time:     time.Unix(0, 0),
+		Message:  "oops",
+		Code:     "internal",
+		Service:  "svc",
+		Endpoint: "Foo",
+		Stack:    []Frame{{Function: "inner"}, {Function: "outer"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/api/42/store/" {
+		t.Errorf("path = %q, want /api/42/store/", gotPath)
+	}
+	if want := "sentry_key=pubkey"; !strings.Contains(gotAuth, want) {
+		t.Errorf("X-Sentry-Auth = %q, want it to contain %q", gotAuth, want)
+	}
+	if got["transaction"] != "svc.Foo" || got["level"] != "error" {
+		t.Errorf("transaction, level = %v, %v", got["transaction"], got["level"])
+	}
+	exc := got["exception"].(map[string]interface{})["values"].([]interface{})[0].(map[string]interface{})
+	frames := exc["stacktrace"].(map[string]interface{})["frames"].([]interface{})
+	if fn := frames[0].(map[string]interface{})["function"]; fn != "outer" {
+		t.Errorf("first frame = %v, want outer", fn)
+	}
+}
+
+func TestNewSentryInvalid(t *testing.T) {
+	for _, dsn := range []string{"https://sentry.io/1", "https://key@sentry.io/", "://"} {
+		if _, err := NewSentry(dsn); err == nil {
+			t.Errorf("NewSentry(%q): got nil error", dsn)
+		}
+	}
+}
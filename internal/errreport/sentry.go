@@ -0,0 +1,152 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Sentry sends events to Sentry using its store API.
+type Sentry struct {
+	storeURL string
+	key      string
+
+	// Environment and Release are reported with each event, if set.
+	Environment string
+	Release     string
+
+	// Client is the HTTP client to use. If nil http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewSentry returns a Sentry sender for the given DSN,
+// of the form "https://<key>@<host>/<project>".
+func NewSentry(dsn string) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sentry: invalid dsn: %v", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("sentry: invalid dsn: missing key")
+	}
+	idx := strings.LastIndexByte(u.Path, '/')
+	project := u.Path[idx+1:]
+	if project == "" {
+		return nil, fmt.Errorf("sentry: invalid dsn: missing project id")
+	}
+	store := &url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   u.Path[:idx] + "/api/" + project + "/store/",
+	}
+	return &Sentry{storeURL: store.String(), key: u.User.Username()}, nil
+}
+
+func (s *Sentry) Send(ctx context.Context, ev *Event) error {
+	body, err := json.Marshal(s.event(ev))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=encore-runtime/1.0, sentry_key="+s.key)
+	return post(s.Client, req, "sentry")
+}
+
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	Environment string                 `json:"environment,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	Transaction string                 `json:"transaction,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]string      `json:"extra,omitempty"`
+	User        *sentryUser            `json:"user,omitempty"`
+	Request     *sentryRequest         `json:"request,omitempty"`
+	Exception   map[string]interface{} `json:"exception"`
+}
+
+type sentryUser struct {
+	ID string `json:"id"`
+}
+
+type sentryRequest struct {
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+}
+
+func (s *Sentry) event(ev *Event) *sentryEvent {
+	level, typ := "error", "error"
+	if ev.Panic {
+		level, typ = "fatal", "panic"
+	} else if ev.Code != "" {
+		typ = ev.Code
+	}
+
+	// Sentry expects frames ordered from the outermost call.
+	frames := make([]sentryFrame, len(ev.Stack))
+	for i, f := range ev.Stack {
+		frames[len(frames)-1-i] = sentryFrame{Function: f.Function, Filename: f.File, Lineno: f.Line}
+	}
+	exc := map[string]interface{}{"type": typ, "value": ev.Message}
+	if len(frames) > 0 {
+		exc["stacktrace"] = map[string]interface{}{"frames": frames}
+	}
+
+	se := &sentryEvent{
+		EventID:     newEventID(),
+		Timestamp:   ev.Time.UTC().Format("2006-01-02T15:04:05.000Z"),
+		Level:       level,
+		Platform:    "go",
+		Environment: s.Environment,
+		Release:     s.Release,
+		Tags:        map[string]string{},
+		Extra:       ev.Meta,
+		Exception:   map[string]interface{}{"values": []interface{}{exc}},
+	}
+	if ev.Service != "" {
+		se.Transaction = ev.Service + "." + ev.Endpoint
+		se.Tags["service"] = ev.Service
+		se.Tags["endpoint"] = ev.Endpoint
+	}
+	if ev.Code != "" {
+		se.Tags["code"] = ev.Code
+	}
+	if ev.RequestID != "" {
+		se.Tags["request_id"] = ev.RequestID
+	}
+	if ev.TraceID != "" {
+		se.Tags["trace_id"] = ev.TraceID
+	}
+	if ev.UserID != "" {
+		se.User = &sentryUser{ID: ev.UserID}
+	}
+	if ev.Method != "" || ev.URL != "" {
+		se.Request = &sentryRequest{Method: ev.Method, URL: ev.URL, Headers: ev.Headers}
+	}
+	return se
+}
+
+func newEventID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
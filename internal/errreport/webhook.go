@@ -0,0 +1,54 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Webhook sends events as JSON to a URL.
+type Webhook struct {
+	URL string
+
+	// Headers are additional headers to send, such as for authentication.
+	Headers map[string]string
+
+	// Client is the HTTP client to use. If nil http.DefaultClient is used.
+	Client *http.Client
+}
+
+func (h *Webhook) Send(ctx context.Context, ev *Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	return post(h.Client, req, "webhook")
+}
+
+func post(client *http.Client, req *http.Request, what string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %v", what, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: got status %s", what, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Package fieldmask prunes JSON documents to a set of field paths.
+package fieldmask
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Mask is a set of field paths. Each key is a field name, mapping to
+// the mask of its sub-fields, or to nil to select the whole field.
+type Mask map[string]Mask
+
+// Parse parses a comma-separated list of dot-separated
+// field paths, such as "id,author.name".
+// Selecting a field selects all of its sub-fields.
+func Parse(s string) (Mask, error) {
+	m := make(Mask)
+	for _, path := range strings.Split(s, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		names := strings.Split(path, ".")
+		for _, name := range names {
+			if name == "" {
+				return nil, fmt.Errorf("fieldmask: invalid path %q", path)
+			}
+		}
+		m.add(names)
+	}
+	if len(m) == 0 {
+		return nil, fmt.Errorf("fieldmask: no fields")
+	}
+	return m, nil
+}
+
+func (m Mask) add(names []string) {
+	sub, ok := m[names[0]]
+	switch {
+	case ok && sub == nil:
+		// The whole field is already selected.
+	case len(names) == 1:
+		m[names[0]] = nil
+	default:
+		if sub == nil {
+			sub = make(Mask)
+			m[names[0]] = sub
+		}
+		sub.add(names[1:])
+	}
+}
+
+// Prune returns the JSON document data with only the fields selected
+// by m. The mask applies to each element of arrays, and to the
+// fields of objects; other values are returned as is.
+// Fields keep their order.
+func Prune(data []byte, m Mask) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := prune(&buf, data, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func prune(buf *bytes.Buffer, data []byte, m Mask) error {
+	data = bytes.TrimSpace(data)
+	if m == nil || len(data) == 0 || (data[0] != '{' && data[0] != '[') {
+		buf.Write(data)
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if data[0] == '[' {
+		buf.WriteByte('[')
+		for i := 0; dec.More(); i++ {
+			var elem json.RawMessage
+			if err := dec.Decode(&elem); err != nil {
+				return err
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := prune(buf, elem, m); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	buf.WriteByte('{')
+	n := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		sub, ok := m[key]
+		if !ok {
+			continue
+		}
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		n++
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		if err := prune(buf, val, sub); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
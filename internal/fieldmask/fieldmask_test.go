@@ -0,0 +1,73 @@
+package fieldmask
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Mask
+		err  bool
+	}{
+		{in: "id", want: Mask{"id": nil}},
+		{in: "id, author.name,author.id", want: Mask{"id": nil, "author": Mask{"name": nil, "id": nil}}},
+		{in: "author.name,author", want: Mask{"author": nil}},
+		{in: "author,author.name", want: Mask{"author": nil}},
+		{in: "a.b.c", want: Mask{"a": Mask{"b": Mask{"c": nil}}}},
+		{in: "", err: true},
+		{in: " , ", err: true},
+		{in: "a..b", err: true},
+		{in: "a.", err: true},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.in)
+		if (err != nil) != test.err {
+			t.Errorf("Parse(%q): got err %v, want err %v", test.in, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		mask string
+		in   string
+		want string
+	}{
+		{"id", `{"name":"x","id":1}`, `{"id":1}`},
+		{"b,a", `{"a":1, "b":2, "c":3}`, `{"a":1,"b":2}`},
+		{"author.name", `{"id":1,"author":{"id":2,"name":"n"}}`, `{"author":{"name":"n"}}`},
+		{"author", `{"id":1,"author":{"id":2, "name":"n"}}`, `{"author":{"id":2, "name":"n"}}`},
+		{"items.id", `{"items":[{"id":1,"x":2},{"id":3}],"next":"c"}`, `{"items":[{"id":1},{"id":3}]}`},
+		{"id", `[{"id":1,"x":2},{"x":3}]`, `[{"id":1},{}]`},
+		{"a.b", `{"a":null}`, `{"a":null}`},
+		{"a.b", `{"a":"s"}`, `{"a":"s"}`},
+		{"missing", `{"a":1}`, `{}`},
+		{"id", `"scalar"`, `"scalar"`},
+	}
+	for _, test := range tests {
+		m, err := Parse(test.mask)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Prune([]byte(test.in), m)
+		if err != nil {
+			t.Errorf("Prune(%s, %q): %v", test.in, test.mask, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("Prune(%s, %q) = %s, want %s", test.in, test.mask, got, test.want)
+		}
+	}
+}
+
+func TestPruneInvalid(t *testing.T) {
+	if _, err := Prune([]byte(`{"a":`), Mask{"a": nil}); err == nil {
+		t.Error("got nil error for invalid JSON")
+	}
+}
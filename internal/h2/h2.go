@@ -0,0 +1,27 @@
+// Package h2 enables HTTP/2 on HTTP servers.
+package h2
+
+import (
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Configure enables HTTP/2 on srv: negotiated over TLS if tls is set,
+// and over cleartext connections if h2c is set.
+// Without TLS it leaves srv.TLSConfig nil, as configuring HTTP/2 over
+// TLS would set an empty TLS config the server cannot serve with.
+// It must be called after srv.TLSConfig and srv.Handler are set.
+func Configure(srv *http.Server, h2s *http2.Server, tls, cleartext bool) error {
+	if tls {
+		if err := http2.ConfigureServer(srv, h2s); err != nil {
+			return fmt.Errorf("configure http2: %v", err)
+		}
+	}
+	if cleartext {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package h2
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func TestCleartext(t *testing.T) {
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.Proto)
+	})}
+	if err := Configure(srv, &http2.Server{}, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if srv.TLSConfig != nil {
+		t.Fatal("TLSConfig set without TLS")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+	url := "http://" + ln.Addr().String()
+
+	h1 := &http.Client{Transport: &http.Transport{}}
+	if got := get(t, h1, url); got != "HTTP/1.1" {
+		t.Errorf("HTTP/1.1 request: got proto %q", got)
+	}
+
+	h2c := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	if got := get(t, h2c, url); got != "HTTP/2.0" {
+		t.Errorf("h2c request: got proto %q", got)
+	}
+}
+
+func get(t *testing.T, c *http.Client, url string) string {
+	t.Helper()
+	resp, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,91 @@
+// Package health keeps track of health checks reported
+// by the runtime's subsystems and the application.
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Check reports the health of a dependency.
+// It returns a non-nil error if the dependency is unhealthy.
+type Check func(ctx context.Context) error
+
+// Kind is the kind of a health check.
+type Kind int
+
+const (
+	// Liveness checks report whether the process is working at all;
+	// failing liveness checks typically cause it to be restarted.
+	Liveness Kind = iota
+
+	// Readiness checks report whether the process is ready to serve
+	// requests; failing readiness checks stop traffic from being routed to it.
+	Readiness
+)
+
+type check struct {
+	name  string
+	kind  Kind
+	check Check
+}
+
+var (
+	mu     sync.RWMutex
+	checks = make(map[string]check)
+)
+
+// Register registers a health check, replacing
+// any previous check with the same name.
+func Register(name string, kind Kind, c Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check{name: name, kind: kind, check: c}
+}
+
+// Unregister removes the health check with the given name.
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(checks, name)
+}
+
+// Result is the result of running a health check.
+type Result struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Run runs the health checks of the given kind concurrently and
+// reports their results sorted by name. The checks are expected
+// to respect ctx's deadline.
+func Run(ctx context.Context, kind Kind) []Result {
+	mu.RLock()
+	var cs []check
+	for _, c := range checks {
+		if c.kind == kind {
+			cs = append(cs, c)
+		}
+	}
+	mu.RUnlock()
+
+	results := make([]Result, len(cs))
+	var wg sync.WaitGroup
+	for i, c := range cs {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = Result{Name: c.name, OK: true}
+			if err := c.check(ctx); err != nil {
+				results[i].OK = false
+				results[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
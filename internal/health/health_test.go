@@ -0,0 +1,84 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	defer func() { checks = make(map[string]check) }()
+
+	ok := func(context.Context) error { return nil }
+	Register("db", Readiness, ok)
+	Register("cache", Readiness, func(context.Context) error { return errors.New("connection refused") })
+	Register("deadlock", Liveness, ok)
+	Register("old", Readiness, ok)
+	Unregister("old")
+
+	got := Run(context.Background(), Readiness)
+	want := []Result{
+		{Name: "cache", OK: false, Error: "connection refused"},
+		{Name: "db", OK: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readiness: got %+v, want %+v", got, want)
+	}
+
+	got = Run(context.Background(), Liveness)
+	want = []Result{{Name: "deadlock", OK: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("liveness: got %+v, want %+v", got, want)
+	}
+}
+
+func TestRunStartup(t *testing.T) {
+	defer func() {
+		startup = make(map[string]Init)
+		pending = make(map[string]bool)
+	}()
+
+	attempts := 0
+	RegisterStartup("flaky", func(context.Context) error {
+		if attempts++; attempts < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	RegisterStartup("ok", func(context.Context) error { return nil })
+	if got, want := Pending(), []string{"flaky", "ok"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Pending() = %v, want %v", got, want)
+	}
+
+	var errs []string
+	if err := RunStartup(context.Background(), func(name string, err error) {
+		errs = append(errs, name+": "+err.Error())
+	}); err != nil {
+		t.Fatalf("RunStartup: %v", err)
+	}
+	if got := Pending(); len(got) != 0 {
+		t.Errorf("Pending() = %v, want none", got)
+	}
+	if want := []string{"flaky: not yet", "flaky: not yet"}; !reflect.DeepEqual(errs, want) {
+		t.Errorf("got errors %v, want %v", errs, want)
+	}
+}
+
+func TestRunStartupTimeout(t *testing.T) {
+	defer func() {
+		startup = make(map[string]Init)
+		pending = make(map[string]bool)
+	}()
+
+	RegisterStartup("down", func(context.Context) error { return errors.New("connection refused") })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := RunStartup(ctx, nil); err != context.DeadlineExceeded {
+		t.Fatalf("RunStartup: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got, want := Pending(), []string{"down"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Init initializes a dependency at startup, such as by
+// establishing a database connection.
+type Init func(ctx context.Context) error
+
+var (
+	startupMu sync.Mutex
+	startup   = make(map[string]Init)
+	pending   = make(map[string]bool) // names of the tasks not yet completed
+)
+
+// RegisterStartup registers a task that must complete before the
+// process is ready. Tasks must be registered before RunStartup is
+// called, typically during package initialization.
+func RegisterStartup(name string, init Init) {
+	startupMu.Lock()
+	defer startupMu.Unlock()
+	startup[name] = init
+	pending[name] = true
+}
+
+// Pending reports the names of the startup tasks
+// that have not yet completed, sorted by name.
+func Pending() []string {
+	startupMu.Lock()
+	defer startupMu.Unlock()
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+const (
+	minRetryDelay = 100 * time.Millisecond
+	maxRetryDelay = 5 * time.Second
+)
+
+// RunStartup runs the startup tasks concurrently, retrying failing
+// tasks with backoff until they succeed or ctx is done. onErr, if
+// non-nil, is called for each failed attempt.
+//
+// It returns ctx.Err() if any task did not complete in time.
+func RunStartup(ctx context.Context, onErr func(name string, err error)) error {
+	startupMu.Lock()
+	tasks := make(map[string]Init, len(startup))
+	for name, init := range startup {
+		if pending[name] {
+			tasks[name] = init
+		}
+	}
+	startupMu.Unlock()
+
+	var wg sync.WaitGroup
+	for name, init := range tasks {
+		wg.Add(1)
+		go func(name string, init Init) {
+			defer wg.Done()
+			delay := minRetryDelay
+			for {
+				err := init(ctx)
+				if err == nil {
+					startupMu.Lock()
+					delete(pending, name)
+					startupMu.Unlock()
+					return
+				}
+				if onErr != nil {
+					onErr(name, err)
+				}
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return
+				}
+				if delay *= 2; delay > maxRetryDelay {
+					delay = maxRetryDelay
+				}
+			}
+		}(name, init)
+	}
+	wg.Wait()
+
+	if len(Pending()) > 0 {
+		return ctx.Err()
+	}
+	return nil
+}
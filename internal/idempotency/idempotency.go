@@ -0,0 +1,107 @@
+// Package idempotency records responses to requests made with
+// an idempotency key, so that retries can be answered by
+// replaying the first response.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrInProgress is returned by Store.Begin when a request
+// with the same key is still being processed.
+var ErrInProgress = errors.New("idempotency: request in progress")
+
+// Response is a recorded response.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Store stores idempotency keys and their responses.
+type Store interface {
+	// Begin reserves key for a request whose payload has the given
+	// fingerprint, until ttl elapses or the reservation is completed
+	// or released. If a response has been recorded for key it returns
+	// it along with the fingerprint of the request that produced it.
+	// If key is reserved by another request it returns ErrInProgress.
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (resp *Response, respFingerprint string, err error)
+
+	// Complete records the response for key, keeping it for ttl.
+	Complete(ctx context.Context, key, fingerprint string, resp *Response, ttl time.Duration) error
+
+	// Release removes the reservation of key without
+	// recording a response, allowing the request to be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// sweepInterval is how often the memory store removes expired entries.
+const sweepInterval = time.Minute
+
+// MemoryStore is an in-memory Store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+
+	now func() time.Time // for testing
+}
+
+type entry struct {
+	fingerprint string
+	resp        *Response // or nil if in progress
+	expires     time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*entry), now: time.Now}
+}
+
+func (s *MemoryStore) Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Response, string, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		if e.resp == nil {
+			return nil, "", ErrInProgress
+		}
+		return e.resp, e.fingerprint, nil
+	}
+	s.entries[key] = &entry{fingerprint: fingerprint, expires: now.Add(ttl)}
+	return nil, "", nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key, fingerprint string, resp *Response, ttl time.Duration) error {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &entry{fingerprint: fingerprint, resp: resp, expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep removes expired entries, at most once per sweepInterval.
+// s.mu must be held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	ttl := time.Minute
+
+	// The first request reserves the key.
+	if resp, _, err := s.Begin(ctx, "key", "fp1", ttl); resp != nil || err != nil {
+		t.Fatalf("got %v, %v, want reservation", resp, err)
+	}
+	// Concurrent retries are rejected.
+	if _, _, err := s.Begin(ctx, "key", "fp1", ttl); err != ErrInProgress {
+		t.Fatalf("got err %v, want ErrInProgress", err)
+	}
+
+	want := &Response{Status: 201, Body: []byte("created")}
+	if err := s.Complete(ctx, "key", "fp1", want, ttl); err != nil {
+		t.Fatal(err)
+	}
+	resp, fp, err := s.Begin(ctx, "key", "fp2", ttl)
+	if err != nil || resp != want || fp != "fp1" {
+		t.Fatalf("got %v, %q, %v, want recorded response", resp, fp, err)
+	}
+
+	// Responses expire after the TTL.
+	now = now.Add(ttl)
+	if resp, _, err := s.Begin(ctx, "key", "fp1", ttl); resp != nil || err != nil {
+		t.Fatalf("got %v, %v after expiry, want reservation", resp, err)
+	}
+
+	// Released keys can be reserved again.
+	if err := s.Release(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _, err := s.Begin(ctx, "key", "fp1", ttl); resp != nil || err != nil {
+		t.Fatalf("got %v, %v after release, want reservation", resp, err)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.Begin(ctx, "a", "", time.Second)
+	s.Complete(ctx, "b", "", &Response{Status: 200}, time.Hour)
+
+	now = now.Add(2 * sweepInterval)
+	s.Begin(ctx, "c", "", time.Second)
+	if _, ok := s.entries["a"]; ok {
+		t.Error("expired entry was not swept")
+	}
+	if _, ok := s.entries["b"]; !ok {
+		t.Error("live entry was swept")
+	}
+}
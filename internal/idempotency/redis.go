@@ -0,0 +1,79 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"runtime.encore.dev/internal/redis"
+)
+
+// RedisStore is a Store backed by Redis, for sharing
+// idempotency keys between multiple instances.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, keyPrefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: keyPrefix}
+}
+
+// Values stored in Redis are "pending:<fingerprint>" for reservations
+// and "done:" followed by a JSON-encoded record for responses.
+const (
+	pendingPrefix = "pending:"
+	donePrefix    = "done:"
+)
+
+type record struct {
+	Fingerprint string    `json:"fingerprint"`
+	Response    *Response `json:"response"`
+}
+
+// beginScript reserves the key if it is unset, and otherwise returns its value.
+const beginScript = `
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return false
+end
+return redis.call("GET", KEYS[1])
+`
+
+func (s *RedisStore) Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Response, string, error) {
+	reply, err := s.client.Do(ctx, "EVAL", beginScript, 1, s.prefix+key,
+		pendingPrefix+fingerprint, ttl.Milliseconds())
+	if err == redis.Nil {
+		return nil, "", nil // reserved
+	}
+	val, err := redis.String(reply, err)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case strings.HasPrefix(val, pendingPrefix):
+		return nil, "", ErrInProgress
+	case strings.HasPrefix(val, donePrefix):
+		var rec record
+		if err := json.Unmarshal([]byte(val[len(donePrefix):]), &rec); err != nil {
+			return nil, "", fmt.Errorf("idempotency: invalid record: %v", err)
+		}
+		return rec.Response, rec.Fingerprint, nil
+	}
+	return nil, "", fmt.Errorf("idempotency: invalid record %q", val)
+}
+
+func (s *RedisStore) Complete(ctx context.Context, key, fingerprint string, resp *Response, ttl time.Duration) error {
+	data, err := json.Marshal(record{Fingerprint: fingerprint, Response: resp})
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Do(ctx, "SET", s.prefix+key, donePrefix+string(data), "PX", ttl.Milliseconds())
+	return err
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	_, err := s.client.Do(ctx, "DEL", s.prefix+key)
+	return err
+}
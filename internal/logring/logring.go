@@ -0,0 +1,100 @@
+// Package logring keeps the most recent log records in memory.
+package logring
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Ring is a ring buffer of JSON log records, one per line,
+// as written by zerolog. It implements io.Writer.
+type Ring struct {
+	mu   sync.Mutex
+	recs [][]byte
+	next int  // index of the next record to write
+	full bool // whether the buffer has wrapped around
+}
+
+// New returns a ring keeping the last n records.
+func New(n int) *Ring {
+	return &Ring{recs: make([][]byte, n)}
+}
+
+// Write adds a record to the ring.
+// It never fails, so it can be used with io.MultiWriter.
+func (r *Ring) Write(p []byte) (int, error) {
+	rec := make([]byte, len(p))
+	copy(rec, p)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recs[r.next] = rec
+	if r.next++; r.next == len(r.recs) {
+		r.next, r.full = 0, true
+	}
+	return len(p), nil
+}
+
+// Filter filters log records.
+// Zero values match all records.
+type Filter struct {
+	MinLevel string // minimum level, such as "warn"
+	Service  string
+	Endpoint string
+	Limit    int // maximum number of records, keeping the most recent
+}
+
+// levels orders the zerolog levels.
+var levels = map[string]int{
+	"trace": -1,
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+	"fatal": 4,
+	"panic": 5,
+}
+
+// ValidLevel reports whether level is a valid minimum level.
+func ValidLevel(level string) bool {
+	_, ok := levels[level]
+	return ok
+}
+
+// Records returns the records matching f, oldest first.
+// Records that are not valid JSON are skipped.
+func (r *Ring) Records(f Filter) []json.RawMessage {
+	r.mu.Lock()
+	var recs [][]byte
+	if r.full {
+		recs = append(recs, r.recs[r.next:]...)
+	}
+	recs = append(recs, r.recs[:r.next]...)
+	r.mu.Unlock()
+
+	minLevel, hasMin := levels[f.MinLevel]
+	var out []json.RawMessage
+	for _, rec := range recs {
+		var fields struct {
+			Level    string `json:"level"`
+			Service  string `json:"service"`
+			Endpoint string `json:"endpoint"`
+		}
+		if err := json.Unmarshal(rec, &fields); err != nil {
+			continue
+		}
+		if hasMin {
+			if l, ok := levels[fields.Level]; ok && l < minLevel {
+				continue
+			}
+		}
+		if (f.Service != "" && fields.Service != f.Service) || (f.Endpoint != "" && fields.Endpoint != f.Endpoint) {
+			continue
+		}
+		out = append(out, json.RawMessage(rec))
+	}
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[len(out)-f.Limit:]
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package logring
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := New(3)
+	for _, rec := range []string{
+		`{"level":"info","message":"1"}`,
+		`{"level":"error","service":"a","endpoint":"E","message":"2"}`,
+		`{"level":"debug","service":"a","message":"3"}`,
+		`{"level":"warn","service":"b","message":"4"}`,
+		`not json`,
+	} {
+		r.Write([]byte(rec + "\n"))
+	}
+
+	tests := []struct {
+		name string
+		f    Filter
+		want []string // messages
+	}{
+		{"all", Filter{}, []string{"3", "4"}},
+		{"level", Filter{MinLevel: "info"}, []string{"4"}},
+		{"service", Filter{Service: "a"}, []string{"3"}},
+		{"limit", Filter{Limit: 1}, []string{"4"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, rec := range r.Records(test.f) {
+				s := string(rec)
+				got = append(got, s[strings.Index(s, `"message":"`)+11:strings.LastIndex(s, `"`)])
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRingNotFull(t *testing.T) {
+	r := New(10)
+	r.Write([]byte(`{"level":"error","endpoint":"E"}`))
+	if got := r.Records(Filter{Endpoint: "E", MinLevel: "warn"}); len(got) != 1 {
+		t.Errorf("got %d records, want 1", len(got))
+	}
+}
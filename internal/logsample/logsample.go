@@ -0,0 +1,107 @@
+// Package logsample samples log messages so that
+// hot paths don't flood the log output.
+package logsample
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Policy is a sampling policy. The first Burst messages in each
+// Period are logged, and after that one in every N messages.
+//
+// For example, {N: 100} logs one in every 100 messages, and
+// {Burst: 10, Period: time.Second} logs at most 10 messages per
+// second. If N is zero, messages beyond the burst are dropped.
+type Policy struct {
+	Burst  int
+	Period time.Duration
+	N      int
+}
+
+// maxKeys is the maximum number of distinct messages
+// tracked; further messages share a single counter.
+const maxKeys = 10000
+
+// overflowKey is the key of the counter shared by messages
+// beyond maxKeys.
+const overflowKey = "\x00overflow"
+
+// Sampler samples log messages, sampling each distinct message
+// independently. Messages at the error level or above are never
+// sampled. It implements zerolog.Hook.
+type Sampler struct {
+	def      *Policy
+	messages map[string]Policy
+	now      func() time.Time
+
+	mu       sync.Mutex
+	counters map[string]*counter
+}
+
+type counter struct {
+	start time.Time // start of the current period
+	n     int       // messages seen in the current period
+}
+
+// New returns a sampler using the policy given for a message
+// in messages, or def if there is none. If def is nil, messages
+// without a policy of their own are not sampled.
+func New(def *Policy, messages map[string]Policy) *Sampler {
+	return &Sampler{
+		def:      def,
+		messages: messages,
+		now:      time.Now,
+		counters: make(map[string]*counter),
+	}
+}
+
+// Allow reports whether a message should be logged.
+func (s *Sampler) Allow(level zerolog.Level, msg string) bool {
+	if level >= zerolog.ErrorLevel && level != zerolog.NoLevel {
+		return true
+	}
+	p, ok := s.messages[msg]
+	if !ok {
+		if s.def == nil {
+			return true
+		}
+		p = *s.def
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[msg]
+	if !ok {
+		if len(s.counters) >= maxKeys {
+			msg = overflowKey
+			c = s.counters[msg]
+		}
+		if c == nil {
+			c = &counter{start: now}
+			s.counters[msg] = c
+		}
+	}
+	return p.allow(c, now)
+}
+
+func (p Policy) allow(c *counter, now time.Time) bool {
+	if p.Period > 0 && now.Sub(c.start) >= p.Period {
+		c.start, c.n = now, 0
+	}
+	c.n++
+	if c.n <= p.Burst {
+		return true
+	}
+	return p.N > 0 && (c.n-p.Burst-1)%p.N == 0
+}
+
+// Run implements zerolog.Hook, discarding events that are not sampled.
+func (s *Sampler) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if !s.Allow(level, msg) {
+		e.Discard()
+	}
+}
@@ -0,0 +1,81 @@
+package logsample
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSampler(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   string // whether each of the messages is logged
+	}{
+		{"one_in_n", Policy{N: 3}, "x..x..x.."},
+		{"burst", Policy{Burst: 2}, "xx......."},
+		{"burst_then_sample", Policy{Burst: 2, N: 3}, "xxx..x..x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := New(&test.policy, nil)
+			got := ""
+			for range test.want {
+				if s.Allow(zerolog.InfoLevel, "msg") {
+					got += "x"
+				} else {
+					got += "."
+				}
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSamplerPeriod(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := New(&Policy{Burst: 1, Period: time.Second}, nil)
+	s.now = func() time.Time { return now }
+
+	if !s.Allow(zerolog.InfoLevel, "msg") {
+		t.Fatal("first message not logged")
+	}
+	if s.Allow(zerolog.InfoLevel, "msg") {
+		t.Fatal("second message logged within period")
+	}
+	now = now.Add(time.Second)
+	if !s.Allow(zerolog.InfoLevel, "msg") {
+		t.Fatal("message not logged in new period")
+	}
+}
+
+func TestSamplerMessages(t *testing.T) {
+	s := New(&Policy{Burst: 1}, map[string]Policy{"hot": {N: 2}})
+	for i, tc := range []struct {
+		level zerolog.Level
+		msg   string
+		want  bool
+	}{
+		{zerolog.InfoLevel, "a", true},
+		{zerolog.InfoLevel, "b", true}, // sampled independently of "a"
+		{zerolog.InfoLevel, "a", false},
+		{zerolog.ErrorLevel, "a", true}, // errors are never sampled
+		{zerolog.InfoLevel, "hot", true},
+		{zerolog.InfoLevel, "hot", false},
+		{zerolog.InfoLevel, "hot", true},
+	} {
+		if got := s.Allow(tc.level, tc.msg); got != tc.want {
+			t.Errorf("%d: Allow(%v, %q) = %v, want %v", i, tc.level, tc.msg, got, tc.want)
+		}
+	}
+
+	s = New(nil, map[string]Policy{"hot": {N: 2}})
+	for i := 0; i < 3; i++ {
+		if !s.Allow(zerolog.InfoLevel, "other") {
+			t.Fatal("message without policy sampled without default policy")
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"strconv"
+
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 )
@@ -18,12 +20,233 @@ func ReqEnd(service, api string, durSecs float64, code string) {
 	rpcDuration.WithLabelValues(service, api, code).Observe(durSecs)
 }
 
+// Endpoint initializes the request and error counters of an endpoint,
+// so they are reported as zero before the endpoint is first called.
+func Endpoint(service, api string) {
+	reqTotal.WithLabelValues(service, api)
+	for _, class := range errorClasses {
+		reqErrors.WithLabelValues(service, api, class)
+	}
+}
+
+var errorClasses = []string{"4xx", "5xx"}
+
+// Request records an HTTP request to an endpoint: its rate,
+// whether it failed, and its latency. The status class is
+// the class of the response status, such as "2xx".
+//
+// If traceID is non-empty it is attached to the latency
+// observation as an exemplar.
+func Request(service, api, method, statusClass string, durSecs float64, traceID string) {
+	reqTotal.WithLabelValues(service, api).Inc()
+	if statusClass == "4xx" || statusClass == "5xx" {
+		reqErrors.WithLabelValues(service, api, statusClass).Inc()
+	}
+	obs := reqLatency.WithLabelValues(service, api, method, statusClass)
+	if eo, ok := obs.(prometheus.ExemplarObserver); ok && traceID != "" {
+		eo.ObserveWithExemplar(durSecs, prometheus.Labels{"trace_id": traceID})
+	} else {
+		obs.Observe(durSecs)
+	}
+}
+
+// HandlerError records an error returned by an endpoint handler.
+// The class is "4xx" for client errors and "5xx" for server errors.
+func HandlerError(service, api, code, class string) {
+	handlerErrors.WithLabelValues(service, api, code, class).Inc()
+}
+
+// SetLatencyBuckets sets the buckets of the request latency histogram.
+// It must be called before any request latencies are recorded.
+func SetLatencyBuckets(buckets []float64) {
+	prometheus.Unregister(reqLatency)
+	reqLatency = newReqLatency(buckets)
+	prometheus.MustRegister(reqLatency)
+}
+
 func UnknownEndpoint(service, api string) {
 	unknownEndpoint.WithLabelValues(service, api).Add(1)
 }
 
+func MethodNotAllowed(service, api string) {
+	methodNotAllowed.WithLabelValues(service, api).Add(1)
+}
+
+func Panic(service, api string) {
+	rpcPanics.WithLabelValues(service, api).Add(1)
+}
+
+func RateLimited(service, api string) {
+	rpcRateLimited.WithLabelValues(service, api).Add(1)
+}
+
+// PermissionDenied records a call denied due to a missing
+// scope or role; kind is "scope" or "role".
+func PermissionDenied(service, api, kind, name string) {
+	rpcPermissionDenied.WithLabelValues(service, api, kind, name).Add(1)
+}
+
+// APIKeyRequest records a request authenticated with an API key.
+// The result is "ok", "expired" or "invalid"; keyID is empty for invalid keys.
+func APIKeyRequest(keyID, result string) {
+	apiKeyRequests.WithLabelValues(keyID, result).Add(1)
+}
+
+// SSEConnect records a client connecting to a Server-Sent Events endpoint.
+func SSEConnect(service, api string) {
+	sseConnections.WithLabelValues(service, api).Inc()
+	sseConnectionsTotal.WithLabelValues(service, api).Inc()
+}
+
+// SSEDisconnect records a client disconnecting from a Server-Sent
+// Events endpoint after being connected for durSecs seconds.
+func SSEDisconnect(service, api string, durSecs float64) {
+	sseConnections.WithLabelValues(service, api).Dec()
+	sseDuration.WithLabelValues(service, api).Observe(durSecs)
+}
+
+// SSEEvent records an event sent by a Server-Sent Events endpoint.
+func SSEEvent(service, api string) {
+	sseEvents.WithLabelValues(service, api).Inc()
+}
+
+// WebSocketConnect records a WebSocket connection being established.
+func WebSocketConnect(service, api string) {
+	wsConnections.WithLabelValues(service, api).Inc()
+	wsConnectionsTotal.WithLabelValues(service, api).Inc()
+}
+
+// WebSocketDisconnect records a WebSocket connection closing
+// after being open for durSecs seconds.
+func WebSocketDisconnect(service, api string, durSecs float64) {
+	wsConnections.WithLabelValues(service, api).Dec()
+	wsDuration.WithLabelValues(service, api).Observe(durSecs)
+}
+
+// WebSocketMessage records a WebSocket message of size bytes.
+// The direction is "in" for received messages and "out" for sent ones.
+func WebSocketMessage(service, api, direction string, size int) {
+	wsMessages.WithLabelValues(service, api, direction).Inc()
+	wsMessageBytes.WithLabelValues(service, api, direction).Add(float64(size))
+}
+
+// APIVersionRequest records a request to an endpoint of an API version.
+func APIVersionRequest(service, api, version string, deprecated bool) {
+	apiVersionRequests.WithLabelValues(service, api, version, strconv.FormatBool(deprecated)).Inc()
+}
+
+// SlowClientAborted records a request aborted because
+// its body was received too slowly.
+func SlowClientAborted(service, api string) {
+	slowClientsAborted.WithLabelValues(service, api).Inc()
+}
+
+// PubSubPublish records a message published to a topic.
+func PubSubPublish(topic string) {
+	pubsubPublished.WithLabelValues(topic).Inc()
+}
+
+// PubSubMessage records a message handled by a subscription
+// in durSecs seconds. The result is "ok", "error", "discarded",
+// "dead_lettered", the latter two for failed messages that are not
+// retried, or "duplicate" for messages that were already processed.
+func PubSubMessage(topic, sub, result string, durSecs float64) {
+	pubsubProcessed.WithLabelValues(topic, sub, result).Inc()
+	pubsubDuration.WithLabelValues(topic, sub).Observe(durSecs)
+}
+
+// PubSubDeadLetters records the number of messages
+// held in a dead-letter topic.
+func PubSubDeadLetters(topic string, n int64) {
+	pubsubDeadLetters.WithLabelValues(topic).Set(float64(n))
+}
+
+// CronJobRun records a run of a cron job taking durSecs seconds.
+// The result is "ok", "error", or "skipped" for runs skipped since
+// the previous run was still in progress.
+func CronJobRun(job, result string, durSecs float64) {
+	cronRuns.WithLabelValues(job, result).Inc()
+	if result != "skipped" {
+		cronDuration.WithLabelValues(job).Observe(durSecs)
+	}
+}
+
+// TaskEnqueued records a task enqueued to a queue.
+func TaskEnqueued(queue string) {
+	tasksEnqueued.WithLabelValues(queue).Inc()
+}
+
+// TaskRun records an attempt at a task taking durSecs seconds.
+// The result is "ok", "error", or "discarded" for failed tasks
+// that are not retried.
+func TaskRun(queue, result string, durSecs float64) {
+	tasksProcessed.WithLabelValues(queue, result).Inc()
+	taskDuration.WithLabelValues(queue).Observe(durSecs)
+}
+
+// TaskQueueDepth records the number of pending tasks of a queue.
+func TaskQueueDepth(queue string, n int64) {
+	taskQueueDepth.WithLabelValues(queue).Set(float64(n))
+}
+
+// SQLQuery records a query to a database taking durSecs seconds,
+// identified by the fingerprint of its statement.
+func SQLQuery(database, statement string, failed bool, durSecs float64) {
+	result := "ok"
+	if failed {
+		result = "error"
+	}
+	sqlQueries.WithLabelValues(database, statement, result).Inc()
+	sqlQueryDuration.WithLabelValues(database, statement).Observe(durSecs)
+}
+
+// SQLQueryRows records the number of rows returned or affected by a query.
+func SQLQueryRows(database, statement string, n int64) {
+	sqlQueryRows.WithLabelValues(database, statement).Observe(float64(n))
+}
+
+// SQLPoolAcquire records waiting durSecs seconds to acquire a
+// connection from the pool of a database, which timed out if timedOut.
+func SQLPoolAcquire(database string, durSecs float64, timedOut bool) {
+	sqlPoolWait.WithLabelValues(database).Observe(durSecs)
+	if timedOut {
+		sqlPoolTimeouts.WithLabelValues(database).Inc()
+	}
+}
+
+// CacheOperation records an operation on a cache keyspace taking
+// durSecs seconds. The result is "hit" or "miss" for reads, and
+// "ok" or "error" otherwise.
+func CacheOperation(keyspace, op, result string, durSecs float64) {
+	cacheOps.WithLabelValues(keyspace, op, result).Inc()
+	cacheDuration.WithLabelValues(keyspace, op).Observe(durSecs)
+}
+
+// ResponseCacheRequest records a request to an endpoint whose
+// responses are cached. The result is "hit", "miss" or "bypass".
+func ResponseCacheRequest(service, api, result string) {
+	responseCacheRequests.WithLabelValues(service, api, result).Inc()
+}
+
+// ObjectOperation records an object storage operation on bucket.
+// The result is "ok", "not_found" or "error".
+func ObjectOperation(bucket, op, result string, durSecs float64) {
+	objectOps.WithLabelValues(bucket, op, result).Inc()
+	objectDuration.WithLabelValues(bucket, op).Observe(durSecs)
+}
+
+// ObjectBytes records n bytes uploaded to or downloaded from bucket.
+// The direction is "upload" or "download".
+func ObjectBytes(bucket, direction string, n int64) {
+	objectBytes.WithLabelValues(bucket, direction).Add(float64(n))
+}
+
+func RequestShed() {
+	rpcShed.Add(1)
+}
+
 func init() {
-	prometheus.MustRegister(rpcCountTotal, rpcCount, rpcDuration, unknownEndpoint)
+	prometheus.MustRegister(rpcCountTotal, rpcCount, rpcDuration, reqTotal, reqErrors, reqLatency, handlerErrors, unknownEndpoint, methodNotAllowed, rpcShed, rpcPanics, rpcRateLimited, rpcPermissionDenied, apiKeyRequests, sseConnections, sseConnectionsTotal, sseDuration, sseEvents, wsConnections, wsConnectionsTotal, wsDuration, wsMessages, wsMessageBytes, apiVersionRequests, slowClientsAborted, pubsubPublished, pubsubProcessed, pubsubDuration, pubsubDeadLetters, cronRuns, cronDuration, tasksEnqueued, tasksProcessed, taskDuration, taskQueueDepth, sqlQueries, sqlQueryDuration, sqlQueryRows, sqlPools, sqlPoolWait, sqlPoolTimeouts, cacheOps, cacheDuration, responseCacheRequests, objectOps, objectDuration, objectBytes)
 }
 
 var (
@@ -43,8 +266,235 @@ var (
 		Buckets: prometheus.DefBuckets,
 	}, []string{"service", "api", "status"})
 
+	reqTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_requests_total",
+		Help: "Per-endpoint HTTP requests",
+	}, []string{"service", "api"})
+
+	reqErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_request_errors_total",
+		Help: "Per-endpoint HTTP requests that failed with a 4xx or 5xx status",
+	}, []string{"service", "api", "status_class"})
+
+	reqLatency = newReqLatency(prometheus.DefBuckets)
+
+	handlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_handler_errors_total",
+		Help: "Per-endpoint errors returned by handlers, by error code",
+	}, []string{"service", "api", "code", "class"})
+
 	unknownEndpoint = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "rpc_unknown_endpoint_total",
 		Help: "RPC calls to unknown endpoints",
 	}, []string{"service", "api"})
+
+	methodNotAllowed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_method_not_allowed_total",
+		Help: "RPC calls to known endpoints with an unsupported HTTP method",
+	}, []string{"service", "api"})
+
+	rpcShed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rpc_shed_total",
+		Help: "RPC calls rejected due to the server being at its concurrency limit",
+	})
+
+	rpcPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_panics_total",
+		Help: "RPC calls that panicked",
+	}, []string{"service", "api"})
+
+	rpcRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_rate_limited_total",
+		Help: "RPC calls rejected due to rate limiting",
+	}, []string{"service", "api"})
+
+	rpcPermissionDenied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_permission_denied_total",
+		Help: "RPC calls denied due to a missing scope or role",
+	}, []string{"service", "api", "kind", "name"})
+
+	apiKeyRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_api_key_requests_total",
+		Help: "Requests authenticated with an API key",
+	}, []string{"key", "result"})
+
+	sseConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sse_connections",
+		Help: "Open Server-Sent Events connections",
+	}, []string{"service", "api"})
+
+	sseConnectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sse_connections_total",
+		Help: "Server-Sent Events connections opened",
+	}, []string{"service", "api"})
+
+	sseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sse_connection_duration_seconds",
+		Help:    "Server-Sent Events connection duration distributions.",
+		Buckets: []float64{1, 10, 60, 300, 900, 1800, 3600, 4 * 3600},
+	}, []string{"service", "api"})
+
+	sseEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sse_events_total",
+		Help: "Events sent by Server-Sent Events endpoints",
+	}, []string{"service", "api"})
+
+	wsConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "websocket_connections",
+		Help: "Open WebSocket connections",
+	}, []string{"service", "api"})
+
+	wsConnectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_connections_total",
+		Help: "WebSocket connections established",
+	}, []string{"service", "api"})
+
+	wsDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "websocket_connection_duration_seconds",
+		Help:    "WebSocket connection duration distributions.",
+		Buckets: []float64{1, 10, 60, 300, 900, 1800, 3600, 4 * 3600},
+	}, []string{"service", "api"})
+
+	wsMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_messages_total",
+		Help: "WebSocket messages sent and received",
+	}, []string{"service", "api", "direction"})
+
+	wsMessageBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_message_bytes_total",
+		Help: "Bytes of WebSocket messages sent and received",
+	}, []string{"service", "api", "direction"})
+
+	apiVersionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_version_requests_total",
+		Help: "Requests to versioned endpoints, by version",
+	}, []string{"service", "api", "version", "deprecated"})
+
+	slowClientsAborted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_slow_clients_aborted_total",
+		Help: "Requests aborted due to their body being received too slowly",
+	}, []string{"service", "api"})
+
+	pubsubPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pubsub_messages_published_total",
+		Help: "Messages published, by topic",
+	}, []string{"topic"})
+
+	pubsubProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pubsub_messages_processed_total",
+		Help: "Messages handled by subscriptions, by result",
+	}, []string{"topic", "subscription", "result"})
+
+	pubsubDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pubsub_message_duration_seconds",
+		Help:    "Message handling duration distributions.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic", "subscription"})
+
+	pubsubDeadLetters = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pubsub_dead_letter_messages",
+		Help: "Messages held in dead-letter topics awaiting re-drive",
+	}, []string{"topic"})
+
+	cronRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cron_job_runs_total",
+		Help: "Cron job runs, by result",
+	}, []string{"job", "result"})
+
+	cronDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cron_job_duration_seconds",
+		Help:    "Cron job run duration distributions.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"job"})
+
+	tasksEnqueued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tasks_enqueued_total",
+		Help: "Background tasks enqueued, by queue",
+	}, []string{"queue"})
+
+	tasksProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tasks_processed_total",
+		Help: "Background task attempts, by result",
+	}, []string{"queue", "result"})
+
+	taskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "task_duration_seconds",
+		Help:    "Background task attempt duration distributions.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"queue"})
+
+	taskQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "task_queue_depth",
+		Help: "Pending background tasks, by queue",
+	}, []string{"queue"})
+
+	sqlQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqldb_queries_total",
+		Help: "Database queries, by database, statement fingerprint and result",
+	}, []string{"database", "statement", "result"})
+
+	sqlQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sqldb_query_duration_seconds",
+		Help:    "Database query duration distributions.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"database", "statement"})
+
+	sqlQueryRows = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sqldb_query_rows",
+		Help:    "Distributions of the number of rows returned or affected by database queries.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"database", "statement"})
+
+	sqlPools = &sqlPoolCollector{pools: make(map[sqlPoolKey]func() SQLPoolStats)}
+
+	sqlPoolWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sqldb_pool_acquire_duration_seconds",
+		Help:    "Distributions of the time waited to acquire database connections.",
+		Buckets: []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"database"})
+
+	sqlPoolTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sqldb_pool_acquire_timeouts_total",
+		Help: "Database connection acquisitions that timed out, by database",
+	}, []string{"database"})
+
+	cacheOps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_operations_total",
+		Help: "Cache operations, by keyspace, operation and result",
+	}, []string{"keyspace", "op", "result"})
+
+	responseCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "response_cache_requests_total",
+		Help: "Requests to endpoints with cached responses, by endpoint and result",
+	}, []string{"service", "api", "result"})
+
+	cacheDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cache_operation_duration_seconds",
+		Help:    "Cache operation duration distributions.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"keyspace", "op"})
+
+	objectOps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "objects_operations_total",
+		Help: "Object storage operations, by bucket, operation and result",
+	}, []string{"bucket", "op", "result"})
+
+	objectDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "objects_operation_duration_seconds",
+		Help:    "Object storage operation duration distributions.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"bucket", "op"})
+
+	objectBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "objects_bytes_total",
+		Help: "Bytes uploaded to and downloaded from object storage, by bucket and direction",
+	}, []string{"bucket", "direction"})
 )
+
+func newReqLatency(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rpc_request_latency_seconds",
+		Help:    "Per-endpoint HTTP request latency distributions.",
+		Buckets: buckets,
+	}, []string{"service", "api", "method", "status_class"})
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SQLPoolStats are statistics of a database connection pool.
+type SQLPoolStats struct {
+	InUse int32
+	Idle  int32
+	Max   int32
+}
+
+type sqlPoolKey struct {
+	database, pool string
+}
+
+// sqlPoolCollector collects the statistics
+// of the registered pools when gathered.
+type sqlPoolCollector struct {
+	mu    sync.Mutex
+	pools map[sqlPoolKey]func() SQLPoolStats
+}
+
+var (
+	sqlPoolConnsDesc = prometheus.NewDesc("sqldb_pool_connections",
+		"Database pool connections, by database, pool and state", []string{"database", "pool", "state"}, nil)
+	sqlPoolMaxConnsDesc = prometheus.NewDesc("sqldb_pool_max_connections",
+		"Maximum database pool connections, by database and pool", []string{"database", "pool"}, nil)
+)
+
+// RegisterSQLPool registers a connection pool of a database, such as
+// "primary" or the address of a replica, whose statistics are
+// reported by stats when metrics are gathered.
+func RegisterSQLPool(database, pool string, stats func() SQLPoolStats) {
+	sqlPools.mu.Lock()
+	defer sqlPools.mu.Unlock()
+	sqlPools.pools[sqlPoolKey{database, pool}] = stats
+}
+
+func (c *sqlPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sqlPoolConnsDesc
+	ch <- sqlPoolMaxConnsDesc
+}
+
+func (c *sqlPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	keys := make([]sqlPoolKey, 0, len(c.pools))
+	for k := range c.pools {
+		keys = append(keys, k)
+	}
+	fns := make([]func() SQLPoolStats, len(keys))
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].database != keys[j].database {
+			return keys[i].database < keys[j].database
+		}
+		return keys[i].pool < keys[j].pool
+	})
+	for i, k := range keys {
+		fns[i] = c.pools[k]
+	}
+	c.mu.Unlock()
+
+	for i, k := range keys {
+		s := fns[i]()
+		ch <- prometheus.MustNewConstMetric(sqlPoolConnsDesc, prometheus.GaugeValue, float64(s.InUse), k.database, k.pool, "in_use")
+		ch <- prometheus.MustNewConstMetric(sqlPoolConnsDesc, prometheus.GaugeValue, float64(s.Idle), k.database, k.pool, "idle")
+		ch <- prometheus.MustNewConstMetric(sqlPoolMaxConnsDesc, prometheus.GaugeValue, float64(s.Max), k.database, k.pool)
+	}
+}
@@ -0,0 +1,102 @@
+// Package migrate loads versioned SQL migrations and tracks
+// the status of applying them to databases.
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Migration is a versioned SQL migration.
+type Migration struct {
+	Version uint64
+	Name    string
+	SQL     string
+}
+
+// Load loads the migrations in the root directory of fsys, in order
+// of their versions. Migrations are files named "<version>_<name>.up.sql",
+// such as "1_create_users.up.sql". Other files are ignored.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var migs []*Migration
+	seen := make(map[uint64]string)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		base := strings.TrimSuffix(name, ".up.sql")
+		i := strings.IndexByte(base, '_')
+		if i < 0 {
+			return nil, fmt.Errorf("migrate: invalid migration name %q", name)
+		}
+		version, err := strconv.ParseUint(base[:i], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("migrate: invalid version in migration name %q", name)
+		}
+		if prev, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrate: migrations %q and %q have the same version", prev, name)
+		}
+		seen[version] = name
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		migs = append(migs, &Migration{Version: version, Name: base[i+1:], SQL: string(data)})
+	}
+	sort.Slice(migs, func(i, j int) bool { return migs[i].Version < migs[j].Version })
+	return migs, nil
+}
+
+// States of migrating a database.
+const (
+	Pending = "pending"
+	Running = "running"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// Status is the status of migrating a database.
+type Status struct {
+	Database string    `json:"database"`
+	State    string    `json:"state"`
+	Version  uint64    `json:"version"` // of the last applied migration, or 0
+	Pending  []uint64  `json:"pending"` // versions not yet applied
+	Error    string    `json:"error,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+var (
+	mu       sync.Mutex
+	statuses = make(map[string]Status) // by database
+)
+
+// SetStatus records the status of migrating a database.
+func SetStatus(s Status) {
+	s.Updated = time.Now()
+	mu.Lock()
+	defer mu.Unlock()
+	statuses[s.Database] = s
+}
+
+// Statuses returns the status of migrating
+// each database, sorted by database.
+func Statuses() []Status {
+	mu.Lock()
+	defer mu.Unlock()
+	list := make([]Status, 0, len(statuses))
+	for _, s := range statuses {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Database < list[j].Database })
+	return list
+}
@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"10_add_index.up.sql":     {Data: []byte("CREATE INDEX i ON users (name);")},
+		"2_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"2_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"README.md":               {Data: []byte("migrations")},
+		"sub/3_ignored.up.sql":    {Data: []byte("SELECT 1;")},
+	}
+	migs, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migs))
+	}
+	if m := migs[0]; m.Version != 2 || m.Name != "create_users" || m.SQL != "CREATE TABLE users (id INT);" {
+		t.Errorf("migs[0] = %+v", m)
+	}
+	if m := migs[1]; m.Version != 10 || m.Name != "add_index" {
+		t.Errorf("migs[1] = %+v", m)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []fstest.MapFS{
+		{"create_users.up.sql": {}},
+		{"x_create_users.up.sql": {}},
+		{"0_create_users.up.sql": {}},
+		{"1_a.up.sql": {}, "01_b.up.sql": {}},
+	}
+	for _, fsys := range tests {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("Load(%v): got nil error", fsys)
+		}
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	SetStatus(Status{Database: "b", State: Done, Version: 3})
+	SetStatus(Status{Database: "a", State: Pending, Pending: []uint64{1}})
+	SetStatus(Status{Database: "a", State: Running, Pending: []uint64{1}})
+	list := Statuses()
+	if len(list) != 2 || list[0].Database != "a" || list[1].Database != "b" {
+		t.Fatalf("Statuses() = %+v", list)
+	}
+	if list[0].State != Running || list[0].Updated.IsZero() {
+		t.Errorf("list[0] = %+v", list[0])
+	}
+}
@@ -0,0 +1,570 @@
+package msgpack
+
+import (
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Unmarshal decodes the MessagePack data into v, which must be a
+// non-nil pointer. Values decoded into an interface{} are nil, bool,
+// int64, uint64, float64, string, []byte, []interface{} and
+// map[string]interface{}.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("msgpack: Unmarshal requires a non-nil pointer")
+	}
+	d := &decoder{data: data}
+	if err := d.value(rv.Elem()); err != nil {
+		return err
+	}
+	if d.off != len(d.data) {
+		return errors.New("msgpack: trailing data")
+	}
+	return nil
+}
+
+var errShort = errors.New("msgpack: unexpected end of data")
+
+// maxDepth limits the nesting of decoded values.
+const maxDepth = 1000
+
+type decoder struct {
+	data  []byte
+	off   int
+	depth int
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func (d *decoder) value(v reflect.Value) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDepth {
+		return errors.New("msgpack: exceeded max depth")
+	}
+
+	if d.off >= len(d.data) {
+		return errShort
+	}
+	if d.data[d.off] == 0xc0 {
+		d.off++
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.value(v.Elem())
+	}
+
+	if v.CanAddr() {
+		pt := reflect.PtrTo(v.Type())
+		if pt.Implements(textUnmarshalerType) && d.isStr() {
+			s, err := d.readStr()
+			if err != nil {
+				return err
+			}
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}
+		if pt.Implements(jsonUnmarshalerType) {
+			x, err := d.any()
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(jsonCompatible(x))
+			if err != nil {
+				return err
+			}
+			return v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(data)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("msgpack: cannot decode into %s", v.Type())
+		}
+		x, err := d.any()
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		} else {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	case reflect.Struct:
+		return d.structValue(v)
+	case reflect.Map:
+		return d.mapValue(v)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && (d.isBin() || d.isStr()) {
+			b, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		n, err := d.arrayLen()
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := d.value(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Array:
+		n, err := d.arrayLen()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if i < v.Len() {
+				if err := d.value(v.Index(i)); err != nil {
+					return err
+				}
+			} else if _, err := d.any(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	x, err := d.any()
+	if err != nil {
+		return err
+	}
+	return assignScalar(v, x)
+}
+
+// assignScalar assigns x, a decoded scalar, to v.
+func assignScalar(v reflect.Value, x interface{}) error {
+	mismatch := func() error {
+		return fmt.Errorf("msgpack: cannot decode %T into %s", x, v.Type())
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := x.(bool)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b)
+	case reflect.String:
+		s, ok := x.(string)
+		if !ok {
+			return mismatch()
+		}
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch x := x.(type) {
+		case int64:
+			n = x
+		case uint64:
+			if x > math.MaxInt64 {
+				return mismatch()
+			}
+			n = int64(x)
+		case float64:
+			if x != math.Trunc(x) {
+				return mismatch()
+			}
+			n = int64(x)
+		default:
+			return mismatch()
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("msgpack: %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch x := x.(type) {
+		case int64:
+			if x < 0 {
+				return mismatch()
+			}
+			n = uint64(x)
+		case uint64:
+			n = x
+		case float64:
+			if x < 0 || x != math.Trunc(x) {
+				return mismatch()
+			}
+			n = uint64(x)
+		default:
+			return mismatch()
+		}
+		if v.OverflowUint(n) {
+			return fmt.Errorf("msgpack: %d overflows %s", n, v.Type())
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch x := x.(type) {
+		case int64:
+			v.SetFloat(float64(x))
+		case uint64:
+			v.SetFloat(float64(x))
+		case float64:
+			v.SetFloat(x)
+		default:
+			return mismatch()
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+func (d *decoder) structValue(v reflect.Value) error {
+	n, err := d.mapLen()
+	if err != nil {
+		return err
+	}
+	fields := cachedFields(v.Type())
+	for i := 0; i < n; i++ {
+		key, err := d.readStr()
+		if err != nil {
+			return err
+		}
+		f := lookupField(fields, key)
+		if f == nil {
+			if _, err := d.any(); err != nil {
+				return err
+			}
+			continue
+		}
+		fv := v
+		for j, x := range f.index {
+			if j > 0 && fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			fv = fv.Field(x)
+		}
+		if err := d.value(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupField finds the field for a key, preferring
+// an exact match, like encoding/json.
+func lookupField(fields []field, key string) *field {
+	for i := range fields {
+		if fields[i].name == key {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, key) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+func (d *decoder) mapValue(v reflect.Value) error {
+	t := v.Type()
+	n, err := d.mapLen()
+	if err != nil {
+		return err
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, n))
+	}
+	for i := 0; i < n; i++ {
+		ks, err := d.readStr()
+		if err != nil {
+			return err
+		}
+		key := reflect.New(t.Key()).Elem()
+		if err := setMapKey(key, ks); err != nil {
+			return err
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		if err := d.value(elem); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+// setMapKey sets a map key from its string form, as encoding/json does.
+func setMapKey(key reflect.Value, s string) error {
+	if key.Kind() == reflect.String {
+		key.SetString(s)
+		return nil
+	}
+	if tu, ok := key.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(s))
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || key.OverflowInt(n) {
+			return fmt.Errorf("msgpack: invalid map key %q for %s", s, key.Type())
+		}
+		key.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || key.OverflowUint(n) {
+			return fmt.Errorf("msgpack: invalid map key %q for %s", s, key.Type())
+		}
+		key.SetUint(n)
+	default:
+		return fmt.Errorf("msgpack: unsupported map key type %s", key.Type())
+	}
+	return nil
+}
+
+// any decodes the next value as a generic value.
+func (d *decoder) any() (interface{}, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDepth {
+		return nil, errors.New("msgpack: exceeded max depth")
+	}
+
+	if d.off >= len(d.data) {
+		return nil, errShort
+	}
+	c := d.data[d.off]
+	switch {
+	case c <= 0x7f:
+		d.off++
+		return int64(c), nil
+	case c >= 0xe0:
+		d.off++
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f, c == 0xde, c == 0xdf:
+		n, err := d.mapLen()
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := d.readStr()
+			if err != nil {
+				return nil, err
+			}
+			if m[k], err = d.any(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case c >= 0x90 && c <= 0x9f, c == 0xdc, c == 0xdd:
+		n, err := d.arrayLen()
+		if err != nil {
+			return nil, err
+		}
+		s := make([]interface{}, n)
+		for i := range s {
+			if s[i], err = d.any(); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case d.isStr():
+		return d.readStr()
+	case d.isBin():
+		return d.readBytes()
+	}
+
+	d.off++
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 0xcb:
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		b, err := d.read(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return readUint(b), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		b, err := d.read(1 << (c - 0xd0))
+		if err != nil {
+			return nil, err
+		}
+		n := readUint(b)
+		switch len(b) {
+		case 1:
+			return int64(int8(n)), nil
+		case 2:
+			return int64(int16(n)), nil
+		case 4:
+			return int64(int32(n)), nil
+		}
+		return int64(n), nil
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type byte 0x%x", c)
+}
+
+func readUint(b []byte) uint64 {
+	var n uint64
+	for _, x := range b {
+		n = n<<8 | uint64(x)
+	}
+	return n
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.off < n {
+		return nil, errShort
+	}
+	b := d.data[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+// readLen reads a length of size bytes.
+func (d *decoder) readLen(size int) (int, error) {
+	b, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+	n := readUint(b)
+	if n > uint64(len(d.data)) {
+		// Every element takes at least one byte.
+		return 0, errShort
+	}
+	return int(n), nil
+}
+
+func (d *decoder) isStr() bool {
+	c := d.data[d.off]
+	return (c >= 0xa0 && c <= 0xbf) || c == 0xd9 || c == 0xda || c == 0xdb
+}
+
+func (d *decoder) isBin() bool {
+	c := d.data[d.off]
+	return c == 0xc4 || c == 0xc5 || c == 0xc6
+}
+
+func (d *decoder) readStr() (string, error) {
+	if d.off >= len(d.data) {
+		return "", errShort
+	}
+	if !d.isStr() {
+		return "", fmt.Errorf("msgpack: expected string, got type byte 0x%x", d.data[d.off])
+	}
+	b, err := d.readBytes()
+	return string(b), err
+}
+
+// readBytes reads a str or bin value.
+func (d *decoder) readBytes() ([]byte, error) {
+	c := d.data[d.off]
+	d.off++
+	var n int
+	var err error
+	switch {
+	case c >= 0xa0 && c <= 0xbf:
+		n = int(c & 0x1f)
+	case c == 0xd9, c == 0xc4:
+		n, err = d.readLen(1)
+	case c == 0xda, c == 0xc5:
+		n, err = d.readLen(2)
+	default:
+		n, err = d.readLen(4)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+func (d *decoder) arrayLen() (int, error) {
+	if d.off >= len(d.data) {
+		return 0, errShort
+	}
+	c := d.data[d.off]
+	d.off++
+	switch {
+	case c >= 0x90 && c <= 0x9f:
+		return int(c & 0x0f), nil
+	case c == 0xdc:
+		return d.readLen(2)
+	case c == 0xdd:
+		return d.readLen(4)
+	}
+	return 0, fmt.Errorf("msgpack: expected array, got type byte 0x%x", c)
+}
+
+func (d *decoder) mapLen() (int, error) {
+	if d.off >= len(d.data) {
+		return 0, errShort
+	}
+	c := d.data[d.off]
+	d.off++
+	switch {
+	case c >= 0x80 && c <= 0x8f:
+		return int(c & 0x0f), nil
+	case c == 0xde:
+		return d.readLen(2)
+	case c == 0xdf:
+		return d.readLen(4)
+	}
+	return 0, fmt.Errorf("msgpack: expected map, got type byte 0x%x", c)
+}
+
+// jsonCompatible converts binary values in x, a generic
+// decoded value, to strings so x can be encoded as JSON.
+func jsonCompatible(x interface{}) interface{} {
+	switch x := x.(type) {
+	case []byte:
+		return string(x)
+	case []interface{}:
+		for i, e := range x {
+			x[i] = jsonCompatible(e)
+		}
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = jsonCompatible(e)
+		}
+	}
+	return x
+}
@@ -0,0 +1,341 @@
+// Package msgpack implements MessagePack encoding of Go values.
+//
+// Values are mapped like encoding/json maps them to JSON: structs
+// are encoded as maps keyed by their "json" tag names (honoring
+// omitempty and "-"), encoding.TextMarshaler values as strings,
+// and json.Marshaler values as their JSON decoded to generic values.
+// Byte slices are encoded as binary rather than base64 strings.
+package msgpack
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Marshal returns the MessagePack encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encoder{}
+	if err := e.value(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (e *encoder) value(v reflect.Value) error {
+	if !v.IsValid() {
+		e.nil()
+		return nil
+	}
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			e.nil()
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			return e.value(v.Elem())
+		}
+	}
+
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) && !t.Implements(textMarshalerType) {
+		return e.jsonMarshaler(v.Interface().(json.Marshaler))
+	}
+	if t.Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		e.str(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uint(v.Uint())
+	case reflect.Float32:
+		e.buf = append(e.buf, 0xca)
+		e.buf = appendUint32(e.buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.buf = append(e.buf, 0xcb)
+		e.buf = appendUint64(e.buf, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.str(v.String())
+	case reflect.Ptr:
+		return e.value(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.nil()
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			e.bin(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		n := v.Len()
+		e.arrayHeader(n)
+		for i := 0; i < n; i++ {
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.nil()
+			return nil
+		}
+		return e.mapValue(v)
+	case reflect.Struct:
+		return e.structValue(v)
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", t)
+	}
+	return nil
+}
+
+func (e *encoder) mapValue(v reflect.Value) error {
+	keys := make([]string, 0, v.Len())
+	vals := make(map[string]reflect.Value, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		k, err := mapKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+		vals[k] = iter.Value()
+	}
+	sort.Strings(keys) // deterministic output, like encoding/json
+	e.mapHeader(len(keys))
+	for _, k := range keys {
+		e.str(k)
+		if err := e.value(vals[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapKey returns the string form of a map key, as encoding/json does.
+func mapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("msgpack: unsupported map key type %s", k.Type())
+}
+
+func (e *encoder) structValue(v reflect.Value) error {
+	fields := cachedFields(v.Type())
+	// Count the fields to encode first, since the map header
+	// holds the number of entries.
+	vals := make([]reflect.Value, 0, len(fields))
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmpty(fv)) {
+			continue
+		}
+		vals = append(vals, fv)
+		names = append(names, f.name)
+	}
+	e.mapHeader(len(vals))
+	for i, fv := range vals {
+		e.str(names[i])
+		if err := e.value(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is like v.FieldByIndex, but reports false
+// if the field is in a nil embedded struct pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmpty reports whether v is empty as defined by encoding/json's omitempty.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (e *encoder) jsonMarshaler(m json.Marshaler) error {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	var x interface{}
+	if err := json.Unmarshal(data, &x); err != nil {
+		return err
+	}
+	return e.value(reflect.ValueOf(x))
+}
+
+func (e *encoder) nil() {
+	e.buf = append(e.buf, 0xc0)
+}
+
+func (e *encoder) int(n int64) {
+	switch {
+	case n >= 0:
+		e.uint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1)
+		e.buf = appendUint16(e.buf, uint16(n))
+	case n >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2)
+		e.buf = appendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = appendUint64(e.buf, uint64(n))
+	}
+}
+
+func (e *encoder) uint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd)
+		e.buf = appendUint16(e.buf, uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce)
+		e.buf = appendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xcf)
+		e.buf = appendUint64(e.buf, n)
+	}
+}
+
+func (e *encoder) str(s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xda)
+		e.buf = appendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xdb)
+		e.buf = appendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) bin(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xc5)
+		e.buf = appendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xc6)
+		e.buf = appendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) arrayHeader(n int) {
+	switch {
+	case n <= 15:
+		e.buf = append(e.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xdc)
+		e.buf = appendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xdd)
+		e.buf = appendUint32(e.buf, uint32(n))
+	}
+}
+
+func (e *encoder) mapHeader(n int) {
+	switch {
+	case n <= 15:
+		e.buf = append(e.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xde)
+		e.buf = appendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xdf)
+		e.buf = appendUint32(e.buf, uint32(n))
+	}
+}
+
+func appendUint16(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	return append(b, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+		byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
@@ -0,0 +1,87 @@
+package msgpack
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// field is an encoded struct field.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	depth     int
+}
+
+// fieldCache maps reflect.Type to []field.
+var fieldCache sync.Map
+
+func cachedFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	fields := typeFields(t)
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// typeFields returns the encoded fields of t, a struct type,
+// promoting the fields of embedded structs as encoding/json does.
+// Of fields with the same name, the least nested one is used.
+func typeFields(t reflect.Type) []field {
+	var all []field
+	collectFields(t, nil, 0, &all)
+
+	byName := make(map[string]int) // index into fields
+	var fields []field
+	for _, f := range all {
+		if i, ok := byName[f.name]; ok {
+			if f.depth < fields[i].depth {
+				fields[i] = f
+			}
+			continue
+		}
+		byName[f.name] = len(fields)
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, depth int, out *[]field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx != -1 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		idx := append(append([]int(nil), index...), i)
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectFields(ft, idx, depth+1, out)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		*out = append(*out, field{
+			name:      name,
+			index:     idx,
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+			depth:     depth,
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Note string `json:"note,omitempty"`
+}
+
+type Embedded struct {
+	Shared string `json:"shared"`
+}
+
+type payload struct {
+	Embedded
+	Name    string            `json:"name"`
+	Count   int               `json:"count"`
+	Neg     int64             `json:"neg"`
+	Big     uint64            `json:"big"`
+	Ratio   float64           `json:"ratio"`
+	OK      bool              `json:"ok"`
+	Data    []byte            `json:"data"`
+	Tags    []string          `json:"tags"`
+	Attrs   map[string]int    `json:"attrs"`
+	IDs     map[int]string    `json:"ids"`
+	Inner   *inner            `json:"inner"`
+	When    time.Time         `json:"when"`
+	Raw     json.RawMessage   `json:"raw"`
+	Any     interface{}       `json:"any"`
+	Skipped string            `json:"-"`
+	Empty   string            `json:"empty,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := payload{
+		Embedded: Embedded{Shared: "s"},
+		Name:     "widget",
+		Count:    300,
+		Neg:      -70000,
+		Big:      math.MaxUint64,
+		Ratio:    0.25,
+		OK:       true,
+		Data:     []byte{0, 1, 2},
+		Tags:     []string{"a", "b"},
+		Attrs:    map[string]int{"x": 1, "y": -1},
+		IDs:      map[int]string{7: "seven"},
+		Inner:    &inner{Note: "hi"},
+		When:     time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		Raw:      json.RawMessage(`{"k":[1,"two"]}`),
+		Any:      map[string]interface{}{"n": int64(1)},
+		Skipped:  "gone",
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out payload
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Skipped = ""
+	// RawMessage round-trips through generic values.
+	in.Raw = json.RawMessage(`{"k":[1,"two"]}`)
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", out, in)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{5, []byte{0x05}},
+		{-1, []byte{0xff}},
+		{200, []byte{0xcc, 0xc8}},
+		{-200, []byte{0xd1, 0xff, 0x38}},
+		{"ab", []byte{0xa2, 'a', 'b'}},
+		{[]byte{1}, []byte{0xc4, 0x01, 0x01}},
+		{[]int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		{map[string]bool{"b": true, "a": false}, []byte{0x82, 0xa1, 'a', 0xc2, 0xa1, 'b', 0xc3}},
+		{struct {
+			A int `json:"a,omitempty"`
+			B int
+		}{B: 1}, []byte{0x81, 0xa1, 'B', 0x01}},
+	}
+	for _, test := range tests {
+		got, err := Marshal(test.in)
+		if err != nil {
+			t.Errorf("Marshal(%#v): %v", test.in, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("Marshal(%#v) = %x, want %x", test.in, got, test.want)
+		}
+	}
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	data, err := Marshal(map[string]interface{}{
+		"list": []interface{}{1, "x", nil, 1.5},
+		"neg":  -3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"list": []interface{}{int64(1), "x", nil, 1.5},
+		"neg":  int64(-3),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestUnmarshalCaseInsensitive(t *testing.T) {
+	data, _ := Marshal(map[string]string{"NAME": "x"})
+	var out payload
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "x" {
+		t.Errorf("got name %q, want %q", out.Name, "x")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		v    interface{}
+	}{
+		{"truncated", []byte{0xa3, 'a'}, new(string)},
+		{"trailing", []byte{0x01, 0x02}, new(int)},
+		{"type mismatch", []byte{0xa1, 'a'}, new(int)},
+		{"overflow", []byte{0xcd, 0x01, 0x00}, new(int8)},
+		{"huge length", []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, new([]int)},
+		{"non-string key", []byte{0x81, 0x01, 0x01}, new(map[string]int)},
+	}
+	for _, test := range tests {
+		if err := Unmarshal(test.data, test.v); err == nil {
+			t.Errorf("%s: got nil error", test.name)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package objstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Local stores objects in a directory on local disk, such as for
+// development. Objects are stored in the data subdirectory under
+// their escaped keys, and their attributes in the meta subdirectory.
+//
+// Signed URLs start with a URL prefix whose handler checks them
+// with Verify, and are signed with an HMAC key.
+type Local struct {
+	root   string
+	prefix string // URL prefix of signed URLs
+	key    []byte
+	now    func() time.Time
+}
+
+// NewLocal returns a driver storing objects under root, creating it
+// if needed. Signed URLs start with urlPrefix and are signed with
+// signingKey.
+func NewLocal(root, urlPrefix string, signingKey []byte) (*Local, error) {
+	for _, dir := range []string{"data", "meta", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+	if !strings.HasSuffix(urlPrefix, "/") {
+		urlPrefix += "/"
+	}
+	return &Local{root: root, prefix: urlPrefix, key: signingKey, now: time.Now}, nil
+}
+
+// localMeta are the attributes stored alongside an object.
+type localMeta struct {
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+}
+
+func (l *Local) path(dir, key string) string {
+	return filepath.Join(l.root, dir, url.PathEscape(key))
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (*Attrs, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	f, err := ioutil.TempFile(filepath.Join(l.root, "tmp"), "put-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.Size >= 0 && n != opts.Size {
+		return nil, errors.New("objstore: size mismatch: read " + strconv.FormatInt(n, 10) + " bytes")
+	}
+
+	meta := localMeta{ContentType: opts.ContentType, ETag: `"` + hex.EncodeToString(h.Sum(nil)) + `"`}
+	if meta.ContentType == "" {
+		meta.ContentType = defaultContentType
+	}
+	data, _ := json.Marshal(meta)
+	if err := l.writeFile(l.path("meta", key), data); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(f.Name(), l.path("data", key)); err != nil {
+		return nil, err
+	}
+	return l.Stat(ctx, key)
+}
+
+// writeFile writes data to path atomically.
+func (l *Local) writeFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Join(l.root, "tmp"), "meta-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, *Attrs, error) {
+	if !ValidKey(key) {
+		return nil, nil, ErrInvalidKey
+	}
+	f, err := os.Open(l.path("data", key))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotExist
+	} else if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, l.attrs(key, fi), nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (*Attrs, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	fi, err := os.Stat(l.path("data", key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	return l.attrs(key, fi), nil
+}
+
+func (l *Local) attrs(key string, fi os.FileInfo) *Attrs {
+	var meta localMeta
+	if data, err := ioutil.ReadFile(l.path("meta", key)); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	if meta.ContentType == "" {
+		meta.ContentType = defaultContentType
+	}
+	return &Attrs{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: meta.ContentType,
+		ETag:        meta.ETag,
+		Modified:    fi.ModTime(),
+	}
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	if err := os.Remove(l.path("data", key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(l.path("meta", key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) List(ctx context.Context, prefix, after string, limit int) ([]*Attrs, bool, error) {
+	names, err := ioutil.ReadDir(filepath.Join(l.root, "data"))
+	if err != nil {
+		return nil, false, err
+	}
+	var keys []string
+	fis := make(map[string]os.FileInfo)
+	for _, fi := range names {
+		key, err := url.PathUnescape(fi.Name())
+		if err != nil || !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		keys = append(keys, key)
+		fis[key] = fi
+	}
+	sort.Strings(keys)
+	more := false
+	if limit > 0 && len(keys) > limit {
+		keys, more = keys[:limit], true
+	}
+	objs := make([]*Attrs, len(keys))
+	for i, key := range keys {
+		objs[i] = l.attrs(key, fis[key])
+	}
+	return objs, more, nil
+}
+
+// SignURL returns a URL under the driver's URL prefix, with the
+// expiry time and signature in the "expires" and "sig" query
+// parameters.
+func (l *Local) SignURL(method, key string, expiry time.Duration) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	expires := strconv.FormatInt(l.now().Add(expiry).Unix(), 10)
+	q := url.Values{
+		"expires": {expires},
+		"sig":     {l.sign(method, key, expires)},
+	}
+	return l.prefix + escapeKey(key) + "?" + q.Encode(), nil
+}
+
+// Verify reports whether q holds a valid, unexpired signature
+// for accessing key with method.
+func (l *Local) Verify(method, key string, q url.Values) bool {
+	expires := q.Get("expires")
+	t, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || l.now().Unix() > t {
+		return false
+	}
+	want := l.sign(method, key, expires)
+	return hmac.Equal([]byte(q.Get("sig")), []byte(want))
+}
+
+func (l *Local) sign(method, key, expires string) string {
+	mac := hmac.New(sha256.New, l.key)
+	io.WriteString(mac, method+"\n"+key+"\n"+expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// escapeKey escapes the elements of key for use in a URL path.
+func escapeKey(key string) string {
+	elems := strings.Split(key, "/")
+	for i, e := range elems {
+		elems[i] = url.PathEscape(e)
+	}
+	return strings.Join(elems, "/")
+}
@@ -0,0 +1,143 @@
+package objstore
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newLocal(t *testing.T) *Local {
+	t.Helper()
+	l, err := NewLocal(t.TempDir(), "/objects/b", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestLocalPutGet(t *testing.T) {
+	ctx := context.Background()
+	l := newLocal(t)
+	a, err := l.Put(ctx, "dir/a.txt", strings.NewReader("hello"), PutOptions{ContentType: "text/plain", Size: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Size != 5 || a.ContentType != "text/plain" || a.ETag == "" {
+		t.Errorf("Put attrs = %+v", a)
+	}
+
+	rc, a, err := l.Get(ctx, "dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	if string(data) != "hello" || a.ContentType != "text/plain" {
+		t.Errorf("Get = %q, %+v", data, a)
+	}
+
+	if err := l.Delete(ctx, "dir/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat(ctx, "dir/a.txt"); err != ErrNotExist {
+		t.Errorf("Stat after Delete: got err %v, want ErrNotExist", err)
+	}
+	if err := l.Delete(ctx, "dir/a.txt"); err != nil {
+		t.Errorf("Delete of missing object: %v", err)
+	}
+}
+
+func TestLocalPutSizeMismatch(t *testing.T) {
+	l := newLocal(t)
+	_, err := l.Put(context.Background(), "a", strings.NewReader("hello"), PutOptions{Size: 3})
+	if err == nil {
+		t.Fatal("Put with wrong size succeeded")
+	}
+	if _, err := l.Stat(context.Background(), "a"); err != ErrNotExist {
+		t.Errorf("Stat: got err %v, want ErrNotExist", err)
+	}
+}
+
+func TestLocalList(t *testing.T) {
+	ctx := context.Background()
+	l := newLocal(t)
+	for _, key := range []string{"b/2", "a/1", "b/1", "b/3", "c"} {
+		if _, err := l.Put(ctx, key, strings.NewReader(key), PutOptions{Size: -1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := func(objs []*Attrs) string {
+		var ks []string
+		for _, o := range objs {
+			ks = append(ks, o.Key)
+		}
+		return strings.Join(ks, ",")
+	}
+
+	objs, more, err := l.List(ctx, "b/", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(objs); got != "b/1,b/2" || !more {
+		t.Errorf("List = %s, %v; want b/1,b/2, true", got, more)
+	}
+	objs, more, err = l.List(ctx, "b/", "b/2", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(objs); got != "b/3" || more {
+		t.Errorf("List after b/2 = %s, %v; want b/3, false", got, more)
+	}
+}
+
+func TestLocalSignURL(t *testing.T) {
+	l := newLocal(t)
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time { return now }
+
+	s, err := l.SignURL("GET", "dir/a b.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/objects/b/dir/a b.txt" {
+		t.Errorf("path = %q", u.Path)
+	}
+	q := u.Query()
+	if !l.Verify("GET", "dir/a b.txt", q) {
+		t.Errorf("Verify failed")
+	}
+	if l.Verify("PUT", "dir/a b.txt", q) || l.Verify("GET", "dir/other", q) {
+		t.Errorf("Verify succeeded for other method or key")
+	}
+	now = now.Add(2 * time.Minute)
+	if l.Verify("GET", "dir/a b.txt", q) {
+		t.Errorf("Verify succeeded after expiry")
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"a":         true,
+		"a/b.txt":   true,
+		"":          false,
+		"/a":        false,
+		"a/":        false,
+		"a//b":      false,
+		"a/../b":    false,
+		"./a":       false,
+		"a\x00b":    false,
+		"..a/b..":   true,
+		"a b/c%20d": true,
+	} {
+		if got := ValidKey(key); got != want {
+			t.Errorf("ValidKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Package objstore implements object storage drivers for S3,
+// services compatible with it such as GCS, and local disk.
+package objstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned for objects that do not exist.
+var ErrNotExist = errors.New("objstore: object does not exist")
+
+// ErrInvalidKey is returned for keys that are not valid object keys.
+var ErrInvalidKey = errors.New("objstore: invalid key")
+
+// Attrs are the attributes of an object.
+type Attrs struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ETag        string
+	Modified    time.Time
+}
+
+// PutOptions are options for storing an object.
+type PutOptions struct {
+	// ContentType is the content type of the object.
+	// If empty it defaults to "application/octet-stream".
+	ContentType string
+
+	// Size is the size of the object in bytes, or -1 if unknown.
+	Size int64
+}
+
+// Driver stores objects in a bucket.
+type Driver interface {
+	// Put stores the data read from r under key.
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (*Attrs, error)
+
+	// Get opens the object stored under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, *Attrs, error)
+
+	// Stat returns the attributes of the object stored under key.
+	Stat(ctx context.Context, key string) (*Attrs, error)
+
+	// Delete deletes the object stored under key.
+	// Deleting an object that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// List lists up to limit objects with keys starting with prefix
+	// and sorting after the key after, in key order, reporting
+	// whether there are more.
+	List(ctx context.Context, prefix, after string, limit int) (objs []*Attrs, more bool, err error)
+
+	// SignURL returns a URL granting access to the object stored
+	// under key using method, GET or PUT, until expiry.
+	SignURL(method, key string, expiry time.Duration) (string, error)
+}
+
+// MaxKeyLen is the maximum length of an object key.
+const MaxKeyLen = 1024
+
+// ValidKey reports whether key is a valid object key: a non-empty
+// slash-separated path with no empty, "." or ".." elements.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > MaxKeyLen || strings.ContainsRune(key, 0) {
+		return false
+	}
+	for _, elem := range strings.Split(key, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+const defaultContentType = "application/octet-stream"
@@ -0,0 +1,318 @@
+package objstore
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config configures a driver for S3 or a service compatible
+// with it.
+type S3Config struct {
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Region is the region of the bucket, such as "us-east-1".
+	Region string
+
+	// Endpoint is the URL of the service, such as
+	// "https://storage.googleapis.com". If empty it defaults to
+	// the regional S3 endpoint.
+	Endpoint string
+
+	// PathStyle addresses the bucket in the URL path instead of
+	// in the host name, as some compatible services require.
+	PathStyle bool
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// TempDir is the directory objects of unknown size are written
+	// to before they are uploaded. If empty it defaults to the
+	// system's temporary directory.
+	TempDir string
+}
+
+// S3 stores objects in an S3 bucket, or the bucket of a service
+// compatible with it, using its REST API with requests signed with
+// Signature Version 4. Payloads are not signed.
+type S3 struct {
+	cfg    S3Config
+	base   *url.URL // URL of the bucket, with a trailing slash
+	sig    *signer
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3 returns a driver for the bucket configured by cfg, making
+// requests with client. If client is nil it uses http.DefaultClient.
+func NewS3(cfg S3Config, client *http.Client) (*S3, error) {
+	if cfg.Bucket == "" || cfg.Region == "" {
+		return nil, fmt.Errorf("objstore: s3 bucket and region must be set")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("objstore: invalid s3 endpoint %q", endpoint)
+	}
+	if cfg.PathStyle {
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/" + cfg.Bucket + "/"
+	} else {
+		base.Host = cfg.Bucket + "." + base.Host
+		base.Path = "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3{
+		cfg:  cfg,
+		base: base,
+		sig: &signer{
+			accessKey:    cfg.AccessKeyID,
+			secretKey:    cfg.SecretAccessKey,
+			sessionToken: cfg.SessionToken,
+			region:       cfg.Region,
+			service:      "s3",
+		},
+		client: client,
+		now:    time.Now,
+	}, nil
+}
+
+// url returns the URL of the object stored under key,
+// or of the bucket if key is empty.
+func (s *S3) url(key string, q url.Values) *url.URL {
+	u := *s.base
+	u.Path += key
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(q)
+	return &u
+}
+
+// do makes a signed request for key, returning an error
+// for unsuccessful responses.
+func (s *S3) do(ctx context.Context, method, key string, q url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.url(key, q).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	switch b := body.(type) {
+	case *os.File:
+		fi, err := b.Stat()
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = fi.Size()
+	case *sizedReader:
+		req.ContentLength = b.size
+	}
+	if req.ContentLength == 0 && body != nil {
+		req.Body = http.NoBody
+	}
+	s.sig.signRequest(req, s.now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotExist
+		}
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// s3Error is an error response.
+type s3Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("objstore: s3 request failed with status %d", e.Status)
+	}
+	return fmt.Sprintf("objstore: s3 request failed with status %d: %s: %s", e.Status, e.Code, e.Message)
+}
+
+func responseError(resp *http.Response) error {
+	e := &s3Error{Status: resp.StatusCode}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	xml.Unmarshal(data, e)
+	return e
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (*Attrs, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	size := opts.Size
+	if size < 0 {
+		// Uploads must have a known length, so spool the object.
+		f, err := ioutil.TempFile(s.cfg.TempDir, "objstore-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if size, err = io.Copy(f, r); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		r = f
+	} else {
+		r = &sizedReader{r: io.LimitReader(r, size), size: size}
+	}
+
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	resp, err := s.do(ctx, "PUT", key, nil, r, http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return &Attrs{
+		Key:         key,
+		Size:        size,
+		ContentType: contentType,
+		ETag:        resp.Header.Get("ETag"),
+		Modified:    s.now(),
+	}, nil
+}
+
+// sizedReader is a reader of a known size.
+type sizedReader struct {
+	r    io.Reader
+	size int64
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) { return r.r.Read(p) }
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, *Attrs, error) {
+	if !ValidKey(key) {
+		return nil, nil, ErrInvalidKey
+	}
+	resp, err := s.do(ctx, "GET", key, nil, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, headerAttrs(key, resp), nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*Attrs, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	resp, err := s.do(ctx, "HEAD", key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return headerAttrs(key, resp), nil
+}
+
+func headerAttrs(key string, resp *http.Response) *Attrs {
+	a := &Attrs{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		a.Modified = t
+	}
+	return a
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	resp, err := s.do(ctx, "DELETE", key, nil, nil, nil)
+	if err == ErrNotExist {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listResult is the response to a ListObjectsV2 request.
+type listResult struct {
+	IsTruncated bool `xml:"IsTruncated"`
+	Contents    []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+func (s *S3) List(ctx context.Context, prefix, after string, limit int) ([]*Attrs, bool, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	q := url.Values{
+		"list-type": {"2"},
+		"max-keys":  {strconv.Itoa(limit)},
+	}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if after != "" {
+		q.Set("start-after", after)
+	}
+	resp, err := s.do(ctx, "GET", "", q, nil, nil)
+	if err == ErrNotExist {
+		return nil, false, fmt.Errorf("objstore: bucket %s does not exist", s.cfg.Bucket)
+	} else if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	var res listResult
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, false, fmt.Errorf("objstore: invalid list response: %v", err)
+	}
+	objs := make([]*Attrs, len(res.Contents))
+	for i, c := range res.Contents {
+		objs[i] = &Attrs{Key: c.Key, Size: c.Size, ETag: c.ETag, Modified: c.LastModified}
+	}
+	return objs, res.IsTruncated, nil
+}
+
+// SignURL returns a presigned URL. Signature Version 4 limits
+// expiry to 7 days.
+func (s *S3) SignURL(method, key string, expiry time.Duration) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	if expiry <= 0 || expiry > 7*24*time.Hour {
+		return "", fmt.Errorf("objstore: invalid expiry %v", expiry)
+	}
+	return s.sig.presign(method, s.url(key, nil), s.now().UTC(), expiry), nil
+}
@@ -0,0 +1,153 @@
+package objstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigAlgorithm    = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+// signer signs requests with AWS Signature Version 4.
+type signer struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	region       string
+	service      string
+}
+
+func (s *signer) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+// signRequest signs req, made at t, in its Authorization header.
+// The payload is not signed.
+func (s *signer) signRequest(req *http.Request, t time.Time) {
+	req.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	names := []string{"host"}
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-type" || lk == "content-md5" {
+			names = append(names, lk)
+			headers[lk] = strings.TrimSpace(strings.Join(vs, ","))
+		}
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	sig := s.signature(t, req.Method, req.URL, canonHeaders.String(), signed)
+	req.Header.Set("Authorization", sigAlgorithm+" Credential="+s.accessKey+"/"+s.scope(t)+
+		", SignedHeaders="+signed+", Signature="+sig)
+}
+
+// presign returns u signed in its query string to grant access
+// using method from t until t+expiry.
+func (s *signer) presign(method string, u *url.URL, t time.Time, expiry time.Duration) string {
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", sigAlgorithm)
+	q.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(t))
+	q.Set("X-Amz-Date", t.Format(amzDateFormat))
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(expiry/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if s.sessionToken != "" {
+		q.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	signedURL := *u
+	signedURL.RawQuery = canonicalQuery(q)
+	sig := s.signature(t, method, &signedURL, "host:"+u.Host+"\n", "host")
+	signedURL.RawQuery += "&X-Amz-Signature=" + sig
+	return signedURL.String()
+}
+
+func (s *signer) signature(t time.Time, method string, u *url.URL, canonHeaders, signedHeaders string) string {
+	canonReq := strings.Join([]string{
+		method,
+		escapePath(u.Path),
+		canonicalQuery(u.Query()),
+		canonHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+	h := sha256.Sum256([]byte(canonReq))
+	toSign := sigAlgorithm + "\n" + t.Format(amzDateFormat) + "\n" + s.scope(t) + "\n" + hex.EncodeToString(h[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes q sorted by key, escaping as required
+// by Signature Version 4.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapePath escapes path as required by Signature Version 4.
+func escapePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return uriEncode(path, false)
+}
+
+// uriEncode escapes all but unreserved characters in s, and
+// slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,206 @@
+// Package openapi builds OpenAPI 3 documents describing endpoints.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Version is the OpenAPI version of the documents.
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem holds the operations of a path, by lowercase HTTP method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"` // "path" or "query"
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// Endpoint describes an endpoint to document.
+type Endpoint struct {
+	Service  string
+	Name     string
+	Path     string // httprouter path, such as "/users/:id"
+	Methods  []string
+	Doc      string
+	Auth     bool // whether the endpoint requires authentication
+	Request  reflect.Type
+	Response reflect.Type
+}
+
+// Build builds a document describing the endpoints.
+func Build(info Info, servers []string, endpoints []Endpoint) *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]*PathItem),
+	}
+	for _, s := range servers {
+		doc.Servers = append(doc.Servers, Server{URL: s})
+	}
+
+	g := newGenerator()
+	errRef := g.errorSchema()
+	auth := false
+	for _, ep := range endpoints {
+		path, params := convertPath(ep.Path)
+		item := doc.Paths[path]
+		if item == nil {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+
+		methods := expandMethods(ep.Methods)
+		for _, m := range methods {
+			op := &Operation{
+				OperationID: ep.Service + "." + ep.Name,
+				Summary:     ep.Doc,
+				Tags:        []string{ep.Service},
+				Parameters:  append([]*Parameter(nil), params...),
+				Responses: map[string]*Response{
+					"default": {Description: "Error", Content: jsonContent(errRef)},
+				},
+			}
+			if len(methods) > 1 {
+				op.OperationID += "_" + strings.ToLower(m)
+			}
+			if ep.Auth {
+				op.Security = []map[string][]string{{"bearerAuth": {}}}
+				auth = true
+			}
+
+			if ep.Request != nil {
+				if hasBody(m) && hasFiles(ep.Request) {
+					op.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{
+						"multipart/form-data": {Schema: g.schema(ep.Request)},
+					}}
+				} else if hasBody(m) {
+					op.RequestBody = &RequestBody{Required: true, Content: jsonContent(g.schema(ep.Request))}
+				} else {
+					op.Parameters = append(op.Parameters, g.queryParams(ep.Request)...)
+				}
+			}
+			if ep.Response != nil {
+				op.Responses["200"] = &Response{Description: "OK", Content: jsonContent(g.schema(ep.Response))}
+			} else {
+				op.Responses["200"] = &Response{Description: "OK"}
+			}
+			(*item)[strings.ToLower(m)] = op
+		}
+	}
+
+	doc.Components.Schemas = g.schemas
+	if auth {
+		doc.Components.SecuritySchemes = map[string]*SecurityScheme{
+			"bearerAuth": {Type: "http", Scheme: "bearer"},
+		}
+	}
+	return doc
+}
+
+// JSON encodes the document as indented JSON.
+func (d *Document) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+func jsonContent(s *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: s}}
+}
+
+// convertPath converts an httprouter path to an OpenAPI path,
+// returning its path parameters.
+func convertPath(path string) (string, []*Parameter) {
+	var params []*Parameter
+	segs := strings.Split(path, "/")
+	for i, s := range segs {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			name := s[1:]
+			segs[i] = "{" + name + "}"
+			params = append(params, &Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+	return strings.Join(segs, "/"), params
+}
+
+// expandMethods expands the wildcard method to the common methods.
+func expandMethods(methods []string) []string {
+	for _, m := range methods {
+		if m == "*" {
+			return []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+		}
+	}
+	out := append([]string(nil), methods...)
+	sort.Strings(out)
+	return out
+}
+
+// hasBody reports whether requests with the method have
+// the payload in the body, rather than the query string.
+func hasBody(method string) bool {
+	switch method {
+	case "GET", "HEAD", "DELETE":
+		return false
+	}
+	return true
+}
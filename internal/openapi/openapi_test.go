@@ -0,0 +1,124 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"runtime.encore.dev/internal/upload"
+)
+
+type Params struct {
+	Name  string   `json:"name" validate:"required,max=20"`
+	Kind  string   `json:"kind,omitempty" validate:"enum=a|b"`
+	Limit int      `json:"limit" validate:"min=1,max=100"`
+	Tags  []string `json:"tags"`
+	Owner *User    `json:"owner"`
+	When  time.Time
+	skip  int
+}
+
+type User struct {
+	ID      string `json:"id"`
+	Friends []User `json:"friends"`
+}
+
+func TestBuild(t *testing.T) {
+	doc := Build(Info{Title: "test", Version: "1"}, []string{"https://api.example.com"}, []Endpoint{
+		{Service: "svc", Name: "Create", Path: "/things/:id", Methods: []string{"POST"}, Auth: true,
+			Request: reflect.TypeOf(Params{}), Response: reflect.TypeOf(&User{})},
+		{Service: "svc", Name: "List", Path: "/things", Methods: []string{"GET"},
+			Request: reflect.TypeOf(Params{})},
+	})
+
+	create := (*doc.Paths["/things/{id}"])["post"]
+	if create == nil {
+		t.Fatalf("missing POST /things/{id}: %v", doc.Paths)
+	}
+	if create.OperationID != "svc.Create" || len(create.Security) != 1 {
+		t.Errorf("operation = %+v", create)
+	}
+	if p := create.Parameters; len(p) != 1 || p[0].Name != "id" || p[0].In != "path" {
+		t.Errorf("parameters = %+v", p)
+	}
+	body := create.RequestBody.Content["application/json"].Schema
+	if body.Ref != "#/components/schemas/openapi.Params" {
+		t.Errorf("request body schema = %+v", body)
+	}
+	if doc.Components.SecuritySchemes["bearerAuth"] == nil {
+		t.Errorf("missing bearerAuth security scheme")
+	}
+
+	params := doc.Components.Schemas["openapi.Params"]
+	if !reflect.DeepEqual(params.Required, []string{"name"}) {
+		t.Errorf("required = %v, want [name]", params.Required)
+	}
+	for _, name := range []string{"name", "kind", "limit", "tags", "owner", "When"} {
+		if params.Properties[name] == nil {
+			t.Errorf("missing property %q", name)
+		}
+	}
+	if p := params.Properties["name"]; p.MaxLength == nil || *p.MaxLength != 20 {
+		t.Errorf("name schema = %+v", p)
+	}
+	if p := params.Properties["limit"]; p.Minimum == nil || *p.Minimum != 1 || *p.Maximum != 100 {
+		t.Errorf("limit schema = %+v", p)
+	}
+	if p := params.Properties["When"]; p.Format != "date-time" {
+		t.Errorf("When schema = %+v", p)
+	}
+	if p := params.Properties["owner"]; p.Ref != "#/components/schemas/openapi.User" {
+		t.Errorf("owner schema = %+v", p)
+	}
+	user := doc.Components.Schemas["openapi.User"]
+	if items := user.Properties["friends"].Items; items.Ref != "#/components/schemas/openapi.User" {
+		t.Errorf("recursive friends schema = %+v", items)
+	}
+
+	list := (*doc.Paths["/things"])["get"]
+	if list.RequestBody != nil || len(list.Parameters) != 6 {
+		t.Errorf("GET parameters = %d, body = %v; want 6 query params and no body", len(list.Parameters), list.RequestBody)
+	}
+
+	data, err := doc.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil || v["openapi"] != Version {
+		t.Errorf("JSON: got %v, err %v", v["openapi"], err)
+	}
+}
+
+type Upload struct {
+	Title string         `json:"title"`
+	Image *upload.File   `json:"image"`
+	Extra []*upload.File `json:"extra"`
+}
+
+func TestBuildUpload(t *testing.T) {
+	doc := Build(Info{}, nil, []Endpoint{
+		{Service: "svc", Name: "Upload", Path: "/upload", Methods: []string{"POST"},
+			Request: reflect.TypeOf(Upload{})},
+	})
+	body := (*doc.Paths["/upload"])["post"].RequestBody
+	mt := body.Content["multipart/form-data"]
+	if mt == nil {
+		t.Fatalf("request content = %v, want multipart/form-data", body.Content)
+	}
+	s := doc.Components.Schemas["openapi.Upload"]
+	if img := s.Properties["image"]; img.Type != "string" || img.Format != "binary" {
+		t.Errorf("image schema = %+v", img)
+	}
+	if extra := s.Properties["extra"]; extra.Type != "array" || extra.Items.Format != "binary" {
+		t.Errorf("extra schema = %+v", extra)
+	}
+}
+
+func TestConvertPath(t *testing.T) {
+	path, params := convertPath("/a/:b/c/*rest")
+	if path != "/a/{b}/c/{rest}" || len(params) != 2 || params[1].Name != "rest" {
+		t.Errorf("convertPath = %q, %+v", path, params)
+	}
+}
@@ -0,0 +1,281 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"runtime.encore.dev/internal/upload"
+	"runtime.encore.dev/internal/validate"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	fileType       = reflect.TypeOf(upload.File{})
+)
+
+// generator generates schemas, collecting the schemas
+// of named struct types as components.
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newGenerator() *generator {
+	return &generator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+// errorSchema returns a reference to the schema of error responses.
+func (g *generator) errorSchema() *Schema {
+	g.schemas["Error"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code":    {Type: "string"},
+			"message": {Type: "string"},
+			"details": {Type: "object", Nullable: true},
+		},
+		Required: []string{"code", "message"},
+	}
+	return &Schema{Ref: "#/components/schemas/Error"}
+}
+
+// hasFiles reports whether t, a request type, has fields
+// for uploaded files, making it a multipart/form-data request.
+func hasFiles(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i).Type
+		for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if ft == fileType {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	case fileType:
+		return &Schema{Type: "string", Format: "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if s.Ref != "" {
+			return s // nullable is ignored alongside $ref
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = g.componentName(t)
+			g.names[t] = name
+			g.schemas[name] = &Schema{} // placeholder for recursive types
+			g.schemas[name] = g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+// componentName returns a unique component name for a named type,
+// qualified by its package name.
+func (g *generator) componentName(t reflect.Type) string {
+	base := t.Name()
+	if pkg := t.PkgPath(); pkg != "" {
+		base = pkg[strings.LastIndexByte(pkg, '/')+1:] + "." + base
+	}
+	name := base
+	for i := 2; g.schemas[name] != nil; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	return name
+}
+
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.addFields(s, t)
+	return s
+}
+
+func (g *generator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := jsonName(f)
+		if !ok {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := g.schema(f.Type)
+		s.Properties[name] = fs
+		if applyRules(fs, f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// queryParams returns the fields of t, a struct, as query parameters.
+func (g *generator) queryParams(t reflect.Type) []*Parameter {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var params []*Parameter
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := jsonName(f)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := g.schema(f.Type)
+		required := applyRules(s, f.Tag.Get("validate"))
+		params = append(params, &Parameter{Name: name, In: "query", Required: required, Schema: s})
+	}
+	return params
+}
+
+// jsonName returns the JSON name of a field, which is empty if
+// the field has no name in its tag. It reports false if the field
+// is not encoded.
+func jsonName(f reflect.StructField) (name string, ok bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false // unexported
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	return strings.Split(tag, ",")[0], true
+}
+
+// applyRules applies the validation rules in tag to s,
+// reporting whether the field is required.
+func applyRules(s *Schema, tag string) (required bool) {
+	for _, r := range validate.SplitTag(tag) {
+		switch r.Name {
+		case "required":
+			required = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(r.Arg, 64)
+			if err != nil {
+				continue
+			}
+			isMin := r.Name == "min"
+			switch s.Type {
+			case "integer", "number":
+				if isMin {
+					s.Minimum = &n
+				} else {
+					s.Maximum = &n
+				}
+			case "string":
+				if isMin {
+					s.MinLength = intPtr(n)
+				} else {
+					s.MaxLength = intPtr(n)
+				}
+			case "array":
+				if isMin {
+					s.MinItems = intPtr(n)
+				} else {
+					s.MaxItems = intPtr(n)
+				}
+			}
+		case "enum":
+			for _, v := range strings.Split(r.Arg, "|") {
+				if n, err := strconv.ParseFloat(v, 64); err == nil && (s.Type == "integer" || s.Type == "number") {
+					s.Enum = append(s.Enum, n)
+				} else {
+					s.Enum = append(s.Enum, v)
+				}
+			}
+		case "regex":
+			s.Pattern = r.Arg
+		}
+	}
+	return required
+}
+
+func intPtr(n float64) *int {
+	i := int(n)
+	return &i
+}
@@ -0,0 +1,166 @@
+package otel
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// instrumentationName is the instrumentation scope of the spans.
+const instrumentationName = "runtime.encore.dev"
+
+// encodeRequest encodes an OTLP ExportTraceServiceRequest
+// in the protobuf wire format.
+//
+// The relevant parts of the schema (opentelemetry/proto/trace/v1) are:
+//
+//	ExportTraceServiceRequest { repeated ResourceSpans resource_spans = 1; }
+//	ResourceSpans { Resource resource = 1; repeated ScopeSpans scope_spans = 2; }
+//	Resource { repeated KeyValue attributes = 1; }
+//	ScopeSpans { InstrumentationScope scope = 1; repeated Span spans = 2; }
+//	InstrumentationScope { string name = 1; }
+//	Span {
+//	  bytes trace_id = 1; bytes span_id = 2; string trace_state = 3;
+//	  bytes parent_span_id = 4; string name = 5; SpanKind kind = 6;
+//	  fixed64 start_time_unix_nano = 7; fixed64 end_time_unix_nano = 8;
+//	  repeated KeyValue attributes = 9; Status status = 15;
+//	}
+//	Status { string message = 2; StatusCode code = 3; }
+//	KeyValue { string key = 1; AnyValue value = 2; }
+//	AnyValue {
+//	  oneof value { string string_value = 1; bool bool_value = 2;
+//	                int64 int_value = 3; double double_value = 4; }
+//	}
+func encodeRequest(resource []Attr, spans []*Span) []byte {
+	var res, scope, scopeSpans, resourceSpans, req buf
+
+	for _, a := range resource {
+		res.message(1, encodeKeyValue(a))
+	}
+
+	scope.string(1, instrumentationName)
+	scopeSpans.message(1, scope)
+	for _, s := range spans {
+		scopeSpans.message(2, encodeSpan(s))
+	}
+
+	resourceSpans.message(1, res)
+	resourceSpans.message(2, scopeSpans)
+	req.message(1, resourceSpans)
+	return req
+}
+
+func encodeSpan(s *Span) buf {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b buf
+	b.bytes(1, s.Context.TraceID[:])
+	b.bytes(2, s.Context.SpanID[:])
+	b.string(3, s.Context.TraceState)
+	if s.ParentID.IsValid() {
+		b.bytes(4, s.ParentID[:])
+	}
+	b.string(5, s.Name)
+	b.varint(6, uint64(s.Kind))
+	b.fixed64(7, uint64(s.Start.UnixNano()))
+	b.fixed64(8, uint64(s.end.UnixNano()))
+	for _, a := range s.attrs {
+		b.message(9, encodeKeyValue(a))
+	}
+	if s.status != StatusUnset {
+		var st buf
+		st.string(2, s.statusMsg)
+		st.varint(3, uint64(s.status))
+		b.message(15, st)
+	}
+	return b
+}
+
+func encodeKeyValue(a Attr) buf {
+	var val buf
+	switch v := a.Value.(type) {
+	case string:
+		val.string(1, v)
+	case bool:
+		var x uint64
+		if v {
+			x = 1
+		}
+		val.varint(2, x)
+	case int64:
+		val.varint(3, uint64(v))
+	case int:
+		val.varint(3, uint64(v))
+	case float64:
+		val.fixed64(4, math.Float64bits(v))
+	}
+
+	var kv buf
+	kv.string(1, a.Key)
+	kv.message(2, val)
+	return kv
+}
+
+// buf is a protobuf wire format encoder. Fields with
+// zero values are omitted, as in proto3.
+type buf []byte
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func (b *buf) tag(field, wireType int) {
+	*b = appendUvarint(*b, uint64(field)<<3|uint64(wireType))
+}
+
+func (b *buf) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireVarint)
+	*b = appendUvarint(*b, v)
+}
+
+func (b *buf) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireFixed64)
+	var x [8]byte
+	binary.LittleEndian.PutUint64(x[:], v)
+	*b = append(*b, x[:]...)
+}
+
+func (b *buf) bytes(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	b.tag(field, wireBytes)
+	*b = appendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *buf) string(field int, v string) {
+	if v == "" {
+		return
+	}
+	b.tag(field, wireBytes)
+	*b = appendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+// message encodes an embedded message. Unlike other fields,
+// empty messages are encoded, since their presence is significant.
+func (b *buf) message(field int, m buf) {
+	b.tag(field, wireBytes)
+	*b = appendUvarint(*b, uint64(len(m)))
+	*b = append(*b, m...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var x [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(x[:], v)
+	return append(b, x[:n]...)
+}
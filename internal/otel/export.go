@@ -0,0 +1,55 @@
+package otel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Exporter exports spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, resource []Attr, spans []*Span) error
+}
+
+// HTTPExporter exports spans using OTLP over HTTP, with protobuf encoding.
+type HTTPExporter struct {
+	// URL is the URL of the traces endpoint,
+	// such as "http://localhost:4318/v1/traces".
+	URL string
+
+	// Headers are additional headers to send, such as for authentication.
+	Headers map[string]string
+
+	// Client is the HTTP client to use. If nil http.DefaultClient is used.
+	Client *http.Client
+}
+
+func (e *HTTPExporter) Export(ctx context.Context, resource []Attr, spans []*Span) error {
+	body := encodeRequest(resource, spans)
+	req, err := http.NewRequestWithContext(ctx, "POST", e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp export: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: got status %s", resp.Status)
+	}
+	return nil
+}
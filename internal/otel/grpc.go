@@ -0,0 +1,68 @@
+package otel
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// exportMethod is the OTLP trace export gRPC method.
+const exportMethod = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+// GRPCExporter exports spans using OTLP over gRPC.
+type GRPCExporter struct {
+	conn    *grpc.ClientConn
+	headers metadata.MD
+}
+
+// NewGRPCExporter creates an exporter sending spans to the collector
+// at addr, such as "localhost:4317". If insecure is true the connection
+// does not use TLS. Headers are sent as request metadata.
+func NewGRPCExporter(addr string, insecure bool, headers map[string]string) (*GRPCExporter, error) {
+	opt := grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))
+	if insecure {
+		opt = grpc.WithInsecure()
+	}
+	conn, err := grpc.Dial(addr, opt)
+	if err != nil {
+		return nil, fmt.Errorf("otlp: dial %s: %v", addr, err)
+	}
+	return &GRPCExporter{conn: conn, headers: metadata.New(headers)}, nil
+}
+
+func (e *GRPCExporter) Export(ctx context.Context, resource []Attr, spans []*Span) error {
+	if len(e.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	}
+	req := rawMessage(encodeRequest(resource, spans))
+	var resp rawMessage
+	if err := e.conn.Invoke(ctx, exportMethod, &req, &resp, grpc.ForceCodec(rawCodec{})); err != nil {
+		return fmt.Errorf("otlp export: %v", err)
+	}
+	return nil
+}
+
+func (e *GRPCExporter) Close() error {
+	return e.conn.Close()
+}
+
+// rawMessage is a pre-encoded protobuf message.
+type rawMessage []byte
+
+// rawCodec is a gRPC codec passing pre-encoded protobuf messages through.
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "proto" }
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*rawMessage), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*rawMessage) = append((*v.(*rawMessage))[:0], data...)
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package otel implements OpenTelemetry tracing with export
+// to an OTLP collector over HTTP or gRPC.
+//
+// It implements the subset of the OpenTelemetry SDK the runtime needs,
+// without depending on it.
+package otel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) IsValid() bool  { return id != TraceID{} }
+func (id SpanID) IsValid() bool   { return id != SpanID{} }
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// NewTraceID returns a random trace id.
+func NewTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// NewSpanID returns a random span id.
+func NewSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string // W3C tracestate, passed through as is
+	Remote     bool   // whether the span context was propagated from a remote parent
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind is the kind of a span, using the OTLP enum values.
+type SpanKind int
+
+const (
+	Internal SpanKind = 1
+	Server   SpanKind = 2
+	Client   SpanKind = 3
+	Producer SpanKind = 4
+	Consumer SpanKind = 5
+)
+
+// StatusCode is the status of a span, using the OTLP enum values.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attr is a span attribute. The value is a string, bool, int64 or float64.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attr                            { return Attr{key, value} }
+func Bool(key string, value bool) Attr                         { return Attr{key, value} }
+func Int(key string, value int64) Attr                         { return Attr{key, value} }
+func Float(key string, value float64) Attr                     { return Attr{key, value} }
+func Stringer(key string, v interface{ String() string }) Attr { return Attr{key, v.String()} }
+
+// Span is a span being recorded. Its methods are safe for concurrent use,
+// and are no-ops on a nil *Span so callers need not check whether
+// tracing is enabled.
+type Span struct {
+	tracer *Tracer
+
+	Context  SpanContext
+	ParentID SpanID
+	Name     string
+	Kind     SpanKind
+	Start    time.Time
+
+	root bool // whether the span is the local root of its trace
+
+	mu        sync.Mutex
+	end       time.Time
+	attrs     []Attr
+	status    StatusCode
+	statusMsg string
+	ended     bool
+}
+
+// SpanContext reports the span context, or the zero
+// SpanContext if s is nil.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.Context
+}
+
+// SetAttrs sets attributes on the span.
+func (s *Span) SetAttrs(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// SetStatus sets the status of the span.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status, s.statusMsg = code, msg
+	s.mu.Unlock()
+}
+
+// End ends the span. If err is non-nil the span's status is set
+// to an error. Calls after the first have no effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	if err != nil {
+		s.status, s.statusMsg = StatusError, err.Error()
+	}
+	s.mu.Unlock()
+
+	s.tracer.ended(s)
+}
+
+// failed reports whether the span's status is an error.
+func (s *Span) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status == StatusError
+}
@@ -0,0 +1,144 @@
+package otel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// field is a decoded protobuf field.
+type field struct {
+	num   int
+	value uint64 // for varint and fixed64 fields
+	data  []byte // for length-delimited fields
+}
+
+// decode decodes a protobuf message into its fields.
+func decode(t *testing.T, b []byte) []field {
+	t.Helper()
+	var fields []field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		f := field{num: int(tag >> 3)}
+		switch tag & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case wireFixed64:
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			f.data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// get returns the fields with the given number.
+func get(fields []field, num int) []field {
+	var res []field
+	for _, f := range fields {
+		if f.num == num {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func TestEncodeRequest(t *testing.T) {
+	tr := &Tracer{}
+	parent := tr.Start(SpanContext{}, "parent", Server)
+	child := tr.Start(parent.SpanContext(), "child", Client, String("db.system", "postgresql"), Int("n", 3))
+	child.End(errors.New("boom"))
+
+	data := encodeRequest([]Attr{String("service.name", "svc")}, []*Span{child})
+	resourceSpans := decode(t, get(decode(t, data), 1)[0].data)
+
+	resource := decode(t, get(resourceSpans, 1)[0].data)
+	kv := decode(t, get(resource, 1)[0].data)
+	if key := string(get(kv, 1)[0].data); key != "service.name" {
+		t.Errorf("got resource attr %q, want service.name", key)
+	}
+
+	scopeSpans := decode(t, get(resourceSpans, 2)[0].data)
+	spans := get(scopeSpans, 2)
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := decode(t, spans[0].data)
+
+	if got := get(span, 1)[0].data; string(got) != string(parent.Context.TraceID[:]) {
+		t.Errorf("got trace id %x, want %x", got, parent.Context.TraceID)
+	}
+	if got := get(span, 4)[0].data; string(got) != string(parent.Context.SpanID[:]) {
+		t.Errorf("got parent span id %x, want %x", got, parent.Context.SpanID)
+	}
+	if got := string(get(span, 5)[0].data); got != "child" {
+		t.Errorf("got name %q, want child", got)
+	}
+	if got := get(span, 6)[0].value; got != uint64(Client) {
+		t.Errorf("got kind %d, want %d", got, Client)
+	}
+	if attrs := get(span, 9); len(attrs) != 2 {
+		t.Errorf("got %d attrs, want 2", len(attrs))
+	} else {
+		val := decode(t, get(decode(t, attrs[1].data), 2)[0].data)
+		if got := get(val, 3)[0].value; got != 3 {
+			t.Errorf("got int attr %d, want 3", got)
+		}
+	}
+	status := decode(t, get(span, 15)[0].data)
+	if msg, code := string(get(status, 2)[0].data), get(status, 3)[0].value; msg != "boom" || code != uint64(StatusError) {
+		t.Errorf("got status (%q, %d), want (boom, %d)", msg, code, StatusError)
+	}
+}
+
+type fakeExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *fakeExporter) Export(ctx context.Context, resource []Attr, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	exp := &fakeExporter{}
+	tr := NewTracer(Config{Exporter: exp})
+
+	root := tr.Start(SpanContext{}, "root", Server)
+	child := tr.Start(root.SpanContext(), "child", Internal)
+	if child.Context.TraceID != root.Context.TraceID || child.ParentID != root.Context.SpanID {
+		t.Errorf("child is not a child of root")
+	}
+	child.End(nil)
+	child.End(nil) // no-op
+	root.End(nil)
+
+	unsampled := tr.Start(SpanContext{TraceID: NewTraceID(), SpanID: NewSpanID()}, "unsampled", Server)
+	unsampled.End(nil)
+
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(exp.spans) != 2 {
+		t.Fatalf("got %d exported spans, want 2", len(exp.spans))
+	}
+
+	// Spans on a nil tracer are no-ops.
+	var nilTracer *Tracer
+	s := nilTracer.Start(SpanContext{}, "x", Internal)
+	s.SetAttrs(String("a", "b"))
+	s.End(nil)
+}
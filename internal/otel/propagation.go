@@ -0,0 +1,148 @@
+package otel
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Propagation formats.
+const (
+	TraceContext = "tracecontext" // W3C traceparent and tracestate headers
+	B3           = "b3"           // B3 single header
+	B3Multi      = "b3multi"      // B3 X-B3-* headers
+)
+
+// Extract extracts the span context propagated in h, trying the W3C
+// traceparent header, then the B3 single header, then the B3 multi headers.
+// It reports false if there is no valid span context.
+func Extract(h http.Header) (SpanContext, bool) {
+	if tp := h.Get("traceparent"); tp != "" {
+		if sc, ok := ParseTraceparent(tp); ok {
+			sc.TraceState = h.Get("tracestate")
+			return sc, true
+		}
+	}
+	if b3 := h.Get("b3"); b3 != "" {
+		if sc, ok := parseB3(b3); ok {
+			return sc, true
+		}
+	}
+	if tid := h.Get("X-B3-TraceId"); tid != "" {
+		sampled := h.Get("X-B3-Sampled")
+		if h.Get("X-B3-Flags") == "1" {
+			sampled = "d"
+		}
+		if sc, ok := b3Context(tid, h.Get("X-B3-SpanId"), sampled); ok {
+			return sc, true
+		}
+	}
+	return SpanContext{}, false
+}
+
+// Inject injects sc into h in the given formats.
+// Headers that are already set are left as is.
+func Inject(h http.Header, sc SpanContext, formats []string) {
+	if !sc.IsValid() {
+		return
+	}
+	setDefault := func(k, v string) {
+		if h.Get(k) == "" {
+			h.Set(k, v)
+		}
+	}
+	sampled := "0"
+	if sc.Sampled {
+		sampled = "1"
+	}
+	for _, f := range formats {
+		switch f {
+		case TraceContext:
+			setDefault("traceparent", FormatTraceparent(sc))
+			if sc.TraceState != "" {
+				setDefault("tracestate", sc.TraceState)
+			}
+		case B3:
+			setDefault("b3", sc.TraceID.String()+"-"+sc.SpanID.String()+"-"+sampled)
+		case B3Multi:
+			setDefault("X-B3-TraceId", sc.TraceID.String())
+			setDefault("X-B3-SpanId", sc.SpanID.String())
+			setDefault("X-B3-Sampled", sampled)
+		}
+	}
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	// version-traceid-spanid-flags, where future versions may append fields.
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	} else if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) ||
+		!decodeHex(flags[:], parts[3]) || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	sc.Remote = true
+	return sc, true
+}
+
+// FormatTraceparent formats sc as a W3C traceparent header value.
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// parseB3 parses a B3 single header value:
+// {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}, where the
+// last two fields are optional. A lone sampling state carries no
+// span context and is rejected.
+func parseB3(s string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 2 {
+		return SpanContext{}, false
+	}
+	sampled := ""
+	if len(parts) >= 3 {
+		sampled = parts[2]
+	}
+	return b3Context(parts[0], parts[1], sampled)
+}
+
+// b3Context creates a span context from B3 fields.
+// 64-bit trace ids are left-padded to 128 bits.
+func b3Context(traceID, spanID, sampled string) (SpanContext, bool) {
+	if len(traceID) == 16 {
+		traceID = "0000000000000000" + traceID
+	}
+	var sc SpanContext
+	if !decodeHex(sc.TraceID[:], traceID) || !decodeHex(sc.SpanID[:], spanID) || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	switch sampled {
+	case "1", "d", "true":
+		sc.Sampled = true
+	case "":
+		sc.Sampled = true // defer to us
+	}
+	sc.Remote = true
+	return sc, true
+}
+
+// decodeHex decodes a lowercase hex string of exactly len(dst) bytes.
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
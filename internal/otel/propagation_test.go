@@ -0,0 +1,107 @@
+package otel
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		ok, sampled bool
+		traceID     string
+	}{
+		{
+			name:    "traceparent",
+			headers: map[string]string{"traceparent": "00-" + traceID + "-" + spanID + "-01", "tracestate": "a=b"},
+			ok:      true, sampled: true, traceID: traceID,
+		},
+		{
+			name:    "traceparent not sampled",
+			headers: map[string]string{"traceparent": "00-" + traceID + "-" + spanID + "-00"},
+			ok:      true, sampled: false, traceID: traceID,
+		},
+		{
+			name:    "traceparent future version",
+			headers: map[string]string{"traceparent": "01-" + traceID + "-" + spanID + "-01-extra"},
+			ok:      true, sampled: true, traceID: traceID,
+		},
+		{name: "traceparent invalid version", headers: map[string]string{"traceparent": "ff-" + traceID + "-" + spanID + "-01"}},
+		{name: "traceparent zero trace id", headers: map[string]string{"traceparent": "00-00000000000000000000000000000000-" + spanID + "-01"}},
+		{name: "traceparent uppercase", headers: map[string]string{"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01"}},
+		{
+			name:    "b3 single",
+			headers: map[string]string{"b3": traceID + "-" + spanID + "-1"},
+			ok:      true, sampled: true, traceID: traceID,
+		},
+		{
+			name:    "b3 single 64-bit",
+			headers: map[string]string{"b3": "a3ce929d0e0e4736-" + spanID + "-0"},
+			ok:      true, sampled: false, traceID: "0000000000000000a3ce929d0e0e4736",
+		},
+		{name: "b3 sampling only", headers: map[string]string{"b3": "0"}},
+		{
+			name:    "b3 multi",
+			headers: map[string]string{"X-B3-TraceId": traceID, "X-B3-SpanId": spanID, "X-B3-Flags": "1"},
+			ok:      true, sampled: true, traceID: traceID,
+		},
+		{name: "none"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := make(http.Header)
+			for k, v := range test.headers {
+				h.Set(k, v)
+			}
+			sc, ok := Extract(h)
+			if ok != test.ok {
+				t.Fatalf("got ok=%v, want %v", ok, test.ok)
+			} else if !ok {
+				return
+			}
+			if sc.TraceID.String() != test.traceID || sc.SpanID.String() != spanID {
+				t.Errorf("got %s/%s, want %s/%s", sc.TraceID, sc.SpanID, test.traceID, spanID)
+			}
+			if sc.Sampled != test.sampled {
+				t.Errorf("got sampled=%v, want %v", sc.Sampled, test.sampled)
+			}
+			if !sc.Remote {
+				t.Errorf("got remote=false")
+			}
+			if ts := test.headers["tracestate"]; sc.TraceState != ts {
+				t.Errorf("got tracestate %q, want %q", sc.TraceState, ts)
+			}
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	sc := SpanContext{TraceID: NewTraceID(), SpanID: NewSpanID(), Sampled: true, TraceState: "a=b"}
+	h := make(http.Header)
+	h.Set("b3", "existing")
+	Inject(h, sc, []string{TraceContext, B3, B3Multi})
+
+	if got, want := h.Get("traceparent"), FormatTraceparent(sc); got != want {
+		t.Errorf("got traceparent %q, want %q", got, want)
+	}
+	if got := h.Get("tracestate"); got != "a=b" {
+		t.Errorf("got tracestate %q, want a=b", got)
+	}
+	if got := h.Get("b3"); got != "existing" {
+		t.Errorf("existing b3 header was overwritten: %q", got)
+	}
+	if got := h.Get("X-B3-SpanId"); got != sc.SpanID.String() {
+		t.Errorf("got X-B3-SpanId %q, want %q", got, sc.SpanID)
+	}
+
+	// Round trip.
+	got, ok := Extract(h)
+	if !ok || got.TraceID != sc.TraceID || got.SpanID != sc.SpanID || !got.Sampled {
+		t.Errorf("Extract(Inject(sc)) = %+v, %v; want %+v", got, ok, sc)
+	}
+}
@@ -0,0 +1,99 @@
+package otel
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+// Sampler decides whether to sample a new trace.
+type Sampler interface {
+	Sample(traceID TraceID) bool
+}
+
+type alwaysSample struct{}
+
+func (alwaysSample) Sample(TraceID) bool { return true }
+
+// AlwaysSample samples all traces.
+var AlwaysSample Sampler = alwaysSample{}
+
+type neverSample struct{}
+
+func (neverSample) Sample(TraceID) bool { return false }
+
+// NeverSample samples no traces.
+var NeverSample Sampler = neverSample{}
+
+// Probability samples the given fraction of traces, between 0 and 1.
+// The decision is derived from the trace id, so it is consistent
+// across services using the same probability.
+func Probability(p float64) Sampler {
+	switch {
+	case p >= 1:
+		return AlwaysSample
+	case p <= 0:
+		return NeverSample
+	}
+	return probability{bound: uint64(p * (1 << 63))}
+}
+
+type probability struct{ bound uint64 }
+
+func (s probability) Sample(id TraceID) bool {
+	return binary.BigEndian.Uint64(id[8:])>>1 < s.bound
+}
+
+// RateLimited samples at most perSecond traces per second,
+// allowing bursts of up to perSecond traces (and at least one).
+func RateLimited(perSecond float64) Sampler {
+	return &rateLimited{
+		rate:   perSecond,
+		burst:  math.Max(1, perSecond),
+		tokens: math.Max(1, perSecond),
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+type rateLimited struct {
+	rate, burst float64
+	now         func() time.Time // for testing
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (s *rateLimited) Sample(TraceID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if elapsed := now.Sub(s.last); elapsed > 0 {
+		s.tokens = math.Min(s.burst, s.tokens+elapsed.Seconds()*s.rate)
+		s.last = now
+	}
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// All samples traces sampled by all the given samplers, which are
+// consulted in order until one declines.
+func All(samplers ...Sampler) Sampler {
+	return all(samplers)
+}
+
+type all []Sampler
+
+func (s all) Sample(id TraceID) bool {
+	for _, x := range s {
+		if !x.Sample(id) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProbability(t *testing.T) {
+	s := Probability(0.25)
+	n := 0
+	for i := 0; i < 10000; i++ {
+		if s.Sample(NewTraceID()) {
+			n++
+		}
+	}
+	if n < 2000 || n > 3000 {
+		t.Errorf("sampled %d/10000 traces, want about 2500", n)
+	}
+
+	id := NewTraceID()
+	if s.Sample(id) != s.Sample(id) {
+		t.Errorf("sampling is not deterministic")
+	}
+	if Probability(0).Sample(id) || !Probability(1).Sample(id) {
+		t.Errorf("got wrong decision for probability 0 or 1")
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	now := time.Now()
+	s := RateLimited(2).(*rateLimited)
+	s.now = func() time.Time { return now }
+	s.last = now
+
+	sampled := func(n int) int {
+		res := 0
+		for i := 0; i < n; i++ {
+			if s.Sample(TraceID{}) {
+				res++
+			}
+		}
+		return res
+	}
+	if n := sampled(5); n != 2 {
+		t.Errorf("got %d sampled in burst, want 2", n)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if n := sampled(5); n != 1 {
+		t.Errorf("got %d sampled after 500ms, want 1", n)
+	}
+}
+
+func TestSampleErrors(t *testing.T) {
+	exp := &fakeExporter{}
+	tr := NewTracer(Config{Exporter: exp, Sampler: NeverSample, SampleErrors: true})
+
+	// A successful unsampled trace is dropped.
+	root := tr.Start(SpanContext{}, "ok", Server)
+	tr.Start(root.SpanContext(), "child", Internal).End(nil)
+	root.End(nil)
+
+	// A failed unsampled trace is exported, including its children.
+	root = tr.Start(SpanContext{}, "failed", Server)
+	tr.Start(root.SpanContext(), "child", Internal).End(nil)
+	root.End(errors.New("boom"))
+
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(exp.spans) != 2 {
+		t.Fatalf("got %d exported spans, want 2", len(exp.spans))
+	}
+	for _, s := range exp.spans {
+		if s.Context.TraceID != root.Context.TraceID {
+			t.Errorf("exported span %q of unexpected trace", s.Name)
+		}
+	}
+	if len(tr.pending) != 0 {
+		t.Errorf("got %d pending traces, want 0", len(tr.pending))
+	}
+}
@@ -0,0 +1,217 @@
+package otel
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Default batching parameters.
+const (
+	defaultQueueSize    = 2048
+	defaultBatchSize    = 512
+	defaultBatchTimeout = 5 * time.Second
+	exportTimeout       = 10 * time.Second
+)
+
+type Config struct {
+	// Exporter exports finished spans.
+	Exporter Exporter
+
+	// Resource are attributes describing the process, such as "service.name".
+	Resource []Attr
+
+	// Sampler decides whether to sample traces started by the tracer.
+	// Traces continued from a remote parent follow the parent's decision.
+	// If nil all traces are sampled.
+	Sampler Sampler
+
+	// SampleErrors exports traces that are not sampled if their local
+	// root span fails. Spans of unsampled traces are buffered until
+	// the local root span ends.
+	SampleErrors bool
+
+	// OnError is called when exporting fails. It may be nil.
+	OnError func(err error)
+}
+
+// Limits on buffering spans of unsampled traces.
+const (
+	maxPendingTraces = 10000
+	maxPendingSpans  = 256 // per trace
+)
+
+// Tracer starts spans and exports them in batches
+// once they have ended. It is safe for concurrent use.
+type Tracer struct {
+	cfg   Config
+	queue chan *Span
+
+	mu      sync.Mutex
+	pending map[TraceID][]*Span // ended spans of unsampled traces
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewTracer creates a tracer and starts its export loop.
+func NewTracer(cfg Config) *Tracer {
+	t := &Tracer{
+		cfg:     cfg,
+		queue:   make(chan *Span, defaultQueueSize),
+		pending: make(map[TraceID][]*Span),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// Start starts a span. If parent is valid the span is its child,
+// otherwise the span starts a new trace, sampled by the tracer's sampler.
+func (t *Tracer) Start(parent SpanContext, name string, kind SpanKind, attrs ...Attr) *Span {
+	if t == nil {
+		return nil
+	}
+	return t.StartWith(nil, parent, name, kind, attrs...)
+}
+
+// StartWith is like Start but samples new traces using sampler.
+// If sampler is nil the tracer's sampler is used.
+func (t *Tracer) StartWith(sampler Sampler, parent SpanContext, name string, kind SpanKind, attrs ...Attr) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{
+		tracer: t,
+		Name:   name,
+		Kind:   kind,
+		Start:  time.Now(),
+		attrs:  attrs,
+	}
+	if parent.IsValid() {
+		s.Context = SpanContext{
+			TraceID:    parent.TraceID,
+			SpanID:     NewSpanID(),
+			Sampled:    parent.Sampled,
+			TraceState: parent.TraceState,
+		}
+		s.ParentID = parent.SpanID
+		s.root = parent.Remote
+	} else {
+		if sampler == nil {
+			sampler = t.cfg.Sampler
+		}
+		traceID := NewTraceID()
+		s.Context = SpanContext{
+			TraceID: traceID,
+			SpanID:  NewSpanID(),
+			Sampled: sampler == nil || sampler.Sample(traceID),
+		}
+		s.root = true
+	}
+	return s
+}
+
+// ended handles a span that has ended.
+func (t *Tracer) ended(s *Span) {
+	if s.Context.Sampled {
+		t.enqueue(s)
+	} else if t.cfg.SampleErrors {
+		t.endedUnsampled(s)
+	}
+}
+
+// endedUnsampled buffers the spans of an unsampled trace until its
+// local root span ends, and exports them if the root span failed.
+func (t *Tracer) endedUnsampled(s *Span) {
+	id := s.Context.TraceID
+	t.mu.Lock()
+	if !s.root {
+		if spans, ok := t.pending[id]; (ok || len(t.pending) < maxPendingTraces) && len(spans) < maxPendingSpans {
+			t.pending[id] = append(spans, s)
+		}
+		t.mu.Unlock()
+		return
+	}
+	spans := t.pending[id]
+	delete(t.pending, id)
+	t.mu.Unlock()
+
+	if s.failed() {
+		for _, c := range spans {
+			t.enqueue(c)
+		}
+		t.enqueue(s)
+	}
+}
+
+// enqueue queues an ended span for export,
+// dropping it if the queue is full.
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+	}
+}
+
+func (t *Tracer) loop() {
+	defer close(t.done)
+	ticker := time.NewTicker(defaultBatchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, defaultBatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			t.export(batch)
+			batch = make([]*Span, 0, defaultBatchSize)
+		}
+	}
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= defaultBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+					if len(batch) >= defaultBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) export(spans []*Span) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	if err := t.cfg.Exporter.Export(ctx, t.cfg.Resource, spans); err != nil && t.cfg.OnError != nil {
+		t.cfg.OnError(err)
+	}
+}
+
+// Shutdown exports any queued spans and stops the tracer.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() { close(t.stop) })
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,136 @@
+// Package pagination implements opaque pagination cursors,
+// signed so that clients cannot forge them.
+package pagination
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// ErrInvalidCursor is returned when decoding a cursor
+// that is malformed or has an invalid signature.
+var ErrInvalidCursor = errors.New("pagination: invalid cursor")
+
+// macSize is the size of the truncated HMAC-SHA256 cursor signature.
+const macSize = 16
+
+// Config configures cursors and page sizes.
+type Config struct {
+	// Key is the key cursors are signed with.
+	// If empty cursors are not signed.
+	Key []byte
+
+	// DefaultSize and MaxSize are the default and
+	// maximum page sizes used by Size.
+	DefaultSize int
+	MaxSize     int
+}
+
+const (
+	defaultSize    = 50
+	defaultMaxSize = 1000
+)
+
+var (
+	mu  sync.RWMutex
+	cfg = Config{DefaultSize: defaultSize, MaxSize: defaultMaxSize}
+)
+
+// Configure sets the configuration. It is called by the runtime during setup.
+func Configure(c Config) {
+	if c.MaxSize <= 0 {
+		c.MaxSize = defaultMaxSize
+	}
+	if c.DefaultSize <= 0 {
+		c.DefaultSize = defaultSize
+	}
+	if c.DefaultSize > c.MaxSize {
+		c.DefaultSize = c.MaxSize
+	}
+	mu.Lock()
+	cfg = c
+	mu.Unlock()
+}
+
+func config() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return cfg
+}
+
+// Encode encodes v as JSON into an opaque cursor.
+func Encode(v interface{}) (string, error) {
+	return encode(config().Key, v)
+}
+
+// Decode decodes a cursor created by Encode into dst.
+// It returns ErrInvalidCursor if the cursor is malformed or was
+// not signed with the configured key.
+func Decode(cursor string, dst interface{}) error {
+	return decode(config().Key, cursor, dst)
+}
+
+// Size returns the page size to use for a requested size: the
+// default size if requested is not positive, and at most the
+// maximum size.
+func Size(requested int) int {
+	c := config()
+	return Clamp(requested, c.DefaultSize, c.MaxSize)
+}
+
+// Clamp returns def if requested is not positive,
+// and otherwise requested capped to max.
+func Clamp(requested, def, max int) int {
+	switch {
+	case requested <= 0:
+		return def
+	case requested > max:
+		return max
+	}
+	return requested
+}
+
+func encode(key []byte, v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	if len(key) > 0 {
+		data = append(data, sign(key, data)...)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decode(key []byte, cursor string, dst interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if len(key) > 0 {
+		if len(data) < macSize {
+			return ErrInvalidCursor
+		}
+		n := len(data) - macSize
+		if !hmac.Equal(data[n:], sign(key, data[:n])) {
+			return ErrInvalidCursor
+		}
+		data = data[:n]
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(dst); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+func sign(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)[:macSize]
+}
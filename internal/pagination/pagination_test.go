@@ -0,0 +1,86 @@
+package pagination
+
+import (
+	"testing"
+)
+
+type cursor struct {
+	ID    int64  `json:"id"`
+	After string `json:"after"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("secret")} {
+		want := cursor{ID: 42, After: "2021-01-01"}
+		s, err := encode(key, want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got cursor
+		if err := decode(key, s, &got); err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		if got != want {
+			t.Errorf("key %q: got %+v, want %+v", key, got, want)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	key := []byte("secret")
+	s, err := encode(key, cursor{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := encode(nil, cursor{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := []byte(s)
+	tampered[2] ^= 1
+
+	tests := []struct {
+		name   string
+		key    string
+		cursor string
+	}{
+		{"other key", "other", s},
+		{"tampered", "secret", string(tampered)},
+		{"unsigned", "secret", unsigned},
+		{"short", "secret", "e30"},
+		{"not base64", "secret", "!!"},
+		{"not json", "", "bm90IGpzb24"},
+	}
+	for _, test := range tests {
+		var c cursor
+		if err := decode([]byte(test.key), test.cursor, &c); err != ErrInvalidCursor {
+			t.Errorf("%s: got err %v, want ErrInvalidCursor", test.name, err)
+		}
+	}
+}
+
+func TestClamp(t *testing.T) {
+	tests := []struct{ requested, want int }{
+		{-1, 10}, {0, 10}, {5, 5}, {100, 100}, {101, 100},
+	}
+	for _, test := range tests {
+		if got := Clamp(test.requested, 10, 100); got != test.want {
+			t.Errorf("Clamp(%d) = %d, want %d", test.requested, got, test.want)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer Configure(Config{})
+	Configure(Config{DefaultSize: 500, MaxSize: 200})
+	if got := Size(0); got != 200 {
+		t.Errorf("Size(0) = %d, want default capped to 200", got)
+	}
+	Configure(Config{})
+	if got := Size(0); got != defaultSize {
+		t.Errorf("Size(0) = %d, want %d", got, defaultSize)
+	}
+	if got := Size(1e6); got != defaultMaxSize {
+		t.Errorf("Size(1e6) = %d, want %d", got, defaultMaxSize)
+	}
+}
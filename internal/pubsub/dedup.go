@@ -0,0 +1,141 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"runtime.encore.dev/internal/redis"
+)
+
+// DedupStore records the messages processed by subscriptions, so
+// redelivered and republished messages are only processed once.
+type DedupStore interface {
+	// Claim claims key for processing until lease elapses. It reports
+	// whether key was claimed and, if not, whether it has already
+	// been processed rather than being claimed by another receiver.
+	Claim(ctx context.Context, key string, lease time.Duration) (claimed, processed bool, err error)
+
+	// Complete marks key as processed, remembering it for window.
+	Complete(ctx context.Context, key string, window time.Duration) error
+
+	// Release releases the claim on key, so it can be claimed again.
+	Release(ctx context.Context, key string) error
+}
+
+// dedupSweepInterval is how often MemoryDedupStore removes expired keys.
+const dedupSweepInterval = time.Minute
+
+// MemoryDedupStore is an in-memory DedupStore.
+type MemoryDedupStore struct {
+	mu        sync.Mutex
+	keys      map[string]dedupEntry
+	lastSweep time.Time
+
+	now func() time.Time // for testing
+}
+
+type dedupEntry struct {
+	processed bool
+	expires   time.Time
+}
+
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{keys: make(map[string]dedupEntry), now: time.Now}
+}
+
+func (s *MemoryDedupStore) Claim(ctx context.Context, key string, lease time.Duration) (claimed, processed bool, err error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	if e, ok := s.keys[key]; ok && now.Before(e.expires) {
+		return false, e.processed, nil
+	}
+	s.keys[key] = dedupEntry{expires: now.Add(lease)}
+	return true, false, nil
+}
+
+func (s *MemoryDedupStore) Complete(ctx context.Context, key string, window time.Duration) error {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = dedupEntry{processed: true, expires: now.Add(window)}
+	return nil
+}
+
+func (s *MemoryDedupStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.keys[key]; ok && !e.processed {
+		delete(s.keys, key)
+	}
+	return nil
+}
+
+// sweep removes expired keys, at most once per dedupSweepInterval.
+// s.mu must be held.
+func (s *MemoryDedupStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < dedupSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.keys {
+		if !now.Before(e.expires) {
+			delete(s.keys, key)
+		}
+	}
+}
+
+// RedisDedupStore is a DedupStore backed by Redis, for sharing
+// processed messages between multiple instances.
+//
+// Each key is stored with the value "claimed" or "processed",
+// expiring at the end of its lease or window.
+type RedisDedupStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisDedupStore(client *redis.Client, keyPrefix string) *RedisDedupStore {
+	return &RedisDedupStore{client: client, prefix: keyPrefix}
+}
+
+// claimScript claims the key if it is unset, and otherwise returns its value.
+const claimScript = `
+if redis.call("SET", KEYS[1], "claimed", "NX", "PX", ARGV[1]) then
+	return false
+end
+return redis.call("GET", KEYS[1])
+`
+
+func (s *RedisDedupStore) Claim(ctx context.Context, key string, lease time.Duration) (claimed, processed bool, err error) {
+	reply, err := s.client.Do(ctx, "EVAL", claimScript, 1, s.prefix+key, lease.Milliseconds())
+	if err == redis.Nil {
+		return true, false, nil
+	}
+	val, err := redis.String(reply, err)
+	if err != nil {
+		return false, false, err
+	}
+	return false, val == "processed", nil
+}
+
+func (s *RedisDedupStore) Complete(ctx context.Context, key string, window time.Duration) error {
+	_, err := s.client.Do(ctx, "SET", s.prefix+key, "processed", "PX", window.Milliseconds())
+	return err
+}
+
+// releaseScript deletes the key unless it has been processed.
+const releaseScript = `
+if redis.call("GET", KEYS[1]) == "claimed" then
+	redis.call("DEL", KEYS[1])
+end
+return 1
+`
+
+func (s *RedisDedupStore) Release(ctx context.Context, key string) error {
+	_, err := s.client.Do(ctx, "EVAL", releaseScript, 1, s.prefix+key)
+	return err
+}
@@ -0,0 +1,41 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	s := NewMemoryDedupStore()
+	s.now = func() time.Time { return now }
+
+	check := func(key string, wantClaimed, wantProcessed bool) {
+		t.Helper()
+		claimed, processed, err := s.Claim(ctx, key, time.Minute)
+		if err != nil || claimed != wantClaimed || processed != wantProcessed {
+			t.Fatalf("Claim(%q) = %v, %v, %v, want %v, %v", key, claimed, processed, err, wantClaimed, wantProcessed)
+		}
+	}
+
+	check("a", true, false)
+	check("a", false, false) // claimed by another receiver
+
+	// Released keys can be claimed again.
+	s.Release(ctx, "a")
+	check("a", true, false)
+
+	// Processed keys are remembered for the window, and not released.
+	s.Complete(ctx, "a", time.Hour)
+	s.Release(ctx, "a")
+	check("a", false, true)
+	now = now.Add(time.Hour)
+	check("a", true, false)
+
+	// Claims expire with their lease.
+	check("b", true, false)
+	now = now.Add(time.Minute)
+	check("b", true, false)
+}
@@ -0,0 +1,281 @@
+package pubsub
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBroker is an in-memory Broker. Messages are
+// neither shared between processes nor persisted.
+type MemoryBroker struct {
+	mu     sync.Mutex
+	topics map[string][]*memSub // subscriptions by topic
+	subs   map[subKey]*memSub
+
+	now func() time.Time // for testing
+}
+
+type subKey struct{ topic, sub string }
+
+// memSub is a subscription of the memory broker.
+type memSub struct {
+	queue  entryQueue
+	byID   map[string]*memEntry
+	keyed  map[string][]*memEntry // pending entries by ordering key
+	seq    uint64
+	notify chan struct{} // closed when a message may have become available
+}
+
+type memEntry struct {
+	msg      Message
+	visible  time.Time // when the message can next be received
+	attempts int
+	seq      uint64 // for ordering entries visible at the same time
+	index    int    // index in the queue, or -1 if not queued
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics: make(map[string][]*memSub),
+		subs:   make(map[subKey]*memSub),
+		now:    time.Now,
+	}
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, topic, sub string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := subKey{topic, sub}
+	if _, ok := b.subs[key]; ok {
+		return nil
+	}
+	s := &memSub{
+		byID:   make(map[string]*memEntry),
+		keyed:  make(map[string][]*memEntry),
+		notify: make(chan struct{}),
+	}
+	b.subs[key] = s
+	b.topics[topic] = append(b.topics[topic], s)
+	return nil
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, msg *Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	visible := visibleAt(msg, b.now())
+	for _, s := range b.topics[topic] {
+		s.add(msg, visible)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) PublishTo(ctx context.Context, topic, sub string, msg *Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.subs[subKey{topic, sub}]
+	if !ok {
+		return ErrUnknownSubscription
+	}
+	s.add(msg, visibleAt(msg, b.now()))
+	return nil
+}
+
+// add adds msg to the subscription, visible at the given time.
+// Messages with an ordering key are only queued once the messages
+// with the same key added before them are acknowledged.
+// b.mu must be held.
+func (s *memSub) add(msg *Message, visible time.Time) {
+	if _, ok := s.byID[msg.ID]; ok {
+		return
+	}
+	s.seq++
+	e := &memEntry{msg: *msg, visible: visible, seq: s.seq, index: -1}
+	s.byID[msg.ID] = e
+	if k := msg.OrderingKey; k != "" {
+		s.keyed[k] = append(s.keyed[k], e)
+		if len(s.keyed[k]) > 1 {
+			return
+		}
+	}
+	heap.Push(&s.queue, e)
+	s.signal()
+}
+
+// remove removes e from the subscription, queuing the next
+// message with the same ordering key, if any. b.mu must be held.
+func (s *memSub) remove(e *memEntry, now time.Time) {
+	if e.index >= 0 {
+		heap.Remove(&s.queue, e.index)
+	}
+	delete(s.byID, e.msg.ID)
+
+	k := e.msg.OrderingKey
+	if k == "" {
+		return
+	}
+	pending := s.keyed[k]
+	for i, p := range pending {
+		if p == e {
+			pending = append(pending[:i], pending[i+1:]...)
+			break
+		}
+	}
+	if len(pending) == 0 {
+		delete(s.keyed, k)
+		return
+	}
+	s.keyed[k] = pending
+	// The next message keeps its visibility time if it is delayed.
+	if next := pending[0]; next.index < 0 {
+		if next.visible.Before(now) {
+			next.visible = now
+		}
+		heap.Push(&s.queue, next)
+		s.signal()
+	}
+}
+
+// signal wakes up receivers. b.mu must be held.
+func (s *memSub) signal() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+func (b *MemoryBroker) Receive(ctx context.Context, topic, sub string, ackDeadline time.Duration) (*Message, error) {
+	for {
+		msg, notify, wait, err := b.receive(topic, sub, ackDeadline)
+		if msg != nil || err != nil {
+			return msg, err
+		}
+		if err := waitFor(ctx, notify, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (b *MemoryBroker) TryReceive(ctx context.Context, topic, sub string, ackDeadline time.Duration) (*Message, error) {
+	msg, _, _, err := b.receive(topic, sub, ackDeadline)
+	return msg, err
+}
+
+// receive leases the next visible message of the subscription.
+// If there is none it returns a channel closed when one may have
+// become available, and how long until the next message becomes
+// visible, or -1 if there are no messages.
+func (b *MemoryBroker) receive(topic, sub string, ackDeadline time.Duration) (msg *Message, notify <-chan struct{}, wait time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.subs[subKey{topic, sub}]
+	if !ok {
+		return nil, nil, 0, ErrUnknownSubscription
+	}
+	now := b.now()
+	wait = -1
+	if len(s.queue) > 0 {
+		e := s.queue[0]
+		if !e.visible.After(now) {
+			e.attempts++
+			e.visible = now.Add(ackDeadline)
+			heap.Fix(&s.queue, e.index)
+			m := e.msg
+			m.Attempt = e.attempts
+			return &m, nil, 0, nil
+		}
+		wait = e.visible.Sub(now)
+	}
+	return nil, s.notify, wait, nil
+}
+
+// waitFor waits until notify is closed, the wait duration has
+// elapsed if it is not negative, or ctx is done.
+func waitFor(ctx context.Context, notify <-chan struct{}, wait time.Duration) error {
+	var timeout <-chan time.Time
+	if wait >= 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-notify:
+		return nil
+	case <-timeout:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *MemoryBroker) Ack(ctx context.Context, topic, sub, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.subs[subKey{topic, sub}]
+	if !ok {
+		return ErrUnknownSubscription
+	}
+	if e, ok := s.byID[id]; ok {
+		s.remove(e, b.now())
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Nack(ctx context.Context, topic, sub, id string, delay time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.subs[subKey{topic, sub}]
+	if !ok {
+		return ErrUnknownSubscription
+	}
+	if e, ok := s.byID[id]; ok {
+		e.visible = b.now().Add(delay)
+		if e.index >= 0 {
+			heap.Fix(&s.queue, e.index)
+			s.signal()
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Depth(ctx context.Context, topic, sub string) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.subs[subKey{topic, sub}]
+	if !ok {
+		return 0, ErrUnknownSubscription
+	}
+	return int64(len(s.byID)), nil
+}
+
+// entryQueue is a heap of entries ordered by visibility time.
+type entryQueue []*memEntry
+
+func (q entryQueue) Len() int { return len(q) }
+
+func (q entryQueue) Less(i, j int) bool {
+	if !q[i].visible.Equal(q[j].visible) {
+		return q[i].visible.Before(q[j].visible)
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q entryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *entryQueue) Push(x interface{}) {
+	e := x.(*memEntry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *entryQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	e.index = -1
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
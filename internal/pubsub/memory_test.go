@@ -0,0 +1,222 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBroker()
+	b.Subscribe(ctx, "topic", "a")
+	b.Subscribe(ctx, "topic", "b")
+	b.Publish(ctx, "topic", &Message{ID: "1", Data: []byte("one")})
+	b.Publish(ctx, "topic", &Message{ID: "2", Data: []byte("two")})
+	b.Publish(ctx, "other", &Message{ID: "3"})
+
+	// Each subscription gets every message, in order.
+	for _, sub := range []string{"a", "b"} {
+		for _, want := range []string{"1", "2"} {
+			msg := receive(t, b, sub, time.Minute)
+			if msg.ID != want || msg.Attempt != 1 {
+				t.Fatalf("sub %s: got message %s attempt %d, want %s attempt 1", sub, msg.ID, msg.Attempt, want)
+			}
+		}
+	}
+
+	// Leased messages are not received again until acked or nacked.
+	b.Ack(ctx, "topic", "a", "1")
+	b.Nack(ctx, "topic", "a", "2", 0)
+	if msg := receive(t, b, "a", time.Minute); msg.ID != "2" || msg.Attempt != 2 {
+		t.Fatalf("got message %s attempt %d, want 2 attempt 2", msg.ID, msg.Attempt)
+	}
+	b.Ack(ctx, "topic", "a", "2")
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if msg, err := b.Receive(ctx2, "topic", "a", time.Minute); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, %v, want no message", msg, err)
+	}
+}
+
+func TestMemoryBrokerRedelivery(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBroker()
+	b.Subscribe(ctx, "topic", "sub")
+	b.Publish(ctx, "topic", &Message{ID: "1"})
+
+	receive(t, b, "sub", 20*time.Millisecond)
+	// The message is redelivered once the ack deadline passes.
+	start := time.Now()
+	msg := receive(t, b, "sub", time.Minute)
+	if msg.Attempt != 2 {
+		t.Errorf("got attempt %d, want 2", msg.Attempt)
+	}
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("redelivered after %v, want after ack deadline", d)
+	}
+}
+
+func TestMemoryBrokerWakeUp(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBroker()
+	b.Subscribe(ctx, "topic", "sub")
+
+	got := make(chan *Message)
+	go func() {
+		msg, _ := b.Receive(ctx, "topic", "sub", time.Minute)
+		got <- msg
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b.Publish(ctx, "topic", &Message{ID: "1"})
+	select {
+	case msg := <-got:
+		if msg.ID != "1" {
+			t.Errorf("got message %s, want 1", msg.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("receiver was not woken up")
+	}
+}
+
+func TestMemoryBrokerPublishTo(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBroker()
+	b.Subscribe(ctx, "topic", "a")
+	b.Subscribe(ctx, "topic", "b")
+	b.PublishTo(ctx, "topic", "b", &Message{ID: "1"})
+
+	if msg, err := b.TryReceive(ctx, "topic", "a", time.Minute); msg != nil || err != nil {
+		t.Fatalf("sub a: got %v, %v, want no message", msg, err)
+	}
+	if n, _ := b.Depth(ctx, "topic", "b"); n != 1 {
+		t.Fatalf("got depth %d, want 1", n)
+	}
+	msg, err := b.TryReceive(ctx, "topic", "b", time.Minute)
+	if err != nil || msg == nil || msg.ID != "1" {
+		t.Fatalf("sub b: got %v, %v, want message 1", msg, err)
+	}
+
+	// Leased messages count towards the depth until acked.
+	if n, _ := b.Depth(ctx, "topic", "b"); n != 1 {
+		t.Fatalf("got depth %d, want 1", n)
+	}
+	b.Ack(ctx, "topic", "b", "1")
+	if n, _ := b.Depth(ctx, "topic", "b"); n != 0 {
+		t.Fatalf("got depth %d, want 0", n)
+	}
+
+	// Acked messages can be published again, starting over.
+	b.PublishTo(ctx, "topic", "b", &Message{ID: "1"})
+	if msg := receive(t, b, "b", time.Minute); msg.ID != "1" || msg.Attempt != 1 {
+		t.Fatalf("got message %s attempt %d, want 1 attempt 1", msg.ID, msg.Attempt)
+	}
+}
+
+func TestMemoryBrokerOrdering(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBroker()
+	b.Subscribe(ctx, "topic", "sub")
+	b.Publish(ctx, "topic", &Message{ID: "a1", OrderingKey: "a"})
+	b.Publish(ctx, "topic", &Message{ID: "a2", OrderingKey: "a"})
+	b.Publish(ctx, "topic", &Message{ID: "b1", OrderingKey: "b"})
+	b.Publish(ctx, "topic", &Message{ID: "a3", OrderingKey: "a"})
+
+	// Only the first message of each key is available.
+	for _, want := range []string{"a1", "b1"} {
+		if msg := receive(t, b, "sub", time.Minute); msg.ID != want {
+			t.Fatalf("got message %s, want %s", msg.ID, want)
+		}
+	}
+	if msg, _ := b.TryReceive(ctx, "topic", "sub", time.Minute); msg != nil {
+		t.Fatalf("got message %s, want none", msg.ID)
+	}
+
+	// A nacked message holds up the messages after it.
+	b.Nack(ctx, "topic", "sub", "a1", 0)
+	if msg := receive(t, b, "sub", time.Minute); msg.ID != "a1" || msg.Attempt != 2 {
+		t.Fatalf("got message %s attempt %d, want a1 attempt 2", msg.ID, msg.Attempt)
+	}
+
+	// Acking a message makes the next one with its key available.
+	for _, id := range []string{"a1", "a2"} {
+		b.Ack(ctx, "topic", "sub", id)
+		msg := receive(t, b, "sub", time.Minute)
+		if want := "a" + string(id[1]+1); msg.ID != want {
+			t.Fatalf("got message %s, want %s", msg.ID, want)
+		}
+		if msg, _ := b.TryReceive(ctx, "topic", "sub", time.Minute); msg != nil {
+			t.Fatalf("got message %s, want none", msg.ID)
+		}
+	}
+	b.Ack(ctx, "topic", "sub", "a3")
+	if n, _ := b.Depth(ctx, "topic", "sub"); n != 1 {
+		t.Fatalf("got depth %d, want 1", n)
+	}
+}
+
+func TestMemoryBrokerDelayed(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	b := NewMemoryBroker()
+	b.now = func() time.Time { return now }
+	b.Subscribe(ctx, "topic", "sub")
+	b.Publish(ctx, "topic", &Message{ID: "1", DeliverAt: now.Add(time.Hour)})
+	b.Publish(ctx, "topic", &Message{ID: "2"})
+	b.Publish(ctx, "topic", &Message{ID: "a1", OrderingKey: "a"})
+	b.Publish(ctx, "topic", &Message{ID: "a2", OrderingKey: "a", DeliverAt: now.Add(time.Minute)})
+
+	for _, want := range []string{"2", "a1"} {
+		msg, _ := b.TryReceive(ctx, "topic", "sub", time.Minute)
+		if msg == nil || msg.ID != want {
+			t.Fatalf("got %v, want message %s", msg, want)
+		}
+		b.Ack(ctx, "topic", "sub", msg.ID)
+	}
+	// Delayed messages keep their delay when queued after their ordering key.
+	if msg, _ := b.TryReceive(ctx, "topic", "sub", time.Minute); msg != nil {
+		t.Fatalf("got message %s before it is due", msg.ID)
+	}
+	for _, test := range []struct {
+		after time.Duration
+		want  string
+	}{{time.Minute, "a2"}, {time.Hour, "1"}} {
+		now = time.Unix(0, 0).Add(test.after)
+		msg, _ := b.TryReceive(ctx, "topic", "sub", time.Hour)
+		if msg == nil || msg.ID != test.want {
+			t.Fatalf("after %v: got %v, want message %s", test.after, msg, test.want)
+		}
+	}
+}
+
+func TestMemoryBrokerUnknown(t *testing.T) {
+	b := NewMemoryBroker()
+	if _, err := b.Receive(context.Background(), "topic", "sub", time.Minute); err != ErrUnknownSubscription {
+		t.Errorf("got err %v, want ErrUnknownSubscription", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second}, {2, 2 * time.Second}, {3, 4 * time.Second}, {10, time.Minute}, {100, time.Minute},
+	}
+	for _, test := range tests {
+		if got := Backoff(test.attempt, time.Second, time.Minute); got != test.want {
+			t.Errorf("Backoff(%d) = %v, want %v", test.attempt, got, test.want)
+		}
+	}
+}
+
+func receive(t *testing.T, b Broker, sub string, ackDeadline time.Duration) *Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := b.Receive(ctx, "topic", sub, ackDeadline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
@@ -0,0 +1,97 @@
+// Package pubsub implements message brokers for publish/subscribe
+// messaging with at-least-once delivery.
+//
+// Each message published to a topic is delivered to every
+// subscription of the topic. A received message is leased to the
+// receiver until its ack deadline, after which it is redelivered
+// unless it has been acknowledged. Messages with the same ordering
+// key are delivered to each subscription serially, in publish order.
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrUnknownSubscription is returned when receiving
+// from a subscription that does not exist.
+var ErrUnknownSubscription = errors.New("pubsub: unknown subscription")
+
+// Message is a published message.
+type Message struct {
+	ID          string            `json:"id"`
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attrs,omitempty"`
+	PublishTime time.Time         `json:"publish_time"`
+
+	// OrderingKey, if set, orders the delivery of messages with
+	// the same key: each subscription receives them one at a time,
+	// in the order they were published, receiving a message only
+	// once the previous one has been acknowledged.
+	OrderingKey string `json:"ordering_key,omitempty"`
+
+	// DeliverAt, if set, is when the message is first delivered.
+	// It is only used by Publish and PublishTo.
+	DeliverAt time.Time `json:"-"`
+
+	// Attempt is the delivery attempt, starting at 1.
+	// It is set by Receive.
+	Attempt int `json:"-"`
+}
+
+// Broker stores and delivers messages.
+type Broker interface {
+	// Subscribe creates the subscription sub to topic if it does not
+	// exist. Messages published to topic after it is created are
+	// delivered to it.
+	Subscribe(ctx context.Context, topic, sub string) error
+
+	// Publish publishes msg to the subscriptions of topic.
+	Publish(ctx context.Context, topic string, msg *Message) error
+
+	// PublishTo publishes msg to a single subscription of topic,
+	// such as for redelivering a dead-lettered message.
+	PublishTo(ctx context.Context, topic, sub string, msg *Message) error
+
+	// Receive leases the next available message of the subscription,
+	// waiting until one is available or ctx is done. The message is
+	// redelivered if it is not acknowledged within ackDeadline.
+	Receive(ctx context.Context, topic, sub string, ackDeadline time.Duration) (*Message, error)
+
+	// TryReceive is like Receive, but returns a nil message
+	// without waiting if none is available.
+	TryReceive(ctx context.Context, topic, sub string, ackDeadline time.Duration) (*Message, error)
+
+	// Ack acknowledges the message with the given ID,
+	// removing it from the subscription.
+	Ack(ctx context.Context, topic, sub, id string) error
+
+	// Nack makes the message with the given ID
+	// available for redelivery after delay.
+	Nack(ctx context.Context, topic, sub, id string, delay time.Duration) error
+
+	// Depth reports the number of unacknowledged messages of the subscription.
+	Depth(ctx context.Context, topic, sub string) (int64, error)
+}
+
+// visibleAt returns when msg published at now is first delivered.
+func visibleAt(msg *Message, now time.Time) time.Time {
+	if msg.DeliverAt.After(now) {
+		return msg.DeliverAt
+	}
+	return now
+}
+
+// Backoff returns the delay before redelivering a message after
+// the given failed delivery attempt, doubling from min up to max.
+func Backoff(attempt int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
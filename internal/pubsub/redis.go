@@ -0,0 +1,227 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"runtime.encore.dev/internal/redis"
+)
+
+// redisPollInterval is how often RedisBroker polls
+// for messages when a subscription has none available.
+const redisPollInterval = 500 * time.Millisecond
+
+// RedisBroker is a Broker backed by Redis, for sharing
+// messages between multiple instances.
+//
+// Each subscription is stored as a sorted set of message IDs scored
+// by when they can next be received, a hash of the messages by ID,
+// and a hash of delivery attempts by ID. The subscriptions of each
+// topic are stored in a set.
+//
+// Messages with an ordering key are additionally kept in a list per
+// key and subscription, and only the first message of each list is
+// added to the sorted set, with the next one added once it is
+// acknowledged. The ordering keys of messages are stored in a hash,
+// as are the delivery times of delayed messages waiting in a list.
+type RedisBroker struct {
+	client *redis.Client
+	prefix string
+
+	now func() time.Time // for testing
+}
+
+func NewRedisBroker(client *redis.Client, keyPrefix string) *RedisBroker {
+	return &RedisBroker{client: client, prefix: keyPrefix, now: time.Now}
+}
+
+func (b *RedisBroker) topicKey(topic string) string {
+	return b.prefix + "topic:" + topic
+}
+
+// subKeys returns the keys of the queue, message and
+// attempt hashes of a subscription.
+func (b *RedisBroker) subKeys(topic, sub string) (queue, msgs, attempts string) {
+	base := b.prefix + "sub:" + topic + "/" + sub
+	return base + ":q", base + ":m", base + ":a"
+}
+
+// orderKeys returns the key of the ordering key hash of a
+// subscription, the prefix of the keys of its ordering lists,
+// and the key of the delivery time hash of its listed messages.
+func (b *RedisBroker) orderKeys(topic, sub string) (keys, listPrefix, delays string) {
+	base := b.prefix + "sub:" + topic + "/" + sub
+	return base + ":o", base + ":k:", base + ":d"
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, topic, sub string) error {
+	_, err := b.client.Do(ctx, "SADD", b.topicKey(topic), topic+"/"+sub)
+	return err
+}
+
+// addFunc is a Lua function adding a message to the subscription
+// with the given key prefix, unless it has already been added.
+const addFunc = `
+local function add(base, id, data, at, okey)
+	if redis.call("HSETNX", base .. ":m", id, data) == 0 then
+		return
+	end
+	redis.call("HDEL", base .. ":a", id)
+	if okey ~= "" then
+		redis.call("HSET", base .. ":o", id, okey)
+		if redis.call("RPUSH", base .. ":k:" .. okey, id) > 1 then
+			redis.call("HSET", base .. ":d", id, at)
+			return
+		end
+	end
+	redis.call("ZADD", base .. ":q", at, id)
+end
+`
+
+// publishScript adds a message to each subscription of a topic.
+const publishScript = addFunc + `
+local subs = redis.call("SMEMBERS", KEYS[1])
+for _, sub in ipairs(subs) do
+	add(ARGV[1] .. sub, ARGV[2], ARGV[3], ARGV[4], ARGV[5])
+end
+return #subs
+`
+
+func (b *RedisBroker) Publish(ctx context.Context, topic string, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.Do(ctx, "EVAL", publishScript, 1, b.topicKey(topic),
+		b.prefix+"sub:", msg.ID, data, ms(visibleAt(msg, b.now())), msg.OrderingKey)
+	return err
+}
+
+// publishToScript adds a message to a single subscription.
+const publishToScript = addFunc + `
+add(ARGV[1], ARGV[2], ARGV[3], ARGV[4], ARGV[5])
+return 1
+`
+
+func (b *RedisBroker) PublishTo(ctx context.Context, topic, sub string, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.Do(ctx, "EVAL", publishToScript, 0,
+		b.prefix+"sub:"+topic+"/"+sub, msg.ID, data, ms(visibleAt(msg, b.now())), msg.OrderingKey)
+	return err
+}
+
+// receiveScript leases the first message visible at ARGV[1]
+// until ARGV[2], returning it and its delivery attempt.
+const receiveScript = `
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 1)
+if #ids == 0 then
+	return false
+end
+local id = ids[1]
+local msg = redis.call("HGET", KEYS[2], id)
+if not msg then
+	redis.call("ZREM", KEYS[1], id)
+	redis.call("HDEL", KEYS[3], id)
+	return false
+end
+redis.call("ZADD", KEYS[1], ARGV[2], id)
+local attempt = redis.call("HINCRBY", KEYS[3], id, 1)
+return {msg, attempt}
+`
+
+func (b *RedisBroker) Receive(ctx context.Context, topic, sub string, ackDeadline time.Duration) (*Message, error) {
+	for {
+		msg, err := b.TryReceive(ctx, topic, sub, ackDeadline)
+		if msg != nil || err != nil {
+			return msg, err
+		}
+		if err := waitFor(ctx, nil, redisPollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (b *RedisBroker) TryReceive(ctx context.Context, topic, sub string, ackDeadline time.Duration) (*Message, error) {
+	queue, msgs, attempts := b.subKeys(topic, sub)
+	now := b.now()
+	reply, err := b.client.Do(ctx, "EVAL", receiveScript, 3, queue, msgs, attempts,
+		ms(now), ms(now.Add(ackDeadline)))
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	arr, ok := reply.([]interface{})
+	if !ok || len(arr) != 2 {
+		return nil, fmt.Errorf("pubsub: unexpected reply %v", reply)
+	}
+	data, err := redis.String(arr[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	attempt, err := redis.Int64(arr[1], nil)
+	if err != nil {
+		return nil, err
+	}
+	msg := new(Message)
+	if err := json.Unmarshal([]byte(data), msg); err != nil {
+		return nil, fmt.Errorf("pubsub: invalid message: %v", err)
+	}
+	msg.Attempt = int(attempt)
+	return msg, nil
+}
+
+// ackScript removes a message from a subscription, adding the next
+// message with the same ordering key, if any, once it is due.
+const ackScript = `
+redis.call("ZREM", KEYS[1], ARGV[1])
+redis.call("HDEL", KEYS[2], ARGV[1])
+redis.call("HDEL", KEYS[3], ARGV[1])
+local okey = redis.call("HGET", KEYS[4], ARGV[1])
+if okey then
+	redis.call("HDEL", KEYS[4], ARGV[1])
+	local list = ARGV[2] .. okey
+	redis.call("LREM", list, 1, ARGV[1])
+	local next = redis.call("LINDEX", list, 0)
+	if next and not redis.call("ZSCORE", KEYS[1], next) then
+		local at = tonumber(redis.call("HGET", KEYS[5], next))
+		redis.call("HDEL", KEYS[5], next)
+		if not at or at < tonumber(ARGV[3]) then
+			at = ARGV[3]
+		end
+		redis.call("ZADD", KEYS[1], at, next)
+	end
+end
+return 1
+`
+
+func (b *RedisBroker) Ack(ctx context.Context, topic, sub, id string) error {
+	queue, msgs, attempts := b.subKeys(topic, sub)
+	okeys, listPrefix, delays := b.orderKeys(topic, sub)
+	_, err := b.client.Do(ctx, "EVAL", ackScript, 5, queue, msgs, attempts, okeys, delays,
+		id, listPrefix, ms(b.now()))
+	return err
+}
+
+func (b *RedisBroker) Nack(ctx context.Context, topic, sub, id string, delay time.Duration) error {
+	queue, _, _ := b.subKeys(topic, sub)
+	_, err := b.client.Do(ctx, "ZADD", queue, "XX", ms(b.now().Add(delay)), id)
+	return err
+}
+
+func (b *RedisBroker) Depth(ctx context.Context, topic, sub string) (int64, error) {
+	_, msgs, _ := b.subKeys(topic, sub)
+	return redis.Int64(b.client.Do(ctx, "HLEN", msgs))
+}
+
+// ms formats t as Unix milliseconds.
+func ms(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
@@ -0,0 +1,112 @@
+// Package ratelimit implements token bucket rate limiting.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit describes a token bucket: it holds up to Burst tokens
+// and is refilled at Rate tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the result of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Remaining int // tokens remaining in the bucket
+
+	// RetryAfter is how long until a token is available.
+	// It is zero if the request was allowed.
+	RetryAfter time.Duration
+
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store stores token buckets.
+type Store interface {
+	// Take takes a token from the bucket for key.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result computes the Result given the tokens remaining
+// in a bucket after attempting to take a token.
+func result(limit Limit, tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// sweepInterval is how often the memory store removes full buckets.
+const sweepInterval = time.Minute
+
+// MemoryStore is an in-memory Store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	now func() time.Time // for testing
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket will be full
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	res := result(limit, b.tokens, allowed)
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+// sweep removes buckets that are full, since they are
+// equivalent to buckets that don't exist.
+func (s *MemoryStore) sweep(now time.Time) {
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+	ctx := context.Background()
+
+	take := func(wantAllowed bool, wantRemaining int) Result {
+		t.Helper()
+		res, err := s.Take(ctx, "key", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != wantAllowed || res.Remaining != wantRemaining {
+			t.Fatalf("got allowed=%v remaining=%d, want allowed=%v remaining=%d",
+				res.Allowed, res.Remaining, wantAllowed, wantRemaining)
+		}
+		return res
+	}
+
+	take(true, 1)
+	take(true, 0)
+	res := take(false, 0)
+	if res.RetryAfter != time.Second {
+		t.Errorf("got RetryAfter=%v, want 1s", res.RetryAfter)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	res = take(false, 0)
+	if res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("got RetryAfter=%v, want 500ms", res.RetryAfter)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	take(true, 0)
+
+	// Other keys have their own buckets.
+	if res, _ := s.Take(ctx, "other", limit); !res.Allowed || res.Remaining != 1 {
+		t.Errorf("got %+v for other key, want allowed with 1 remaining", res)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	limit := Limit{Rate: 10, Burst: 10}
+
+	s.Take(context.Background(), "a", limit)
+	now = now.Add(2 * sweepInterval)
+	s.Take(context.Background(), "b", limit)
+	if _, ok := s.buckets["a"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if _, ok := s.buckets["b"]; !ok {
+		t.Error("bucket b was unexpectedly swept")
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"runtime.encore.dev/internal/redis"
+)
+
+// RedisStore is a Store backed by Redis, for sharing
+// rate limits between multiple instances.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, keyPrefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: keyPrefix}
+}
+
+// takeScript atomically refills the bucket and takes a token.
+// It returns whether the token was taken and the remaining tokens.
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	reply, err := s.client.Do(ctx, "EVAL", takeScript, 1, s.prefix+key,
+		limit.Rate, limit.Burst, now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	arr, ok := reply.([]interface{})
+	if !ok || len(arr) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+	allowed, err := redis.Int64(arr[0], nil)
+	if err != nil {
+		return Result{}, err
+	}
+	tokensStr, err := redis.String(arr[1], nil)
+	if err != nil {
+		return Result{}, err
+	}
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: invalid token count: %v", err)
+	}
+	return result(limit, tokens, allowed == 1), nil
+}
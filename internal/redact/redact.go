@@ -0,0 +1,98 @@
+// Package redact redacts sensitive fields from structured data.
+package redact
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Placeholder replaces redacted values.
+const Placeholder = "[REDACTED]"
+
+// DefaultFields are fields that are always redacted.
+var DefaultFields = []string{"password", "secret", "token", "authorization", "api_key", "apikey"}
+
+// Fields is a set of field names to redact.
+// Names are matched case-insensitively.
+type Fields map[string]bool
+
+// NewFields returns the set of DefaultFields and the given names.
+func NewFields(names ...string) Fields {
+	f := make(Fields, len(DefaultFields)+len(names))
+	for _, n := range DefaultFields {
+		f[strings.ToLower(n)] = true
+	}
+	for _, n := range names {
+		f[strings.ToLower(n)] = true
+	}
+	return f
+}
+
+// With returns a copy of f with the given names added.
+func (f Fields) With(names ...string) Fields {
+	if len(names) == 0 {
+		return f
+	}
+	f2 := make(Fields, len(f)+len(names))
+	for n := range f {
+		f2[n] = true
+	}
+	for _, n := range names {
+		f2[strings.ToLower(n)] = true
+	}
+	return f2
+}
+
+// Has reports whether the field name is redacted.
+func (f Fields) Has(name string) bool {
+	return f[strings.ToLower(name)]
+}
+
+// Value redacts the fields of v, a value decoded from JSON,
+// recursing into nested objects and arrays. It modifies v in place
+// and returns it.
+func (f Fields) Value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			if f.Has(k) {
+				v[k] = Placeholder
+			} else {
+				v[k] = f.Value(x)
+			}
+		}
+	case []interface{}:
+		for i, x := range v {
+			v[i] = f.Value(x)
+		}
+	}
+	return v
+}
+
+// JSON redacts the fields of a JSON document.
+// It reports false if data is not valid JSON.
+func (f Fields) JSON(data []byte) ([]byte, bool) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, false
+	}
+	out, err := json.Marshal(f.Value(v))
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// Strings redacts the fields of a map of string values,
+// such as url.Values or http.Header. It returns a redacted copy.
+func (f Fields) Strings(m map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(m))
+	for k, v := range m {
+		if f.Has(k) {
+			out[k] = []string{Placeholder}
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
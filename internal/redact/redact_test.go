@@ -0,0 +1,79 @@
+package redact
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	f := NewFields("SSN")
+	tests := []struct {
+		in, want string
+	}{
+		{`{"name":"alice","password":"hunter2"}`, `{"name":"alice","password":"[REDACTED]"}`},
+		{`{"user":{"Password":"x","ssn":"123"}}`, `{"user":{"Password":"[REDACTED]","ssn":"[REDACTED]"}}`},
+		{`[{"token":"x"},{"id":1}]`, `[{"token":"[REDACTED]"},{"id":1}]`},
+		{`{"secret":{"nested":true}}`, `{"secret":"[REDACTED]"}`},
+		{`"plain"`, `"plain"`},
+	}
+	for _, test := range tests {
+		got, ok := f.JSON([]byte(test.in))
+		if !ok {
+			t.Errorf("JSON(%s): not ok", test.in)
+		} else if string(got) != test.want {
+			t.Errorf("JSON(%s) = %s, want %s", test.in, got, test.want)
+		}
+	}
+
+	if _, ok := f.JSON([]byte(`{invalid`)); ok {
+		t.Errorf("JSON(invalid): got ok")
+	}
+}
+
+func TestStrings(t *testing.T) {
+	f := NewFields().With("email")
+	got := f.Strings(map[string][]string{
+		"q":     {"search"},
+		"Email": {"a@example.com"},
+		"token": {"a", "b"},
+	})
+	want := map[string][]string{
+		"q":     {"search"},
+		"Email": {Placeholder},
+		"token": {Placeholder},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Strings() = %v, want %v", got, want)
+	}
+	if NewFields().Has("email") {
+		t.Errorf("With modified the receiver")
+	}
+}
+
+func TestRules(t *testing.T) {
+	r := &Rules{
+		Fields:        NewFields(),
+		FieldPatterns: []*regexp.Regexp{regexp.MustCompile(`(?i)_secret$`)},
+		ValuePatterns: []*regexp.Regexp{regexp.MustCompile(`Bearer \S+`)},
+		CardNumbers:   true,
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{`{"level":"info","message":"ok"}` + "\n", `{"level":"info","message":"ok"}` + "\n"},
+		{`{"id":12345678901234567890,"token":"x"}` + "\n", `{"id":12345678901234567890,"token":"[REDACTED]"}` + "\n"},
+		{`{"client_secret":"x"}`, `{"client_secret":"[REDACTED]"}`},
+		{`{"header":"Bearer abc.def"}`, `{"header":"[REDACTED]"}`},
+		{`{"msg":"paid with 4111 1111 1111 1111 today"}`, `{"msg":"paid with [REDACTED] today"}`},
+		{`{"card":4111111111111111}`, `{"card":"[REDACTED]"}`},
+		{`{"order":4111111111111112}`, `{"order":4111111111111112}`}, // fails Luhn check
+		{`{"nested":[{"password":"x","html":"<b>"}]}`, `{"nested":[{"html":"<b>","password":"[REDACTED]"}]}`},
+		{`not json`, `not json`},
+	}
+	for _, test := range tests {
+		if got := r.JSON([]byte(test.in)); string(got) != test.want {
+			t.Errorf("JSON(%s) = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
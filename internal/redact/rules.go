@@ -0,0 +1,136 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+)
+
+// Rules redacts fields by exact name or name pattern,
+// and parts of string values matching value patterns.
+type Rules struct {
+	Fields        Fields           // field names to redact
+	FieldPatterns []*regexp.Regexp // field name patterns to redact
+	ValuePatterns []*regexp.Regexp // patterns to redact within string values
+
+	// CardNumbers redacts numbers that look like payment card
+	// numbers, both within strings and as JSON numbers.
+	CardNumbers bool
+}
+
+// cardNumber matches candidate payment card numbers:
+// 13 to 19 digits, optionally separated by spaces or dashes.
+var cardNumber = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+func (r *Rules) hasField(name string) bool {
+	if r.Fields.Has(name) {
+		return true
+	}
+	for _, p := range r.FieldPatterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// String redacts the parts of s matching the value patterns.
+// It reports whether anything was redacted.
+func (r *Rules) String(s string) (string, bool) {
+	changed := false
+	for _, p := range r.ValuePatterns {
+		if p.MatchString(s) {
+			s, changed = p.ReplaceAllString(s, Placeholder), true
+		}
+	}
+	if r.CardNumbers {
+		s = cardNumber.ReplaceAllStringFunc(s, func(m string) string {
+			if !luhn(m) {
+				return m
+			}
+			changed = true
+			return Placeholder
+		})
+	}
+	return s, changed
+}
+
+// value redacts v, a value decoded from JSON with numbers as
+// json.Number, in place. It reports whether anything was redacted.
+func (r *Rules) value(v interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		changed := false
+		for k, e := range x {
+			if r.hasField(k) {
+				x[k], changed = Placeholder, true
+			} else if e2, c := r.value(e); c {
+				x[k], changed = e2, true
+			}
+		}
+		return x, changed
+	case []interface{}:
+		changed := false
+		for i, e := range x {
+			if e2, c := r.value(e); c {
+				x[i], changed = e2, true
+			}
+		}
+		return x, changed
+	case string:
+		return r.String(x)
+	case json.Number:
+		if r.CardNumbers && cardNumber.MatchString(string(x)) && luhn(string(x)) {
+			return Placeholder, true
+		}
+	}
+	return v, false
+}
+
+// JSON redacts a JSON document. If nothing was redacted, or data
+// is not valid JSON, it returns data as is. Otherwise the document
+// is re-encoded, with object keys sorted.
+func (r *Rules) JSON(data []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return data
+	}
+	v, changed := r.value(v)
+	if !changed {
+		return data
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return data
+	}
+	out := buf.Bytes()
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		out = bytes.TrimSuffix(out, []byte("\n"))
+	}
+	return out
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum
+// used by payment card numbers. Non-digits are ignored.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,287 @@
+// Package redis implements a minimal Redis client
+// speaking the RESP2 protocol.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Nil is returned when Redis replies with a nil value,
+// such as when getting a key that does not exist.
+var Nil = errors.New("redis: nil")
+
+// Error is an error reply from the Redis server.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+type Config struct {
+	Addr     string
+	Password string
+	DB       int
+
+	// MaxIdle is the maximum number of idle connections to keep.
+	// If zero it defaults to 10.
+	MaxIdle int
+
+	// DialTimeout is the timeout for establishing connections.
+	// If zero it defaults to 5s.
+	DialTimeout time.Duration
+}
+
+// Client is a Redis client. It is safe for concurrent use.
+type Client struct {
+	cfg  Config
+	idle chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func New(cfg Config) *Client {
+	if cfg.MaxIdle <= 0 {
+		cfg.MaxIdle = 10
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	return &Client{cfg: cfg, idle: make(chan *conn, cfg.MaxIdle)}
+}
+
+// Do executes a command and returns the reply.
+// Replies are returned as string (simple strings), int64 (integers),
+// []byte (bulk strings) or []interface{} (arrays).
+// A nil reply is returned as the error Nil, and error replies
+// as the error type Error.
+func (c *Client) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(ctx, args)
+	if _, ok := err.(Error); err != nil && !ok && err != Nil {
+		// Connection-level error; don't reuse the connection.
+		cn.Close()
+	} else {
+		c.put(cn)
+	}
+	return reply, err
+}
+
+// Close closes the client's idle connections.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.idle)
+	for cn := range c.idle {
+		cn.Close()
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn, ok := <-c.idle:
+		if ok {
+			return cn, nil
+		}
+		return nil, errors.New("redis: client closed")
+	default:
+	}
+
+	d := net.Dialer{Timeout: c.cfg.DialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{
+		Conn: nc,
+		r:    bufio.NewReader(nc),
+		w:    bufio.NewWriter(nc),
+	}
+	if c.cfg.Password != "" {
+		if _, err := cn.do(ctx, []interface{}{"AUTH", c.cfg.Password}); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis: auth: %v", err)
+		}
+	}
+	if c.cfg.DB != 0 {
+		if _, err := cn.do(ctx, []interface{}{"SELECT", c.cfg.DB}); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis: select db: %v", err)
+		}
+	}
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		cn.Close()
+		return
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (cn *conn) do(ctx context.Context, args []interface{}) (interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	cn.SetDeadline(deadline) // zero deadline means none
+
+	if err := writeCommand(cn.w, args); err != nil {
+		return nil, err
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(cn.r)
+}
+
+func writeCommand(w *bufio.Writer, args []interface{}) error {
+	w.WriteByte('*')
+	w.WriteString(strconv.Itoa(len(args)))
+	w.WriteString("\r\n")
+	for _, arg := range args {
+		var b []byte
+		switch a := arg.(type) {
+		case string:
+			b = []byte(a)
+		case []byte:
+			b = a
+		case int:
+			b = strconv.AppendInt(nil, int64(a), 10)
+		case int64:
+			b = strconv.AppendInt(nil, a, 10)
+		case uint64:
+			b = strconv.AppendUint(nil, a, 10)
+		case float64:
+			b = strconv.AppendFloat(nil, a, 'f', -1, 64)
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+		w.WriteByte('$')
+		w.WriteString(strconv.Itoa(len(b)))
+		w.WriteString("\r\n")
+		w.Write(b)
+		w.WriteString("\r\n")
+	}
+	return nil
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	} else if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length: %v", err)
+		} else if n < 0 {
+			return nil, Nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length: %v", err)
+		} else if n < 0 {
+			return nil, Nil
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			v, err := readReply(r)
+			if err == Nil {
+				v = nil
+			} else if _, ok := err.(Error); ok {
+				v = err
+			} else if err != nil {
+				return nil, err
+			}
+			arr[i] = v
+		}
+		return arr, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+	}
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	} else if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	return line[:len(line)-2], nil
+}
+
+// String converts a reply to a string.
+func String(reply interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch r := reply.(type) {
+	case []byte:
+		return string(r), nil
+	case string:
+		return r, nil
+	case int64:
+		return strconv.FormatInt(r, 10), nil
+	default:
+		return "", fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+}
+
+// Int64 converts a reply to an int64.
+func Int64(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch r := reply.(type) {
+	case int64:
+		return r, nil
+	case []byte:
+		return strconv.ParseInt(string(r), 10, 64)
+	case string:
+		return strconv.ParseInt(r, 10, 64)
+	default:
+		return 0, fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+}
@@ -0,0 +1,46 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteCommand(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := writeCommand(w, []interface{}{"SET", "key", []byte("val"), 42}); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	want := "*4\r\n$3\r\nSET\r\n$3\r\nkey\r\n$3\r\nval\r\n$2\r\n42\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+		err  error
+	}{
+		{"+OK\r\n", "OK", nil},
+		{"-ERR bad\r\n", nil, Error("ERR bad")},
+		{":42\r\n", int64(42), nil},
+		{"$5\r\nhello\r\n", []byte("hello"), nil},
+		{"$-1\r\n", nil, Nil},
+		{"*2\r\n$1\r\na\r\n:1\r\n", []interface{}{[]byte("a"), int64(1)}, nil},
+		{"*2\r\n$-1\r\n+x\r\n", []interface{}{nil, "x"}, nil},
+	}
+	for _, test := range tests {
+		got, err := readReply(bufio.NewReader(strings.NewReader(test.in)))
+		if err != test.err {
+			t.Errorf("readReply(%q): got err %v, want %v", test.in, err, test.err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("readReply(%q) = %#v, want %#v", test.in, got, test.want)
+		}
+	}
+}
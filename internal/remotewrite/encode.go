@@ -0,0 +1,119 @@
+package remotewrite
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// encodeRequest encodes a remote-write WriteRequest
+// in the protobuf wire format.
+//
+// The relevant parts of the schema (prometheus/prompb) are:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label { string name = 1; string value = 2; }
+//	Sample { double value = 1; int64 timestamp = 2; }
+func encodeRequest(mfs []*dto.MetricFamily, labels map[string]string, now time.Time) []byte {
+	var req buf
+	for _, s := range toSeries(mfs, labels, now) {
+		var ts buf
+		for _, l := range s.labels {
+			var lb buf
+			lb.string(1, l.name)
+			lb.string(2, l.value)
+			ts.message(1, lb)
+		}
+		var sample buf
+		sample.fixed64(1, math.Float64bits(s.value))
+		sample.varint(2, uint64(s.ts))
+		ts.message(2, sample)
+		req.message(1, ts)
+	}
+	return req
+}
+
+// buf is a protobuf wire format encoder. Fields with
+// zero values are omitted, as in proto3.
+type buf []byte
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func (b *buf) tag(field, wireType int) {
+	*b = appendUvarint(*b, uint64(field)<<3|uint64(wireType))
+}
+
+func (b *buf) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireVarint)
+	*b = appendUvarint(*b, v)
+}
+
+func (b *buf) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireFixed64)
+	var x [8]byte
+	binary.LittleEndian.PutUint64(x[:], v)
+	*b = append(*b, x[:]...)
+}
+
+func (b *buf) string(field int, v string) {
+	if v == "" {
+		return
+	}
+	b.tag(field, wireBytes)
+	*b = appendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+// message encodes an embedded message.
+func (b *buf) message(field int, m buf) {
+	b.tag(field, wireBytes)
+	*b = appendUvarint(*b, uint64(len(m)))
+	*b = append(*b, m...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var x [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(x[:], v)
+	return append(b, x[:n]...)
+}
+
+// maxLiteral is the maximum length of a snappy literal
+// encoded with a two-byte length.
+const maxLiteral = 1 << 16
+
+// snappyEncode encodes src in the snappy block format, as required
+// by remote-write. It only emits literals; the payload is valid but
+// not compressed, which avoids a dependency on a snappy implementation.
+func snappyEncode(src []byte) []byte {
+	dst := appendUvarint(make([]byte, 0, len(src)+len(src)/maxLiteral*3+16), uint64(len(src)))
+	for len(src) > 0 {
+		n := len(src)
+		if n > maxLiteral {
+			n = maxLiteral
+		}
+		switch m := n - 1; {
+		case m < 60:
+			dst = append(dst, byte(m)<<2)
+		case m < 1<<8:
+			dst = append(dst, 60<<2, byte(m))
+		default:
+			dst = append(dst, 61<<2, byte(m), byte(m>>8))
+		}
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
@@ -0,0 +1,166 @@
+// Package remotewrite pushes Prometheus metrics to an endpoint
+// implementing the Prometheus remote-write protocol.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+type Config struct {
+	URL     string            // remote-write endpoint URL
+	Headers map[string]string // additional request headers, such as Authorization
+	Labels  map[string]string // labels added to all series, such as "job"
+
+	// Timeout is the timeout for a single push.
+	// If zero it defaults to 30 seconds.
+	Timeout time.Duration
+
+	HTTPClient *http.Client // if nil, http.DefaultClient is used
+}
+
+// Client pushes metrics to a remote-write endpoint.
+type Client struct {
+	cfg Config
+}
+
+func New(cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return &Client{cfg: cfg}
+}
+
+// Push pushes the given metric families, timestamped with
+// the current time unless they carry a timestamp of their own.
+func (c *Client) Push(mfs []*dto.MetricFamily) error {
+	body := snappyEncode(encodeRequest(mfs, c.cfg.Labels, time.Now()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("remotewrite: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range c.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("remotewrite: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remotewrite: got status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// series is a time series with a single sample.
+type series struct {
+	labels []label // sorted by name
+	value  float64
+	ts     int64 // milliseconds since the epoch
+}
+
+type label struct{ name, value string }
+
+// toSeries converts metric families to time series, following
+// the Prometheus text format naming: histograms and summaries
+// are split into _bucket/quantile, _sum and _count series.
+func toSeries(mfs []*dto.MetricFamily, extra map[string]string, now time.Time) []series {
+	var out []series
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			ts := now.UnixNano() / int64(time.Millisecond)
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			add := func(name string, value float64, extraName, extraValue string) {
+				labels := []label{{"__name__", name}}
+				for k, v := range extra {
+					labels = append(labels, label{k, v})
+				}
+				for _, l := range m.GetLabel() {
+					labels = append(labels, label{l.GetName(), l.GetValue()})
+				}
+				if extraName != "" {
+					labels = append(labels, label{extraName, extraValue})
+				}
+				sort.SliceStable(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+				out = append(out, series{labels: dedupLabels(labels), value: value, ts: ts})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue(), "", "")
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue(), "", "")
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue(), "", "")
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, q.GetValue(), "quantile", formatFloat(q.GetQuantile()))
+				}
+				add(name+"_sum", s.GetSampleSum(), "", "")
+				add(name+"_count", float64(s.GetSampleCount()), "", "")
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				infSeen := false
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), +1) {
+						infSeen = true
+					}
+					add(name+"_bucket", float64(b.GetCumulativeCount()), "le", formatFloat(b.GetUpperBound()))
+				}
+				if !infSeen {
+					add(name+"_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+				}
+				add(name+"_sum", h.GetSampleSum(), "", "")
+				add(name+"_count", float64(h.GetSampleCount()), "", "")
+			}
+		}
+	}
+	return out
+}
+
+// dedupLabels removes labels with duplicate names from the sorted
+// labels, keeping the last one so metric labels take precedence
+// over the configured labels.
+func dedupLabels(labels []label) []label {
+	out := labels[:0]
+	for i, l := range labels {
+		if i+1 < len(labels) && labels[i+1].name == l.name {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
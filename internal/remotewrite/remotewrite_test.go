@@ -0,0 +1,159 @@
+package remotewrite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestToSeries(t *testing.T) {
+	name, typ := "dur", dto.MetricType_HISTOGRAM
+	count, sum := uint64(3), 1.5
+	bound, bcount := 0.5, uint64(2)
+	lname, lvalue := "job", "own"
+	mfs := []*dto.MetricFamily{{
+		Name: &name,
+		Type: &typ,
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{{Name: &lname, Value: &lvalue}},
+			Histogram: &dto.Histogram{
+				SampleCount: &count,
+				SampleSum:   &sum,
+				Bucket:      []*dto.Bucket{{UpperBound: &bound, CumulativeCount: &bcount}},
+			},
+		}},
+	}}
+
+	now := time.Unix(10, 0)
+	got := toSeries(mfs, map[string]string{"job": "app", "instance": "a"}, now)
+	ls := func(name string, extra ...label) []label {
+		return append([]label{{"__name__", name}, {"instance", "a"}, {"job", "own"}}, extra...)
+	}
+	want := []series{
+		{labels: ls("dur_bucket", label{"le", "0.5"}), value: 2, ts: 10000},
+		{labels: ls("dur_bucket", label{"le", "+Inf"}), value: 3, ts: 10000},
+		{labels: ls("dur_sum"), value: 1.5, ts: 10000},
+		{labels: ls("dur_count"), value: 3, ts: 10000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v,\nwant %+v", got, want)
+	}
+}
+
+func TestSnappyEncode(t *testing.T) {
+	for _, n := range []int{0, 1, 59, 60, 61, 255, 256, 257, 1 << 16, 1<<16 + 1, 200000} {
+		src := make([]byte, n)
+		for i := range src {
+			src[i] = byte(i)
+		}
+		got, err := snappyDecode(snappyEncode(src))
+		if err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		} else if !bytes.Equal(got, src) {
+			t.Fatalf("n=%d: roundtrip mismatch", n)
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	var gotHeader http.Header
+	var gotBody []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotHeader = req.Header
+		body, _ := ioutil.ReadAll(req.Body)
+		var err error
+		if gotBody, err = snappyDecode(body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	name, typ, value := "reqs", dto.MetricType_COUNTER, 3.0
+	mfs := []*dto.MetricFamily{{
+		Name:   &name,
+		Type:   &typ,
+		Metric: []*dto.Metric{{Counter: &dto.Counter{Value: &value}}},
+	}}
+	c := New(Config{URL: ts.URL, Headers: map[string]string{"Authorization": "Bearer x"}})
+	if err := c.Push(mfs); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, want := range map[string]string{
+		"Content-Encoding": "snappy",
+		"Content-Type":     "application/x-protobuf",
+		"Authorization":    "Bearer x",
+	} {
+		if got := gotHeader.Get(k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+
+	// The sample is encoded last; check its value.
+	var tail [8]byte
+	binary.LittleEndian.PutUint64(tail[:], math.Float64bits(3))
+	if !bytes.Contains(gotBody, append([]byte{0x09}, tail[:]...)) {
+		t.Errorf("body does not contain sample value: %x", gotBody)
+	}
+	if !bytes.Contains(gotBody, []byte("__name__")) || !bytes.Contains(gotBody, []byte("reqs")) {
+		t.Errorf("body does not contain metric name: %x", gotBody)
+	}
+}
+
+func TestPushError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+	if err := New(Config{URL: ts.URL}).Push(nil); err == nil {
+		t.Fatal("got nil error, want error")
+	}
+}
+
+// snappyDecode decodes a snappy block consisting of literals only.
+func snappyDecode(src []byte) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 {
+		return nil, errCorrupt
+	}
+	src = src[k:]
+	var dst []byte
+	for len(src) > 0 {
+		tag := src[0]
+		if tag&3 != 0 {
+			return nil, errCorrupt
+		}
+		var m int
+		switch x := int(tag >> 2); {
+		case x < 60:
+			m, src = x, src[1:]
+		case x == 60 && len(src) >= 2:
+			m, src = int(src[1]), src[2:]
+		case x == 61 && len(src) >= 3:
+			m, src = int(src[1])|int(src[2])<<8, src[3:]
+		default:
+			return nil, errCorrupt
+		}
+		if len(src) < m+1 {
+			return nil, errCorrupt
+		}
+		dst = append(dst, src[:m+1]...)
+		src = src[m+1:]
+	}
+	if uint64(len(dst)) != n {
+		return nil, errCorrupt
+	}
+	return dst, nil
+}
+
+var errCorrupt = errors.New("corrupt snappy input")
@@ -0,0 +1,133 @@
+// Package respcache implements an in-memory LRU cache of responses.
+package respcache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response.
+type Entry struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Created time.Time
+}
+
+// size approximates the memory used by the entry in bytes.
+func (e *Entry) size() int64 {
+	n := int64(len(e.Body))
+	for k, vs := range e.Header {
+		n += int64(len(k))
+		for _, v := range vs {
+			n += int64(len(v))
+		}
+	}
+	return n
+}
+
+// Cache is an LRU cache of responses, bounded by the number of entries
+// and their total size. Entries belong to a group, such as the
+// endpoint they are responses of, and are for a path, by which they
+// can be invalidated. It is safe for concurrent use.
+type Cache struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu    sync.Mutex
+	ll    *list.List // of *item, most recently used first
+	items map[string]*list.Element
+	size  int64
+
+	now func() time.Time // for testing
+}
+
+type item struct {
+	key, group, path string
+	entry            *Entry
+	expires          time.Time
+	size             int64
+}
+
+// New returns a cache of at most maxEntries entries
+// of at most maxBytes bytes in total.
+func New(maxEntries int, maxBytes int64) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get returns the entry for key, or nil if there is none or it has expired.
+func (c *Cache) Get(key string) *Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	it := el.Value.(*item)
+	if !c.now().Before(it.expires) {
+		c.remove(el)
+		return nil
+	}
+	c.ll.MoveToFront(el)
+	return it.entry
+}
+
+// Set sets the entry for key, of the given group and path,
+// expiring after ttl. Entries larger than the cache are not cached.
+func (c *Cache) Set(key, group, path string, e *Entry, ttl time.Duration) {
+	it := &item{key: key, group: group, path: path, entry: e, expires: c.now().Add(ttl)}
+	it.size = e.size() + int64(len(key))
+	if it.size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.items[key] = c.ll.PushFront(it)
+	c.size += it.size
+	for c.ll.Len() > c.maxEntries || c.size > c.maxBytes {
+		c.remove(c.ll.Back())
+	}
+}
+
+// Invalidate removes the entries of group, only those for path unless
+// it is empty, and returns the number of entries removed.
+func (c *Cache) Invalidate(group, path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for el := c.ll.Front(); el != nil; {
+		next := el.Next()
+		if it := el.Value.(*item); it.group == group && (path == "" || it.path == path) {
+			c.remove(el)
+			n++
+		}
+		el = next
+	}
+	return n
+}
+
+// Len returns the number of entries, including expired ones
+// not yet removed.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache) remove(el *list.Element) {
+	it := c.ll.Remove(el).(*item)
+	delete(c.items, it.key)
+	c.size -= it.size
+}
@@ -0,0 +1,77 @@
+package respcache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func entry(body string) *Entry {
+	return &Entry{Status: 200, Body: []byte(body)}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := New(10, 1<<20)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	c.Set("k", "svc.Get", "/a", entry("x"), time.Minute)
+	if e := c.Get("k"); e == nil || string(e.Body) != "x" {
+		t.Fatalf("Get = %v, want x", e)
+	}
+	now = now.Add(time.Minute)
+	if e := c.Get("k"); e != nil {
+		t.Fatalf("Get after expiry = %v, want nil", e)
+	}
+	if n := c.Len(); n != 0 {
+		t.Fatalf("Len = %d, want 0", n)
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+	c := New(2, 1<<20)
+	c.Set("a", "g", "/a", entry("a"), time.Minute)
+	c.Set("b", "g", "/b", entry("b"), time.Minute)
+	c.Get("a") // b is now least recently used
+	c.Set("c", "g", "/c", entry("c"), time.Minute)
+	if c.Get("b") != nil {
+		t.Errorf("b not evicted")
+	}
+	if c.Get("a") == nil || c.Get("c") == nil {
+		t.Errorf("a or c evicted")
+	}
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	c := New(100, 9)
+	c.Set("a", "g", "/a", entry("1234"), time.Minute)
+	c.Set("b", "g", "/b", entry("1234"), time.Minute)
+	if c.Get("a") != nil || c.Get("b") == nil {
+		t.Errorf("want a evicted for b")
+	}
+	c.Set("c", "g", "/c", entry(strings.Repeat("x", 20)), time.Minute)
+	if c.Get("c") != nil || c.Get("b") == nil {
+		t.Errorf("want entry larger than the cache not cached")
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	c := New(10, 1<<20)
+	c.Set("1", "svc.Get", "/a", entry("1"), time.Minute)
+	c.Set("2", "svc.Get", "/a", entry("2"), time.Minute)
+	c.Set("3", "svc.Get", "/b", entry("3"), time.Minute)
+	c.Set("4", "svc.List", "/a", entry("4"), time.Minute)
+
+	if n := c.Invalidate("svc.Get", "/a"); n != 2 {
+		t.Errorf("Invalidate(/a) = %d, want 2", n)
+	}
+	if c.Get("3") == nil || c.Get("4") == nil {
+		t.Errorf("other entries invalidated")
+	}
+	if n := c.Invalidate("svc.Get", ""); n != 1 {
+		t.Errorf("Invalidate(all) = %d, want 1", n)
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len = %d, want 1", c.Len())
+	}
+}
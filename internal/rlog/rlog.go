@@ -1,11 +1,13 @@
 package rlog
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
 	"github.com/rs/zerolog"
 
+	"runtime.encore.dev/internal/logsample"
 	"runtime.encore.dev/runtime"
 	"runtime.encore.dev/types/uuid"
 )
@@ -29,6 +31,13 @@ func Error(msg string, keysAndValues ...interface{}) {
 	doLog(2, log.Error(), msg, keysAndValues...)
 }
 
+// FromContext returns the logger of the request associated with ctx,
+// which includes fields such as the request id, trace id and
+// authenticated user.
+func FromContext(ctx context.Context) Ctx {
+	return Ctx{ctx: runtime.LoggerFromContext(ctx).With()}
+}
+
 func With(keysAndValues ...interface{}) Ctx {
 	ctx := runtime.Logger().With()
 	for i := 0; i < len(keysAndValues); i += 2 {
@@ -54,6 +63,14 @@ func (ctx Ctx) Error(msg string, keysAndValues ...interface{}) {
 	doLog(2, l.Error(), msg, keysAndValues...)
 }
 
+// Sample returns a logger that samples its messages according
+// to the policy. Each distinct message is sampled independently,
+// and errors are never sampled.
+func (ctx Ctx) Sample(p logsample.Policy) Ctx {
+	l := ctx.ctx.Logger().Hook(logsample.New(&p, nil))
+	return Ctx{ctx: l.With()}
+}
+
 func (ctx Ctx) With(keysAndValues ...interface{}) Ctx {
 	c := ctx.ctx
 	for i := 0; i < len(keysAndValues); i += 2 {
@@ -0,0 +1,194 @@
+// Package secrets keeps the secret values loaded from the
+// environment and files, and redacts them from text.
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"runtime.encore.dev/internal/redact"
+)
+
+// MinRedactLen is the minimum length of values that are redacted,
+// so that short values such as "1" do not garble text.
+const MinRedactLen = 4
+
+// Source is where a secret is loaded from.
+type Source struct {
+	Name     string
+	Env      string // environment variable, or ""
+	File     string // file, or ""
+	Required bool
+
+	// External secrets are not loaded by the store,
+	// but set with Set, such as from Vault.
+	External bool
+}
+
+// Store holds secret values. It is safe for concurrent use.
+type Store struct {
+	sources []Source
+	getenv  func(string) (string, bool)
+
+	mu        sync.RWMutex
+	values    map[string]string
+	redacted  map[string]bool   // values ever held, including rotated ones
+	replacer  *strings.Replacer // or nil if there is nothing to redact
+	onChanges map[string][]func()
+}
+
+// NewStore returns a store of the secrets loaded from sources.
+// Sources with neither Env nor File set are read from the
+// environment variable named by Name.
+func NewStore(sources []Source) *Store {
+	return &Store{
+		sources:   sources,
+		getenv:    lookupEnv,
+		values:    make(map[string]string),
+		redacted:  make(map[string]bool),
+		onChanges: make(map[string][]func()),
+	}
+}
+
+// lookupEnv looks up an environment variable and unsets it,
+// so that it is not inherited by child processes.
+func lookupEnv(key string) (string, bool) {
+	v, ok := os.LookupEnv(key)
+	if ok {
+		os.Unsetenv(key)
+	}
+	return v, ok
+}
+
+// Load loads the secrets not yet loaded and returns the names of
+// the required secrets that are missing. Environment variables take
+// precedence over files, and trailing newlines are trimmed from files.
+func (s *Store) Load() (missing []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for _, src := range s.sources {
+		if _, ok := s.values[src.Name]; ok {
+			continue
+		}
+		if v, ok := s.read(src); ok {
+			s.values[src.Name] = v
+			s.redacted[v] = true
+			changed = true
+		} else if src.Required {
+			missing = append(missing, src.Name)
+		}
+	}
+	if changed {
+		s.replacer = newReplacer(s.redacted)
+	}
+	return missing
+}
+
+// Set sets the value of the secret with the given name, such as
+// when it is rotated. If it had another value, the functions
+// registered with OnChange are called.
+func (s *Store) Set(name, value string) {
+	s.mu.Lock()
+	old, ok := s.values[name]
+	if ok && old == value {
+		s.mu.Unlock()
+		return
+	}
+	s.values[name] = value
+	if !s.redacted[value] {
+		s.redacted[value] = true
+		s.replacer = newReplacer(s.redacted)
+	}
+	fns := s.onChanges[name]
+	s.mu.Unlock()
+
+	if ok {
+		for _, fn := range fns {
+			fn()
+		}
+	}
+}
+
+// OnChange registers fn to be called when the value
+// of the secret with the given name changes.
+func (s *Store) OnChange(name string, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChanges[name] = append(s.onChanges[name], fn)
+}
+
+func (s *Store) read(src Source) (string, bool) {
+	if src.External {
+		return "", false
+	}
+	env := src.Env
+	if env == "" && src.File == "" {
+		env = src.Name
+	}
+	if env != "" {
+		if v, ok := s.getenv(env); ok {
+			return v, true
+		}
+	}
+	if src.File != "" {
+		if data, err := ioutil.ReadFile(src.File); err == nil {
+			return strings.TrimRight(string(data), "\r\n"), true
+		}
+	}
+	return "", false
+}
+
+// Get returns the value of the secret with the given name,
+// reporting whether it is loaded.
+func (s *Store) Get(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[name]
+	return v, ok
+}
+
+// Redact replaces the secret values in text with redact.Placeholder,
+// including their JSON-escaped forms and previous values.
+func (s *Store) Redact(text string) string {
+	s.mu.RLock()
+	r := s.replacer
+	s.mu.RUnlock()
+	if r == nil {
+		return text
+	}
+	return r.Replace(text)
+}
+
+// newReplacer returns a replacer of the values and their
+// JSON-escaped forms, longest first so that values containing
+// others are redacted whole.
+func newReplacer(values map[string]bool) *strings.Replacer {
+	seen := make(map[string]bool)
+	var olds []string
+	for v := range values {
+		if len(v) < MinRedactLen {
+			continue
+		}
+		esc, _ := json.Marshal(v)
+		for _, o := range []string{v, string(esc[1 : len(esc)-1])} {
+			if !seen[o] {
+				seen[o] = true
+				olds = append(olds, o)
+			}
+		}
+	}
+	if len(olds) == 0 {
+		return nil
+	}
+	sort.Slice(olds, func(i, j int) bool { return len(olds[i]) > len(olds[j]) })
+	var pairs []string
+	for _, o := range olds {
+		pairs = append(pairs, o, redact.Placeholder)
+	}
+	return strings.NewReplacer(pairs...)
+}
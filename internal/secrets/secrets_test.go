@@ -0,0 +1,103 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestStore(env map[string]string, sources ...Source) *Store {
+	s := NewStore(sources)
+	s.getenv = func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+	return s
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"API_KEY": "from-env", "OTHER": "other-env"}
+	s := newTestStore(env,
+		Source{Name: "API_KEY"},
+		Source{Name: "Token", Env: "TOKEN", File: file},
+		Source{Name: "Other", Env: "OTHER", File: file},
+		Source{Name: "Missing", Env: "MISSING", Required: true},
+		Source{Name: "Optional", Env: "OPTIONAL"},
+	)
+
+	if missing := s.Load(); !reflect.DeepEqual(missing, []string{"Missing"}) {
+		t.Errorf("Load = %v, want [Missing]", missing)
+	}
+	for name, want := range map[string]string{
+		"API_KEY": "from-env",
+		"Token":   "from-file",
+		"Other":   "other-env",
+	} {
+		if v, ok := s.Get(name); !ok || v != want {
+			t.Errorf("Get(%q) = %q, %v; want %q", name, v, ok, want)
+		}
+	}
+	if _, ok := s.Get("Optional"); ok {
+		t.Errorf("Get(Optional) reported loaded")
+	}
+
+	env["MISSING"] = "now-set"
+	if missing := s.Load(); len(missing) != 0 {
+		t.Errorf("Load after setting = %v, want none", missing)
+	}
+	if v, _ := s.Get("Missing"); v != "now-set" {
+		t.Errorf("Get(Missing) = %q, want now-set", v)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	s := newTestStore(map[string]string{
+		"A": "hunter2hunter2",
+		"B": "hunter2",
+		"C": `pa"ss`,
+		"D": "abc",
+	}, Source{Name: "A"}, Source{Name: "B"}, Source{Name: "C"}, Source{Name: "D"})
+	if got := s.Redact("hunter2"); got != "hunter2" {
+		t.Errorf("Redact before Load = %q", got)
+	}
+	s.Load()
+	for in, want := range map[string]string{
+		"key=hunter2hunter2":    "key=[REDACTED]",
+		"key=hunter2 x":         "key=[REDACTED] x",
+		`{"p":"pa\"ss"}`:        `{"p":"[REDACTED]"}`,
+		"abc is too short":      "abc is too short",
+		"nothing to see here!!": "nothing to see here!!",
+	} {
+		if got := s.Redact(in); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	s := newTestStore(map[string]string{"Token": "from-env"},
+		Source{Name: "Token", External: true, Required: true})
+	if missing := s.Load(); len(missing) != 1 {
+		t.Fatalf("Load = %v, want [Token]", missing)
+	}
+	changes := 0
+	s.OnChange("Token", func() { changes++ })
+
+	s.Set("Token", "first-value")
+	if len(s.Load()) != 0 || changes != 0 {
+		t.Errorf("after first Set: missing %v, %d changes", s.Load(), changes)
+	}
+	s.Set("Token", "first-value")
+	s.Set("Token", "second-value")
+	if v, _ := s.Get("Token"); v != "second-value" || changes != 1 {
+		t.Errorf("after rotation: value %q, %d changes; want second-value, 1", v, changes)
+	}
+	if got := s.Redact("first-value second-value"); got != "[REDACTED] [REDACTED]" {
+		t.Errorf("Redact = %q, want previous value redacted too", got)
+	}
+}
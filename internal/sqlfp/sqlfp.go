@@ -0,0 +1,141 @@
+// Package sqlfp computes fingerprints of SQL queries,
+// for identifying them without including their values.
+package sqlfp
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLen is the maximum length of fingerprints in bytes.
+const MaxLen = 512
+
+var (
+	valueList = regexp.MustCompile(`\?(\s*,\s*\?)+`)
+	tupleList = regexp.MustCompile(`\(\?\)(\s*,\s*\(\?\))+`)
+)
+
+// Fingerprint returns the fingerprint of query: the query with its
+// literals and placeholders replaced by "?", lists of these collapsed
+// into one, comments removed and whitespace normalized. Queries that
+// differ only in their values, or in the number of values in a list,
+// have the same fingerprint. Fingerprints longer than MaxLen are
+// truncated.
+func Fingerprint(query string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case isSpace(c):
+			space = true
+			i++
+			continue
+		case strings.HasPrefix(query[i:], "--"):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+
+		switch {
+		case c == '\'':
+			i = skipQuoted(query, i, '\'')
+			b.WriteByte('?')
+		case c == '"':
+			j := skipQuoted(query, i, '"')
+			b.WriteString(query[i:j])
+			i = j
+		case c == '$':
+			j := i + 1
+			for j < len(query) && isIdent(query[j]) {
+				j++
+			}
+			switch {
+			case j > i+1 && isDigit(query[i+1]):
+				// A placeholder, such as $1.
+				i = j
+				b.WriteByte('?')
+			case j < len(query) && query[j] == '$':
+				// A dollar-quoted string, such as $tag$...$tag$.
+				tag := query[i : j+1]
+				if end := strings.Index(query[j+1:], tag); end >= 0 {
+					i = j + 1 + end + len(tag)
+				} else {
+					i = len(query)
+				}
+				b.WriteByte('?')
+			default:
+				b.WriteByte(c)
+				i++
+			}
+		case isDigit(c) || (c == '.' && i+1 < len(query) && isDigit(query[i+1])):
+			for i < len(query) && (isDigit(query[i]) || query[i] == '.' || query[i] == 'e' || query[i] == 'E') {
+				i++
+			}
+			b.WriteByte('?')
+		case isIdent(c):
+			j := i
+			for j < len(query) && isIdent(query[j]) {
+				j++
+			}
+			b.WriteString(query[i:j])
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	fp := valueList.ReplaceAllString(b.String(), "?")
+	fp = tupleList.ReplaceAllString(fp, "(?)")
+	if len(fp) > MaxLen {
+		n := MaxLen
+		for n > 0 && !utf8.RuneStart(fp[n]) {
+			n--
+		}
+		fp = fp[:n]
+	}
+	return fp
+}
+
+// skipQuoted returns the index after the quoted string starting at
+// s[i], where the quote is escaped by doubling it.
+func skipQuoted(s string, i int, quote byte) int {
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == quote {
+			if j+1 < len(s) && s[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
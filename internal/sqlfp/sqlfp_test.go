@@ -0,0 +1,38 @@
+package sqlfp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"SELECT id FROM users WHERE id = $1", "SELECT id FROM users WHERE id = ?"},
+		{"select *\n\tfrom t   where a = 'it''s' and b = 42", "select * from t where a = ? and b = ?"},
+		{"SELECT x FROM t WHERE id IN (1, 2, 3)", "SELECT x FROM t WHERE id IN (?)"},
+		{"SELECT x FROM t WHERE id IN ($1,$2)", "SELECT x FROM t WHERE id IN (?)"},
+		{"INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4)", "INSERT INTO t (a, b) VALUES (?)"},
+		{"SELECT 1.5e3, .5, $$body$$, $tag$x$y$tag$", "SELECT ?"},
+		{`SELECT "col1" FROM "t2" -- comment` + "\n" + "WHERE c2 = 'x' /* note */", `SELECT "col1" FROM "t2" WHERE c2 = ?`},
+		{"UPDATE t SET n = n + 1 WHERE name = 'a'", "UPDATE t SET n = n + ? WHERE name = ?"},
+		{"  SELECT  1  ", "SELECT ?"},
+	}
+	for _, test := range tests {
+		if got := Fingerprint(test.in); got != test.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestFingerprintTruncated(t *testing.T) {
+	q := "SELECT " + strings.Repeat("é", MaxLen)
+	fp := Fingerprint(q)
+	if len(fp) > MaxLen {
+		t.Fatalf("len(fp) = %d, want <= %d", len(fp), MaxLen)
+	}
+	if !strings.HasPrefix(q, fp) {
+		t.Fatalf("fp is not a prefix of the query")
+	}
+}
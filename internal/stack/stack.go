@@ -66,6 +66,23 @@ func Print(s Stack) {
 	}
 }
 
+// Frames formats the frames of s as "file:line function".
+func Frames(s Stack) []string {
+	if len(s.Frames) == 0 {
+		return nil
+	}
+	var out []string
+	cf := runtime.CallersFrames(s.Frames)
+	for {
+		f, more := cf.Next()
+		out = append(out, fmt.Sprintf("%s:%d %s", f.File, f.Line, f.Function))
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
 var (
 	stopMu  sync.RWMutex
 	stopPCs = make(map[uintptr]bool)
@@ -0,0 +1,216 @@
+// Package statsd pushes Prometheus metrics to a StatsD
+// or DogStatsD server.
+//
+// Counters are sent as deltas since the previous push, and gauges
+// as their current value. Histograms and summaries are sent as
+// counters of their sample count and sum, and histogram buckets as
+// counters tagged with their upper bound, mirroring the Prometheus
+// representation.
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// maxPacketSize is the maximum size of a UDP packet,
+// chosen to fit in the typical MTU.
+const maxPacketSize = 1432
+
+type Config struct {
+	Addr      string   // UDP address of the server, such as "localhost:8125"
+	Prefix    string   // prefix for metric names, such as "myapp."
+	DogStatsD bool     // use DogStatsD tags instead of encoding labels in names
+	Tags      []string // global tags, such as "env:prod" (DogStatsD only)
+}
+
+// Client pushes metrics to a StatsD server. It is safe for concurrent use.
+type Client struct {
+	cfg  Config
+	conn net.Conn
+
+	mu   sync.Mutex
+	last map[string]float64 // last pushed value of cumulative series
+}
+
+func New(cfg Config) (*Client, error) {
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %v", err)
+	}
+	return &Client{cfg: cfg, conn: conn, last: make(map[string]float64)}, nil
+}
+
+// Push pushes the given metric families.
+func (c *Client) Push(mfs []*dto.MetricFamily) error {
+	c.mu.Lock()
+	lines := c.format(mfs)
+	c.mu.Unlock()
+
+	var pkt bytes.Buffer
+	for _, line := range lines {
+		if pkt.Len() > 0 && pkt.Len()+1+len(line) > maxPacketSize {
+			if err := c.send(pkt.Bytes()); err != nil {
+				return err
+			}
+			pkt.Reset()
+		}
+		if pkt.Len() > 0 {
+			pkt.WriteByte('\n')
+		}
+		pkt.WriteString(line)
+	}
+	if pkt.Len() > 0 {
+		return c.send(pkt.Bytes())
+	}
+	return nil
+}
+
+func (c *Client) send(pkt []byte) error {
+	if _, err := c.conn.Write(pkt); err != nil {
+		return fmt.Errorf("statsd: %v", err)
+	}
+	return nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// format formats the metric families as StatsD lines.
+// c.mu must be held.
+func (c *Client) format(mfs []*dto.MetricFamily) []string {
+	var lines []string
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			labels := m.GetLabel()
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = c.appendDelta(lines, name, labels, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				lines = c.appendLine(lines, name, labels, m.GetGauge().GetValue(), "g")
+			case dto.MetricType_UNTYPED:
+				lines = c.appendLine(lines, name, labels, m.GetUntyped().GetValue(), "g")
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				lines = c.appendDelta(lines, name+"_count", labels, float64(s.GetSampleCount()))
+				lines = c.appendDelta(lines, name+"_sum", labels, s.GetSampleSum())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				lines = c.appendDelta(lines, name+"_count", labels, float64(h.GetSampleCount()))
+				lines = c.appendDelta(lines, name+"_sum", labels, h.GetSampleSum())
+				for _, b := range h.GetBucket() {
+					le := &dto.LabelPair{Name: strPtr("le"), Value: strPtr(formatFloat(b.GetUpperBound()))}
+					bucketLabels := append(labels[:len(labels):len(labels)], le)
+					lines = c.appendDelta(lines, name+"_bucket", bucketLabels, float64(b.GetCumulativeCount()))
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// appendDelta appends a counter line with the increase of a cumulative
+// value since the last push. Nothing is appended if it did not increase.
+func (c *Client) appendDelta(lines []string, name string, labels []*dto.LabelPair, value float64) []string {
+	key := seriesKey(name, labels)
+	prev, seen := c.last[key]
+	c.last[key] = value
+	delta := value - prev
+	if !seen || delta < 0 {
+		// First push, or the process was restarted; report the value as is.
+		delta = value
+	}
+	if delta == 0 {
+		return lines
+	}
+	return c.appendLine(lines, name, labels, delta, "c")
+}
+
+func (c *Client) appendLine(lines []string, name string, labels []*dto.LabelPair, value float64, typ string) []string {
+	var b strings.Builder
+	b.WriteString(sanitize(c.cfg.Prefix + name))
+	if !c.cfg.DogStatsD {
+		for _, l := range labels {
+			b.WriteByte('.')
+			b.WriteString(sanitize(l.GetName()))
+			b.WriteByte('.')
+			b.WriteString(sanitize(l.GetValue()))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(formatFloat(value))
+	b.WriteByte('|')
+	b.WriteString(typ)
+	if c.cfg.DogStatsD && (len(labels) > 0 || len(c.cfg.Tags) > 0) {
+		b.WriteString("|#")
+		first := true
+		for _, t := range c.cfg.Tags {
+			if !first {
+				b.WriteByte(',')
+			}
+			b.WriteString(t)
+			first = false
+		}
+		for _, l := range labels {
+			if !first {
+				b.WriteByte(',')
+			}
+			b.WriteString(sanitizeTag(l.GetName()))
+			b.WriteByte(':')
+			b.WriteString(sanitizeTag(l.GetValue()))
+			first = false
+		}
+	}
+	return append(lines, b.String())
+}
+
+// seriesKey returns a key identifying a series.
+func seriesKey(name string, labels []*dto.LabelPair) string {
+	pairs := make([]string, len(labels))
+	for i, l := range labels {
+		pairs[i] = l.GetName() + "=" + l.GetValue()
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sanitize replaces characters with special meaning in StatsD names.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// sanitizeTag replaces characters with special meaning in DogStatsD tags.
+func sanitizeTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func strPtr(s string) *string { return &s }
@@ -0,0 +1,161 @@
+package statsd
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counter(name string, value float64, labels ...string) *dto.MetricFamily {
+	typ := dto.MetricType_COUNTER
+	return &dto.MetricFamily{
+		Name: &name,
+		Type: &typ,
+		Metric: []*dto.Metric{{
+			Label:   labelPairs(labels...),
+			Counter: &dto.Counter{Value: &value},
+		}},
+	}
+}
+
+func gauge(name string, value float64) *dto.MetricFamily {
+	typ := dto.MetricType_GAUGE
+	return &dto.MetricFamily{
+		Name:   &name,
+		Type:   &typ,
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: &value}}},
+	}
+}
+
+func labelPairs(kv ...string) []*dto.LabelPair {
+	var pairs []*dto.LabelPair
+	for i := 0; i < len(kv); i += 2 {
+		pairs = append(pairs, &dto.LabelPair{Name: &kv[i], Value: &kv[i+1]})
+	}
+	return pairs
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		mfs  []*dto.MetricFamily
+		want []string
+	}{
+		{
+			name: "statsd",
+			cfg:  Config{Prefix: "app."},
+			mfs:  []*dto.MetricFamily{counter("reqs", 3, "service", "svc"), gauge("inflight", 2)},
+			want: []string{"app.reqs.service.svc:3|c", "app.inflight:2|g"},
+		},
+		{
+			name: "dogstatsd",
+			cfg:  Config{DogStatsD: true, Tags: []string{"env:prod"}},
+			mfs:  []*dto.MetricFamily{counter("reqs", 3, "service", "svc")},
+			want: []string{"reqs:3|c|#env:prod,service:svc"},
+		},
+		{
+			name: "sanitize",
+			cfg:  Config{DogStatsD: true},
+			mfs:  []*dto.MetricFamily{counter("reqs", 1, "path", "a:b|c")},
+			want: []string{"reqs:1|c|#path:a_b_c"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Client{cfg: test.cfg, last: make(map[string]float64)}
+			if got := c.format(test.mfs); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatDeltas(t *testing.T) {
+	c := &Client{last: make(map[string]float64)}
+	for i, tc := range []struct {
+		value float64
+		want  []string
+	}{
+		{5, []string{"reqs:5|c"}},
+		{5, nil},
+		{8, []string{"reqs:3|c"}},
+		{2, []string{"reqs:2|c"}}, // reset
+	} {
+		if got := c.format([]*dto.MetricFamily{counter("reqs", tc.value)}); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("push %d: got %q, want %q", i, got, tc.want)
+		}
+	}
+}
+
+func TestFormatHistogram(t *testing.T) {
+	name, typ := "dur", dto.MetricType_HISTOGRAM
+	count, sum := uint64(3), 1.5
+	b1, b1Count := 0.5, uint64(2)
+	b2, b2Count := 1.0, uint64(3)
+	mf := &dto.MetricFamily{
+		Name: &name,
+		Type: &typ,
+		Metric: []*dto.Metric{{
+			Histogram: &dto.Histogram{
+				SampleCount: &count,
+				SampleSum:   &sum,
+				Bucket: []*dto.Bucket{
+					{UpperBound: &b1, CumulativeCount: &b1Count},
+					{UpperBound: &b2, CumulativeCount: &b2Count},
+				},
+			},
+		}},
+	}
+	c := &Client{cfg: Config{DogStatsD: true}, last: make(map[string]float64)}
+	want := []string{
+		"dur_count:3|c",
+		"dur_sum:1.5|c",
+		"dur_bucket:2|c|#le:0.5",
+		"dur_bucket:3|c|#le:1",
+	}
+	if got := c.format([]*dto.MetricFamily{mf}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPush(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	c, err := New(Config{Addr: pc.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Push enough metrics to require several packets.
+	var mfs []*dto.MetricFamily
+	for i := 0; i < 200; i++ {
+		mfs = append(mfs, counter("some_long_metric_name_"+strings.Repeat("x", i%10), float64(i+1), "i", string(rune('a'+i%26))))
+	}
+	if err := c.Push(mfs); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	lines := 0
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for lines < 200 {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v (got %d lines)", err, lines)
+		}
+		if n > maxPacketSize {
+			t.Errorf("packet size %d exceeds max %d", n, maxPacketSize)
+		}
+		lines += strings.Count(string(buf[:n]), "\n") + 1
+	}
+}
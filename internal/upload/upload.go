@@ -0,0 +1,302 @@
+// Package upload parses multipart/form-data requests,
+// streaming uploaded files to temporary files or a Store
+// instead of buffering them in memory.
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Store stores uploaded files, such as in an object store.
+type Store interface {
+	// Put stores the data read from r under key.
+	Put(ctx context.Context, key, contentType string, r io.Reader) error
+
+	// Open opens the data stored under key.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+type Config struct {
+	// TempDir is the directory for temporary files.
+	// If empty it defaults to os.TempDir().
+	TempDir string
+
+	// Store, if set, stores files instead of temporary files.
+	// Stored files are not removed by RemoveAll.
+	Store Store
+
+	// KeyPrefix is prepended to the keys of stored files.
+	KeyPrefix string
+
+	// MaxFileSize is the maximum size of a file in bytes.
+	// If zero it defaults to 32 MiB.
+	MaxFileSize int64
+
+	// MaxParts is the maximum number of parts.
+	// If zero it defaults to 100.
+	MaxParts int
+
+	// MaxValueSize is the maximum total size of non-file values in bytes.
+	// If zero it defaults to 1 MiB.
+	MaxValueSize int64
+
+	// AllowedTypes, if non-empty, are the allowed content types of
+	// files, as sniffed from their content. Entries may be wildcards
+	// such as "image/*".
+	AllowedTypes []string
+}
+
+// Errors returned by Parse for requests exceeding the limits.
+var (
+	ErrFileTooLarge  = errors.New("upload: file too large")
+	ErrTooManyParts  = errors.New("upload: too many parts")
+	ErrValueTooLarge = errors.New("upload: form values too large")
+)
+
+// TypeError is returned by Parse for files of a disallowed content type.
+type TypeError struct {
+	Field       string
+	ContentType string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("upload: file %q has disallowed content type %s", e.Field, e.ContentType)
+}
+
+// File is an uploaded file.
+type File struct {
+	// Filename is the base name of the file, as provided by the client.
+	Filename string
+
+	// ContentType is the content type sniffed from the file's content.
+	// DeclaredType is the content type declared by the client.
+	ContentType  string
+	DeclaredType string
+
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// Key is the key of the file in the Store, or "" if it
+	// was written to a temporary file.
+	Key string
+
+	path  string // temporary file, or ""
+	store Store
+}
+
+// Open opens the file for reading.
+func (f *File) Open(ctx context.Context) (io.ReadCloser, error) {
+	if f.store != nil {
+		return f.store.Open(ctx, f.Key)
+	}
+	return os.Open(f.path)
+}
+
+// Form is a parsed multipart form.
+type Form struct {
+	Values url.Values
+	Files  map[string][]*File
+}
+
+// RemoveAll removes the form's temporary files.
+func (f *Form) RemoveAll() error {
+	var err error
+	for _, files := range f.Files {
+		for _, file := range files {
+			if file.path == "" {
+				continue
+			}
+			if e := os.Remove(file.path); e != nil && !os.IsNotExist(e) && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Parse parses a multipart form with the given boundary from r.
+// On error any files written so far are removed.
+func Parse(ctx context.Context, r io.Reader, boundary string, cfg Config) (_ *Form, err error) {
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = 32 << 20
+	}
+	if cfg.MaxParts <= 0 {
+		cfg.MaxParts = 100
+	}
+	if cfg.MaxValueSize <= 0 {
+		cfg.MaxValueSize = 1 << 20
+	}
+
+	form := &Form{Values: make(url.Values), Files: make(map[string][]*File)}
+	defer func() {
+		if err != nil {
+			form.RemoveAll()
+		}
+	}()
+
+	mr := multipart.NewReader(r, boundary)
+	valueBytes := int64(0)
+	for parts := 0; ; parts++ {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return form, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if parts == cfg.MaxParts {
+			p.Close()
+			return nil, ErrTooManyParts
+		}
+
+		name := p.FormName()
+		if name == "" {
+			p.Close()
+			continue
+		}
+		if p.FileName() == "" {
+			data, err := ioutil.ReadAll(io.LimitReader(p, cfg.MaxValueSize-valueBytes+1))
+			p.Close()
+			if err != nil {
+				return nil, err
+			}
+			valueBytes += int64(len(data))
+			if valueBytes > cfg.MaxValueSize {
+				return nil, ErrValueTooLarge
+			}
+			form.Values.Add(name, string(data))
+			continue
+		}
+
+		f, err := saveFile(ctx, p, cfg)
+		p.Close()
+		if f != nil {
+			// Add files before checking the error so they are removed.
+			form.Files[name] = append(form.Files[name], f)
+		}
+		if err != nil {
+			var te *TypeError
+			if errors.As(err, &te) {
+				te.Field = name
+			}
+			return nil, err
+		}
+	}
+}
+
+// saveFile writes the file in p to a temporary file or the store.
+// If a temporary file was created it is returned even on error.
+func saveFile(ctx context.Context, p *multipart.Part, cfg Config) (*File, error) {
+	// Sniff the content type from the beginning of the file.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(p, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	f := &File{
+		Filename:     path.Base(filepath.ToSlash(p.FileName())),
+		ContentType:  http.DetectContentType(head),
+		DeclaredType: p.Header.Get("Content-Type"),
+	}
+	if !allowedType(f.ContentType, cfg.AllowedTypes) {
+		return nil, &TypeError{ContentType: f.ContentType}
+	}
+
+	lr := &limitedReader{r: io.MultiReader(bytes.NewReader(head), p), n: cfg.MaxFileSize}
+	if cfg.Store != nil {
+		f.Key = cfg.KeyPrefix + randomKey() + "/" + f.Filename
+		f.store = cfg.Store
+		if err := cfg.Store.Put(ctx, f.Key, f.ContentType, lr); err != nil {
+			if lr.exceeded {
+				return nil, ErrFileTooLarge
+			}
+			return nil, err
+		}
+	} else {
+		tmp, err := ioutil.TempFile(cfg.TempDir, "upload-")
+		if err != nil {
+			return nil, err
+		}
+		f.path = tmp.Name()
+		_, err = io.Copy(tmp, lr)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return f, err
+		}
+	}
+	if lr.exceeded {
+		return f, ErrFileTooLarge
+	}
+	f.Size = lr.read
+	return f, nil
+}
+
+// allowedType reports whether contentType matches one of the
+// allowed types, or if there are none.
+func allowedType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType := contentType
+	if i := strings.IndexByte(mediaType, ';'); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	mediaType = strings.TrimSpace(mediaType)
+	for _, a := range allowed {
+		if a == mediaType || a == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, a[:len(a)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func randomKey() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// limitedReader reads at most n bytes, failing with
+// ErrFileTooLarge if there is more data.
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	read     int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, ErrFileTooLarge
+	}
+	if rem := l.n - l.read + 1; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.n {
+		l.exceeded = true
+		l.read = l.n
+		return 0, ErrFileTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,191 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type part struct {
+	name, filename, contentType, data string
+}
+
+func newForm(t *testing.T, parts ...part) (io.Reader, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		var w io.Writer
+		var err error
+		if p.filename != "" {
+			h := make(map[string][]string)
+			h["Content-Disposition"] = []string{`form-data; name="` + p.name + `"; filename="` + p.filename + `"`}
+			if p.contentType != "" {
+				h["Content-Type"] = []string{p.contentType}
+			}
+			w, err = mw.CreatePart(h)
+		} else {
+			w, err = mw.CreateFormField(p.name)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, p.data)
+	}
+	mw.Close()
+	return &buf, mw.Boundary()
+}
+
+const png = "\x89PNG\r\n\x1a\nrest of image"
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+	r, boundary := newForm(t,
+		part{name: "title", data: "hello"},
+		part{name: "tags", data: "a"},
+		part{name: "tags", data: "b"},
+		part{name: "image", filename: "../../etc/cat.png", contentType: "text/plain", data: png},
+	)
+	form, err := Parse(context.Background(), r, boundary, Config{TempDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := form.Values.Get("title"); got != "hello" {
+		t.Errorf("title = %q, want %q", got, "hello")
+	}
+	if got := form.Values["tags"]; len(got) != 2 {
+		t.Errorf("tags = %q, want 2 values", got)
+	}
+
+	files := form.Files["image"]
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+	f := files[0]
+	if f.Filename != "cat.png" || f.ContentType != "image/png" || f.DeclaredType != "text/plain" || f.Size != int64(len(png)) {
+		t.Errorf("got file %+v", f)
+	}
+	rc, err := f.Open(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	if string(data) != png {
+		t.Errorf("got data %q, want %q", data, png)
+	}
+
+	if err := form.RemoveAll(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("got %d files after RemoveAll, want 0", len(entries))
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []part
+		cfg   Config
+		want  error
+	}{
+		{
+			name:  "file too large",
+			parts: []part{{name: "f", filename: "a.txt", data: strings.Repeat("x", 600)}},
+			cfg:   Config{MaxFileSize: 599},
+			want:  ErrFileTooLarge,
+		},
+		{
+			name:  "too many parts",
+			parts: []part{{name: "a", data: "1"}, {name: "b", data: "2"}, {name: "c", data: "3"}},
+			cfg:   Config{MaxParts: 2},
+			want:  ErrTooManyParts,
+		},
+		{
+			name:  "values too large",
+			parts: []part{{name: "a", data: "123"}, {name: "b", data: "456"}},
+			cfg:   Config{MaxValueSize: 5},
+			want:  ErrValueTooLarge,
+		},
+		{
+			name:  "disallowed type",
+			parts: []part{{name: "f", filename: "a.png", data: "plain text"}},
+			cfg:   Config{AllowedTypes: []string{"image/*"}},
+			want:  &TypeError{Field: "f", ContentType: "text/plain; charset=utf-8"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			test.cfg.TempDir = dir
+			r, boundary := newForm(t, test.parts...)
+			_, err := Parse(context.Background(), r, boundary, test.cfg)
+			var te *TypeError
+			if want, ok := test.want.(*TypeError); ok {
+				if !errors.As(err, &te) || *te != *want {
+					t.Errorf("got error %v, want %v", err, want)
+				}
+			} else if err != test.want {
+				t.Errorf("got error %v, want %v", err, test.want)
+			}
+			if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("got %d files after failure, want 0", len(entries))
+			}
+		})
+	}
+}
+
+type memStore struct {
+	mu   sync.Mutex
+	objs map[string][]byte
+}
+
+func (s *memStore) Put(ctx context.Context, key, contentType string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.objs[key] = data
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objs[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestParseStore(t *testing.T) {
+	store := &memStore{objs: make(map[string][]byte)}
+	r, boundary := newForm(t, part{name: "doc", filename: "a.txt", data: "contents"})
+	form, err := Parse(context.Background(), r, boundary, Config{Store: store, KeyPrefix: "uploads/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := form.Files["doc"][0]
+	if !strings.HasPrefix(f.Key, "uploads/") || !strings.HasSuffix(f.Key, "/a.txt") {
+		t.Errorf("got key %q", f.Key)
+	}
+	rc, err := f.Open(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(rc)
+	if string(data) != "contents" || f.Size != int64(len("contents")) {
+		t.Errorf("got data %q and size %d", data, f.Size)
+	}
+}
@@ -0,0 +1,367 @@
+// Package validate validates request payloads using
+// struct tags and the Validator interface.
+//
+// Fields are validated according to their "validate" tag, a comma
+// separated list of rules:
+//
+//	required     the field must not be the zero value
+//	min=N        numbers must be at least N; strings, slices
+//	             and maps must have at least N elements
+//	max=N        like min, but an upper bound
+//	enum=a|b|c   the field must be one of the given values
+//	regex=RE     strings must match the regular expression RE;
+//	             it must be the last rule, so RE may contain commas
+//
+// Rules other than required are not checked for nil pointers.
+// Nested structs, and structs in slices and maps, are validated
+// recursively. Values implementing Validator are validated by
+// calling their Validate method as well.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validator is implemented by payloads with custom validation.
+type Validator interface {
+	Validate() error
+}
+
+// Violation describes an invalid field.
+type Violation struct {
+	Field       string // path of the field, such as "address.zip"
+	Description string // why the field is invalid
+}
+
+// Error is returned by Validate when a Validator fails.
+type Error struct {
+	Field string // path of the value, or "" for the payload itself
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Field == "" {
+		return e.Err.Error()
+	}
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Validate validates v, reporting the fields that violate their
+// rules. It returns an *Error if a Validator fails, and other
+// errors if v has invalid validation tags.
+func Validate(v interface{}) ([]Violation, error) {
+	var c checker
+	if err := c.value("", reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return c.violations, nil
+}
+
+type checker struct {
+	violations []Violation
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+func (c *checker) value(path string, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type().Implements(validatorType) {
+		if err := c.validator(path, v); err != nil {
+			return err
+		}
+	} else if v.CanAddr() && v.Addr().Type().Implements(validatorType) {
+		if err := c.validator(path, v.Addr()); err != nil {
+			return err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields, err := typeFields(v.Type())
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			fv := v.Field(f.index)
+			fpath := join(path, f.name)
+			c.check(fpath, fv, f.rules)
+			if err := c.value(fpath, fv); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := c.value(path+"["+strconv.Itoa(i)+"]", v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := c.value(path+"["+fmt.Sprint(iter.Key().Interface())+"]", iter.Value()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *checker) validator(path string, v reflect.Value) error {
+	if err := v.Interface().(Validator).Validate(); err != nil {
+		return &Error{Field: path, Err: err}
+	}
+	return nil
+}
+
+func (c *checker) check(path string, v reflect.Value, rules []rule) {
+	elem, isNil := v, false
+	if v.Kind() == reflect.Ptr {
+		elem, isNil = v.Elem(), v.IsNil()
+	}
+	for _, r := range rules {
+		var desc string
+		if r.kind == ruleRequired {
+			desc = r.check(v)
+		} else if !isNil {
+			desc = r.check(elem)
+		}
+		if desc != "" {
+			c.violations = append(c.violations, Violation{Field: path, Description: desc})
+			return
+		}
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+type ruleKind int
+
+const (
+	ruleRequired ruleKind = iota
+	ruleMin
+	ruleMax
+	ruleEnum
+	ruleRegex
+)
+
+type rule struct {
+	kind  ruleKind
+	n     float64
+	enum  []string
+	regex *regexp.Regexp
+}
+
+func (r *rule) check(v reflect.Value) string {
+	switch r.kind {
+	case ruleRequired:
+		if v.IsZero() {
+			return "is required"
+		}
+	case ruleMin, ruleMax:
+		n, unit := size(v)
+		if unit != "" {
+			unit = " " + unit
+		}
+		if r.kind == ruleMin && n < r.n {
+			if unit != "" {
+				return "must have at least " + formatNum(r.n) + unit
+			}
+			return "must be at least " + formatNum(r.n)
+		} else if r.kind == ruleMax && n > r.n {
+			if unit != "" {
+				return "must have at most " + formatNum(r.n) + unit
+			}
+			return "must be at most " + formatNum(r.n)
+		}
+	case ruleEnum:
+		s := fmt.Sprint(v.Interface())
+		for _, e := range r.enum {
+			if s == e {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(r.enum, ", ")
+	case ruleRegex:
+		if !r.regex.MatchString(v.String()) {
+			return "must match " + r.regex.String()
+		}
+	}
+	return ""
+}
+
+// size returns the value of a number, or the length of a string,
+// slice or map along with the unit of the length.
+func size(v reflect.Value) (n float64, unit string) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "characters"
+	default:
+		return float64(v.Len()), "elements"
+	}
+}
+
+func formatNum(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+type field struct {
+	index int
+	name  string // name in the payload
+	rules []rule
+}
+
+// fieldCache caches the fields of struct types,
+// mapping reflect.Type to []field or error.
+var fieldCache sync.Map
+
+func typeFields(t reflect.Type) ([]field, error) {
+	if v, ok := fieldCache.Load(t); ok {
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		return v.([]field), nil
+	}
+	fields, err := parseFields(t)
+	if err != nil {
+		fieldCache.Store(t, err)
+		return nil, err
+	}
+	fieldCache.Store(t, fields)
+	return fields, nil
+}
+
+func parseFields(t reflect.Type) ([]field, error) {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		name := sf.Name
+		if tag := sf.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		rules, err := parseRules(sf.Type, sf.Tag.Get("validate"))
+		if err != nil {
+			return nil, fmt.Errorf("validate: %s.%s: %v", t, sf.Name, err)
+		}
+		fields = append(fields, field{index: i, name: name, rules: rules})
+	}
+	return fields, nil
+}
+
+// TagRule is a rule of a "validate" tag, such as "min=1".
+type TagRule struct {
+	Name string // such as "min"
+	Arg  string // such as "1", or "" if the rule has no argument
+}
+
+// SplitTag splits a "validate" tag into its rules,
+// without checking that they are valid.
+func SplitTag(tag string) []TagRule {
+	var rules []TagRule
+	for tag != "" {
+		var s string
+		if strings.HasPrefix(tag, "regex=") {
+			s, tag = tag, ""
+		} else if idx := strings.IndexByte(tag, ','); idx != -1 {
+			s, tag = tag[:idx], tag[idx+1:]
+		} else {
+			s, tag = tag, ""
+		}
+		r := TagRule{Name: s}
+		if idx := strings.IndexByte(s, '='); idx != -1 {
+			r.Name, r.Arg = s[:idx], s[idx+1:]
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+func parseRules(t reflect.Type, tag string) ([]rule, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var rules []rule
+	for _, tr := range SplitTag(tag) {
+		name, arg := tr.Name, tr.Arg
+		switch name {
+		case "required":
+			rules = append(rules, rule{kind: ruleRequired})
+		case "min", "max":
+			if !sized(t) {
+				return nil, fmt.Errorf("rule %s: unsupported type %s", name, t)
+			}
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid number %q", name, arg)
+			}
+			kind := ruleMin
+			if name == "max" {
+				kind = ruleMax
+			}
+			rules = append(rules, rule{kind: kind, n: n})
+		case "enum":
+			if arg == "" {
+				return nil, fmt.Errorf("rule enum: no values")
+			}
+			rules = append(rules, rule{kind: ruleEnum, enum: strings.Split(arg, "|")})
+		case "regex":
+			if t.Kind() != reflect.String {
+				return nil, fmt.Errorf("rule regex: unsupported type %s", t)
+			}
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, fmt.Errorf("rule regex: %v", err)
+			}
+			rules = append(rules, rule{kind: ruleRegex, regex: re})
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return rules, nil
+}
+
+// sized reports whether the min and max rules apply to t.
+func sized(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
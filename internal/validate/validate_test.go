@@ -0,0 +1,117 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type address struct {
+	Zip string `json:"zip" validate:"required,regex=^[0-9]{5}(,[0-9]{4})?$"`
+}
+
+type item struct {
+	Qty int `json:"qty" validate:"min=1,max=10"`
+}
+
+type order struct {
+	Email   string   `json:"email" validate:"required"`
+	Status  string   `json:"status" validate:"enum=open|closed"`
+	Tags    []string `json:"tags" validate:"max=2"`
+	Note    *string  `json:"note" validate:"min=3"`
+	Address *address `json:"address" validate:"required"`
+	Items   []item   `json:"items"`
+	Ignored string   `json:"-" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	short := "ab"
+	tests := []struct {
+		name string
+		in   interface{}
+		want []Violation
+	}{
+		{
+			name: "valid",
+			in: &order{
+				Email:   "a@example.com",
+				Status:  "open",
+				Address: &address{Zip: "12345,6789"},
+				Items:   []item{{Qty: 1}},
+			},
+		},
+		{
+			name: "invalid",
+			in: order{
+				Status:  "pending",
+				Tags:    []string{"a", "b", "c"},
+				Note:    &short,
+				Address: &address{Zip: "1234"},
+				Items:   []item{{Qty: 1}, {Qty: 11}},
+			},
+			want: []Violation{
+				{"email", "is required"},
+				{"status", "must be one of open, closed"},
+				{"tags", "must have at most 2 elements"},
+				{"note", "must have at least 3 characters"},
+				{"address.zip", "must match ^[0-9]{5}(,[0-9]{4})?$"},
+				{"items[1].qty", "must be at most 10"},
+			},
+		},
+		{
+			name: "nil pointers",
+			in:   &order{Email: "a", Status: "closed"},
+			want: []Violation{{"address", "is required"}},
+		},
+		{name: "nil", in: (*order)(nil)},
+	}
+	for _, test := range tests {
+		got, err := Validate(test.in)
+		if err != nil {
+			t.Errorf("%s: got err %v", test.name, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+type custom struct {
+	Inner inner `json:"inner"`
+}
+
+type inner struct{ N int }
+
+var errOdd = errors.New("must be even")
+
+func (i *inner) Validate() error {
+	if i.N%2 != 0 {
+		return errOdd
+	}
+	return nil
+}
+
+func TestValidator(t *testing.T) {
+	if _, err := Validate(&custom{Inner: inner{N: 2}}); err != nil {
+		t.Fatalf("got err %v", err)
+	}
+	_, err := Validate(&custom{Inner: inner{N: 3}})
+	var verr *Error
+	if !errors.As(err, &verr) || verr.Field != "inner" || !errors.Is(err, errOdd) {
+		t.Fatalf("got err %v, want validator error for inner", err)
+	}
+}
+
+func TestInvalidTag(t *testing.T) {
+	type bad struct {
+		N bool `validate:"min=1"`
+	}
+	if _, err := Validate(bad{}); err == nil {
+		t.Fatal("got nil error for invalid tag")
+	}
+	type unknown struct {
+		S string `validate:"email"`
+	}
+	if _, err := Validate(unknown{}); err == nil {
+		t.Fatal("got nil error for unknown rule")
+	}
+}
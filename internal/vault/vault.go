@@ -0,0 +1,213 @@
+// Package vault implements a minimal client for the HTTP API of
+// HashiCorp Vault: logging in, reading secrets and renewing
+// tokens and leases.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client is a Vault client. It is safe for concurrent use.
+type Client struct {
+	addr      string
+	namespace string
+	http      *http.Client
+
+	mu    sync.RWMutex
+	token string
+}
+
+// New returns a client of the Vault server at addr, such as
+// "https://vault:8200", making requests with hc. If hc is nil
+// it uses http.DefaultClient.
+func New(addr, namespace string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{addr: strings.TrimSuffix(addr, "/"), namespace: namespace, http: hc}
+}
+
+// SetToken sets the token requests are made with.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+// Auth is the result of logging in or renewing a token.
+type Auth struct {
+	ClientToken   string        `json:"client_token"`
+	LeaseDuration time.Duration `json:"-"`
+	Renewable     bool          `json:"renewable"`
+
+	LeaseSeconds int `json:"lease_duration"`
+}
+
+// Secret is a secret read from Vault.
+type Secret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration time.Duration          `json:"-"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+
+	LeaseSeconds int `json:"lease_duration"`
+}
+
+// response is the envelope of API responses.
+type response struct {
+	Secret
+	Auth   *Auth    `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// Error is an error response.
+type Error struct {
+	Status int
+	Errors []string
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("vault: request failed with status %d", e.Status)
+	}
+	return fmt.Sprintf("vault: request failed with status %d: %s", e.Status, strings.Join(e.Errors, "; "))
+}
+
+// do makes a request to the API path, such as "auth/token/renew-self",
+// with body encoded as JSON if non-nil.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}) (*response, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.addr+"/v1/"+strings.TrimPrefix(path, "/"), r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var res response
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &res); err != nil && resp.StatusCode < 300 {
+			return nil, fmt.Errorf("vault: invalid response: %v", err)
+		}
+	}
+	if resp.StatusCode >= 300 {
+		return nil, &Error{Status: resp.StatusCode, Errors: res.Errors}
+	}
+	res.LeaseDuration = time.Duration(res.LeaseSeconds) * time.Second
+	if res.Auth != nil {
+		res.Auth.LeaseDuration = time.Duration(res.Auth.LeaseSeconds) * time.Second
+	}
+	return &res, nil
+}
+
+// Login logs in with the auth method mounted at mount, such as
+// "approle" with a role_id and secret_id, or "kubernetes" with a
+// role and jwt. The client's token is set to the token logged in.
+func (c *Client) Login(ctx context.Context, mount string, params map[string]string) (*Auth, error) {
+	res, err := c.do(ctx, "POST", "auth/"+mount+"/login", params)
+	if err != nil {
+		return nil, err
+	}
+	if res.Auth == nil || res.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("vault: login returned no token")
+	}
+	c.SetToken(res.Auth.ClientToken)
+	return res.Auth, nil
+}
+
+// RenewSelf renews the client's token.
+func (c *Client) RenewSelf(ctx context.Context) (*Auth, error) {
+	res, err := c.do(ctx, "POST", "auth/token/renew-self", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	if res.Auth == nil {
+		return nil, fmt.Errorf("vault: renewal returned no token")
+	}
+	return res.Auth, nil
+}
+
+// Read reads the secret at path, such as "secret/data/app" or
+// "database/creds/app".
+func (c *Client) Read(ctx context.Context, path string) (*Secret, error) {
+	res, err := c.do(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &res.Secret, nil
+}
+
+// RenewLease renews the lease of a secret by increment, returning
+// the renewed lease. Vault may grant a shorter lease than requested,
+// such as when reaching the lease's maximum TTL.
+func (c *Client) RenewLease(ctx context.Context, leaseID string, increment time.Duration) (*Secret, error) {
+	res, err := c.do(ctx, "PUT", "sys/leases/renew", map[string]interface{}{
+		"lease_id":  leaseID,
+		"increment": int(increment / time.Second),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res.Secret, nil
+}
+
+// Value returns the value of field in the data of s, or the data
+// encoded as JSON if field is empty. The data of KV version 2
+// secrets, nested under "data" alongside "metadata", is unwrapped.
+// Values that are not strings are encoded as JSON.
+func (s *Secret) Value(field string) (string, error) {
+	data := s.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	var v interface{} = data
+	if field != "" {
+		var ok bool
+		if v, ok = data[field]; !ok {
+			return "", fmt.Errorf("vault: secret has no field %q", field)
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
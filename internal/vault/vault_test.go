@@ -0,0 +1,209 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault is a Vault server with an AppRole login, a KV version 2
+// secret and database credentials with leases.
+type fakeVault struct {
+	mu       sync.Mutex
+	logins   int
+	creds    int // database credentials issued
+	renewals int
+	renew    bool // whether credential leases are renewable
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(v interface{}) { json.NewEncoder(w).Encode(v) }
+
+	if req.URL.Path != "/v1/auth/approle/login" && req.Header.Get("X-Vault-Token") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		reply(map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+	switch req.URL.Path {
+	case "/v1/auth/approle/login":
+		var params map[string]string
+		json.NewDecoder(req.Body).Decode(&params)
+		if params["role_id"] != "role" || params["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(map[string]interface{}{"errors": []string{"invalid credentials"}})
+			return
+		}
+		f.logins++
+		reply(map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": "token", "lease_duration": 3600, "renewable": true,
+		}})
+	case "/v1/secret/data/app":
+		reply(map[string]interface{}{"data": map[string]interface{}{
+			"data":     map[string]interface{}{"api_key": "key-1", "port": 5432},
+			"metadata": map[string]interface{}{"version": 1},
+		}})
+	case "/v1/database/creds/app":
+		f.creds++
+		reply(map[string]interface{}{
+			"lease_id": "database/creds/app/lease", "lease_duration": 3, "renewable": f.renew,
+			"data": map[string]interface{}{
+				"username": "user-" + string(rune('0'+f.creds)),
+				"password": "pass-" + string(rune('0'+f.creds)),
+			},
+		})
+	case "/v1/sys/leases/renew":
+		f.renewals++
+		reply(map[string]interface{}{"lease_id": "database/creds/app/lease", "lease_duration": 3, "renewable": true})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		reply(map[string]interface{}{"errors": []string{}})
+	}
+}
+
+func appRoleLogin(ctx context.Context, c *Client) (*Auth, error) {
+	return c.Login(ctx, "approle", map[string]string{"role_id": "role", "secret_id": "secret"})
+}
+
+// values records the values reported by a watcher.
+type values struct {
+	mu sync.Mutex
+	m  map[string][]string
+}
+
+func (v *values) set(name, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.m == nil {
+		v.m = make(map[string][]string)
+	}
+	v.m[name] = append(v.m[name], value)
+}
+
+func (v *values) get(name string) []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]string(nil), v.m[name]...)
+}
+
+func TestWatcherRead(t *testing.T) {
+	srv := httptest.NewServer(&fakeVault{})
+	defer srv.Close()
+
+	var vals values
+	w := NewWatcher(New(srv.URL, "", srv.Client()), []Target{
+		{Name: "APIKey", Path: "secret/data/app", Field: "api_key"},
+		{Name: "Port", Path: "secret/data/app", Field: "port"},
+		{Name: "App", Path: "secret/data/app"},
+	}, WatchConfig{Login: appRoleLogin, OnValue: vals.set})
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	w.Stop()
+
+	for name, want := range map[string]string{
+		"APIKey": "key-1",
+		"Port":   "5432",
+		"App":    `{"api_key":"key-1","port":5432}`,
+	} {
+		if got := vals.get(name); len(got) != 1 || got[0] != want {
+			t.Errorf("%s = %v, want [%s]", name, got, want)
+		}
+	}
+}
+
+func TestWatcherLoginError(t *testing.T) {
+	srv := httptest.NewServer(&fakeVault{})
+	defer srv.Close()
+
+	var errNames []string
+	w := NewWatcher(New(srv.URL, "", srv.Client()), []Target{
+		{Name: "APIKey", Path: "secret/data/app", Field: "api_key"},
+	}, WatchConfig{
+		Login: func(ctx context.Context, c *Client) (*Auth, error) {
+			return c.Login(ctx, "approle", map[string]string{"role_id": "role", "secret_id": "wrong"})
+		},
+		OnError: func(name string, err error) { errNames = append(errNames, name) },
+	})
+	err := w.Start(context.Background())
+	w.Stop()
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusBadRequest {
+		t.Errorf("Start: got err %v, want login error", err)
+	}
+	if len(errNames) != 2 || errNames[0] != "" || errNames[1] != "APIKey" {
+		t.Errorf("errors reported for %q, want login and APIKey", errNames)
+	}
+}
+
+// fastWatcher returns a watcher sleeping for a hundredth
+// of the durations it would otherwise.
+func fastWatcher(c *Client, targets []Target, cfg WatchConfig) *Watcher {
+	w := NewWatcher(c, targets, cfg)
+	w.after = func(d time.Duration) <-chan time.Time { return time.After(d / 100) }
+	return w
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatcherRotation(t *testing.T) {
+	f := &fakeVault{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	var vals values
+	w := fastWatcher(New(srv.URL, "", srv.Client()), []Target{
+		{Name: "User", Path: "database/creds/app", Field: "username"},
+		{Name: "Password", Path: "database/creds/app", Field: "password"},
+	}, WatchConfig{Login: appRoleLogin, OnValue: vals.set})
+	defer w.Stop()
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Non-renewable leases are replaced by reading the secret again,
+	// with both fields from the same read.
+	waitFor(t, func() bool { return len(vals.get("Password")) >= 2 })
+	users, passwords := vals.get("User"), vals.get("Password")
+	if users[1] != "user-2" || passwords[1] != "pass-2" {
+		t.Errorf("after rotation: user %v, password %v", users, passwords)
+	}
+}
+
+func TestWatcherRenewal(t *testing.T) {
+	f := &fakeVault{renew: true}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	w := fastWatcher(New(srv.URL, "", srv.Client()), []Target{
+		{Name: "User", Path: "database/creds/app", Field: "username"},
+	}, WatchConfig{Login: appRoleLogin})
+	defer w.Stop()
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.renewals >= 2
+	})
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.creds != 1 {
+		t.Errorf("credentials issued %d times, want 1", f.creds)
+	}
+}
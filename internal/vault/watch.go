@@ -0,0 +1,299 @@
+package vault
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRefresh = 5 * time.Minute
+	minRetryDelay  = time.Second
+	maxRetryDelay  = time.Minute
+)
+
+// LoginFunc logs c in, such as by calling c.Login.
+type LoginFunc func(ctx context.Context, c *Client) (*Auth, error)
+
+// Target is a secret to watch: the value of a field of the secret
+// at a path, or all of its data if the field is empty.
+type Target struct {
+	Name  string
+	Path  string
+	Field string
+}
+
+// WatchConfig configures a Watcher.
+type WatchConfig struct {
+	// Login logs in, and again when the token cannot be renewed.
+	// If nil the client's token is used as is.
+	Login LoginFunc
+
+	// Refresh is how often secrets without leases, such as those
+	// of the KV secrets engine, are read again to pick up rotations.
+	// If zero it defaults to 5 minutes.
+	Refresh time.Duration
+
+	// OnValue is called with the value of a target whenever it is
+	// read, and OnError with errors logging in or reading secrets.
+	// The target name is "" for login errors.
+	OnValue func(name, value string)
+	OnError func(name string, err error)
+}
+
+// Watcher keeps a client logged in and the values of secrets up to
+// date, renewing the token and the leases of secrets until they can
+// no longer be renewed, at which point it logs in again or reads the
+// secrets again. Secrets are read again after logging in again, since
+// their leases are revoked along with the previous token.
+type Watcher struct {
+	c       *Client
+	cfg     WatchConfig
+	targets map[string][]Target // by path
+	after   func(time.Duration) <-chan time.Time
+
+	ctx  context.Context // canceled by Stop
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	relogin chan struct{} // closed when logged in again
+}
+
+func NewWatcher(c *Client, targets []Target, cfg WatchConfig) *Watcher {
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = defaultRefresh
+	}
+	if cfg.OnValue == nil {
+		cfg.OnValue = func(string, string) {}
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(string, error) {}
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	w := &Watcher{
+		ctx:     ctx,
+		stop:    stop,
+		c:       c,
+		cfg:     cfg,
+		targets: make(map[string][]Target),
+		after:   time.After,
+		relogin: make(chan struct{}),
+	}
+	for _, t := range targets {
+		w.targets[t.Path] = append(w.targets[t.Path], t)
+	}
+	return w
+}
+
+// Start logs in and reads the secrets using ctx, returning the first
+// error, and keeps them up to date in the background until Stop is
+// called. Secrets that could not be read are retried in the background.
+func (w *Watcher) Start(ctx context.Context) error {
+	var first error
+	var auth *Auth
+	if w.cfg.Login != nil {
+		var err error
+		if auth, err = w.cfg.Login(ctx, w.c); err != nil {
+			w.cfg.OnError("", err)
+			first = err
+		}
+	}
+	w.wg.Add(1)
+	go w.keepToken(w.ctx, auth)
+
+	for path, targets := range w.targets {
+		sec, err := w.read(ctx, path, targets)
+		if err != nil && first == nil {
+			first = err
+		}
+		w.wg.Add(1)
+		go w.keepSecret(w.ctx, path, targets, sec)
+	}
+	return first
+}
+
+// Stop stops keeping the secrets up to date.
+func (w *Watcher) Stop() {
+	w.stop()
+	w.wg.Wait()
+}
+
+// relogged returns a channel closed when the client logs in again.
+func (w *Watcher) relogged() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.relogin
+}
+
+// keepToken renews the client's token, logging in again when it
+// cannot be renewed. Login failures are retried with backoff.
+func (w *Watcher) keepToken(ctx context.Context, auth *Auth) {
+	defer w.wg.Done()
+	if w.cfg.Login == nil {
+		return
+	}
+	delay := minRetryDelay
+	for {
+		if auth == nil {
+			// Logging in failed; retry.
+			if !w.sleep(ctx, delay, nil) {
+				return
+			}
+			delay = backoff(delay)
+		} else {
+			if auth.LeaseDuration <= 0 {
+				return // the token does not expire
+			}
+			if !w.sleep(ctx, auth.LeaseDuration*2/3, nil) {
+				return
+			}
+			if auth.Renewable {
+				renewed, err := w.c.RenewSelf(ctx)
+				if err == nil && renewed.LeaseDuration >= auth.LeaseDuration {
+					auth = renewed
+					continue
+				} else if err == nil {
+					// The token is reaching its maximum TTL; use it
+					// while logging in again before it expires.
+					auth = renewed
+					auth.Renewable = false
+					continue
+				}
+				w.cfg.OnError("", err)
+			}
+		}
+
+		var err error
+		if auth, err = w.cfg.Login(ctx, w.c); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.cfg.OnError("", err)
+			auth = nil
+			continue
+		}
+		delay = minRetryDelay
+		w.mu.Lock()
+		close(w.relogin)
+		w.relogin = make(chan struct{})
+		w.mu.Unlock()
+	}
+}
+
+// keepSecret keeps the targets of the secret at path up to date,
+// given the secret last read, or nil if reading it failed.
+func (w *Watcher) keepSecret(ctx context.Context, path string, targets []Target, sec *Secret) {
+	defer w.wg.Done()
+	delay := minRetryDelay
+	for {
+		relogin := w.relogged()
+		switch {
+		case sec == nil:
+			if !w.sleep(ctx, delay, relogin) {
+				return
+			}
+			delay = backoff(delay)
+		case sec.LeaseID == "" || sec.LeaseDuration <= 0:
+			delay = minRetryDelay
+			if !w.sleep(ctx, w.cfg.Refresh, relogin) {
+				return
+			}
+		default:
+			delay = minRetryDelay
+			onErr := func(err error) {
+				for _, t := range targets {
+					w.cfg.OnError(t.Name, err)
+				}
+			}
+			if !w.keepLease(ctx, sec, relogin, onErr) {
+				return
+			}
+		}
+		sec, _ = w.read(ctx, path, targets)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// keepLease renews the lease of sec until it cannot be renewed any
+// longer or the client logs in again, reporting false if ctx is
+// canceled first. Renewal errors are passed to onErr.
+func (w *Watcher) keepLease(ctx context.Context, sec *Secret, relogin <-chan struct{}, onErr func(error)) bool {
+	lease := sec.LeaseDuration
+	renewable := sec.Renewable
+	for {
+		select {
+		case <-relogin:
+			return true
+		default:
+		}
+		if !w.sleep(ctx, lease*2/3, relogin) {
+			return false
+		}
+		if !renewable {
+			return true
+		}
+		renewed, err := w.c.RenewLease(ctx, sec.LeaseID, sec.LeaseDuration)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			onErr(err)
+			return true
+		}
+		if renewed.LeaseDuration < sec.LeaseDuration {
+			// Capped by the lease's maximum TTL; read the secret
+			// again before it expires.
+			renewable = false
+		}
+		lease = renewed.LeaseDuration
+	}
+}
+
+// read reads the secret at path, reporting the values of its targets.
+func (w *Watcher) read(ctx context.Context, path string, targets []Target) (*Secret, error) {
+	sec, err := w.c.Read(ctx, path)
+	if err != nil {
+		if ctx.Err() == nil {
+			for _, t := range targets {
+				w.cfg.OnError(t.Name, err)
+			}
+		}
+		return nil, err
+	}
+	var first error
+	for _, t := range targets {
+		v, err := sec.Value(t.Field)
+		if err != nil {
+			w.cfg.OnError(t.Name, err)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		w.cfg.OnValue(t.Name, v)
+	}
+	return sec, first
+}
+
+// sleep waits for d, reporting false if ctx is canceled first.
+// It returns early if wake is closed.
+func (w *Watcher) sleep(ctx context.Context, d time.Duration, wake <-chan struct{}) bool {
+	select {
+	case <-w.after(d):
+		return true
+	case <-wake:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func backoff(d time.Duration) time.Duration {
+	if d *= 2; d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
@@ -0,0 +1,449 @@
+// Package websocket implements the server side
+// of the WebSocket protocol (RFC 6455).
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Message types.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+// Frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// Close codes.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseTooLarge        = 1009
+	CloseInternalError   = 1011
+)
+
+// acceptGUID is the GUID used to compute Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// closeTimeout is how long Close waits for the
+// client to acknowledge the close handshake.
+const closeTimeout = 5 * time.Second
+
+// CloseError is returned by ReadMessage when the client closes the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: closed with code %d: %s", e.Code, e.Reason)
+}
+
+// ErrClosed is returned when using a connection that has been closed.
+var ErrClosed = errors.New("websocket: connection closed")
+
+// HandshakeError is returned by Upgrade for invalid handshake requests.
+type HandshakeError struct {
+	Status int
+	Msg    string
+}
+
+func (e *HandshakeError) Error() string { return "websocket: " + e.Msg }
+
+type Options struct {
+	// Subprotocols are the supported subprotocols, in order of preference.
+	Subprotocols []string
+
+	// CheckOrigin reports whether to accept a request with the given
+	// Origin header. If nil, requests whose origin host differs from
+	// the request's host are rejected.
+	CheckOrigin func(req *http.Request) bool
+
+	// MaxMessageSize is the maximum size of received messages.
+	// If zero it defaults to 1 MiB.
+	MaxMessageSize int64
+
+	// IdleTimeout, if non-zero, fails reads when no frame, including
+	// pongs, is received from the client within the timeout.
+	IdleTimeout time.Duration
+}
+
+// Upgrade upgrades the HTTP connection of req to a WebSocket connection.
+// On failure the handshake error has been written as the response.
+func Upgrade(w http.ResponseWriter, req *http.Request, opts Options) (*Conn, error) {
+	fail := func(status int, msg string) (*Conn, error) {
+		http.Error(w, msg, status)
+		return nil, &HandshakeError{Status: status, Msg: msg}
+	}
+	if req.Method != http.MethodGet {
+		return fail(http.StatusMethodNotAllowed, "handshake requires GET")
+	}
+	if !headerContains(req.Header, "Connection", "upgrade") || !headerContains(req.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := opts.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return fail(http.StatusForbidden, "origin not allowed")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return fail(http.StatusInternalServerError, "connection does not support upgrading")
+	}
+	subprotocol := negotiateSubprotocol(req, opts.Subprotocols)
+
+	nc, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack: %v", err)
+	}
+	if brw.Reader.Buffered() > 0 {
+		nc.Close()
+		return nil, errors.New("websocket: client sent data before handshake completed")
+	}
+
+	var resp strings.Builder
+	resp.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	resp.WriteString("Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		resp.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	resp.WriteString("\r\n")
+	if _, err := nc.Write([]byte(resp.String())); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{}) // clear server timeouts
+
+	maxSize := opts.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = 1 << 20
+	}
+	return &Conn{
+		nc:          nc,
+		br:          brw.Reader,
+		maxSize:     maxSize,
+		idleTimeout: opts.IdleTimeout,
+		Subprotocol: subprotocol,
+		closeAck:    make(chan struct{}),
+	}, nil
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept value for a key.
+func AcceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerContains reports whether the comma-separated
+// header contains token, ignoring case.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether the request has no Origin
+// header or one whose host matches the request's host.
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	i := strings.Index(origin, "://")
+	return i != -1 && strings.EqualFold(origin[i+3:], req.Host)
+}
+
+func negotiateSubprotocol(req *http.Request, supported []string) string {
+	var requested []string
+	for _, v := range req.Header["Sec-Websocket-Protocol"] {
+		for _, p := range strings.Split(v, ",") {
+			requested = append(requested, strings.TrimSpace(p))
+		}
+	}
+	for _, s := range supported {
+		for _, r := range requested {
+			if s == r {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Conn is a server-side WebSocket connection. Reads must be done by a
+// single goroutine; writes are safe for concurrent use.
+type Conn struct {
+	// Subprotocol is the negotiated subprotocol, or "".
+	Subprotocol string
+
+	nc          net.Conn
+	br          *bufio.Reader
+	maxSize     int64
+	idleTimeout time.Duration
+
+	wmu    sync.Mutex
+	closed bool // close frame sent
+
+	reading   int32 // whether ReadMessage is running, accessed atomically
+	closeOnce sync.Once
+	closeAck  chan struct{} // closed when the client's close frame is read
+}
+
+// ReadMessage reads the next data message, handling control frames.
+// When the client closes the connection it returns a *CloseError,
+// after acknowledging the close.
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	atomic.StoreInt32(&c.reading, 1)
+	defer atomic.StoreInt32(&c.reading, 0)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil && err != ErrClosed {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.handleClose(payload)
+		case opText, opBinary:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+			}
+			messageType = int(op)
+		case opContinuation:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+
+		if int64(len(data))+int64(len(payload)) > c.maxSize {
+			return 0, nil, c.fail(CloseTooLarge, "message too large")
+		}
+		data = append(data, payload...)
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(data) {
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8")
+			}
+			return messageType, data, nil
+		}
+	}
+}
+
+// readFrame reads a frame, unmasking its payload.
+func (c *Conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	if c.idleTimeout > 0 {
+		c.nc.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	}
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = hdr[0]&0x80 != 0
+	op = hdr[0] & 0x0f
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	if hdr[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "client frames must be masked")
+	}
+
+	n := int64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint64(b[:]))
+	}
+	if op >= opClose {
+		if n > 125 || !fin {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+		}
+	}
+	if n < 0 || n > c.maxSize {
+		return false, 0, nil, c.fail(CloseTooLarge, "message too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// handleClose handles a close frame from the client.
+func (c *Conn) handleClose(payload []byte) error {
+	ce := &CloseError{Code: CloseNoStatus}
+	if len(payload) >= 2 {
+		ce.Code = int(binary.BigEndian.Uint16(payload))
+		ce.Reason = string(payload[2:])
+	}
+	c.wmu.Lock()
+	sentClose := c.closed
+	c.wmu.Unlock()
+	if !sentClose {
+		// Echo the close code to complete the handshake.
+		code := ce.Code
+		if code == CloseNoStatus {
+			code = CloseNormal
+		}
+		c.writeFrame(opClose, closePayload(code, ""))
+	}
+	c.ackClose()
+	c.nc.Close()
+	return ce
+}
+
+func (c *Conn) ackClose() {
+	c.closeOnce.Do(func() { close(c.closeAck) })
+}
+
+// fail closes the connection due to a protocol error.
+func (c *Conn) fail(code int, reason string) error {
+	c.writeFrame(opClose, closePayload(code, reason))
+	c.nc.Close()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// WriteMessage writes a data message.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", messageType)
+	}
+	return c.writeFrame(byte(messageType), data)
+}
+
+// Ping sends a ping. The client's pong is handled by ReadMessage.
+func (c *Conn) Ping(data []byte) error {
+	return c.writeFrame(opPing, data)
+}
+
+// SetWriteDeadline sets the deadline for writes.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.nc.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for reads.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.nc.SetReadDeadline(t)
+}
+
+// writeFrame writes an unmasked frame, as servers do.
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if op == opClose {
+		c.closed = true
+	}
+
+	hdr := make([]byte, 2, 10+len(payload))
+	hdr[0] = 0x80 | op
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = append(hdr, byte(n>>8), byte(n))
+	default:
+		hdr[1] = 127
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		hdr = append(hdr, b[:]...)
+	}
+	_, err := c.nc.Write(append(hdr, payload...))
+	return err
+}
+
+func closePayload(code int, reason string) []byte {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	b := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(b, uint16(code))
+	return append(b, reason...)
+}
+
+// Close starts the close handshake with the given code and reason.
+// If ReadMessage is running concurrently, it waits for the client to
+// acknowledge the close, or for a timeout, before closing the connection.
+func (c *Conn) Close(code int, reason string) error {
+	if err := c.writeFrame(opClose, closePayload(code, reason)); err != nil {
+		return c.nc.Close()
+	}
+	if atomic.LoadInt32(&c.reading) == 1 {
+		select {
+		case <-c.closeAck:
+		case <-time.After(closeTimeout):
+		}
+	}
+	return c.nc.Close()
+}
@@ -0,0 +1,187 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455, section 1.3.
+	if got, want := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf("AcceptKey = %q, want %q", got, want)
+	}
+}
+
+// dial performs the handshake with srv and returns the connection.
+func dial(t *testing.T, srv *httptest.Server, extra string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	nc, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	nc.SetDeadline(time.Now().Add(5 * time.Second))
+	req := "GET / HTTP/1.1\r\nHost: " + srv.Listener.Addr().String() + "\r\n" +
+		"Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" + extra + "\r\n"
+	if _, err := nc.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(nc)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nc, br, resp
+}
+
+// writeClientFrame writes a masked frame, as clients do.
+func writeClientFrame(t *testing.T, w io.Writer, fin bool, op byte, payload []byte) {
+	t.Helper()
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	default:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, c := range payload {
+		frame = append(frame, c^mask[i%4])
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readServerFrame reads an unmasked frame.
+func readServerFrame(t *testing.T, r io.Reader) (op byte, payload []byte) {
+	t.Helper()
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	if hdr[1]&0x80 != 0 {
+		t.Fatal("server frame is masked")
+	}
+	n := int(hdr[1] & 0x7f)
+	if n == 126 {
+		var b [2]byte
+		io.ReadFull(r, b[:])
+		n = int(binary.BigEndian.Uint16(b[:]))
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return hdr[0] & 0x0f, payload
+}
+
+func echoServer(t *testing.T, opts Options, done chan<- error) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c, err := Upgrade(w, req, opts)
+		if err != nil {
+			done <- err
+			return
+		}
+		for {
+			typ, data, err := c.ReadMessage()
+			if err != nil {
+				done <- err
+				return
+			}
+			if err := c.WriteMessage(typ, data); err != nil {
+				done <- err
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEcho(t *testing.T) {
+	done := make(chan error, 1)
+	srv := echoServer(t, Options{Subprotocols: []string{"chat"}}, done)
+	nc, br, resp := dial(t, srv, "Sec-WebSocket-Protocol: other, chat\r\n")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != "chat" {
+		t.Errorf("got subprotocol %q, want %q", got, "chat")
+	}
+
+	// A fragmented message with an interleaved ping.
+	writeClientFrame(t, nc, false, opText, []byte("hello, "))
+	writeClientFrame(t, nc, true, opPing, []byte("p"))
+	writeClientFrame(t, nc, true, opContinuation, []byte("world"))
+	if op, payload := readServerFrame(t, br); op != opPong || string(payload) != "p" {
+		t.Errorf("got frame %x %q, want pong", op, payload)
+	}
+	if op, payload := readServerFrame(t, br); op != opText || string(payload) != "hello, world" {
+		t.Errorf("got frame %x %q, want echoed text", op, payload)
+	}
+
+	long := strings.Repeat("x", 300)
+	writeClientFrame(t, nc, true, opBinary, []byte(long))
+	if op, payload := readServerFrame(t, br); op != opBinary || string(payload) != long {
+		t.Errorf("got frame %x of %d bytes, want echoed binary", op, len(payload))
+	}
+
+	writeClientFrame(t, nc, true, opClose, closePayload(CloseGoingAway, "bye"))
+	if op, payload := readServerFrame(t, br); op != opClose || binary.BigEndian.Uint16(payload) != CloseGoingAway {
+		t.Errorf("got frame %x %q, want close", op, payload)
+	}
+	var ce *CloseError
+	if err := <-done; !errors.As(err, &ce) || ce.Code != CloseGoingAway || ce.Reason != "bye" {
+		t.Errorf("got error %v, want close error", err)
+	}
+}
+
+func TestMessageTooLarge(t *testing.T) {
+	done := make(chan error, 1)
+	srv := echoServer(t, Options{MaxMessageSize: 4}, done)
+	nc, br, _ := dial(t, srv, "")
+	writeClientFrame(t, nc, true, opText, []byte("too long"))
+	if op, payload := readServerFrame(t, br); op != opClose || binary.BigEndian.Uint16(payload) != CloseTooLarge {
+		t.Errorf("got frame %x %q, want close", op, payload)
+	}
+	var ce *CloseError
+	if err := <-done; !errors.As(err, &ce) || ce.Code != CloseTooLarge {
+		t.Errorf("got error %v, want close error", err)
+	}
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	done := make(chan error, 1)
+	srv := echoServer(t, Options{}, done)
+
+	_, _, resp := dial(t, srv, "Origin: https://evil.example\r\n")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin: got status %d, want 403", resp.StatusCode)
+	}
+	<-done
+
+	resp2, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain request: got status %d, want 400", resp2.StatusCode)
+	}
+	<-done
+}
@@ -0,0 +1,201 @@
+// Package lock provides distributed locks, for making sure only one
+// instance of the application does something at a time, such as for
+// electing a leader or running a singleton background job.
+//
+// Locks are stored in the Redis server caches are stored in, and are
+// held for a time to live which is renewed automatically until they
+// are released. If renewing fails, such as when Redis is unreachable
+// for longer than the TTL, the lock may be acquired by another
+// instance and the holder is notified through Lost.
+//
+// Each acquisition of a lock has a fencing token greater than those of
+// previous acquisitions of it. Passing it along with writes protected
+// by the lock lets the systems written to reject writes from holders
+// that have since lost the lock.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/redis"
+	"runtime.encore.dev/runtime"
+)
+
+// ErrLocked is returned by TryAcquire when the lock is held.
+var ErrLocked = errors.New("lock: held by another owner")
+
+const (
+	minRetryDelay = 50 * time.Millisecond
+	maxRetryDelay = time.Second
+)
+
+// acquireScript sets KEYS[1] to the owner ARGV[1] for ARGV[2]
+// milliseconds unless it is set, and returns the next fencing
+// token, counted by KEYS[2], or 0 if it is set.
+const acquireScript = `
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`
+
+// renewScript extends KEYS[1] by ARGV[2] milliseconds
+// if it is still owned by ARGV[1].
+const renewScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`
+
+// releaseScript deletes KEYS[1] if it is still owned by ARGV[1].
+const releaseScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+
+// Lock is an acquired lock.
+type Lock struct {
+	name   string
+	key    string
+	owner  string
+	token  int64
+	ttl    time.Duration
+	client *redis.Client
+
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Acquire acquires the lock with the given name, waiting until it is
+// released by its holder or expires, or until ctx is done. The lock
+// is held for ttl, which is renewed until the lock is released.
+func Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	delay := minRetryDelay
+	for {
+		l, err := TryAcquire(ctx, name, ttl)
+		if err != ErrLocked {
+			return l, err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, errs.WrapCode(ctx.Err(), errs.DeadlineExceeded, "lock: could not acquire "+name)
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// TryAcquire is like Acquire, but returns ErrLocked
+// instead of waiting if the lock is held.
+func TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if name == "" || ttl < 10*time.Millisecond {
+		return nil, errs.B().Code(errs.InvalidArgument).Msg("lock: invalid name or ttl").Err()
+	}
+	client, prefix := runtime.CacheClient()
+	if client == nil {
+		return nil, errs.B().Code(errs.Internal).Msg("lock: caching not configured").Err()
+	}
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, errs.WrapCode(err, errs.Internal, "lock: could not generate owner id")
+	}
+
+	l := &Lock{
+		name:   name,
+		key:    prefix + "__encore_lock:" + name,
+		owner:  hex.EncodeToString(id[:]),
+		ttl:    ttl,
+		client: client,
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	token, err := redis.Int64(client.Do(ctx, "EVAL", acquireScript, 2, l.key, prefix+"__encore_lock_fence:"+name, l.owner, ttl.Milliseconds()))
+	if err != nil {
+		return nil, errs.WrapCode(err, errs.Unavailable, "lock: could not acquire "+name)
+	} else if token == 0 {
+		return nil, ErrLocked
+	}
+	l.token = token
+	go l.renew(time.Now())
+	return l, nil
+}
+
+// Name returns the name of the lock.
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Token returns the fencing token of this acquisition of the lock.
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Lost returns a channel that is closed if the lock is lost
+// before being released, after which it may be held by another
+// owner and whatever it protects should stop.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// renew renews the lock every third of its TTL until released,
+// marking it lost once it is taken over or has not been renewed
+// for its TTL. The lock was last renewed at renewed.
+func (l *Lock) renew(renewed time.Time) {
+	defer close(l.done)
+	t := time.NewTicker(l.ttl / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-l.stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		start := time.Now()
+		n, err := redis.Int64(l.client.Do(ctx, "EVAL", renewScript, 1, l.key, l.owner, l.ttl.Milliseconds()))
+		cancel()
+		switch {
+		case err == nil && n == 1:
+			renewed = start
+		case err == nil || time.Since(renewed) >= l.ttl:
+			runtime.RootLogger.Error().Err(err).Str("lock", l.name).Msg("lock: lost lock")
+			l.lostOnce.Do(func() { close(l.lost) })
+			return
+		default:
+			runtime.RootLogger.Warn().Err(err).Str("lock", l.name).Msg("lock: could not renew lock")
+		}
+	}
+}
+
+// Release releases the lock, unless it has been lost.
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+	select {
+	case <-l.lost:
+		return nil
+	default:
+	}
+	if _, err := l.client.Do(ctx, "EVAL", releaseScript, 1, l.key, l.owner); err != nil {
+		return errs.WrapCode(err, errs.Unavailable, "lock: could not release "+l.name)
+	}
+	return nil
+}
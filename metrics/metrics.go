@@ -0,0 +1,104 @@
+// Package metrics lets applications define custom metrics.
+//
+// Metrics are registered with the runtime when created and are
+// exported alongside the runtime's own metrics, both when scraped
+// and when pushed to a backend. They are typically declared as
+// package-level variables:
+//
+//	var ordersPlaced = metrics.NewCounter("orders_placed_total",
+//		"Number of orders placed.", "region")
+//
+//	func PlaceOrder(...) {
+//		ordersPlaced.Inc("eu")
+//	}
+//
+// Metric and label names must be valid Prometheus names, and each
+// metric name can only be registered once; the constructors panic
+// otherwise. Methods taking label values panic if the number of
+// values does not match the number of labels.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Counter is a cumulative metric that only increases.
+type Counter struct {
+	vec *prometheus.CounterVec
+}
+
+// NewCounter creates and registers a counter with the given labels.
+func NewCounter(name, help string, labels ...string) *Counter {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	prometheus.MustRegister(vec)
+	return &Counter{vec: vec}
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Inc()
+}
+
+// Add adds v to the counter. It panics if v is negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Add(v)
+}
+
+// Gauge is a metric that can go up and down.
+type Gauge struct {
+	vec *prometheus.GaugeVec
+}
+
+// NewGauge creates and registers a gauge with the given labels.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	prometheus.MustRegister(vec)
+	return &Gauge{vec: vec}
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Set(v)
+}
+
+// Inc increments the gauge by 1.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Inc()
+}
+
+// Dec decrements the gauge by 1.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Dec()
+}
+
+// Add adds v, which may be negative, to the gauge.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Add(v)
+}
+
+// Histogram samples observations, such as request durations,
+// and counts them in configurable buckets.
+type Histogram struct {
+	vec *prometheus.HistogramVec
+}
+
+// DefaultBuckets are the default histogram buckets, suitable for
+// durations in seconds from 5ms to 10s.
+var DefaultBuckets = prometheus.DefBuckets
+
+// NewHistogram creates and registers a histogram with the given labels.
+// Buckets are the upper bounds of the buckets, in increasing order;
+// if nil DefaultBuckets is used.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	prometheus.MustRegister(vec)
+	return &Histogram{vec: vec}
+}
+
+// Observe adds an observation to the histogram.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(v)
+}
@@ -0,0 +1,75 @@
+// Package middleware provides a way to wrap the handling of API endpoints
+// with cross-cutting functionality, such as logging or authentication.
+//
+// Middleware is configured globally, per service, and per endpoint.
+// For a given endpoint the global middleware runs first, followed by the
+// service middleware and finally the endpoint middleware. Within each group
+// middleware runs in the order it was declared, with the first being
+// the outermost.
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Request describes an API request being processed.
+type Request struct {
+	Service  string // service name
+	Endpoint string // endpoint name
+	Path     string // path pattern of the endpoint
+
+	// HTTP is the underlying HTTP request.
+	// Middleware may replace it, for example to add context values,
+	// before passing the request on.
+	HTTP   *http.Request
+	Params httprouter.Params
+}
+
+// ResponseWriter is an http.ResponseWriter that also
+// provides information about the response written so far.
+type ResponseWriter interface {
+	http.ResponseWriter
+
+	// Status reports the HTTP status code written,
+	// or 0 if no status code has been written yet.
+	Status() int
+
+	// Written reports the number of response body bytes written.
+	Written() int64
+}
+
+// Handler handles an API request.
+type Handler func(w ResponseWriter, req *Request)
+
+// Middleware wraps a Handler to provide additional functionality.
+// It must call next to continue processing the request,
+// unless it decides to respond to the request itself.
+type Middleware func(next Handler) Handler
+
+// Chain returns a Handler that runs the given middleware
+// in order before calling h. The first middleware is the outermost.
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Response is a serialized response, buffered so it
+// can be transformed by response hooks before it is sent.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// ResponseHook transforms a response after the endpoint handler has
+// produced it, such as by adding headers, wrapping the body in an
+// envelope or removing fields. It may modify resp in place.
+// If it returns an error the request fails with an internal error.
+//
+// Hooks see the uncompressed body, and are not run for raw
+// endpoints or streamed responses that are flushed.
+type ResponseHook func(req *Request, resp *Response) error
@@ -0,0 +1,89 @@
+// Package pagination provides helpers for cursor-based pagination.
+//
+// Cursors are opaque to clients: they encode an application-defined
+// position, such as the ID of the last item returned, signed with
+// the key configured for the application so they cannot be forged.
+//
+// A typical list endpoint looks like:
+//
+//	type ListParams struct {
+//		Cursor string `json:"cursor"`
+//		Limit  int    `json:"limit"`
+//	}
+//
+//	func List(ctx context.Context, p *ListParams) (*pagination.Page, error) {
+//		var after struct{ ID int64 }
+//		if err := pagination.Decode(p.Cursor, &after); err != nil {
+//			return nil, err
+//		}
+//		limit := pagination.Size(p.Limit)
+//		items := ... // query limit+1 items with ID > after.ID
+//		var next interface{}
+//		if len(items) > limit {
+//			items = items[:limit]
+//			next = struct{ ID int64 }{items[limit-1].ID}
+//		}
+//		return pagination.NewPage(items, next)
+//	}
+package pagination
+
+import (
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/pagination"
+)
+
+// Page is the standard response envelope for a page of items.
+type Page struct {
+	// Items are the items of the page.
+	Items interface{} `json:"items"`
+
+	// NextCursor is the cursor for the next page,
+	// or empty if this is the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPage returns a page of items, with a cursor for the next page
+// encoding next. If next is nil the page is the last page.
+func NewPage(items interface{}, next interface{}) (*Page, error) {
+	p := &Page{Items: items}
+	if next != nil {
+		cursor, err := Encode(next)
+		if err != nil {
+			return nil, err
+		}
+		p.NextCursor = cursor
+	}
+	return p, nil
+}
+
+// Encode encodes v, which must be JSON-encodable, into an opaque cursor.
+func Encode(v interface{}) (string, error) {
+	return pagination.Encode(v)
+}
+
+// Decode decodes a cursor created by Encode into dst.
+// An empty cursor, denoting the first page, leaves dst unchanged.
+// If the cursor is malformed or was not signed by the application
+// it returns an error with code errs.InvalidArgument.
+func Decode(cursor string, dst interface{}) error {
+	if cursor == "" {
+		return nil
+	}
+	if err := pagination.Decode(cursor, dst); err != nil {
+		return errs.B().Code(errs.InvalidArgument).Msg("invalid cursor").Err()
+	}
+	return nil
+}
+
+// Size returns the page size to use for a requested size:
+// the configured default if requested is not positive,
+// and at most the configured maximum.
+func Size(requested int) int {
+	return pagination.Size(requested)
+}
+
+// Clamp returns def if requested is not positive,
+// and otherwise requested capped to max.
+func Clamp(requested, def, max int) int {
+	return pagination.Clamp(requested, def, max)
+}
@@ -0,0 +1,101 @@
+// Package pubsub provides asynchronous publish/subscribe messaging.
+//
+// Messages are published to topics, and delivered at least once to
+// each subscription of the topic, whose handlers are declared in the
+// application's configuration. Handlers run like calls to endpoints:
+// they are logged, traced and measured, and a message whose handler
+// fails is redelivered with exponential backoff. Once its retries
+// are exhausted it is published to the subscription's dead-letter
+// topic, if any, from which it can be re-driven.
+//
+// Since messages may be delivered more than once, handlers should be
+// idempotent, or their subscriptions should have a dedup window, in
+// which case messages with the same ID are only handled once. Messages
+// can be published with an ID, such as one derived from the event they
+// describe, so that republishing them does not handle them again.
+//
+// Messages published with PublishTx are written to the outbox of the
+// transaction's database and published once it commits, so that they
+// are published if and only if the transaction's changes are made.
+package pubsub
+
+import (
+	"context"
+	"time"
+
+	"runtime.encore.dev/runtime"
+	"runtime.encore.dev/storage/sqldb"
+)
+
+// Topic is a topic that messages are published to.
+type Topic struct {
+	name string
+}
+
+// NewTopic returns the topic with the given name.
+func NewTopic(name string) *Topic {
+	return &Topic{name: name}
+}
+
+// Name returns the name of the topic.
+func (t *Topic) Name() string {
+	return t.name
+}
+
+// Publish publishes msg, which must be JSON-encodable, to the topic
+// and returns the ID of the published message.
+func (t *Topic) Publish(ctx context.Context, msg interface{}) (id string, err error) {
+	return runtime.Publish(ctx, t.name, msg)
+}
+
+// PublishOrdered is like Publish, but with an ordering key. Messages
+// with the same ordering key are delivered to each subscription one
+// at a time, in the order they were published, while messages with
+// different keys are handled concurrently.
+func (t *Topic) PublishOrdered(ctx context.Context, orderingKey string, msg interface{}) (id string, err error) {
+	return runtime.PublishOrdered(ctx, t.name, orderingKey, msg)
+}
+
+// PublishOptions are options for publishing a message.
+type PublishOptions struct {
+	// ID, if set, is the ID of the message instead of a generated one,
+	// of at most 255 bytes. Subscriptions with a dedup window handle
+	// messages with the same ID only once.
+	ID string
+
+	// OrderingKey, if set, is the ordering key of the message.
+	OrderingKey string
+
+	// DeliverAt or Delay, if set, delay the delivery of the
+	// message until the given time or by the given duration.
+	// At most one of them may be set.
+	DeliverAt time.Time
+	Delay     time.Duration
+}
+
+// PublishWithOptions is like Publish, but with the given options.
+func (t *Topic) PublishWithOptions(ctx context.Context, msg interface{}, opts PublishOptions) (id string, err error) {
+	return runtime.PublishWithOptions(ctx, t.name, msg, runtime.PublishOptions{
+		ID:          opts.ID,
+		OrderingKey: opts.OrderingKey,
+		DeliverAt:   opts.DeliverAt,
+		Delay:       opts.Delay,
+	})
+}
+
+// PublishTx publishes msg to the topic once tx commits, and returns
+// the ID the message is published with. Nothing is published if tx
+// rolls back. The transaction's database must have an outbox.
+func (t *Topic) PublishTx(ctx context.Context, tx *sqldb.Tx, msg interface{}) (id string, err error) {
+	return t.PublishTxWithOptions(ctx, tx, msg, PublishOptions{})
+}
+
+// PublishTxWithOptions is like PublishTx, but with the given options.
+func (t *Topic) PublishTxWithOptions(ctx context.Context, tx *sqldb.Tx, msg interface{}, opts PublishOptions) (id string, err error) {
+	return tx.Publish(ctx, t.name, msg, runtime.PublishOptions{
+		ID:          opts.ID,
+		OrderingKey: opts.OrderingKey,
+		DeliverAt:   opts.DeliverAt,
+		Delay:       opts.Delay,
+	})
+}
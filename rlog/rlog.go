@@ -1,11 +1,20 @@
 package rlog
 
 import (
+	"context"
+
+	"runtime.encore.dev/internal/logsample"
 	"runtime.encore.dev/internal/rlog"
 )
 
 type Ctx = rlog.Ctx
 
+// SamplingPolicy is a log sampling policy, used with Ctx.Sample.
+// The first Burst messages in each Period are logged, and after
+// that one in every N messages. If N is zero, messages beyond
+// the burst are dropped.
+type SamplingPolicy = logsample.Policy
+
 func Debug(msg string, keysAndValues ...interface{}) {
 	rlog.Debug(msg, keysAndValues...)
 }
@@ -18,6 +27,13 @@ func Error(msg string, keysAndValues ...interface{}) {
 	rlog.Error(msg, keysAndValues...)
 }
 
+// FromContext returns the logger of the request associated with ctx,
+// with fields identifying the request such as the request id, trace id,
+// service, endpoint and authenticated user, so logs can be correlated.
+func FromContext(ctx context.Context) Ctx {
+	return rlog.FromContext(ctx)
+}
+
 func With(keysAndValues ...interface{}) Ctx {
 	return rlog.With(keysAndValues...)
 }
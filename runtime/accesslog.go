@@ -0,0 +1,52 @@
+package runtime
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// accessLog returns a middleware that logs a record per request,
+// or nil if access logging is disabled for the endpoint.
+func (srv *Server) accessLog(endpoint *config.Endpoint) middleware.Middleware {
+	cfg := srv.cfg.AccessLog
+	if endpoint.AccessLog != nil {
+		cfg = *endpoint.AccessLog
+	}
+	if cfg.Disabled {
+		return nil
+	}
+
+	rate := cfg.SampleRate
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			if rate > 0 && rate < 1 && rand.Float64() >= rate {
+				next(w, req)
+				return
+			}
+
+			start := time.Now()
+			next(w, req)
+			dur := time.Since(start)
+
+			status := w.Status()
+			if status == 0 {
+				status = http.StatusOK // nothing written; net/http responds with 200
+			}
+			srv.logger.Info().
+				Str("method", req.HTTP.Method).
+				Str("path", req.HTTP.URL.Path).
+				Str("service", req.Service).
+				Str("endpoint", req.Endpoint).
+				Int("status", status).
+				Dur("duration", dur).
+				Int64("bytes", w.Written()).
+				Str("remote_ip", srv.clientIP(req.HTTP).String()).
+				Str("request_id", RequestID(req.HTTP.Context())).
+				Msg("access")
+		}
+	}
+}
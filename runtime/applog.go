@@ -0,0 +1,188 @@
+package runtime
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultLogSocket = "/var/lib/encore/applog.sock"
+
+// maxLogBuffer is the maximum number of bytes of log output
+// buffered while reconnecting to the logging socket.
+const maxLogBuffer = 1 << 20
+
+// setupLogging redirects stdout/stderr to the logging socket at path
+// (by default /var/lib/encore/applog.sock) for log forwarding, and
+// reconnects if the socket goes away. It exits on error, unless
+// fallback is true in which case it keeps logging to stderr if the
+// socket is unavailable.
+func setupLogging(path string, fallback bool) {
+	if path == "" {
+		path = defaultLogSocket
+	}
+	if fallback {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			log.Printf("logging socket %s does not exist, logging to stderr", path)
+			return
+		}
+	}
+
+	var sock *net.UnixConn
+	for i := 0; ; i++ {
+		var err error
+		sock, err = dialLogSocket(path)
+		if err == nil {
+			break
+		} else if i == 120 {
+			if fallback {
+				log.Printf("could not dial logging socket, logging to stderr: %v", err)
+				return
+			}
+			log.Fatalln("could not setup logging:", err)
+		}
+		log.Printf("could not dial logging socket: %v", err)
+		time.Sleep(1 * time.Second)
+	}
+	// Postcondition: sock != nil
+
+	if err := redirectOutput(sock); err != nil {
+		log.Fatalln("could not setup logging:", err)
+	}
+
+	// Writing to a broken socket on stdout/stderr raises SIGPIPE,
+	// which would kill the process; receive it to get EPIPE instead.
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGPIPE)
+	go monitorLogSocket(path, sock)
+}
+
+func dialLogSocket(path string) (*net.UnixConn, error) {
+	return net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+}
+
+// redirectOutput redirects stdout and stderr to sock.
+func redirectOutput(sock *net.UnixConn) error {
+	out, err := sock.File()
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := syscall.Dup2(int(out.Fd()), 1); err != nil {
+		return err
+	} else if err := syscall.Dup2(int(out.Fd()), 2); err != nil {
+		return err
+	}
+	return nil
+}
+
+// monitorLogSocket waits for the logging socket to be closed by
+// the peer and then reconnects, buffering output in the meantime.
+func monitorLogSocket(path string, sock *net.UnixConn) {
+	for {
+		// The peer never sends anything; Read returns when it goes away.
+		var b [1]byte
+		sock.Read(b[:])
+		sock.Close()
+
+		buf, err := newOutputBuffer()
+		if err != nil {
+			log.Printf("could not buffer logs while reconnecting: %v", err)
+		} else {
+			log.Printf("logging socket closed, reconnecting")
+		}
+		sock = reconnectLogSocket(path)
+		if buf != nil {
+			buf.flush(sock)
+		}
+		log.Printf("reconnected to logging socket")
+	}
+}
+
+// reconnectLogSocket dials the logging socket with backoff until
+// it succeeds, and redirects stdout and stderr to it.
+func reconnectLogSocket(path string) *net.UnixConn {
+	delay := 100 * time.Millisecond
+	for {
+		sock, err := dialLogSocket(path)
+		if err == nil {
+			if err = redirectOutput(sock); err == nil {
+				return sock
+			}
+			sock.Close()
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > 10*time.Second {
+			delay = 10 * time.Second
+		}
+	}
+}
+
+// outputBuffer captures stdout and stderr in memory
+// while the logging socket is unavailable.
+type outputBuffer struct {
+	w    *os.File // write end of the pipe stdout/stderr are redirected to
+	done chan struct{}
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// newOutputBuffer redirects stdout and stderr to a new output buffer.
+func newOutputBuffer() (*outputBuffer, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Dup2(int(w.Fd()), 1); err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	} else if err := syscall.Dup2(int(w.Fd()), 2); err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+
+	b := &outputBuffer{w: w, done: make(chan struct{})}
+	go func() {
+		defer close(b.done)
+		defer r.Close()
+		var chunk [4096]byte
+		for {
+			n, err := r.Read(chunk[:])
+			b.mu.Lock()
+			b.buf.Write(chunk[:n])
+			if over := b.buf.Len() - maxLogBuffer; over > 0 {
+				// Drop the oldest output, up to the end of a line.
+				data := b.buf.Bytes()[over:]
+				if i := bytes.IndexByte(data, '\n'); i >= 0 {
+					data = data[i+1:]
+				}
+				data = append([]byte(nil), data...)
+				b.buf.Reset()
+				b.buf.Write(data)
+			}
+			b.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return b, nil
+}
+
+// flush writes the buffered output to w. Stdout and stderr must
+// have been redirected elsewhere, so the pipe is drained.
+func (b *outputBuffer) flush(w io.Writer) {
+	b.w.Close()
+	<-b.done
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w.Write(b.buf.Bytes())
+}
@@ -0,0 +1,147 @@
+package runtime
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"runtime.encore.dev/internal/redact"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// defaultAuditBodySize is the default maximum request body size to record.
+const defaultAuditBodySize = 64 << 10
+
+// newAuditLogger creates the logger for audit records,
+// or returns nil if audit logging is disabled.
+func (srv *Server) newAuditLogger() *zerolog.Logger {
+	cfg := srv.cfg.AuditLog
+	if cfg == nil {
+		return nil
+	}
+	var out io.Writer = os.Stdout
+	if cfg.Path != "" {
+		f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			srv.logger.Fatal().Err(err).Msg("could not open audit log")
+		}
+		out = f
+	} else if cfg.Output != nil {
+		out = cfg.Output
+	}
+	logger := zerolog.New(out).With().Timestamp().Logger()
+	return &logger
+}
+
+// audit returns a middleware that writes an audit record per call,
+// or nil if the endpoint is not audited.
+//
+// It runs after authentication, so the record includes the caller.
+func (srv *Server) audit(endpoint *config.Endpoint) middleware.Middleware {
+	if srv.auditLogger == nil || (endpoint.Audit != nil && !*endpoint.Audit) {
+		return nil
+	}
+	always := endpoint.Audit != nil
+	// Raw endpoints receive the request body untouched.
+	recordBody := !endpoint.Raw
+	fields := redact.NewFields(srv.cfg.AuditLog.Redact...).With(endpoint.AuditRedact...)
+	maxBody := srv.cfg.AuditLog.MaxBodySize
+	if maxBody <= 0 {
+		maxBody = defaultAuditBodySize
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			if !always && !isMutating(req.HTTP.Method) {
+				next(w, req)
+				return
+			}
+
+			var body []byte
+			if recordBody {
+				body = captureBody(req.HTTP, maxBody)
+			}
+			start := time.Now()
+			next(w, req)
+			dur := time.Since(start)
+
+			status := w.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			ev := srv.auditLogger.Log().
+				Str("method", req.HTTP.Method).
+				Str("path", req.HTTP.URL.Path).
+				Str("service", req.Service).
+				Str("endpoint", req.Endpoint).
+				Str("remote_ip", srv.clientIP(req.HTTP).String()).
+				Str("request_id", RequestID(req.HTTP.Context()))
+			if auth := GetCallOptions(req.HTTP.Context()).Auth; auth != nil {
+				ev = ev.Str("uid", string(auth.UID))
+			}
+			if id := GetClientIdentity(req.HTTP.Context()); id != nil {
+				ev = ev.Str("client_cn", id.CommonName)
+			}
+			if len(req.Params) > 0 {
+				params := zerolog.Dict()
+				for _, p := range req.Params {
+					if fields.Has(p.Key) {
+						params = params.Str(p.Key, redact.Placeholder)
+					} else {
+						params = params.Str(p.Key, p.Value)
+					}
+				}
+				ev = ev.Dict("params", params)
+			}
+			if q := req.HTTP.URL.Query(); len(q) > 0 {
+				ev = ev.Interface("query", fields.Strings(q))
+			}
+			if body != nil {
+				if data, ok := fields.JSON(body); ok {
+					ev = ev.RawJSON("body", data)
+				}
+			}
+			ev.Int("status", status).Dur("duration", dur).Msg("audit")
+		}
+	}
+}
+
+// isMutating reports whether method is a mutating HTTP method.
+func isMutating(method string) bool {
+	switch method {
+	case "POST", "PUT", "PATCH", "DELETE":
+		return true
+	}
+	return false
+}
+
+// captureBody reads the request body if it is JSON and at most limit
+// bytes, restoring it for the handler. It returns nil otherwise.
+func captureBody(req *http.Request, limit int64) []byte {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mt != "application/json" {
+		return nil
+	}
+
+	orig := req.Body
+	data, err := ioutil.ReadAll(io.LimitReader(orig, limit+1))
+	req.Body = readCloser{io.MultiReader(bytes.NewReader(data), orig), orig}
+	if err != nil || int64(len(data)) > limit {
+		return nil
+	}
+	return data
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
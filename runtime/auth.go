@@ -0,0 +1,152 @@
+package runtime
+
+import (
+	"net/http"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// authRequired reports whether calls to the endpoint must be authenticated.
+func authRequired(endpoint *config.Endpoint) bool {
+	return endpoint.AuthRequired || endpoint.Access == config.Auth ||
+		len(endpoint.Scopes) > 0 || len(endpoint.Roles) > 0
+}
+
+// authenticate returns a middleware that authenticates requests
+// using the configured auth handler, or nil if the endpoint
+// needs no authentication.
+//
+// The auth result is added to the request context as call options,
+// so it becomes the auth information of the request when it begins.
+func (srv *Server) authenticate(endpoint *config.Endpoint) middleware.Middleware {
+	handler := srv.cfg.AuthHandler
+	required := authRequired(endpoint)
+	if handler == nil {
+		if endpoint.AuthRequired {
+			srv.logger.Fatal().Str("endpoint", endpoint.Name).
+				Msg("auth: endpoint requires auth but no auth handler is configured")
+		} else if len(endpoint.Scopes) > 0 || len(endpoint.Roles) > 0 {
+			srv.logger.Fatal().Str("endpoint", endpoint.Name).
+				Msg("auth: endpoint requires scopes or roles but no auth handler is configured")
+		}
+		// Endpoints with Access == Auth are still checked when the request begins,
+		// based on the auth information provided by the generated code.
+		return nil
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			res, err := handler(req.HTTP)
+			if err != nil {
+				switch errs.Code(err) {
+				case errs.PermissionDenied, errs.Unauthenticated, errs.Unavailable:
+					// Reported as is.
+				default:
+					err = errs.WrapCode(err, errs.Unauthenticated, "invalid credentials")
+				}
+				srv.authFailed(w, req, err)
+				return
+			}
+			if res == nil || res.UID == "" {
+				if required {
+					srv.authFailed(w, req, &errs.Error{
+						Code:    errs.Unauthenticated,
+						Message: "endpoint requires auth but none provided",
+					})
+					return
+				}
+				next(w, req)
+				return
+			}
+
+			if missing := missingPermissions(endpoint, res); missing != nil {
+				for _, scope := range missing.Scopes {
+					metrics.PermissionDenied(req.Service, req.Endpoint, "scope", scope)
+				}
+				for _, role := range missing.Roles {
+					metrics.PermissionDenied(req.Service, req.Endpoint, "role", role)
+				}
+				srv.authFailed(w, req, &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "missing required permissions",
+					Details: missing,
+				})
+				return
+			}
+
+			if lim := res.RateLimit; lim != nil && lim.Rate > 0 {
+				key := res.LimitKey
+				if key == "" {
+					key = res.UID
+				}
+				if !srv.takeToken(w, req, "auth:"+key, toLimit(lim)) {
+					return
+				}
+			}
+
+			ctx := req.HTTP.Context()
+			opts := *GetCallOptions(ctx) // make a copy
+			opts.Auth = &AuthInfo{UID: UID(res.UID), UserData: res.Data}
+			req.HTTP = req.HTTP.WithContext(WithCallOptions(ctx, &opts))
+			next(w, req)
+		}
+	}
+}
+
+// MissingPermissions are the details of the error returned
+// when a caller lacks the scopes or roles an endpoint requires.
+type MissingPermissions struct {
+	Scopes []string `json:"missing_scopes,omitempty"` // required scopes not granted
+	Roles  []string `json:"required_roles,omitempty"` // one of which is required
+}
+
+func (*MissingPermissions) ErrDetails() {}
+
+// missingPermissions reports the scopes and roles required by the endpoint
+// that are missing from the auth result, or nil if none are missing.
+func missingPermissions(endpoint *config.Endpoint, res *config.AuthResult) *MissingPermissions {
+	var missing MissingPermissions
+	for _, scope := range endpoint.Scopes {
+		if !contains(res.Scopes, scope) {
+			missing.Scopes = append(missing.Scopes, scope)
+		}
+	}
+	if len(endpoint.Roles) > 0 {
+		hasRole := false
+		for _, role := range endpoint.Roles {
+			if contains(res.Roles, role) {
+				hasRole = true
+				break
+			}
+		}
+		if !hasRole {
+			missing.Roles = endpoint.Roles
+		}
+	}
+	if missing.Scopes == nil && missing.Roles == nil {
+		return nil
+	}
+	return &missing
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// authFailed responds to a request that failed authentication.
+func (srv *Server) authFailed(w http.ResponseWriter, req *middleware.Request, err error) {
+	if errs.Code(err) == errs.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	srv.logger.Info().Str("service", req.Service).Str("endpoint", req.Endpoint).
+		Str("code", errs.Code(err).String()).Msg("authentication failed")
+	errs.HTTPError(w, err)
+}
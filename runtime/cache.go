@@ -0,0 +1,35 @@
+package runtime
+
+import (
+	"runtime.encore.dev/internal/redis"
+)
+
+// cacheClient is the Redis client caches are stored with,
+// or nil if they are not configured. It is set by Setup.
+var cacheClient *redis.Client
+
+// cachePrefix is prefixed to the keys of all caches.
+var cachePrefix string
+
+// newCacheClient creates the Redis client caches are stored with.
+func (srv *Server) newCacheClient() *redis.Client {
+	c := srv.cfg.Cache
+	if c == nil {
+		return nil
+	}
+	cachePrefix = c.KeyPrefix
+	if c.Redis != nil {
+		return newRedisClient(c.Redis)
+	}
+	if srv.redis == nil {
+		srv.logger.Fatal().Msg("cache: caching configured but no redis server")
+	}
+	return srv.redis
+}
+
+// CacheClient returns the Redis client caches are stored with and
+// the prefix of their keys, or a nil client if caching is not
+// configured.
+func CacheClient() (client *redis.Client, keyPrefix string) {
+	return cacheClient, cachePrefix
+}
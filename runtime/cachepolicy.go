@@ -0,0 +1,134 @@
+package runtime
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// cachePolicy returns a middleware that sets the Cache-Control and
+// Vary headers of responses according to the endpoint's cache policy,
+// or nil if it has none.
+//
+// The headers are set when the response status is known, so that
+// errors are not cached. Raw endpoints get them before the handler
+// is called instead, since they may need the underlying writer's
+// optional interfaces; they can override them.
+func (srv *Server) cachePolicy(endpoint *config.Endpoint) middleware.Middleware {
+	cfg := endpoint.CachePolicy
+	if cfg == nil {
+		return nil
+	}
+	value := cacheControl(cfg)
+	vary := append([]string(nil), cfg.Vary...)
+	if authRequired(endpoint) {
+		vary = append(vary, "Authorization", "Cookie")
+	}
+	if srv.compressor != nil && !endpoint.Raw {
+		vary = append(vary, "Accept-Encoding")
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			cacheable := req.HTTP.Method == "GET" || req.HTTP.Method == "HEAD"
+			if endpoint.Raw {
+				if cacheable {
+					w.Header().Set("Cache-Control", value)
+				} else {
+					w.Header().Set("Cache-Control", "no-store")
+				}
+				addVary(w.Header(), vary...)
+				next(w, req)
+				return
+			}
+			next(&policyWriter{ResponseWriter: w, value: value, vary: vary, cacheable: cacheable}, req)
+		}
+	}
+}
+
+// cacheControl returns the Cache-Control header value for cfg.
+func cacheControl(cfg *config.CachePolicy) string {
+	if cfg.NoStore {
+		return "no-store"
+	}
+	v := "private"
+	if cfg.Public {
+		v = "public"
+	}
+	v += ", max-age=" + strconv.FormatInt(int64(cfg.MaxAge.Seconds()), 10)
+	if cfg.StaleWhileRevalidate > 0 {
+		v += ", stale-while-revalidate=" + strconv.FormatInt(int64(cfg.StaleWhileRevalidate.Seconds()), 10)
+	}
+	return v
+}
+
+// addVary adds vals to the Vary header, merging it into a single
+// header without duplicates.
+func addVary(h http.Header, vals ...string) {
+	var merged []string
+	seen := make(map[string]bool)
+	add := func(v string) {
+		v = strings.TrimSpace(v)
+		if k := http.CanonicalHeaderKey(v); v != "" && !seen[k] {
+			seen[k] = true
+			merged = append(merged, v)
+		}
+	}
+	for _, line := range h.Values("Vary") {
+		for _, v := range strings.Split(line, ",") {
+			add(v)
+		}
+	}
+	for _, v := range vals {
+		add(v)
+	}
+	if len(merged) > 0 {
+		h.Set("Vary", strings.Join(merged, ", "))
+	}
+}
+
+// policyWriter sets the cache headers of a response
+// when its status is written.
+type policyWriter struct {
+	middleware.ResponseWriter
+	value     string
+	vary      []string
+	cacheable bool // whether the request method is cacheable
+	done      bool
+}
+
+func (w *policyWriter) WriteHeader(code int) {
+	if !w.done {
+		w.done = true
+		h := w.Header()
+		if h.Get("Cache-Control") == "" {
+			ok := code < 300 || code == http.StatusNotModified
+			if w.cacheable && ok {
+				h.Set("Cache-Control", w.value)
+			} else {
+				h.Set("Cache-Control", "no-store")
+			}
+		}
+		addVary(h, w.vary...)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *policyWriter) Write(b []byte) (int, error) {
+	if !w.done {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *policyWriter) Flush() {
+	if !w.done {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
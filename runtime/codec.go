@@ -0,0 +1,181 @@
+package runtime
+
+import (
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/protobuf/proto"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/bodylimit"
+	"runtime.encore.dev/internal/fieldmask"
+	"runtime.encore.dev/internal/msgpack"
+)
+
+// Content types of request and response payloads.
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeProto   = "application/proto"
+	contentTypeMsgpack = "application/msgpack"
+
+	// contentTypeXProto and contentTypeXMsgpack are aliases
+	// used by some protobuf and MessagePack clients.
+	contentTypeXProto   = "application/x-protobuf"
+	contentTypeXMsgpack = "application/x-msgpack"
+)
+
+// DecodeRequest decodes the payload in the body of req into v.
+// Bodies with the "application/proto" content type are decoded as
+// protobuf, which requires v to be a proto.Message; bodies with the
+// "application/msgpack" content type are decoded as MessagePack;
+// multipart/form-data bodies are decoded as forms, with uploaded
+// files streamed to disk (see File); other bodies are decoded as JSON.
+func DecodeRequest(req *http.Request, v interface{}) error {
+	if mediaType(req.Header.Get("Content-Type")) == contentTypeMultipart {
+		return decodeMultipart(req, v)
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if errors.Is(err, bodylimit.ErrTooLarge) {
+		return errs.WrapCode(err, errs.ResourceExhausted, "request body too large")
+	} else if err != nil {
+		return errs.WrapCode(err, errs.InvalidArgument, "could not read request body")
+	}
+
+	switch mediaType(req.Header.Get("Content-Type")) {
+	case contentTypeProto, contentTypeXProto:
+		msg, ok := v.(proto.Message)
+		if !ok {
+			return &errs.Error{Code: errs.InvalidArgument, Message: "endpoint does not support protobuf payloads"}
+		}
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return errs.WrapCode(err, errs.InvalidArgument, "invalid protobuf payload")
+		}
+		return nil
+	case contentTypeMsgpack, contentTypeXMsgpack:
+		if len(data) == 0 {
+			return nil
+		}
+		if err := msgpack.Unmarshal(data, v); err != nil {
+			return errs.WrapCode(err, errs.InvalidArgument, "invalid msgpack payload")
+		}
+		return nil
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errs.WrapCode(err, errs.InvalidArgument, "invalid json payload")
+	}
+	return nil
+}
+
+// EncodeResponse writes v as the response payload with the given
+// status. It is encoded in the format the Accept header prefers:
+// protobuf if v is a proto.Message and "application/proto" is
+// preferred, MessagePack if "application/msgpack" is preferred,
+// and JSON otherwise.
+//
+// Successful JSON responses are pruned to the fields selected by the
+// "fields" query parameter or the X-Fields header, if present: a
+// comma-separated list of dot-separated field paths such as
+// "id,author.name".
+func EncodeResponse(w http.ResponseWriter, req *http.Request, status int, v interface{}) error {
+	_, isMsg := v.(proto.Message)
+	contentType := negotiateResponse(req.Header.Get("Accept"), isMsg)
+
+	var (
+		data []byte
+		err  error
+	)
+	switch contentType {
+	case contentTypeProto:
+		data, err = proto.Marshal(v.(proto.Message))
+	case contentTypeMsgpack:
+		data, err = msgpack.Marshal(v)
+	default:
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return errs.WrapCode(err, errs.Internal, "could not encode response")
+	}
+	if contentType == contentTypeJSON && status < 300 {
+		if data, err = pruneFields(req, data); err != nil {
+			return err
+		}
+		w.Header().Add("Vary", "X-Fields")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
+
+// pruneFields prunes the JSON response data to the fields
+// requested by req, if any.
+func pruneFields(req *http.Request, data []byte) ([]byte, error) {
+	fields := req.URL.Query().Get("fields")
+	if fields == "" {
+		fields = req.Header.Get("X-Fields")
+	}
+	if fields == "" {
+		return data, nil
+	}
+	mask, err := fieldmask.Parse(fields)
+	if err != nil {
+		return nil, errs.WrapCode(err, errs.InvalidArgument, "invalid fields")
+	}
+	data, err = fieldmask.Prune(data, mask)
+	if err != nil {
+		return nil, errs.WrapCode(err, errs.Internal, "could not encode response")
+	}
+	return data, nil
+}
+
+// mediaType returns the media type of a Content-Type header, or "".
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// negotiateResponse returns the response content type preferred by
+// an Accept header. Protobuf is only considered if allowProto is true.
+// JSON is used unless another type is strictly preferred over it,
+// so a missing header or a wildcard yields JSON.
+func negotiateResponse(accept string, allowProto bool) string {
+	if accept == "" {
+		return contentTypeJSON
+	}
+	best, bestQ := contentTypeJSON, acceptQuality(accept, contentTypeJSON)
+	consider := func(contentType string, q float64) {
+		if q > bestQ {
+			best, bestQ = contentType, q
+		}
+	}
+	if allowProto {
+		consider(contentTypeProto, maxQuality(accept, contentTypeProto, contentTypeXProto))
+	}
+	consider(contentTypeMsgpack, maxQuality(accept, contentTypeMsgpack, contentTypeXMsgpack))
+	return best
+}
+
+// maxQuality returns the highest quality an Accept header
+// gives any of the content types.
+func maxQuality(accept string, contentTypes ...string) float64 {
+	q := 0.0
+	for _, ct := range contentTypes {
+		if cq := acceptQuality(accept, ct); cq > q {
+			q = cq
+		}
+	}
+	return q
+}
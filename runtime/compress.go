@@ -0,0 +1,247 @@
+package runtime
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// defaultCompressMinSize is the default minimum response size to compress.
+const defaultCompressMinSize = 1024
+
+// defaultCompressTypes are the media types compressed by default.
+var defaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"image/svg+xml",
+}
+
+// compressor implements response compression.
+type compressor struct {
+	minSize  int
+	types    []string
+	encoders []config.Encoder // in order of preference
+}
+
+func (srv *Server) newCompressor() *compressor {
+	cfg := srv.cfg.Compression
+	if !cfg.Enabled {
+		return nil
+	}
+	c := &compressor{
+		minSize: cfg.MinSize,
+		types:   cfg.ContentTypes,
+	}
+	if c.minSize <= 0 {
+		c.minSize = defaultCompressMinSize
+	}
+	if len(c.types) == 0 {
+		c.types = defaultCompressTypes
+	}
+	c.encoders = append(c.encoders, cfg.Encoders...)
+	c.encoders = append(c.encoders,
+		config.Encoder{Name: "gzip", New: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		config.Encoder{Name: "deflate", New: func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		}},
+	)
+	return c
+}
+
+// middleware compresses responses according to the request's Accept-Encoding.
+func (c *compressor) middleware(next middleware.Handler) middleware.Handler {
+	return func(w middleware.ResponseWriter, req *middleware.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := c.negotiate(req.HTTP.Header.Get("Accept-Encoding"))
+		if enc == nil || req.HTTP.Method == "HEAD" || req.HTTP.Header.Get("Upgrade") != "" {
+			next(w, req)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, c: c, enc: enc}
+		next(cw, req)
+		// Only finish the response if the handler did not panic,
+		// to allow for responding with an error.
+		cw.Close()
+	}
+}
+
+// negotiate selects the encoder to use given an Accept-Encoding header,
+// or nil if the response should not be compressed.
+func (c *compressor) negotiate(accept string) *config.Encoder {
+	if accept == "" {
+		return nil
+	}
+
+	var (
+		best  *config.Encoder
+		bestQ float64
+	)
+	for i := range c.encoders {
+		e := &c.encoders[i]
+		if q := acceptQuality(accept, e.Name); q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// acceptQuality reports the quality value for coding in an Accept-Encoding header.
+// It reports 0 if the coding is not acceptable.
+func acceptQuality(accept, coding string) float64 {
+	wildcard := -1.0
+	for _, part := range strings.Split(accept, ",") {
+		name, q := part, 1.0
+		if idx := strings.IndexByte(part, ';'); idx != -1 {
+			name = part[:idx]
+			param := strings.TrimSpace(part[idx+1:])
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		name = strings.TrimSpace(name)
+		if strings.EqualFold(name, coding) {
+			return q
+		} else if name == "*" {
+			wildcard = q
+		}
+	}
+	if wildcard > 0 {
+		return wildcard
+	}
+	return 0
+}
+
+func (c *compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.types {
+		if strings.HasSuffix(t, "/*") {
+			if strings.HasPrefix(mediaType, t[:len(t)-1]) {
+				return true
+			}
+		} else if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter buffers the beginning of a response to decide
+// whether to compress it, and then compresses it if so.
+type compressWriter struct {
+	middleware.ResponseWriter
+	c   *compressor
+	enc *config.Encoder
+
+	status  int    // status code to write, or 0
+	buf     []byte // buffered response until decided
+	decided bool
+	zw      io.WriteCloser // compressing writer, or nil if not compressing
+	written int64
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	if code == http.StatusNoContent || code == http.StatusNotModified || code < 200 {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written += int64(len(b))
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.c.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide decides whether to compress the response, and writes
+// the header and any buffered data. If compress is false
+// the response is not compressed regardless of its content.
+func (w *compressWriter) decide(compress bool) error {
+	if w.decided {
+		return nil
+	}
+	w.decided = true
+
+	h := w.Header()
+	if compress && h.Get("Content-Encoding") == "" && w.c.compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", w.enc.Name)
+		h.Del("Content-Length")
+		w.zw = w.enc.New(w.ResponseWriter)
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.zw != nil {
+		_, err = w.zw.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush flushes any buffered data to the client.
+func (w *compressWriter) Flush() {
+	w.decide(true)
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close completes the response.
+func (w *compressWriter) Close() error {
+	// If we haven't decided yet the response is smaller than the
+	// minimum size, so don't compress it.
+	if err := w.decide(false); err != nil {
+		return err
+	}
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	return nil
+}
+
+func (w *compressWriter) Status() int    { return w.status }
+func (w *compressWriter) Written() int64 { return w.written }
@@ -1,9 +1,20 @@
 package config
 
 import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
+	"os"
+	"reflect"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	dto "github.com/prometheus/client_model/go"
+
+	"runtime.encore.dev/middleware"
 )
 
 type Access string
@@ -18,23 +29,1602 @@ type ServerConfig struct {
 	Testing     bool
 	TestService string // service being tested, if any
 
+	// EnvType is the type of environment the app is running in,
+	// such as "production", "development" or "local".
+	EnvType string
+
+	// DebugErrors includes the error chain and stack trace of
+	// server errors (5xx) in responses. If nil it is enabled
+	// for "local" and "development" environments. It is never
+	// enabled in "production" environments.
+	DebugErrors *bool
+
 	Services []*Service
 	// AuthData is the custom auth data type, or ""
 	AuthData string
+
+	// ListenAddr is the address to listen on, or "" for the default.
+	// It is overridden by the ENCORE_LISTEN_ADDR environment variable.
+	// An address of the form "unix:/path/to/sock" listens on a Unix domain socket.
+	ListenAddr string
+
+	// UnixSocketMode is the file mode to use for the Unix domain socket
+	// when listening on one. If zero it defaults to 0660.
+	UnixSocketMode os.FileMode
+
+	// ReusePort binds the TCP listener with SO_REUSEPORT, allowing
+	// a new process to start accepting connections on the same address
+	// before the old process has finished draining, for zero-downtime restarts.
+	ReusePort bool
+
+	// TLS configures serving HTTPS directly from the runtime.
+	// If nil the server serves plaintext HTTP.
+	TLS *TLS
+
+	// HTTP2 configures HTTP/2 support. HTTP/2 is always
+	// enabled for TLS connections.
+	HTTP2 HTTP2
+
+	// HTTP3 is a hook for plugging in an HTTP/3 (QUIC) server
+	// implementation; the runtime does not implement HTTP/3 itself.
+	// It requires TLS to be configured. If nil, or if its NewServer
+	// is nil, HTTP/3 is disabled and not advertised.
+	HTTP3 *HTTP3
+
+	// Timeouts configures the HTTP server timeouts.
+	Timeouts Timeouts
+
+	// SlowClients, if set, aborts requests whose bodies
+	// are received slower than a minimum rate.
+	SlowClients *SlowClients
+
+	// Startup configures waiting for dependencies,
+	// such as databases, to initialize at startup.
+	Startup Startup
+
+	// DrainDelay is how long to keep serving requests after shutdown
+	// begins, with readiness checks at /__encore/readyz failing, so that
+	// load balancers stop routing requests before listeners are closed.
+	// If zero listeners are closed immediately.
+	DrainDelay time.Duration
+
+	// MaxBodySize is the maximum request body size in bytes,
+	// unless overridden by the endpoint. If zero there is no limit.
+	MaxBodySize int64
+
+	// MaxConcurrentRequests is the maximum number of requests processed
+	// concurrently. Excess requests are rejected with 503 Service Unavailable.
+	// If zero there is no limit.
+	MaxConcurrentRequests int
+
+	// CORS configures Cross-Origin Resource Sharing for all services,
+	// unless overridden by the service. If nil cross-origin requests
+	// are not allowed.
+	CORS *CORS
+
+	// CSRF, if set, protects endpoints from cross-site request
+	// forgery of requests authenticated with cookies.
+	CSRF *CSRF
+
+	// SecurityHeaders, if set, adds security headers to responses,
+	// unless overridden by the endpoint.
+	SecurityHeaders *SecurityHeaders
+
+	// Middleware is the middleware to apply to all endpoints,
+	// ahead of any service and endpoint middleware.
+	Middleware []middleware.Middleware
+
+	// ResponseHooks transform the responses of all endpoints,
+	// ahead of any service response hooks.
+	ResponseHooks []middleware.ResponseHook
+
+	// AccessLog configures access logging for all endpoints,
+	// unless overridden by the endpoint.
+	AccessLog AccessLog
+
+	// AuditLog, if set, enables audit logging of calls to mutating endpoints.
+	AuditLog *AuditLog
+
+	// LogSocket is the path of the log forwarding socket of the
+	// Encore host environment. If empty it defaults to
+	// /var/lib/encore/applog.sock.
+	LogSocket string
+
+	// LogFallback logs to stderr if the log forwarding socket of the
+	// Encore host environment is unavailable, instead of exiting.
+	// It is useful for running outside of Encore, such as in CI.
+	// It can also be enabled by setting ENCORE_LOG_FALLBACK=1.
+	LogFallback bool
+
+	// LogRedaction, if set, redacts sensitive fields from log output.
+	LogRedaction *LogRedaction
+
+	// RecentLogs, if set, keeps the most recent log records in memory
+	// and serves them at __encore.RecentLogs, for triage when the
+	// central log pipeline lags. The "level", "service", "endpoint" and
+	// "limit" query parameters filter the records.
+	RecentLogs *RecentLogs
+
+	// LogSampling, if set, samples log messages so that hot paths
+	// don't flood the log output. Each distinct message is sampled
+	// independently, and errors are never sampled.
+	LogSampling *LogSampling
+
+	// Compression configures response compression.
+	Compression Compression
+
+	// ETags configures ETags and conditional GET requests.
+	ETags ETags
+
+	// ResponseCache limits the in-memory cache of the responses
+	// of endpoints with a ResponseCache.
+	ResponseCache ResponseCache
+
+	// RequestDecompression, if set, decompresses request bodies
+	// sent with a Content-Encoding. If nil such requests are
+	// passed to the handler as is.
+	RequestDecompression *RequestDecompression
+
+	// APIVersions configures the versions of versioned endpoints.
+	APIVersions APIVersions
+
+	// Redis configures the Redis server used by runtime subsystems
+	// that share state between instances, or nil if there is none.
+	Redis *Redis
+
+	// Cache configures the caches of the cache package,
+	// or is nil if they are not used.
+	Cache *Cache
+
+	// Buckets are the object storage buckets of the objects package.
+	Buckets []*Bucket
+
+	// Secrets are the secrets of the secrets package, loaded at
+	// startup. Their values are redacted from logs.
+	Secrets []*Secret
+
+	// Vault configures the HashiCorp Vault server secrets with
+	// a Vault source are read from, or is nil if there is none.
+	Vault *Vault
+
+	// SQLDatabases are the SQL databases used by the application.
+	// Databases not listed here are connected to using the
+	// ENCORE_SQLDB_ADDRESS and ENCORE_SQLDB_PASSWORD
+	// environment variables.
+	SQLDatabases []*SQLDatabase
+
+	// MigrationsToken must be provided as a bearer token in the
+	// Authorization header to view the status of migrations at
+	// __encore.Migrations. If empty the status is not served.
+	MigrationsToken string
+
+	// RoutesToken must be provided as a bearer token in the
+	// Authorization header to list the routes at __encore.Routes.
+	// If empty the routes are not served.
+	RoutesToken string
+
+	// StatsToken must be provided as a bearer token in the Authorization
+	// header to view runtime statistics at __encore.Stats.
+	// If empty the statistics are not served.
+	StatsToken string
+
+	// RateLimitStore is where rate limit state is stored:
+	// "memory" (the default) or "redis", which requires Redis
+	// to be configured.
+	RateLimitStore string
+
+	// Idempotency, if set, honors the Idempotency-Key header on
+	// mutating (POST, PUT, PATCH and DELETE) requests to non-raw
+	// endpoints, replaying the first response to retries.
+	Idempotency *Idempotency
+
+	// PubSub configures publish/subscribe messaging.
+	PubSub PubSub
+
+	// Cron configures jobs calling endpoints on a schedule.
+	Cron Cron
+
+	// Tasks configures background task queues. Tasks are stored
+	// in the pub/sub store (see PubSub.Store).
+	Tasks Tasks
+
+	// TrustedProxies are the IP addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For header is trusted for determining client IPs.
+	TrustedProxies []string
+
+	// MetricsListener, if set, serves metrics on a separate listener,
+	// so scraping can be firewalled independently of the app.
+	MetricsListener *MetricsListener
+
+	// LatencyBuckets are the bucket upper bounds, in seconds, of the
+	// per-endpoint request latency histogram. If nil they default to
+	// buckets from 5ms to 10s.
+	LatencyBuckets []float64
+
+	// MetricsExport, if set, periodically pushes metrics to backends
+	// such as StatsD, and once more at shutdown. It is useful for
+	// short-lived deployments and those that don't scrape Prometheus.
+	MetricsExport *MetricsExport
+
+	// Pprof, if set, serves profiling data at __encore.pprof/,
+	// such as __encore.pprof/heap and __encore.pprof/profile.
+	Pprof *Pprof
+
+	// LogLevelControl, if set, enables changing the log level at
+	// runtime through __encore.SetLogLevel. The level is given by the
+	// "level" query parameter, and is reverted after the duration given
+	// by the "ttl" query parameter (default 15 minutes).
+	LogLevelControl *LogLevelControl
+
+	// Tracing, if set, enables OpenTelemetry tracing
+	// with export to an OTLP collector.
+	Tracing *Tracing
+
+	// GRPC, if set, exposes endpoints as unary gRPC methods named
+	// /<service>/<endpoint>, with protobuf-encoded payloads.
+	// Calls go through the same middleware as HTTP requests.
+	GRPC *GRPC
+
+	// Connect serves the Connect and gRPC-Web protocols on the app's
+	// listener, for the endpoints exposed as gRPC methods (see GRPC),
+	// so browser and mobile clients can call them without a proxy.
+	Connect bool
+
+	// OpenAPI configures the OpenAPI document
+	// served at __encore.openapi.json.
+	OpenAPI OpenAPI
+
+	// WebSocket configures WebSocket connections
+	// upgraded to by runtime.UpgradeWebSocket.
+	WebSocket WebSocket
+
+	// Uploads configures the handling of multipart/form-data
+	// requests with file uploads.
+	Uploads Uploads
+
+	// Pagination configures the cursors and page sizes
+	// of the runtime.encore.dev/pagination package.
+	Pagination Pagination
+
+	// ErrorReporting, if set, reports panics and server errors (5xx)
+	// to an error tracking service such as Sentry.
+	ErrorReporting *ErrorReporting
+
+	// AuthHandler authenticates incoming requests before they reach
+	// the endpoint handler. If nil requests are not authenticated
+	// by the runtime.
+	AuthHandler AuthHandler
+}
+
+// AuthHandler authenticates a request.
+//
+// It returns nil, nil if the request contains no credentials.
+// If the credentials are invalid it returns an error; errors with
+// the errs.PermissionDenied code are reported as 403 Forbidden,
+// errors with the errs.Unavailable code (such as an unreachable
+// identity provider) as 503 Service Unavailable, and other errors
+// as 401 Unauthorized.
+type AuthHandler func(req *http.Request) (*AuthResult, error)
+
+// AuthResult is the result of successfully authenticating a request.
+type AuthResult struct {
+	UID  string      // the authenticated user id
+	Data interface{} // custom auth data, such as token claims
+
+	Scopes []string // the scopes granted to the caller
+	Roles  []string // the roles of the caller
+
+	// RateLimit, if set, rate limits the caller across all endpoints.
+	// Its Key and KeyFunc fields are ignored; requests are limited
+	// by LimitKey, or by UID if LimitKey is empty.
+	RateLimit *RateLimit
+	LimitKey  string
+}
+
+type Redis struct {
+	Addr     string
+	Password string
+	DB       int
+
+	// MaxIdle is the maximum number of idle connections
+	// kept open. If zero it defaults to 10.
+	MaxIdle int
+
+	// DialTimeout is the timeout for connecting.
+	// If zero it defaults to 5 seconds.
+	DialTimeout time.Duration
+}
+
+// Cache configures the caches of the cache package.
+type Cache struct {
+	// Redis is the Redis server caches are stored in. If nil
+	// they are stored in the one configured by ServerConfig.Redis.
+	Redis *Redis
+
+	// KeyPrefix is prefixed to the keys of all caches,
+	// such as for sharing a Redis server between applications.
+	KeyPrefix string
+}
+
+// Secret declares a secret.
+type Secret struct {
+	// Name is the name the secret is declared with.
+	Name string
+
+	// Env is the environment variable the secret is read from, and
+	// File the file, such as one mounted by Kubernetes. Env takes
+	// precedence if both are set. If neither is set the secret is
+	// read from the environment variable named Name.
+	Env  string
+	File string
+
+	// Vault, if set, reads the secret from Vault instead,
+	// keeping it up to date as it is rotated.
+	Vault *VaultSecret
+
+	// Required fails readiness checks while the secret is missing.
+	// Missing secrets are loaded again by the checks.
+	Required bool
+}
+
+// VaultSecret is a secret stored in Vault.
+type VaultSecret struct {
+	// Path is the path of the secret, such as "secret/data/app"
+	// for the KV secrets engine or "database/creds/app" for
+	// credentials minted by the database secrets engine.
+	Path string
+
+	// Field is the field of the secret's data holding the value, such
+	// as "password". If empty the value is the data encoded as JSON.
+	// Secrets with the same path share a single read, so that fields
+	// of the same credentials are consistent.
+	Field string
+}
+
+// Vault configures a HashiCorp Vault server. One of Token, AppRole
+// and Kubernetes must be set to authenticate with.
+//
+// The token is renewed until it reaches its maximum TTL, after which
+// the server logs in again. Leased secrets are renewed likewise, and
+// read again once they can no longer be renewed. Secrets without
+// leases are read again every RefreshInterval.
+type Vault struct {
+	// Address is the URL of the server, such as "https://vault:8200".
+	Address string
+
+	// Namespace is the Vault Enterprise namespace, if any.
+	Namespace string
+
+	// Token is a token to use as is, such as in development.
+	Token string
+
+	// AppRole authenticates using the AppRole auth method.
+	AppRole *VaultAppRole
+
+	// Kubernetes authenticates using the Kubernetes auth method
+	// with the pod's service account token.
+	Kubernetes *VaultKubernetes
+
+	// RefreshInterval is how often secrets without leases are read
+	// again to pick up rotations. If zero it defaults to 5 minutes.
+	RefreshInterval time.Duration
+
+	// TLS configures connecting to the server, if non-nil.
+	TLS *tls.Config
+}
+
+type VaultAppRole struct {
+	// Mount is the path the auth method is mounted at.
+	// If empty it defaults to "approle".
+	Mount string
+
+	// RoleID is the role ID, and SecretID the secret ID or SecretIDFile
+	// a file holding it, which is read each time the server logs in.
+	RoleID       string
+	SecretID     string
+	SecretIDFile string
+}
+
+type VaultKubernetes struct {
+	// Mount is the path the auth method is mounted at.
+	// If empty it defaults to "kubernetes".
+	Mount string
+
+	// Role is the role to log in as.
+	Role string
+
+	// TokenFile is the file holding the service account token.
+	// If empty it defaults to
+	// "/var/run/secrets/kubernetes.io/serviceaccount/token".
+	TokenFile string
+}
+
+// Bucket is an object storage bucket.
+type Bucket struct {
+	// Name is the name the bucket is declared with.
+	Name string
+
+	// Driver is where objects are stored: "s3" for S3 or services
+	// compatible with it, "gcs" for Google Cloud Storage, or "local"
+	// for a directory on local disk.
+	Driver string
+
+	// BucketName is the name of the S3 or GCS bucket.
+	// If empty it defaults to Name.
+	BucketName string
+
+	// Region is the region of S3 buckets.
+	Region string
+
+	// Endpoint, if set, is the URL of the service,
+	// such as for services compatible with S3.
+	// PathStyle addresses the bucket in the URL path
+	// instead of in the host name.
+	Endpoint  string
+	PathStyle bool
+
+	// AccessKeyID and SecretAccessKey are the credentials of S3 and
+	// GCS buckets, and SessionToken an optional session token. GCS
+	// buckets are accessed through its XML API using HMAC keys.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Root is the directory objects of local buckets are stored in.
+	Root string
+
+	// SigningKey signs the URLs of local buckets, which are served
+	// by the server. If empty a random key is used, so that URLs are
+	// only valid until the server restarts.
+	SigningKey string
+
+	// BaseURL is prefixed to the signed URLs of local buckets,
+	// such as "http://localhost:4000". If empty they are relative.
+	BaseURL string
+}
+
+// SQLDatabase is a PostgreSQL database.
+type SQLDatabase struct {
+	// Name is the name the database is declared with.
+	Name string
+
+	// Host is the address of the server, as "host:port".
+	Host string
+
+	// DatabaseName is the name of the database on the server.
+	// If empty it defaults to Name.
+	DatabaseName string
+
+	// User and Password are the credentials to connect with,
+	// unless Credentials is set.
+	User     string
+	Password string
+
+	// Credentials, if set, returns the credentials to connect with,
+	// such as short-lived ones from a secrets manager. It is called
+	// when opening connections once the credentials it last returned
+	// are older than CredentialsTTL.
+	Credentials func(ctx context.Context) (user, password string, err error)
+
+	// CredentialsTTL is how long credentials returned by
+	// Credentials are used. If zero it defaults to 5 minutes.
+	CredentialsTTL time.Duration
+
+	// CredentialsSecret, if set, is the name of the secret holding
+	// the credentials to connect with, as JSON with "username" and
+	// "password" fields, such as those minted by Vault's database
+	// secrets engine. Connections opened after the secret is rotated
+	// use the new credentials.
+	CredentialsSecret string
+
+	// TLS configures connecting with TLS. If nil connections
+	// are not encrypted.
+	TLS *tls.Config
+
+	// Migrations, if set, holds the migrations of the database,
+	// typically embedded in the binary, which are applied at startup.
+	// Migrations are files named "<version>_<name>.up.sql" in its
+	// root directory, and are applied in order of their versions.
+	Migrations fs.FS
+
+	// Replicas are the addresses of read replicas of the database,
+	// as "host:port", connected to like the primary. Queries made
+	// with a context marked by sqldb.ReadOnly are routed to them.
+	Replicas []string
+
+	// MaxReplicaLag is how far behind the primary a replica may be
+	// for queries to be routed to it. If all replicas lag further or
+	// are unreachable, queries are made to the primary. If zero it
+	// defaults to 10 seconds.
+	MaxReplicaLag time.Duration
+
+	// MaxConns is the maximum number of connections of the pool,
+	// and of the pool of each replica. If zero it defaults to 30.
+	MaxConns int
+
+	// MinConns is the number of connections kept open
+	// even when idle. If zero none are.
+	MinConns int
+
+	// MaxConnLifetime is how long connections are used before being
+	// closed and replaced. If zero it defaults to 1 hour.
+	MaxConnLifetime time.Duration
+
+	// MaxConnIdleTime is how long idle connections are kept open.
+	// If zero it defaults to 30 minutes.
+	MaxConnIdleTime time.Duration
+
+	// AcquireTimeout is the maximum time to wait for a connection
+	// when all are in use, after which queries fail. If zero they
+	// wait until their context is done.
+	AcquireTimeout time.Duration
+}
+
+type Idempotency struct {
+	// TTL is how long responses are kept for replaying.
+	// If zero it defaults to 24 hours.
+	TTL time.Duration
+
+	// Store is where idempotency keys and responses are stored:
+	// "memory" (the default) or "redis", which requires Redis
+	// to be configured.
+	Store string
+
+	// MaxResponseSize is the maximum size in bytes of responses to
+	// record. Larger responses are not replayed. If zero it defaults
+	// to 1 MiB.
+	MaxResponseSize int
+}
+
+type PubSub struct {
+	// Store is where messages are kept until they are delivered:
+	// "memory" (the default), which neither shares messages between
+	// instances nor persists them across restarts, or "redis",
+	// which requires Redis to be configured.
+	Store string
+
+	// Subscriptions are the subscriptions handled by the application.
+	Subscriptions []*Subscription
+
+	// Token must be provided as a bearer token in the Authorization
+	// header to re-drive dead-lettered messages at
+	// __encore.RedriveDeadLetters. If empty re-driving is disabled.
+	Token string
+
+	// DeadLetterPollInterval is how often the number of dead-lettered
+	// messages is measured. If zero it defaults to 30 seconds.
+	DeadLetterPollInterval time.Duration
+
+	// DedupStore, if set, records the messages processed by
+	// subscriptions with a DedupWindow. If nil they are recorded
+	// in the same kind of store as messages.
+	DedupStore DedupStore
+
+	// Outbox configures the transactional outbox.
+	Outbox Outbox
+}
+
+// Outbox configures the transactional outbox, which holds messages
+// published within database transactions until they are committed.
+type Outbox struct {
+	// Databases are the names of the databases with an outbox.
+	// Messages can only be published within transactions of these.
+	Databases []string
+
+	// PollInterval is how often the outboxes are checked for messages
+	// not yet relayed, such as those left by an instance exiting
+	// after committing. If zero it defaults to 10 seconds.
+	PollInterval time.Duration
+
+	// BatchSize is the maximum number of messages relayed
+	// per transaction. If zero it defaults to 100.
+	BatchSize int
+}
+
+// DedupStore records the messages processed by subscriptions,
+// such as in a database.
+type DedupStore interface {
+	// Claim claims key for processing until lease elapses. It reports
+	// whether key was claimed and, if not, whether it has already
+	// been processed rather than being claimed by another receiver.
+	Claim(ctx context.Context, key string, lease time.Duration) (claimed, processed bool, err error)
+
+	// Complete marks key as processed, remembering it for window.
+	Complete(ctx context.Context, key string, window time.Duration) error
+
+	// Release releases the claim on key, so it can be claimed again.
+	Release(ctx context.Context, key string) error
+}
+
+// Subscription is a subscription to a topic. Each message published
+// to the topic is delivered to each of its subscriptions at least once.
+type Subscription struct {
+	Topic   string
+	Name    string
+	Service string // service handling the messages
+
+	// MessageType is the type of the messages, which are decoded
+	// from JSON into a new value of the type. If nil messages are
+	// passed to the handler as a []byte.
+	MessageType reflect.Type
+
+	// Handler handles a message, passed as a pointer to a value of
+	// MessageType. The message is redelivered if the handler returns
+	// an error or does not return within the ack deadline.
+	Handler func(ctx context.Context, msg interface{}) error
+
+	// MaxConcurrency is the maximum number of messages handled
+	// concurrently by each instance. If zero it defaults to 10.
+	MaxConcurrency int
+
+	// AckDeadline is how long the handler has to handle a message
+	// before it is redelivered. If zero it defaults to 30 seconds.
+	AckDeadline time.Duration
+
+	// RetryPolicy configures the redelivery of failed messages.
+	RetryPolicy RetryPolicy
+
+	// DeadLetterTopic, if set, is the topic failed messages are
+	// published to once their retries are exhausted, instead of being
+	// discarded. They are held there, along with the reason for their
+	// failure, until re-driven to the subscription through the
+	// __encore.RedriveDeadLetters endpoint.
+	DeadLetterTopic string
+
+	// DedupWindow, if set, is how long the IDs of processed messages
+	// are remembered. Messages with the same ID delivered within the
+	// window, such as redeliveries or messages republished with a
+	// publisher-supplied ID, are acknowledged without being handled.
+	DedupWindow time.Duration
+}
+
+// RetryPolicy configures the redelivery of failed messages,
+// with exponential backoff between delivery attempts.
+type RetryPolicy struct {
+	// MinBackoff is the delay before the first redelivery.
+	// If zero it defaults to 1 second.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between deliveries.
+	// If zero it defaults to 10 minutes.
+	MaxBackoff time.Duration
+
+	// MaxRetries is the maximum number of redeliveries of a failed
+	// message, after which it is discarded or dead-lettered. If zero
+	// it defaults to 100, and if negative messages are retried
+	// indefinitely.
+	MaxRetries int
+}
+
+type Cron struct {
+	// Store is where the state of jobs is kept: "memory" (the
+	// default), in which case each instance runs every job, or
+	// "redis", which requires Redis to be configured, in which case
+	// each run of a job is made by one of the instances, and missed
+	// runs are known across restarts.
+	Store string
+
+	// Jobs are the jobs to run.
+	Jobs []*CronJob
+}
+
+// CronJob calls an endpoint on a schedule. The call goes through the
+// endpoint's middleware like other requests, so endpoints requiring
+// authentication must be given credentials in Headers.
+type CronJob struct {
+	Name string
+
+	// Schedule is when the job runs, as a cron expression such as
+	// "*/15 * * * *", a macro such as "@daily", or "@every 10m".
+	// Times are in UTC unless Location is set.
+	Schedule string
+	Location *time.Location
+
+	// Service and Endpoint identify the endpoint to call.
+	Service  string
+	Endpoint string
+
+	// Payload is the JSON request body, if any, and Headers
+	// are additional request headers.
+	Payload []byte
+	Headers map[string]string
+
+	// Jitter, if set, delays each run by a random duration of up
+	// to Jitter, to spread out jobs scheduled at the same time.
+	Jitter time.Duration
+
+	// Timeout is how long a run may take. A run is not started while
+	// the previous one is in progress, up to Timeout. If zero it
+	// defaults to 10 minutes.
+	Timeout time.Duration
+
+	// CatchUp is what to do about runs missed while the application
+	// was not running or a previous run was in progress: "skip" (the
+	// default) skips them, "once" runs the job once for all of them,
+	// and "all" runs it once for each.
+	CatchUp string
+}
+
+type Tasks struct {
+	// Queues are the task queues handled by the application.
+	Queues []*TaskQueue
+
+	// Token must be provided as a bearer token in the Authorization
+	// header to view the queues at __encore.TaskQueues.
+	// If empty the queues are not served.
+	Token string
+
+	// DepthPollInterval is how often the depth of the queues is
+	// measured. If zero it defaults to 30 seconds.
+	DepthPollInterval time.Duration
+}
+
+// TaskQueue is a queue of background tasks, enqueued with
+// tasks.Enqueue and handled by a pool of workers.
+type TaskQueue struct {
+	Name    string
+	Service string // service handling the tasks
+
+	// PayloadType is the type of the task payloads, which are decoded
+	// from JSON into a new value of the type. If nil payloads are
+	// passed to the handler as a []byte.
+	PayloadType reflect.Type
+
+	// Handler handles a task, passed its payload as a pointer to a
+	// value of PayloadType. The task is retried if the handler returns
+	// an error or does not return within Timeout.
+	Handler func(ctx context.Context, payload interface{}) error
+
+	// Workers is the number of tasks handled concurrently
+	// by each instance. If zero it defaults to 10.
+	Workers int
+
+	// Timeout is how long the handler has to handle a task before
+	// it is retried. If zero it defaults to 30 seconds.
+	Timeout time.Duration
+
+	// MinBackoff and MaxBackoff are the minimum and maximum
+	// delays between attempts, which double from MinBackoff.
+	// If zero they default to 1 second and 10 minutes.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// MaxAttempts is the maximum number of attempts at a task, after
+	// which it is discarded. If zero it defaults to 25, and if negative
+	// tasks are retried indefinitely.
+	MaxAttempts int
+}
+
+type Pagination struct {
+	// CursorKey is the key pagination cursors are signed with, so
+	// clients cannot forge them. It must be the same for all instances
+	// of the application. If empty cursors are not signed.
+	CursorKey string
+
+	// DefaultPageSize is the page size used when none is requested.
+	// If zero it defaults to 50.
+	DefaultPageSize int
+
+	// MaxPageSize is the maximum page size.
+	// If zero it defaults to 1000.
+	MaxPageSize int
+}
+
+// APIVersions configures the versions of versioned endpoints (see Endpoint.Version).
+type APIVersions struct {
+	// Default is the version requests for paths without a version
+	// prefix are routed to when no unversioned endpoint matches the
+	// path and the Accept header has no version parameter.
+	// If zero such requests are not routed to versioned endpoints.
+	Default int
+
+	// Deprecated are the deprecated versions. Responses of their
+	// endpoints have the Deprecation header set, along with the
+	// Sunset and Link headers if known.
+	Deprecated map[int]Deprecation
+}
+
+// Deprecation describes a deprecated API version.
+type Deprecation struct {
+	// Since is when the version was deprecated, if known.
+	Since time.Time
+
+	// Sunset is when the version will stop being served, if known.
+	Sunset time.Time
+
+	// Link is the URL of documentation about the deprecation,
+	// such as a migration guide, if any.
+	Link string
+}
+
+// ResponseCache limits the in-memory cache of responses,
+// which evicts the least recently used responses beyond them.
+type ResponseCache struct {
+	// MaxEntries is the maximum number of cached responses.
+	// If zero it defaults to 10000.
+	MaxEntries int
+
+	// MaxBytes is the maximum total size of cached responses
+	// in bytes. If zero it defaults to 64 MiB.
+	MaxBytes int64
+}
+
+// EndpointCache configures caching the responses of an endpoint.
+type EndpointCache struct {
+	// TTL is how long responses are cached.
+	// If zero it defaults to 1 minute.
+	TTL time.Duration
+}
+
+// CachePolicy describes how clients and intermediaries may cache
+// the responses of an endpoint. It applies to successful responses
+// to GET and HEAD requests that do not set Cache-Control themselves;
+// other responses get "no-store".
+//
+// Responses of endpoints requiring authentication vary by the
+// Authorization and Cookie headers, and those that may be
+// compressed by Accept-Encoding.
+type CachePolicy struct {
+	// Public allows shared caches, such as CDNs, to store responses.
+	// Otherwise only the client may store them.
+	Public bool
+
+	// MaxAge is how long responses are fresh.
+	MaxAge time.Duration
+
+	// StaleWhileRevalidate, if positive, is how long stale
+	// responses may be used while they are revalidated.
+	StaleWhileRevalidate time.Duration
+
+	// NoStore forbids storing responses at all,
+	// such as for endpoints returning sensitive data.
+	NoStore bool
+
+	// Vary are additional request headers responses vary by.
+	Vary []string
+}
+
+type ETags struct {
+	// Enabled enables answering conditional GET and HEAD requests
+	// to non-raw endpoints (If-None-Match and If-Modified-Since) with
+	// 304 Not Modified. Responses get an ETag computed from their body,
+	// unless the handler sets the ETag header itself.
+	Enabled bool
+
+	// MaxSize is the maximum response size in bytes to compute ETags
+	// for, since computing them requires buffering the response.
+	// If zero it defaults to 1 MiB.
+	MaxSize int
+}
+
+type Compression struct {
+	// Enabled enables compressing responses, negotiated through
+	// the Accept-Encoding header. gzip and deflate are supported
+	// out of the box; see Encoders for adding more.
+	Enabled bool
+
+	// MinSize is the minimum response size in bytes to compress.
+	// If zero it defaults to 1024.
+	MinSize int
+
+	// ContentTypes are the media types to compress. A trailing "*"
+	// matches any subtype, as in "text/*". If empty it defaults
+	// to common text-based types such as JSON, HTML and JavaScript.
+	ContentTypes []string
+
+	// Encoders are additional content encodings to support, such as
+	// "br" or "zstd". They are preferred over the built-in encodings,
+	// in the order given, when the client accepts them equally.
+	Encoders []Encoder
+}
+
+// RequestDecompression configures decompressing request bodies
+// sent with the Content-Encoding header, guarding against
+// decompression bombs.
+type RequestDecompression struct {
+	// MaxSize is the maximum decompressed body size in bytes.
+	// If zero it defaults to 32 MiB.
+	MaxSize int64
+
+	// MaxRatio is the maximum ratio of decompressed to compressed
+	// size, enforced once bodies exceed 64 KiB decompressed.
+	// If zero it defaults to 100.
+	MaxRatio int
+
+	// Decoders are additional content encodings to support, such
+	// as "br" or "zstd". gzip and deflate are supported out of the box.
+	Decoders []Decoder
+}
+
+// Decoder is a content encoding for request decompression.
+type Decoder struct {
+	Name string // content-coding name, e.g. "br"
+	New  func(r io.Reader) (io.ReadCloser, error)
+}
+
+// Encoder is a content encoding for response compression.
+type Encoder struct {
+	Name string // content-coding name, e.g. "br"
+	New  func(w io.Writer) io.WriteCloser
+}
+
+type AccessLog struct {
+	// Disabled disables access logging.
+	Disabled bool
+
+	// SampleRate is the fraction of requests to log, between 0 and 1.
+	// If zero all requests are logged.
+	SampleRate float64
+}
+
+type MetricsListener struct {
+	// Addr is the TCP address to listen on, such as ":9090".
+	Addr string
+
+	// Path is the path to serve metrics on. If empty it defaults to "/metrics".
+	Path string
+
+	// DisableAppRoute stops serving metrics through the app's
+	// listener at __encore.ScrapeMetrics.
+	DisableAppRoute bool
+}
+
+type MetricsExport struct {
+	// Interval is how often metrics are pushed.
+	// If zero it defaults to 10 seconds.
+	Interval time.Duration
+
+	// StatsD, if set, pushes metrics to a StatsD or DogStatsD server.
+	StatsD *StatsD
+
+	// Pushgateway, if set, pushes metrics to a Prometheus Pushgateway.
+	Pushgateway *Pushgateway
+
+	// RemoteWrite, if set, pushes metrics to a Prometheus
+	// remote-write endpoint.
+	RemoteWrite *RemoteWrite
+
+	// Exporters are additional backends to push metrics to.
+	Exporters []MetricsExporter
+}
+
+// MetricsExporter pushes metrics to a backend.
+type MetricsExporter interface {
+	Push(mfs []*dto.MetricFamily) error
+}
+
+type StatsD struct {
+	// Addr is the UDP address of the server, such as "localhost:8125".
+	Addr string
+
+	// Prefix is prepended to metric names, such as "myapp.".
+	Prefix string
+
+	// DogStatsD sends labels as DogStatsD tags. Otherwise labels
+	// are encoded in the metric name, as in "name.label.value".
+	DogStatsD bool
+
+	// Tags are global tags added to all metrics, such as "env:prod".
+	// They require DogStatsD.
+	Tags []string
+}
+
+type Pushgateway struct {
+	// URL is the URL of the Pushgateway, such as "http://pushgateway:9091".
+	URL string
+
+	// Job is the job name to push metrics under.
+	Job string
+
+	// Grouping are additional grouping labels, such as "instance".
+	Grouping map[string]string
+}
+
+type RemoteWrite struct {
+	// URL is the remote-write endpoint, such as
+	// "http://prometheus:9090/api/v1/write".
+	URL string
+
+	// Headers are additional request headers, such as Authorization.
+	Headers map[string]string
+
+	// Labels are added to all series, such as "job" and "instance".
+	Labels map[string]string
+}
+
+type Pprof struct {
+	// Token, if set, must be provided as a bearer token
+	// in the Authorization header to access the profiles.
+	Token string
+
+	// BlockProfileRate enables the block profile; see
+	// runtime.SetBlockProfileRate. If zero it is disabled.
+	BlockProfileRate int
+
+	// MutexProfileFraction enables the mutex profile; see
+	// runtime.SetMutexProfileFraction. If zero it is disabled.
+	MutexProfileFraction int
+}
+
+type LogLevelControl struct {
+	// Token, if set, must be provided as a bearer token
+	// in the Authorization header to change the log level.
+	Token string
+
+	// MaxTTL is the maximum duration of a log level change.
+	// If zero it defaults to 1 hour.
+	MaxTTL time.Duration
+}
+
+type GRPC struct {
+	// Addr is the TCP address to serve gRPC on, such as ":9000".
+	// If empty gRPC is served on the app's listener, which
+	// requires HTTP/2 (TLS, or HTTP2.H2C for cleartext).
+	Addr string
+
+	// MaxRecvMsgSize is the maximum request message size in bytes.
+	// If zero it defaults to 4 MiB.
+	MaxRecvMsgSize int
+}
+
+type OpenAPI struct {
+	// Title and Version describe the API.
+	// They default to "Encore API" and "1.0".
+	Title   string
+	Version string
+
+	// Servers are the base URLs of the API, such as "https://api.example.com".
+	Servers []string
+
+	// Disabled disables serving the document.
+	Disabled bool
+}
+
+type WebSocket struct {
+	// AllowedOrigins are the origins, such as "https://app.example.com",
+	// allowed to connect in addition to the server's own origin.
+	// "*" allows any origin.
+	AllowedOrigins []string
+
+	// MaxMessageSize is the maximum size of received messages in bytes.
+	// If zero it defaults to 1 MiB.
+	MaxMessageSize int64
+
+	// PingInterval is how often to ping clients to detect dead
+	// connections. If zero it defaults to 30s, and if negative
+	// clients are not pinged.
+	PingInterval time.Duration
+
+	// OnMessage, if set, is called for each message sent or received,
+	// such as to trace messages. ctx is the context of the request
+	// that was upgraded.
+	OnMessage func(ctx context.Context, msg WebSocketMessage)
+}
+
+// WebSocketMessage describes a WebSocket message.
+type WebSocketMessage struct {
+	Service  string
+	Endpoint string
+
+	// Inbound is true for messages received from the client.
+	Inbound bool
+
+	// Binary is true for binary messages and false for text messages.
+	Binary bool
+
+	// Size is the message size in bytes.
+	Size int
+}
+
+type Uploads struct {
+	// TempDir is the directory uploaded files are written to.
+	// If empty it defaults to the system's temporary directory.
+	// Files are removed when the request completes.
+	TempDir string
+
+	// Store, if set, stores uploaded files instead, under keys
+	// prefixed with KeyPrefix. Stored files are not removed.
+	Store     UploadStore
+	KeyPrefix string
+
+	// MaxFileSize is the maximum size of an uploaded file in bytes.
+	// If zero it defaults to 32 MiB.
+	MaxFileSize int64
+
+	// MaxParts is the maximum number of parts in a request.
+	// If zero it defaults to 100.
+	MaxParts int
+
+	// AllowedTypes, if non-empty, are the content types files
+	// may have, as sniffed from their content, such as "image/*".
+	AllowedTypes []string
+}
+
+// UploadStore stores uploaded files, such as in an object store.
+type UploadStore interface {
+	Put(ctx context.Context, key, contentType string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+type ErrorReporting struct {
+	// SentryDSN is the DSN of the Sentry project to report to.
+	SentryDSN string
+
+	// WebhookURL, if set, reports errors as JSON to the URL
+	// instead of to Sentry. WebhookHeaders are sent with each
+	// request, such as for authentication.
+	WebhookURL     string
+	WebhookHeaders map[string]string
+
+	// Rate and Burst limit the number of errors reported,
+	// in errors per second. If zero they default to 1 error
+	// per second with bursts of 10.
+	Rate  float64
+	Burst int
+
+	// ScrubFields are the names of additional fields and headers
+	// to scrub from reports. Sensitive fields such as "password",
+	// "authorization" and "cookie" are always scrubbed, as is
+	// anything matched by the LogRedaction rules.
+	ScrubFields []string
+}
+
+type Tracing struct {
+	// Endpoint is the collector endpoint: the URL of the traces endpoint
+	// for HTTP, such as "http://localhost:4318/v1/traces", or the
+	// address for gRPC, such as "localhost:4317".
+	Endpoint string
+
+	// Protocol is "http/protobuf" (the default) or "grpc".
+	Protocol string
+
+	// Insecure disables TLS when exporting over gRPC.
+	Insecure bool
+
+	// Headers are sent with each export request, such as for authentication.
+	Headers map[string]string
+
+	// Propagators are the formats in which the trace context is
+	// propagated on outbound HTTP requests: "tracecontext" (W3C),
+	// "b3" and "b3multi". If empty it defaults to "tracecontext".
+	// Incoming requests are accepted in any of the formats.
+	Propagators []string
+
+	// Sampling configures which traces are sampled,
+	// unless overridden by the endpoint starting the trace.
+	// Traces continued from a caller follow the caller's decision.
+	Sampling TraceSampling
+
+	// SampleErrors samples failed requests even if their trace
+	// was not sampled.
+	SampleErrors bool
+
+	// ServiceName is the "service.name" resource attribute.
+	// If empty it defaults to "encore".
+	ServiceName string
+
+	// ResourceAttributes are additional attributes describing the process,
+	// such as "deployment.environment".
+	ResourceAttributes map[string]string
+}
+
+type TraceSampling struct {
+	// Disabled disables sampling traces.
+	Disabled bool
+
+	// Probability is the fraction of traces to sample, between 0 and 1.
+	// If zero all traces are sampled.
+	Probability float64
+
+	// RateLimit is the maximum number of traces to sample per second,
+	// per instance. If zero there is no limit.
+	RateLimit float64
+}
+
+type LogRedaction struct {
+	// Fields are the names of fields to redact, in addition to common
+	// sensitive fields such as "password", "token" and "authorization".
+	// Names are matched case-insensitively.
+	Fields []string
+
+	// FieldPatterns are regular expressions for the names
+	// of fields to redact, such as "(?i)_key$".
+	FieldPatterns []string
+
+	// ValuePatterns are regular expressions for
+	// sensitive content to redact within string values.
+	ValuePatterns []string
+
+	// CardNumbers redacts values that look like payment card numbers.
+	CardNumbers bool
+}
+
+type RecentLogs struct {
+	// Size is the number of records to keep.
+	// If zero it defaults to 1000.
+	Size int
+
+	// Token, if set, must be provided as a bearer token
+	// in the Authorization header to read the records.
+	Token string
+}
+
+type LogSampling struct {
+	// Default is the policy for messages without a policy of their
+	// own. If nil such messages are not sampled.
+	Default *LogSamplingPolicy
+
+	// Messages are the policies for specific messages,
+	// keyed by the log message.
+	Messages map[string]LogSamplingPolicy
+}
+
+// LogSamplingPolicy is a log sampling policy. The first Burst messages
+// in each Period are logged, and after that one in every N messages.
+// If N is zero, messages beyond the burst are dropped.
+type LogSamplingPolicy struct {
+	Burst  int
+	Period time.Duration
+	N      int
+}
+
+type AuditLog struct {
+	// Path is the file to append audit records to. If empty
+	// records are written to Output, or to stdout if Output is nil.
+	// Application logs are written to stderr, keeping the streams separate.
+	Path   string
+	Output io.Writer
+
+	// Redact are the names of request fields whose values are redacted,
+	// in addition to common credential fields such as "password" and "token".
+	Redact []string
+
+	// MaxBodySize is the maximum request body size to record.
+	// Larger bodies are omitted. If zero it defaults to 64 KiB.
+	MaxBodySize int64
+}
+
+type CORS struct {
+	// AllowOrigins are the origins allowed to make cross-origin requests.
+	// "*" allows any origin, and a leading wildcard subdomain such as
+	// "https://*.example.com" allows any subdomain.
+	AllowOrigins []string
+
+	// AllowMethods are the methods allowed in cross-origin requests.
+	// If empty it defaults to the methods the endpoint supports.
+	AllowMethods []string
+
+	// AllowHeaders are the request headers allowed in cross-origin requests.
+	// If empty it allows the headers requested in the preflight request.
+	AllowHeaders []string
+
+	// ExposeHeaders are the response headers exposed to the client.
+	ExposeHeaders []string
+
+	// AllowCredentials allows requests to include credentials
+	// such as cookies and HTTP authentication.
+	// It cannot be combined with the "*" origin.
+	AllowCredentials bool
+
+	// MaxAge is how long preflight responses may be cached.
+	// If zero no Access-Control-Max-Age header is sent.
+	MaxAge time.Duration
+}
+
+// SecurityHeaders configures the security headers added to responses.
+// Empty fields use the default values, suitable for APIs that do not
+// serve HTML, and fields set to "-" omit the header. Headers set by
+// the handler take precedence.
+type SecurityHeaders struct {
+	// HSTSMaxAge, if positive, sets the Strict-Transport-Security
+	// header, telling browsers to only use HTTPS for the host
+	// for the given duration.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// ContentTypeOptions is the X-Content-Type-Options header.
+	// It defaults to "nosniff".
+	ContentTypeOptions string
+
+	// FrameOptions is the X-Frame-Options header.
+	// It defaults to "DENY".
+	FrameOptions string
+
+	// ReferrerPolicy is the Referrer-Policy header.
+	// It defaults to "no-referrer".
+	ReferrerPolicy string
+
+	// ContentSecurityPolicy is the Content-Security-Policy header.
+	// It defaults to "default-src 'none'; frame-ancestors 'none'".
+	ContentSecurityPolicy string
+}
+
+// CSRF configures cross-site request forgery protection using
+// double-submit cookies. Clients get a token from the
+// /__encore/csrf endpoint, which also sets it as a cookie, and
+// send it in the token header of POST, PUT, PATCH and DELETE
+// requests. Such requests carrying cookies are rejected with
+// 403 Forbidden unless the header matches the cookie.
+type CSRF struct {
+	// CookieName is the name of the token cookie.
+	// If empty it defaults to "encore_csrf".
+	CookieName string
+
+	// HeaderName is the name of the token header.
+	// If empty it defaults to "X-CSRF-Token".
+	HeaderName string
+
+	// Key, if set, signs tokens so that cookies set by other
+	// means, such as by a compromised subdomain, are rejected.
+	Key string
+
+	// CookieDomain is the domain of the token cookie.
+	// If empty the cookie is for the request's host only.
+	CookieDomain string
+
+	// Secure marks the token cookie as only to be sent over HTTPS.
+	Secure bool
+
+	// SameSite is the SameSite attribute of the token cookie.
+	// If zero it defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+
+	// Exempt are request paths that are not protected, such as
+	// webhooks called by other servers. A trailing "*" matches
+	// any path with the preceding prefix, as in "/webhooks/*".
+	Exempt []string
+}
+
+// Startup configures waiting for dependencies to initialize.
+// Readiness checks fail until they have initialized.
+type Startup struct {
+	// Timeout is how long to wait for dependencies to initialize
+	// before exiting. If zero it defaults to 1 minute.
+	Timeout time.Duration
+
+	// GateEndpoints rejects requests to endpoints with 503 Service
+	// Unavailable until dependencies have initialized.
+	GateEndpoints bool
+
+	// WarmUpTimeout is the total time allowed for the functions
+	// registered with runtime.OnWarmUp to run before the server
+	// starts listening. If zero there is no limit.
+	WarmUpTimeout time.Duration
+}
+
+// Timeouts configures the HTTP server timeouts.
+// Zero values use the defaults; negative values disable the timeout.
+type Timeouts struct {
+	Read       time.Duration // default: no timeout
+	ReadHeader time.Duration // default: 10s
+	Write      time.Duration // default: no timeout
+	Idle       time.Duration // default: 2m
+}
+
+// SlowClients configures protection against clients that send request
+// bodies slowly to tie up server resources, as in slowloris attacks.
+type SlowClients struct {
+	// MinBodyRate is the minimum rate in bytes per second at which
+	// request bodies must be received, measured over the time spent
+	// waiting for the body. Slower clients have their connection closed.
+	MinBodyRate int64
+
+	// GracePeriod is how long to wait for a body before enforcing
+	// the minimum rate. If zero it defaults to 5 seconds.
+	GracePeriod time.Duration
+}
+
+type HTTP2 struct {
+	// H2C enables HTTP/2 over cleartext TCP connections (h2c).
+	H2C bool
+
+	// MaxConcurrentStreams is the maximum number of concurrent streams
+	// per connection. If zero it defaults to 250.
+	MaxConcurrentStreams uint32
+
+	// MaxReadFrameSize is the largest frame the server is willing to read,
+	// between 16KiB and 16MiB. If zero it defaults to 1MiB.
+	MaxReadFrameSize uint32
+}
+
+type TLS struct {
+	// CertFile and KeyFile are paths to a PEM-encoded certificate and key.
+	// They are reloaded automatically when they change on disk.
+	CertFile string
+	KeyFile  string
+
+	// CertPEM and KeyPEM are a PEM-encoded certificate and key,
+	// used instead of CertFile and KeyFile if set.
+	CertPEM []byte
+	KeyPEM  []byte
+
+	// AutocertHosts, if non-empty, enables obtaining certificates
+	// for the given hosts automatically using ACME (Let's Encrypt).
+	// It takes precedence over the other certificate options.
+	AutocertHosts []string
+	AutocertEmail string // contact email for the ACME account, if any
+	AutocertCache string // directory to cache certificates in, if any
+
+	// ClientCAFile and ClientCAPEM are a PEM-encoded CA bundle for
+	// verifying client certificates. If either is set, clients must
+	// present a certificate signed by one of the CAs (mutual TLS).
+	ClientCAFile string
+	ClientCAPEM  []byte
+
+	// ClientCertOptional allows clients to connect without a certificate.
+	// Certificates that are presented are still verified.
+	ClientCertOptional bool
+}
+
+// HTTP3 plugs an HTTP/3 server implementation into the runtime.
+// The runtime opens the UDP socket, passes it to the server created
+// by NewServer and, while it is serving, advertises it to clients
+// through the Alt-Svc header on TCP responses.
+type HTTP3 struct {
+	// Addr is the UDP address to listen on.
+	// If empty it uses the same address as the TCP listener.
+	Addr string
+
+	// NewServer creates the HTTP/3 server implementation serving h,
+	// such as an *http3.Server from github.com/lucas-clemente/quic-go.
+	// If nil HTTP/3 is disabled.
+	NewServer func(tlsConfig *tls.Config, h http.Handler) HTTP3Server
+}
+
+// HTTP3Server is an HTTP/3 server implementation.
+type HTTP3Server interface {
+	Serve(conn net.PacketConn) error
+	Close() error
 }
 
 type Service struct {
 	Name      string
 	RelPath   string // relative path to service pkg (from app root)
 	Endpoints []*Endpoint
-	SQLDB     bool // does the service use sqldb?
+	SQLDB     bool  // does the service use sqldb?
+	CORS      *CORS // overrides ServerConfig.CORS, if non-nil
+
+	// Databases are the names of the SQL databases the service uses.
+	// The first is the one used by the package-level sqldb functions.
+	// If empty the service uses the database named after it, and
+	// may look up any other.
+	Databases []string
+
+	// Hosts restricts the service's endpoints to requests for the given
+	// host names, such as "api.example.com" or "*.example.com".
+	// If empty the endpoints are served for any host.
+	Hosts []string
+
+	// Middleware is the middleware to apply to the service's endpoints,
+	// ahead of any endpoint middleware.
+	Middleware []middleware.Middleware
+
+	// ResponseHooks transform the responses of the service's endpoints.
+	ResponseHooks []middleware.ResponseHook
+
+	// IPFilter restricts which client IPs may call the service's endpoints.
+	IPFilter *IPFilter
+}
+
+// IPFilter restricts access based on the client's IP address.
+// Entries are IP addresses or CIDR ranges.
+type IPFilter struct {
+	// Allow, if non-empty, allows only the given addresses.
+	Allow []string
+
+	// Deny denies the given addresses. It takes precedence over Allow.
+	Deny []string
 }
 
 type Endpoint struct {
 	Name    string
-	Raw     bool
 	Path    string
 	Methods []string
 	Access  Access
 	Handler func(w http.ResponseWriter, req *http.Request, ps httprouter.Params)
+
+	// Raw endpoints handle requests directly, without payload
+	// encoding. They receive the request and response writer
+	// untouched by the runtime: responses are not compressed and
+	// audit records omit the request body. They are still measured
+	// and traced, but are not exposed over gRPC.
+	Raw bool
+
+	// Doc is the endpoint's documentation.
+	Doc string
+
+	// Version is the API version of the endpoint. If non-zero the
+	// endpoint is served under the "/v<Version>" path prefix, so
+	// endpoints of different versions can share a Path. Requests
+	// without the prefix are routed to it if their Accept header has
+	// a matching version parameter, such as "application/json;
+	// version=2", or if it is the default version (see APIVersions).
+	Version int
+
+	// Request and Response are the types of the request and response
+	// payloads, or nil if the endpoint has none. They are used to
+	// describe the endpoint in the OpenAPI document.
+	Request  reflect.Type
+	Response reflect.Type
+
+	// AuthRequired requires requests to be authenticated
+	// by the auth handler, which must be configured.
+	// It is implied by Access == Auth.
+	AuthRequired bool
+
+	// Scopes are the scopes the caller must have been granted,
+	// and Roles the roles of which the caller must have at least one.
+	// They are checked against the auth handler's result, which
+	// must be configured, and imply AuthRequired.
+	Scopes []string
+	Roles  []string
+
+	// MaxBodySize is the maximum request body size in bytes.
+	// If zero the server-wide limit applies, and if negative there is no limit.
+	MaxBodySize int64
+
+	// Hosts overrides Service.Hosts for this endpoint, if non-empty.
+	Hosts []string
+
+	// Middleware is the middleware to apply to the endpoint.
+	Middleware []middleware.Middleware
+
+	// AccessLog overrides ServerConfig.AccessLog for this endpoint, if non-nil.
+	AccessLog *AccessLog
+
+	// Audit overrides whether calls to the endpoint are audit logged.
+	// By default calls using POST, PUT, PATCH and DELETE are.
+	Audit *bool
+
+	// AuditRedact are additional fields to redact from audit records.
+	AuditRedact []string
+
+	// TraceSampling overrides Tracing.Sampling for traces
+	// started by the endpoint, if non-nil.
+	TraceSampling *TraceSampling
+
+	// RateLimit rate limits calls to the endpoint. If nil there is no limit.
+	RateLimit *RateLimit
+
+	// IPFilter overrides Service.IPFilter for this endpoint, if non-nil.
+	IPFilter *IPFilter
+
+	// SecurityHeaders overrides ServerConfig.SecurityHeaders for this
+	// endpoint, if non-nil, such as for raw endpoints serving HTML.
+	SecurityHeaders *SecurityHeaders
+
+	// ResponseCache, if set, caches the successful responses of the
+	// endpoint to GET requests in memory, by path, query string and
+	// the caller's identity. Cached responses are invalidated when
+	// they expire or by InvalidateResponses.
+	ResponseCache *EndpointCache
+
+	// CachePolicy sets the Cache-Control header of the endpoint's
+	// responses, if non-nil.
+	CachePolicy *CachePolicy
+}
+
+type RateLimitKey string
+
+const (
+	RateLimitByIP   RateLimitKey = "ip"   // the client's IP address
+	RateLimitByAuth RateLimitKey = "auth" // the authenticated user ID, or IP address if unauthenticated
+)
+
+// RateLimit configures token bucket rate limiting.
+type RateLimit struct {
+	// Rate is the number of requests allowed per second.
+	Rate float64
+
+	// Burst is the maximum number of requests allowed in a burst.
+	// If zero it defaults to Rate, rounded up.
+	Burst int
+
+	// Key is what to rate limit by. If empty it defaults to RateLimitByIP.
+	Key RateLimitKey
+
+	// KeyFunc, if set, computes the key to rate limit by,
+	// and takes precedence over Key.
+	KeyFunc func(req *http.Request) string
 }
@@ -0,0 +1,205 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"runtime.encore.dev/beta/errs"
+)
+
+// Protocols served by serveConnect.
+const (
+	protoConnectUnary  = "connect"
+	protoConnectStream = "connect+stream"
+	protoGRPCWeb       = "grpc-web"
+	protoGRPCWebText   = "grpc-web-text"
+)
+
+// Envelope flags of the Connect streaming and gRPC-Web protocols.
+const (
+	flagCompressed = 0x01
+	flagEndStream  = 0x02 // Connect end-of-stream message
+	flagTrailer    = 0x80 // gRPC-Web trailers
+)
+
+// connectProtocol reports the protocol of req, or ""
+// if it is not a Connect or gRPC-Web request.
+func connectProtocol(req *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(mediaType, "application/grpc-web-text"):
+		return protoGRPCWebText
+	case strings.HasPrefix(mediaType, "application/grpc-web"):
+		return protoGRPCWeb
+	case strings.HasPrefix(mediaType, "application/connect+"):
+		return protoConnectStream
+	case req.Header.Get("Connect-Protocol-Version") != "" &&
+		(mediaType == contentTypeProto || mediaType == contentTypeJSON):
+		return protoConnectUnary
+	}
+	return ""
+}
+
+// payloadType returns the content type of the payloads
+// of a Connect or gRPC-Web request.
+func payloadType(req *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if strings.HasSuffix(mediaType, "+json") || mediaType == contentTypeJSON {
+		return contentTypeJSON
+	}
+	return contentTypeProto
+}
+
+// serveConnect serves a Connect or gRPC-Web request to the endpoint m.
+// Only unary calls are supported: streaming requests must contain
+// a single message, and the response stream contains a single message.
+func (srv *Server) serveConnect(w http.ResponseWriter, req *http.Request, m *grpcMethod, proto string) {
+	contentType := req.Header.Get("Content-Type")
+	var body io.Reader = req.Body
+	if proto == protoGRPCWebText {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		srv.connectError(w, proto, contentType, errs.InvalidArgument, "could not read request: "+err.Error())
+		return
+	}
+	if proto != protoConnectUnary {
+		if data, err = unenvelope(data); err != nil {
+			srv.connectError(w, proto, contentType, errs.InvalidArgument, err.Error())
+			return
+		}
+	}
+
+	r := req.Clone(req.Context())
+	res := m.call(r, payloadType(req), data)
+
+	// Pass on headers set by middleware, such as CORS headers.
+	for k, vs := range res.header {
+		if k != "Content-Type" && k != "Content-Length" {
+			w.Header()[k] = vs
+		}
+	}
+	if res.status/100 != 2 {
+		code, msg := parseErrorResponse(res.status, res.buf.Bytes())
+		srv.connectError(w, proto, contentType, code, msg)
+		return
+	}
+
+	out := res.buf.Bytes()
+	switch proto {
+	case protoConnectUnary:
+		w.Header().Set("Content-Type", res.header.Get("Content-Type"))
+		w.Write(out)
+	case protoConnectStream:
+		w.Header().Set("Content-Type", contentType)
+		var buf bytes.Buffer
+		envelope(&buf, 0, out)
+		envelope(&buf, flagEndStream, []byte("{}"))
+		w.Write(buf.Bytes())
+	default:
+		var buf bytes.Buffer
+		envelope(&buf, 0, out)
+		envelope(&buf, flagTrailer, []byte("grpc-status: 0\r\n"))
+		srv.writeGRPCWeb(w, proto, contentType, buf.Bytes())
+	}
+}
+
+// connectError responds with an error in the format of the protocol.
+func (srv *Server) connectError(w http.ResponseWriter, proto, contentType string, code errs.ErrCode, msg string) {
+	switch proto {
+	case protoConnectUnary:
+		data, _ := json.Marshal(map[string]string{"code": code.String(), "message": msg})
+		w.Header().Set("Content-Type", contentTypeJSON)
+		w.WriteHeader(code.HTTPStatus())
+		w.Write(data)
+	case protoConnectStream:
+		data, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]string{"code": code.String(), "message": msg},
+		})
+		var buf bytes.Buffer
+		envelope(&buf, flagEndStream, data)
+		w.Header().Set("Content-Type", contentType)
+		w.Write(buf.Bytes())
+	default:
+		trailer := fmt.Sprintf("grpc-status: %d\r\ngrpc-message: %s\r\n", code, grpcMessageEncode(msg))
+		var buf bytes.Buffer
+		envelope(&buf, flagTrailer, []byte(trailer))
+		srv.writeGRPCWeb(w, proto, contentType, buf.Bytes())
+	}
+}
+
+func (srv *Server) writeGRPCWeb(w http.ResponseWriter, proto, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	if proto == protoGRPCWebText {
+		data = []byte(base64.StdEncoding.EncodeToString(data))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// parseErrorResponse parses an error response written by
+// an endpoint handler, such as by errs.HTTPError.
+func parseErrorResponse(httpStatus int, body []byte) (errs.ErrCode, string) {
+	var e struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	code := errs.HTTPStatusToCode(httpStatus)
+	msg := http.StatusText(httpStatus)
+	if json.Unmarshal(body, &e) == nil {
+		// Codes specific to the runtime, such as "unknown_endpoint",
+		// fall back to the code implied by the status.
+		if c := errs.ParseCode(e.Code); c != errs.Unknown || e.Code == errs.Unknown.String() {
+			code = c
+		}
+		if e.Message != "" {
+			msg = e.Message
+		}
+	}
+	return code, msg
+}
+
+// envelope writes an enveloped message to buf.
+func envelope(buf *bytes.Buffer, flags byte, data []byte) {
+	var hdr [5]byte
+	hdr[0] = flags
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+	buf.Write(hdr[:])
+	buf.Write(data)
+}
+
+// unenvelope returns the single message in data,
+// a stream of enveloped messages.
+func unenvelope(data []byte) ([]byte, error) {
+	if len(data) < 5 {
+		return nil, fmt.Errorf("invalid message envelope")
+	}
+	flags, n := data[0], binary.BigEndian.Uint32(data[1:5])
+	if flags&flagCompressed != 0 {
+		return nil, fmt.Errorf("compressed messages are not supported")
+	}
+	if uint64(len(data)-5) < uint64(n) {
+		return nil, fmt.Errorf("truncated message")
+	}
+	msg, rest := data[5:5+n], data[5+n:]
+	// Allow a trailing end-of-stream message without data.
+	if len(rest) > 0 && !(len(rest) == 5 && rest[0]&flagEndStream != 0) {
+		return nil, fmt.Errorf("streaming requests must contain a single message")
+	}
+	return msg, nil
+}
+
+// grpcMessageEncode percent-encodes a grpc-message trailer value.
+func grpcMessageEncode(msg string) string {
+	return strings.ReplaceAll(url.PathEscape(msg), "%20", " ")
+}
@@ -0,0 +1,179 @@
+package runtime
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// corsPolicy implements Cross-Origin Resource Sharing
+// according to a config.CORS.
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	subdomains  []string // suffixes of wildcard subdomain origins, e.g. ".example.com"
+	schemes     []string // schemes of wildcard subdomain origins, e.g. "https://"
+	methods     string
+	headers     string
+	expose      string
+	credentials bool
+	maxAge      string
+}
+
+// corsPolicy returns the CORS policy for the service, or nil if
+// cross-origin requests are not allowed.
+func (srv *Server) corsPolicy(svc *config.Service) *corsPolicy {
+	cfg := svc.CORS
+	if cfg == nil {
+		cfg = srv.cfg.CORS
+	}
+	if cfg == nil {
+		return nil
+	}
+
+	p := &corsPolicy{
+		origins:     make(map[string]bool),
+		methods:     strings.Join(cfg.AllowMethods, ", "),
+		headers:     strings.Join(cfg.AllowHeaders, ", "),
+		expose:      strings.Join(cfg.ExposeHeaders, ", "),
+		credentials: cfg.AllowCredentials,
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	for _, o := range cfg.AllowOrigins {
+		if o == "*" {
+			if cfg.AllowCredentials {
+				// Reflecting any origin with credentials would let
+				// any site make credentialed cross-origin requests.
+				srv.logger.Fatal().Str("service", svc.Name).
+					Msg("cors: the \"*\" origin cannot be combined with AllowCredentials")
+			}
+			p.anyOrigin = true
+		} else if idx := strings.Index(o, "://*."); idx != -1 {
+			p.schemes = append(p.schemes, strings.ToLower(o[:idx+3]))
+			p.subdomains = append(p.subdomains, strings.ToLower(o[idx+4:]))
+		} else {
+			p.origins[strings.ToLower(o)] = true
+		}
+	}
+	return p
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for i, suffix := range p.subdomains {
+		if strings.HasPrefix(origin, p.schemes[i]) && strings.HasSuffix(origin, suffix) &&
+			len(origin) > len(p.schemes[i])+len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOrigin sets the headers common to preflight and actual requests.
+// It reports whether the origin is allowed.
+func (p *corsPolicy) setOrigin(w http.ResponseWriter, req *http.Request) bool {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	origin := req.Header.Get("Origin")
+	if origin == "" || !p.allowOrigin(origin) {
+		return false
+	}
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// middleware adds CORS headers to the response of actual requests.
+func (p *corsPolicy) middleware(next middleware.Handler) middleware.Handler {
+	return func(w middleware.ResponseWriter, req *middleware.Request) {
+		if p.setOrigin(w, req.HTTP) && p.expose != "" {
+			w.Header().Set("Access-Control-Expose-Headers", p.expose)
+		}
+		next(w, req)
+	}
+}
+
+// handlePreflight registers a handler for CORS preflight requests
+// for the given path, unless one has already been registered.
+func (rt *routeTable) handlePreflight(path string, p *corsPolicy) {
+	if rt.preflightPaths[path] {
+		return
+	}
+	rt.preflightPaths[path] = true
+	rt.preflight.Handle("OPTIONS", path, func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		p.preflight(w, req, rt.routeMethods(req.URL.Path, req.Header.Get("Access-Control-Request-Method")))
+	})
+}
+
+// routeMethods reports the methods supported by the given path,
+// in the context of a request for the method reqMethod.
+// If the path has a wildcard route the result is just reqMethod.
+func (rt *routeTable) routeMethods(path, reqMethod string) []string {
+	if h, _, _ := rt.router.Lookup(wildcardMethod, path); h != nil {
+		return []string{reqMethod}
+	}
+	return rt.allowedMethods(path)
+}
+
+// preflight responds to a CORS preflight request.
+// allowed are the methods supported by the requested path.
+func (p *corsPolicy) preflight(w http.ResponseWriter, req *http.Request, allowed []string) {
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	reqMethod := req.Header.Get("Access-Control-Request-Method")
+	if !containsMethod(allowed, reqMethod) || !p.setOrigin(w, req) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if p.methods != "" {
+		h.Set("Access-Control-Allow-Methods", p.methods)
+	} else {
+		h.Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+	}
+	if p.headers != "" {
+		h.Set("Access-Control-Allow-Headers", p.headers)
+	} else if reqHeaders := req.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+	if p.maxAge != "" {
+		h.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isPreflight reports whether req is a CORS preflight request.
+func isPreflight(req *http.Request) bool {
+	return req.Method == "OPTIONS" && req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
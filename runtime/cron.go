@@ -0,0 +1,284 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"runtime.encore.dev/internal/cron"
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/runtime/config"
+)
+
+const (
+	defaultCronTimeout = 10 * time.Minute
+
+	// maxCatchUp is the maximum number of missed runs
+	// looked at when catching up with the "once" policy.
+	maxCatchUp = 100000
+)
+
+// cronTarget is an endpoint called by cron jobs.
+type cronTarget struct {
+	method  string
+	path    string
+	handler httprouter.Handle
+}
+
+// cronJob runs a configured cron job.
+type cronJob struct {
+	srv     *Server
+	cfg     *config.CronJob
+	sched   *cron.Schedule
+	loc     *time.Location
+	target  *cronTarget
+	timeout time.Duration
+}
+
+// registerCronTarget records the endpoint, handled by h, as
+// callable by cron jobs. Endpoints with path parameters are
+// not, since jobs cannot provide them.
+func (srv *Server) registerCronTarget(svc *config.Service, endpoint *config.Endpoint, h httprouter.Handle) {
+	if srv.cronTargets == nil || strings.ContainsAny(endpoint.Path, ":*") {
+		return
+	}
+	method := "POST"
+	if len(endpoint.Methods) > 0 && !containsMethod(endpoint.Methods, "POST") && endpoint.Methods[0] != "*" {
+		method = endpoint.Methods[0]
+	}
+	srv.cronTargets[svc.Name+"."+endpoint.Name] = &cronTarget{
+		method:  method,
+		path:    endpointPath(endpoint),
+		handler: h,
+	}
+}
+
+// newCronStore creates the store for the state of cron jobs.
+func (srv *Server) newCronStore() cron.Store {
+	switch store := srv.cfg.Cron.Store; store {
+	case "redis":
+		if srv.redis == nil {
+			srv.logger.Fatal().Msg("cron: redis store configured but no redis server")
+		}
+		return cron.NewRedisStore(srv.redis, "encore:cron:")
+	case "", "memory":
+		return cron.NewMemoryStore()
+	default:
+		srv.logger.Fatal().Str("store", store).Msg("cron: unknown store")
+		return nil
+	}
+}
+
+// setupCron prepares the configured cron jobs,
+// once the endpoints they call have been registered.
+func (srv *Server) setupCron() {
+	seen := make(map[string]bool)
+	for _, cfg := range srv.cfg.Cron.Jobs {
+		log := srv.logger.With().Str("job", cfg.Name).Logger()
+		if cfg.Name == "" || seen[cfg.Name] {
+			log.Fatal().Msg("cron: job names must be unique and non-empty")
+		}
+		seen[cfg.Name] = true
+		sched, err := cron.Parse(cfg.Schedule)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cron: invalid schedule")
+		}
+		switch cfg.CatchUp {
+		case "", "skip", "once", "all":
+		default:
+			log.Fatal().Str("catch_up", cfg.CatchUp).Msg("cron: unknown catch-up policy")
+		}
+		target := srv.cronTargets[cfg.Service+"."+cfg.Endpoint]
+		if target == nil {
+			log.Fatal().Str("service", cfg.Service).Str("endpoint", cfg.Endpoint).
+				Msg("cron: unknown endpoint, or endpoint has path parameters")
+		}
+
+		j := &cronJob{
+			srv:     srv,
+			cfg:     cfg,
+			sched:   sched,
+			loc:     cfg.Location,
+			target:  target,
+			timeout: cfg.Timeout,
+		}
+		if j.loc == nil {
+			j.loc = time.UTC
+		}
+		if j.timeout <= 0 {
+			j.timeout = defaultCronTimeout
+		}
+		srv.cronJobs = append(srv.cronJobs, j)
+	}
+}
+
+// startCron starts running cron jobs.
+func (srv *Server) startCron() {
+	if len(srv.cronJobs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.stopCron = cancel
+	for _, j := range srv.cronJobs {
+		srv.logger.Info().Str("job", j.cfg.Name).Str("schedule", j.cfg.Schedule).Msg("scheduled cron job")
+		srv.cronWG.Add(1)
+		go j.schedule(ctx)
+	}
+}
+
+// stopCronJobs stops scheduling cron jobs and waits
+// for the runs in progress until ctx is done.
+func (srv *Server) stopCronJobs(ctx context.Context) {
+	if srv.stopCron == nil {
+		return
+	}
+	srv.stopCron()
+	done := make(chan struct{})
+	go func() {
+		srv.cronWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// schedule runs the job on its schedule until ctx is canceled.
+// Runs are made one at a time, so runs scheduled while a run is in
+// progress are missed and handled by the catch-up policy.
+func (j *cronJob) schedule(ctx context.Context) {
+	defer j.srv.cronWG.Done()
+	log := j.srv.logger.With().Str("job", j.cfg.Name).Logger()
+
+	last, err := j.srv.cronStore.LastRun(ctx, j.cfg.Name)
+	if err != nil {
+		log.Error().Err(err).Msg("cron: could not get last run")
+	}
+	if last.IsZero() || j.cfg.CatchUp == "" || j.cfg.CatchUp == "skip" {
+		last = time.Now()
+	}
+
+	for {
+		next := j.sched.Next(last.In(j.loc))
+		if next.IsZero() {
+			log.Warn().Msg("cron: job has no further runs")
+			return
+		}
+
+		if now := time.Now(); now.Sub(next) > time.Second {
+			switch j.cfg.CatchUp {
+			case "all":
+				// Run next now.
+			case "once":
+				for i := 0; i < maxCatchUp; i++ {
+					n := j.sched.Next(next)
+					if n.IsZero() || n.After(now) {
+						break
+					}
+					next = n
+				}
+			default:
+				log.Warn().Time("scheduled", next).Msg("cron: skipping missed runs")
+				last = now
+				continue
+			}
+		} else {
+			delay := next.Sub(now)
+			if jitter := j.cfg.Jitter; jitter > 0 {
+				delay += time.Duration(rand.Int63n(int64(jitter)))
+			}
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+		}
+
+		j.run(next)
+		last = next
+	}
+}
+
+// run makes the run of the job scheduled at the given time, unless
+// another instance has made it or is still making a previous run.
+func (j *cronJob) run(scheduled time.Time) {
+	store, name := j.srv.cronStore, j.cfg.Name
+	log := j.srv.logger.With().Str("job", name).Time("scheduled", scheduled).Logger()
+
+	// Store updates must not be canceled by the run timing out.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	runKey := name + ":run:" + strconv.FormatInt(scheduled.Unix(), 10)
+	if ok, err := store.Claim(ctx, runKey, j.timeout+j.cfg.Jitter+time.Minute); err != nil {
+		log.Error().Err(err).Msg("cron: could not claim run")
+		return
+	} else if !ok {
+		return // made by another instance
+	}
+	busyKey := name + ":running"
+	if ok, err := store.Claim(ctx, busyKey, j.timeout); err != nil {
+		log.Error().Err(err).Msg("cron: could not claim run")
+		return
+	} else if !ok {
+		metrics.CronJobRun(name, "skipped", 0)
+		log.Warn().Msg("cron: skipping run since the previous run is in progress")
+		return
+	}
+
+	start := time.Now()
+	err := j.call()
+	dur := time.Since(start)
+	if err != nil {
+		metrics.CronJobRun(name, "error", dur.Seconds())
+		log.Error().Err(err).Dur("duration", dur).Msg("cron: job failed")
+	} else {
+		metrics.CronJobRun(name, "ok", dur.Seconds())
+		log.Info().Dur("duration", dur).Msg("cron: job completed")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := store.Release(ctx, busyKey); err != nil {
+		log.Error().Err(err).Msg("cron: could not release run")
+	}
+	if err := store.SetLastRun(ctx, name, scheduled); err != nil {
+		log.Error().Err(err).Msg("cron: could not record run")
+	}
+}
+
+// call calls the job's endpoint through its middleware,
+// returning an error if it does not succeed.
+func (j *cronJob) call() error {
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+	t := j.target
+	req, err := http.NewRequestWithContext(ctx, t.method, t.path, bytes.NewReader(j.cfg.Payload))
+	if err != nil {
+		return err
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	if len(j.cfg.Payload) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range j.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	w := &grpcResponseWriter{header: make(http.Header)}
+	t.handler(w, req, nil)
+	if w.status/100 > 2 {
+		_, msg := parseErrorResponse(w.status, w.buf.Bytes())
+		return fmt.Errorf("endpoint responded with status %d: %s", w.status, msg)
+	}
+	return nil
+}
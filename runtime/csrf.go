@@ -0,0 +1,151 @@
+package runtime
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/middleware"
+)
+
+const (
+	defaultCSRFCookie = "encore_csrf"
+	defaultCSRFHeader = "X-CSRF-Token"
+
+	// csrfTokenSize is the number of random bytes in a token.
+	csrfTokenSize = 32
+)
+
+// csrf returns a middleware that rejects mutating requests that carry
+// cookies but not a token header matching the token cookie, or nil if
+// CSRF protection is disabled.
+//
+// Requests without cookies are not checked, since browsers attach
+// cookies to forged requests automatically but cannot be made to
+// send other credentials such as the Authorization header.
+func (srv *Server) csrf() middleware.Middleware {
+	cfg := srv.cfg.CSRF
+	if cfg == nil {
+		return nil
+	}
+	cookieName := srv.csrfCookieName()
+	headerName := cfg.HeaderName
+	if headerName == "" {
+		headerName = defaultCSRFHeader
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			r := req.HTTP
+			if !isMutating(r.Method) || r.Header.Get("Cookie") == "" || csrfExempt(cfg.Exempt, r.URL.Path) {
+				next(w, req)
+				return
+			}
+			cookie, err := r.Cookie(cookieName)
+			if err != nil || !srv.validCSRFToken(cookie.Value) {
+				writeErr(w, http.StatusForbidden, errs.PermissionDenied.String(), "missing or invalid csrf cookie")
+				return
+			}
+			token := r.Header.Get(headerName)
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+				writeErr(w, http.StatusForbidden, errs.PermissionDenied.String(), "missing or invalid csrf token")
+				return
+			}
+			next(w, req)
+		}
+	}
+}
+
+// serveCSRFToken responds with the client's CSRF token, issuing a new
+// one in the token cookie if the client has no valid token.
+func (srv *Server) serveCSRFToken(w http.ResponseWriter, req *http.Request) {
+	cfg := srv.cfg.CSRF
+	var token string
+	if c, err := req.Cookie(srv.csrfCookieName()); err == nil && srv.validCSRFToken(c.Value) {
+		token = c.Value
+	} else {
+		if token, err = srv.newCSRFToken(); err != nil {
+			writeErr(w, http.StatusInternalServerError, errs.Internal.String(), "could not generate csrf token")
+			return
+		}
+		sameSite := cfg.SameSite
+		if sameSite == 0 {
+			sameSite = http.SameSiteLaxMode
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     srv.csrfCookieName(),
+			Value:    token,
+			Path:     "/",
+			Domain:   cfg.CookieDomain,
+			Secure:   cfg.Secure,
+			HttpOnly: true,
+			SameSite: sameSite,
+		})
+	}
+
+	data, _ := json.Marshal(struct {
+		Token string `json:"token"`
+	}{token})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(append(data, '\n'))
+}
+
+func (srv *Server) csrfCookieName() string {
+	if name := srv.cfg.CSRF.CookieName; name != "" {
+		return name
+	}
+	return defaultCSRFCookie
+}
+
+// newCSRFToken returns a random token, signed if a key is configured.
+func (srv *Server) newCSRFToken() (string, error) {
+	b := make([]byte, csrfTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if key := srv.cfg.CSRF.Key; key != "" {
+		token += "." + csrfSignature(key, token)
+	}
+	return token, nil
+}
+
+// validCSRFToken reports whether token is well-formed,
+// with a valid signature if a key is configured.
+func (srv *Server) validCSRFToken(token string) bool {
+	key := srv.cfg.CSRF.Key
+	if key == "" {
+		return token != ""
+	}
+	i := strings.LastIndexByte(token, '.')
+	if i <= 0 {
+		return false
+	}
+	return hmac.Equal([]byte(token[i+1:]), []byte(csrfSignature(key, token[:i])))
+}
+
+func csrfSignature(key, token string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// csrfExempt reports whether path matches any of the exempt patterns.
+func csrfExempt(patterns []string, path string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, p[:len(p)-1]) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
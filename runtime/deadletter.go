@@ -0,0 +1,225 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/health"
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/pubsub"
+)
+
+const (
+	// deadLetterSub is the subscription of each dead-letter topic
+	// holding dead-lettered messages until they are re-driven.
+	deadLetterSub = "__encore_dead_letters"
+
+	defaultDeadLetterPollInterval = 30 * time.Second
+
+	// redriveLease is how long messages considered for
+	// re-driving are leased from the dead-letter topic.
+	redriveLease = time.Minute
+)
+
+// Attributes of dead-lettered messages describing their failure.
+const (
+	dlqTopicAttr    = "encore-dlq-topic"
+	dlqSubAttr      = "encore-dlq-subscription"
+	dlqErrorAttr    = "encore-dlq-error"
+	dlqAttemptsAttr = "encore-dlq-attempts"
+	dlqTimeAttr     = "encore-dlq-time"
+	dlqOrderingAttr = "encore-dlq-ordering-key"
+)
+
+// deadLetterTopics returns the dead-letter topics
+// of the configured subscriptions.
+func (srv *Server) deadLetterTopics() []string {
+	var topics []string
+	seen := make(map[string]bool)
+	for _, cfg := range srv.cfg.PubSub.Subscriptions {
+		if t := cfg.DeadLetterTopic; t != "" && !seen[t] {
+			seen[t] = true
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// setupDeadLetters creates the subscriptions holding the
+// messages of dead-letter topics as startup tasks.
+func (srv *Server) setupDeadLetters() {
+	for _, topic := range srv.deadLetterTopics() {
+		topic := topic
+		health.RegisterStartup("pubsub:"+topic+"/"+deadLetterSub, func(ctx context.Context) error {
+			return broker.Subscribe(ctx, topic, deadLetterSub)
+		})
+	}
+}
+
+// monitorDeadLetters periodically measures the number of
+// messages held in dead-letter topics until ctx is canceled.
+func (srv *Server) monitorDeadLetters(ctx context.Context) {
+	topics := srv.deadLetterTopics()
+	if len(topics) == 0 {
+		return
+	}
+	interval := srv.cfg.PubSub.DeadLetterPollInterval
+	if interval <= 0 {
+		interval = defaultDeadLetterPollInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for _, topic := range topics {
+			n, err := broker.Depth(ctx, topic, deadLetterSub)
+			if ctx.Err() != nil {
+				return
+			} else if err != nil {
+				srv.logger.Error().Err(err).Str("topic", topic).Msg("pubsub: could not measure dead letters")
+				continue
+			}
+			metrics.PubSubDeadLetters(topic, n)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deadLetter publishes msg, which failed with err, to the
+// subscription's dead-letter topic along with its failure.
+func (s *subscription) deadLetter(ctx context.Context, msg *pubsub.Message, err error) error {
+	attrs := make(map[string]string, len(msg.Attributes)+6)
+	for k, v := range msg.Attributes {
+		attrs[k] = v
+	}
+	attrs[dlqTopicAttr] = s.cfg.Topic
+	attrs[dlqSubAttr] = s.cfg.Name
+	attrs[dlqErrorAttr] = err.Error()
+	attrs[dlqAttemptsAttr] = strconv.Itoa(msg.Attempt)
+	attrs[dlqTimeAttr] = time.Now().UTC().Format(time.RFC3339)
+	if msg.OrderingKey != "" {
+		attrs[dlqOrderingAttr] = msg.OrderingKey
+	}
+
+	// Dead letters are not ordered, so one message does not hold
+	// up re-driving the others; the key is restored when re-driven.
+	dl := *msg
+	dl.Attributes = attrs
+	dl.OrderingKey = ""
+	return broker.Publish(ctx, s.cfg.DeadLetterTopic, &dl)
+}
+
+type redriveResponse struct {
+	Redriven int `json:"redriven"`
+}
+
+// redriveDeadLetters redelivers the dead-lettered messages of the
+// subscription given by the "topic" and "subscription" query
+// parameters to it, up to the number given by the "max" query
+// parameter.
+func (srv *Server) redriveDeadLetters(w http.ResponseWriter, req *http.Request) {
+	if srv.cfg.PubSub.Token == "" {
+		http.Error(w, "unknown internal endpoint: __encore.RedriveDeadLetters", http.StatusNotFound)
+		return
+	}
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeErr(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if !checkToken(w, req, srv.cfg.PubSub.Token) {
+		return
+	}
+
+	q := req.URL.Query()
+	topic, name := q.Get("topic"), q.Get("subscription")
+	var s *subscription
+	for _, sub := range srv.subs {
+		if sub.cfg.Topic == topic && sub.cfg.Name == name {
+			s = sub
+			break
+		}
+	}
+	if s == nil {
+		writeErr(w, http.StatusNotFound, errs.NotFound.String(), "unknown subscription")
+		return
+	} else if s.cfg.DeadLetterTopic == "" {
+		writeErr(w, http.StatusBadRequest, errs.FailedPrecondition.String(), "subscription has no dead-letter topic")
+		return
+	}
+	max := -1
+	if v := q.Get("max"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeErr(w, http.StatusBadRequest, errs.InvalidArgument.String(), "invalid max")
+			return
+		}
+		max = n
+	}
+
+	n, err := s.redrive(req.Context(), max)
+	if err != nil {
+		srv.logger.Error().Err(err).Str("topic", topic).Str("subscription", name).Int("redriven", n).
+			Msg("pubsub: could not re-drive dead letters")
+		writeErr(w, http.StatusServiceUnavailable, errs.Unavailable.String(), "could not re-drive dead letters")
+		return
+	}
+	srv.logger.Info().Str("topic", topic).Str("subscription", name).Int("redriven", n).Msg("pubsub: re-drove dead letters")
+	data, _ := json.Marshal(redriveResponse{Redriven: n})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// redrive redelivers up to max of the subscription's dead-lettered
+// messages to it, or all of them if max is negative. Messages of
+// other subscriptions sharing the dead-letter topic are leased while
+// looking for the subscription's, and released once done.
+func (s *subscription) redrive(ctx context.Context, max int) (n int, err error) {
+	dlq := s.cfg.DeadLetterTopic
+	var skipped []string
+	defer func() {
+		for _, id := range skipped {
+			if nerr := broker.Nack(ctx, dlq, deadLetterSub, id, 0); nerr != nil && err == nil {
+				err = nerr
+			}
+		}
+	}()
+
+	for max < 0 || n < max {
+		msg, err := broker.TryReceive(ctx, dlq, deadLetterSub, redriveLease)
+		if err != nil {
+			return n, err
+		} else if msg == nil {
+			break
+		}
+		if msg.Attributes[dlqTopicAttr] != s.cfg.Topic || msg.Attributes[dlqSubAttr] != s.cfg.Name {
+			skipped = append(skipped, msg.ID)
+			continue
+		}
+
+		m := *msg
+		m.OrderingKey = msg.Attributes[dlqOrderingAttr]
+		m.Attributes = make(map[string]string, len(msg.Attributes))
+		for k, v := range msg.Attributes {
+			if !strings.HasPrefix(k, "encore-dlq-") {
+				m.Attributes[k] = v
+			}
+		}
+		if err := broker.PublishTo(ctx, s.cfg.Topic, s.cfg.Name, &m); err != nil {
+			skipped = append(skipped, msg.ID)
+			return n, err
+		}
+		if err := broker.Ack(ctx, dlq, deadLetterSub, msg.ID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,151 @@
+package runtime
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+const (
+	defaultDecompressMaxSize  = 32 << 20
+	defaultDecompressMaxRatio = 100
+
+	// decompressRatioMinSize is the decompressed size
+	// from which the compression ratio is enforced.
+	decompressRatioMinSize = 64 << 10
+)
+
+var (
+	errDecompressedTooLarge = errs.B().Code(errs.ResourceExhausted).Msg("decompressed request body too large").Err()
+	errCompressionRatio     = errs.B().Code(errs.ResourceExhausted).Msg("request body compression ratio too high").Err()
+)
+
+// decompressRequests returns a middleware that decompresses request
+// bodies according to their Content-Encoding, or nil if it is disabled
+// or the endpoint is raw. Bodies fail to read once they exceed the
+// maximum decompressed size or compression ratio, and requests with
+// unsupported encodings are rejected with 415 Unsupported Media Type.
+//
+// It runs inside the body size limit, which thereby limits
+// the compressed size.
+func (srv *Server) decompressRequests(endpoint *config.Endpoint) middleware.Middleware {
+	cfg := srv.cfg.RequestDecompression
+	if cfg == nil || endpoint.Raw {
+		return nil
+	}
+	maxSize := cfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultDecompressMaxSize
+	}
+	maxRatio := int64(cfg.MaxRatio)
+	if maxRatio <= 0 {
+		maxRatio = defaultDecompressMaxRatio
+	}
+	decoders := append([]config.Decoder(nil), cfg.Decoders...)
+	decoders = append(decoders,
+		config.Decoder{Name: "gzip", New: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }},
+		config.Decoder{Name: "deflate", New: func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil }},
+	)
+	var names []string
+	for _, d := range decoders {
+		names = append(names, d.Name)
+	}
+	accept := strings.Join(names, ", ")
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			r := req.HTTP
+			enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if enc == "" || enc == "identity" {
+				next(w, req)
+				return
+			}
+			var dec *config.Decoder
+			for i := range decoders {
+				if decoders[i].Name == enc {
+					dec = &decoders[i]
+					break
+				}
+			}
+			if dec == nil {
+				w.Header().Set("Accept-Encoding", accept)
+				writeErr(w, http.StatusUnsupportedMediaType, errs.InvalidArgument.String(), "unsupported content encoding")
+				return
+			}
+
+			compressed := &countingReader{r: r.Body}
+			dr, err := dec.New(compressed)
+			if err != nil {
+				writeErr(w, http.StatusBadRequest, errs.InvalidArgument.String(), "invalid compressed request body")
+				return
+			}
+			r.Body = &decompressedBody{
+				r:          dr,
+				orig:       r.Body,
+				compressed: compressed,
+				maxSize:    maxSize,
+				maxRatio:   maxRatio,
+			}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			next(w, req)
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decompressedBody is a decompressed request body
+// that enforces a maximum size and compression ratio.
+type decompressedBody struct {
+	r          io.ReadCloser
+	orig       io.Closer
+	compressed *countingReader
+	maxSize    int64
+	maxRatio   int64
+
+	n   int64
+	err error
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	// Read at most one byte past the limit, to detect exceeding it.
+	if rem := b.maxSize - b.n + 1; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	switch {
+	case b.n > b.maxSize:
+		b.err = errDecompressedTooLarge
+		return 0, b.err
+	case b.n > decompressRatioMinSize && b.n > b.maxRatio*b.compressed.n:
+		b.err = errCompressionRatio
+		return 0, b.err
+	}
+	return n, err
+}
+
+func (b *decompressedBody) Close() error {
+	b.r.Close()
+	return b.orig.Close()
+}
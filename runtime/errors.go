@@ -0,0 +1,34 @@
+package runtime
+
+import (
+	"net/http"
+
+	"runtime.encore.dev/runtime/config"
+)
+
+// writeErr writes a structured error response with the given status.
+// It uses the same format as errs.HTTPError but allows for status codes
+// and error codes that are specific to the runtime, like "unknown_endpoint".
+func writeErr(w http.ResponseWriter, status int, code, msg string) {
+	data, _ := json.MarshalIndent(struct {
+		Code    string      `json:"code"`
+		Message string      `json:"message"`
+		Details interface{} `json:"details"`
+	}{code, msg, nil}, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+// debugErrors reports whether to include debug
+// information in error responses.
+func debugErrors(cfg *config.ServerConfig) bool {
+	switch {
+	case cfg.EnvType == "production":
+		return false
+	case cfg.DebugErrors != nil:
+		return *cfg.DebugErrors
+	default:
+		return cfg.EnvType == "local" || cfg.EnvType == "development"
+	}
+}
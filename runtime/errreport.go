@@ -0,0 +1,134 @@
+package runtime
+
+import (
+	"fmt"
+	"net/http"
+	goruntime "runtime"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/errreport"
+	"runtime.encore.dev/internal/redact"
+	"runtime.encore.dev/middleware"
+)
+
+// reporter reports errors to an error tracking service,
+// or is nil if error reporting is disabled.
+var reporter *errreport.Reporter
+
+// newErrorReporter creates the error reporter,
+// or returns nil if error reporting is disabled.
+func (srv *Server) newErrorReporter() *errreport.Reporter {
+	cfg := srv.cfg.ErrorReporting
+	if cfg == nil {
+		return nil
+	}
+
+	var sender errreport.Sender
+	if cfg.WebhookURL != "" {
+		sender = &errreport.Webhook{URL: cfg.WebhookURL, Headers: cfg.WebhookHeaders}
+	} else {
+		s, err := errreport.NewSentry(cfg.SentryDSN)
+		if err != nil {
+			srv.logger.Fatal().Err(err).Msg("error reporting: invalid config")
+		}
+		s.Environment = srv.cfg.EnvType
+		sender = s
+	}
+
+	scrub := &redact.Rules{Fields: redact.NewFields(cfg.ScrubFields...)}
+	if lr := srv.cfg.LogRedaction; lr != nil {
+		rules, err := newRedactRules(lr)
+		if err != nil {
+			srv.logger.Fatal().Err(err).Msg("invalid log redaction")
+		}
+		rules.Fields = rules.Fields.With(cfg.ScrubFields...)
+		scrub = rules
+	}
+	scrub.Fields = scrub.Fields.With("cookie", "set-cookie")
+	scrub.CardNumbers = true
+
+	return errreport.New(errreport.Config{
+		Sender: sender,
+		Rate:   cfg.Rate,
+		Burst:  cfg.Burst,
+		Scrub:  scrub,
+		OnError: func(err error) {
+			srv.logger.Error().Err(err).Msg("could not report error")
+		},
+	})
+}
+
+// reportError reports err, returned by the handler of req,
+// if it is a server error.
+func reportError(req *Request, err error, httpStatus int) {
+	if reporter == nil || req.Type != RPCCall {
+		return
+	}
+	e := errs.Convert(err).(*errs.Error)
+	if httpStatus == 0 {
+		httpStatus = e.Code.HTTPStatus()
+	}
+	if httpStatus < 500 {
+		return
+	}
+
+	ev := &errreport.Event{
+		Message:   RedactSecrets(e.ErrorMessage()),
+		Code:      e.Code.String(),
+		Stack:     errreport.Frames(errs.Stack(err).Frames),
+		Service:   req.Service,
+		Endpoint:  req.Endpoint,
+		RequestID: req.RequestID,
+		UserID:    string(req.UID),
+	}
+	if sc := req.span.SpanContext(); sc.IsValid() {
+		ev.TraceID = sc.TraceID.String()
+	}
+	if len(e.Meta) > 0 {
+		ev.Meta = make(map[string]string, len(e.Meta))
+		for k, v := range e.Meta {
+			ev.Meta[k] = fmt.Sprint(v)
+		}
+	}
+	reporter.Report(ev)
+}
+
+// reportPanic reports a panic in the handler of req.
+// It must be called from the deferred function recovering the panic.
+func reportPanic(req *middleware.Request, e interface{}) {
+	if reporter == nil {
+		return
+	}
+	pcs := make([]uintptr, 64)
+	// Skip runtime.Callers, reportPanic, the deferred function and runtime.gopanic.
+	pcs = pcs[:goruntime.Callers(4, pcs)]
+
+	r := req.HTTP
+	ev := &errreport.Event{
+		Panic:     true,
+		Message:   fmt.Sprint(e),
+		Stack:     errreport.Frames(pcs),
+		Service:   req.Service,
+		Endpoint:  req.Endpoint,
+		RequestID: RequestID(r.Context()),
+		Method:    r.Method,
+		URL:       requestURL(r),
+		Headers:   make(map[string]string, len(r.Header)),
+	}
+	if sc := spanFromContext(r.Context()).SpanContext(); sc.IsValid() {
+		ev.TraceID = sc.TraceID.String()
+	}
+	for k := range r.Header {
+		ev.Headers[k] = r.Header.Get(k)
+	}
+	reporter.Report(ev)
+}
+
+// requestURL returns the absolute URL of the request.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
@@ -0,0 +1,211 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// defaultETagMaxSize is the default maximum response size to compute ETags for.
+const defaultETagMaxSize = 1 << 20
+
+// conditional returns a middleware that answers conditional GET and
+// HEAD requests with 304 Not Modified, computing ETags for responses
+// that have none, or nil if it is disabled for the endpoint.
+//
+// It runs inside the compression middleware, so ETags are computed
+// from uncompressed bodies. They are weak, since the same ETag is
+// then used for every content encoding.
+func (srv *Server) conditional(endpoint *config.Endpoint) middleware.Middleware {
+	cfg := srv.cfg.ETags
+	if !cfg.Enabled || endpoint.Raw {
+		return nil
+	}
+	maxSize := cfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultETagMaxSize
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			if m := req.HTTP.Method; m != "GET" && m != "HEAD" {
+				next(w, req)
+				return
+			}
+			ew := &etagWriter{ResponseWriter: w, req: req.HTTP, maxSize: maxSize}
+			next(ew, req)
+			ew.finish()
+		}
+	}
+}
+
+// etagWriter buffers a successful response to compute its ETag,
+// and responds with 304 Not Modified if the request's
+// preconditions match the response.
+type etagWriter struct {
+	middleware.ResponseWriter
+	req     *http.Request
+	maxSize int
+
+	status      int
+	written     int64
+	buf         []byte
+	buffering   bool // whether the response is being buffered
+	passthrough bool // whether writes go to the underlying writer
+	discard     bool // whether the body is discarded due to a 304
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+	w.start()
+}
+
+// start decides how to handle the response once its status is known.
+func (w *etagWriter) start() {
+	h := w.Header()
+	switch {
+	case w.status != http.StatusOK:
+		w.pass()
+	case h.Get("ETag") != "" || h.Get("Last-Modified") != "":
+		// The handler supplied the validators.
+		if notModified(w.req, h) {
+			w.notModified()
+		} else {
+			w.pass()
+		}
+	default:
+		w.buffering = true
+	}
+}
+
+func (w *etagWriter) pass() {
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *etagWriter) notModified() {
+	w.discard = true
+	h := w.Header()
+	for _, k := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+		h.Del(k)
+	}
+	w.ResponseWriter.WriteHeader(http.StatusNotModified)
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.written += int64(len(b))
+	switch {
+	case w.discard:
+		return len(b), nil
+	case w.passthrough:
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) > w.maxSize {
+		// Too large to buffer; send it without an ETag.
+		if err := w.flushBuffer(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// flushBuffer stops buffering, writing the buffered data.
+func (w *etagWriter) flushBuffer() error {
+	w.buffering = false
+	w.pass()
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends any buffered data, without an ETag, to the client.
+func (w *etagWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buffering {
+		w.flushBuffer()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish computes the ETag of a buffered response and writes it,
+// or responds with 304 Not Modified if the client has it.
+func (w *etagWriter) finish() {
+	if w.status == 0 {
+		// Nothing was written; net/http responds with 200 OK.
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		return
+	}
+	w.buffering = false
+
+	h := w.Header()
+	sum := sha256.Sum256(w.buf)
+	h.Set("ETag", `W/"`+base64.RawURLEncoding.EncodeToString(sum[:16])+`"`)
+	if notModified(w.req, h) {
+		w.notModified()
+		return
+	}
+	if h.Get("Content-Length") == "" {
+		h.Set("Content-Length", strconv.Itoa(len(w.buf)))
+	}
+	w.flushBuffer()
+}
+
+func (w *etagWriter) Status() int    { return w.status }
+func (w *etagWriter) Written() int64 { return w.written }
+
+// notModified reports whether the preconditions of req match the
+// response validators in h, so the client's copy is up to date.
+// If-Modified-Since is only considered without If-None-Match,
+// as specified by RFC 7232.
+func notModified(req *http.Request, h http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := h.Get("ETag")
+		return etag != "" && etagMatch(inm, etag)
+	}
+	ims, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lm.Truncate(time.Second).After(ims)
+}
+
+// etagMatch reports whether an If-None-Match header matches
+// etag, using the weak comparison function.
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"runtime.encore.dev/runtime/config"
+)
+
+// grpcMethod is an endpoint exposed as a gRPC method.
+type grpcMethod struct {
+	httpMethod string
+	path       string
+	handler    httprouter.Handle
+}
+
+// newGRPCServer creates the gRPC server, or returns nil if gRPC is disabled.
+func (srv *Server) newGRPCServer() *grpc.Server {
+	cfg := srv.cfg.GRPC
+	if cfg == nil {
+		return nil
+	}
+	opts := []grpc.ServerOption{
+		grpc.CustomCodec(rawServerCodec{}),
+		grpc.UnknownServiceHandler(srv.handleGRPC),
+	}
+	if cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	return grpc.NewServer(opts...)
+}
+
+// registerGRPC exposes the endpoint as the gRPC method /<service>/<endpoint>,
+// handled by h, for gRPC, gRPC-Web and Connect clients. Raw endpoints and endpoints with path parameters
+// are not exposed, since gRPC requests carry neither.
+func (srv *Server) registerGRPC(svc *config.Service, endpoint *config.Endpoint, h httprouter.Handle) {
+	if srv.grpcMethods == nil || endpoint.Raw || strings.ContainsAny(endpoint.Path, ":*") {
+		return
+	}
+	method := "POST"
+	if len(endpoint.Methods) > 0 && !containsMethod(endpoint.Methods, "POST") && endpoint.Methods[0] != "*" {
+		method = endpoint.Methods[0]
+	}
+	srv.grpcMethods["/"+svc.Name+"/"+endpoint.Name] = &grpcMethod{
+		httpMethod: method,
+		path:       endpointPath(endpoint),
+		handler:    h,
+	}
+}
+
+// serveGRPC serves gRPC on a separate listener, if configured.
+// Otherwise gRPC requests are served by the HTTP server,
+// which requires HTTP/2.
+func (srv *Server) serveGRPC() error {
+	if srv.grpcsrv == nil || srv.cfg.GRPC.Addr == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", srv.cfg.GRPC.Addr)
+	if err != nil {
+		return fmt.Errorf("grpc listener: %v", err)
+	}
+	if tc := srv.httpsrv.TLSConfig; tc != nil {
+		ln = tls.NewListener(ln, tc)
+	}
+	srv.logger.Info().Str("addr", ln.Addr().String()).Msg("serving grpc")
+	go func() {
+		if err := srv.grpcsrv.Serve(ln); err != nil && err != grpc.ErrServerStopped {
+			srv.logger.Error().Err(err).Msg("grpc listener failed")
+		}
+	}()
+	return nil
+}
+
+// isGRPC reports whether req is a gRPC request.
+func isGRPC(req *http.Request) bool {
+	return req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+// stopGRPC gracefully stops the gRPC server,
+// stopping it forcefully when ctx is canceled.
+func (srv *Server) stopGRPC(ctx context.Context) {
+	if srv.grpcsrv == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		srv.grpcsrv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		srv.grpcsrv.Stop()
+	}
+}
+
+// handleGRPC handles a unary gRPC call by calling the endpoint's HTTP
+// handler with the protobuf-encoded request, so that calls go through
+// the same middleware (auth, metrics, tracing and so on) as HTTP requests.
+func (srv *Server) handleGRPC(_ interface{}, stream grpc.ServerStream) error {
+	name, _ := grpc.MethodFromServerStream(stream)
+	m := srv.grpcMethods[name]
+	if m == nil {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", name)
+	}
+
+	var in []byte
+	if err := stream.RecvMsg(&in); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	req, err := http.NewRequestWithContext(ctx, m.httpMethod, m.path, nil)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, vs := range md {
+			if k == ":authority" && len(vs) > 0 {
+				req.Host = vs[0]
+			} else if !strings.HasPrefix(k, ":") && !strings.HasPrefix(k, "grpc-") {
+				req.Header[http.CanonicalHeaderKey(k)] = vs
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+	}
+
+	w := m.call(req, contentTypeProto, in)
+	if w.status/100 != 2 {
+		return grpcError(w.status, w.buf.Bytes())
+	}
+	out := w.buf.Bytes()
+	return stream.SendMsg(&out)
+}
+
+// call calls the endpoint's handler with req, whose body is replaced
+// by the payload in of the given content type, and records the response.
+// The response payload has the same content type.
+func (m *grpcMethod) call(req *http.Request, contentType string, in []byte) *grpcResponseWriter {
+	req.Method = m.httpMethod
+	req.URL.Path, req.URL.RawPath = m.path, ""
+	req.Body = ioutil.NopCloser(bytes.NewReader(in))
+	req.ContentLength = int64(len(in))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+	req.Header.Del("Accept-Encoding") // the protocols handle compression themselves
+
+	w := &grpcResponseWriter{header: make(http.Header)}
+	m.handler(w, req, nil)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w
+}
+
+// grpcError converts an error response to a gRPC status error.
+func grpcError(httpStatus int, body []byte) error {
+	code, msg := parseErrorResponse(httpStatus, body)
+	// Encore's error codes are the gRPC status codes.
+	return status.Error(codes.Code(code), msg)
+}
+
+// grpcResponseWriter records the response of an endpoint handler.
+type grpcResponseWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *grpcResponseWriter) Header() http.Header { return w.header }
+
+func (w *grpcResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *grpcResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+// rawServerCodec passes messages through as bytes, leaving
+// them to be decoded and encoded by the endpoint handlers.
+type rawServerCodec struct{}
+
+func (rawServerCodec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+func (rawServerCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawServerCodec) String() string { return "proto" }
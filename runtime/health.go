@@ -0,0 +1,66 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"runtime.encore.dev/internal/health"
+)
+
+// healthCheckTimeout is the timeout for running health checks.
+const healthCheckTimeout = 5 * time.Second
+
+type healthResponse struct {
+	Status string          `json:"status"` // "ok" or "failing"
+	Checks []health.Result `json:"checks"`
+}
+
+// serveHealth runs the health checks of the given kind and responds
+// with their results. Readiness fails until dependencies have
+// initialized and while the server is draining.
+func (srv *Server) serveHealth(w http.ResponseWriter, req *http.Request, kind health.Kind) {
+	ctx, cancel := context.WithTimeout(req.Context(), healthCheckTimeout)
+	defer cancel()
+
+	resp := healthResponse{Status: "ok", Checks: health.Run(ctx, kind)}
+	if kind == health.Readiness {
+		if !srv.isStarted() {
+			msg := "initializing"
+			if p := health.Pending(); len(p) > 0 {
+				msg += " " + strings.Join(p, ", ")
+			}
+			resp.Checks = append(resp.Checks, health.Result{Name: "startup", Error: msg})
+		}
+		if srv.isDraining() {
+			resp.Checks = append(resp.Checks, health.Result{Name: "shutdown", Error: "server is shutting down"})
+		}
+	}
+	status := http.StatusOK
+	for _, c := range resp.Checks {
+		if !c.OK {
+			resp.Status = "failing"
+			status = http.StatusServiceUnavailable
+			break
+		}
+	}
+	if resp.Checks == nil {
+		resp.Checks = []health.Result{}
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "could not marshal health: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+func (srv *Server) isDraining() bool {
+	return atomic.LoadInt32(&srv.draining) != 0
+}
@@ -0,0 +1,100 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	hooksMu   sync.Mutex
+	warmUps   []warmUp
+	shutdowns []func(ctx context.Context)
+)
+
+type warmUp struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// OnWarmUp registers a function to run before the server starts
+// accepting requests, such as for priming caches or establishing
+// connections. Warm-up functions run in the order they were
+// registered, and the server fails to start if any returns an error.
+// It must be called before ListenAndServe, typically during
+// package initialization.
+func OnWarmUp(name string, fn func(ctx context.Context) error) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	warmUps = append(warmUps, warmUp{name: name, fn: fn})
+}
+
+// warmUp runs the registered warm-up functions.
+func (srv *Server) warmUp() error {
+	hooksMu.Lock()
+	fns := append([]warmUp(nil), warmUps...)
+	hooksMu.Unlock()
+	if len(fns) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	if d := srv.cfg.Startup.WarmUpTimeout; d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	for _, w := range fns {
+		start := time.Now()
+		if err := w.fn(ctx); err != nil {
+			return fmt.Errorf("warm-up %s: %v", w.name, err)
+		}
+		srv.logger.Info().Str("name", w.name).Dur("duration", time.Since(start)).Msg("warm-up completed")
+	}
+	return nil
+}
+
+// OnShutdown registers a function to run during graceful shutdown,
+// after in-flight requests have completed, such as for flushing
+// buffers and closing clients. Shutdown functions run concurrently
+// and should return when ctx is canceled, as the shutdown deadline
+// has then passed.
+func OnShutdown(fn func(ctx context.Context)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	shutdowns = append(shutdowns, fn)
+}
+
+// runShutdownHooks runs the registered shutdown functions,
+// waiting for them to return until ctx is canceled.
+func (srv *Server) runShutdownHooks(ctx context.Context) {
+	hooksMu.Lock()
+	fns := append(([]func(context.Context))(nil), shutdowns...)
+	hooksMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, fn := range fns {
+		wg.Add(1)
+		go func(fn func(context.Context)) {
+			defer wg.Done()
+			defer func() {
+				if e := recover(); e != nil {
+					srv.logger.Error().Interface("panic", e).Msg("shutdown hook panicked")
+				}
+			}()
+			fn(ctx)
+		}(fn)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		srv.logger.Error().Msg("shutdown hooks did not complete in time")
+	}
+}
@@ -105,8 +105,19 @@ func (rt *httpRoundTrip) encodeEvents(tb *TraceBuf) {
 
 func httpBeginRoundTrip(req *http.Request) (context.Context, error) {
 	g := encoreGetG()
+	if g != nil && g.req != nil && g.req.data.RequestID != "" && req.Header.Get(requestIDHeader) == "" {
+		// Propagate the request id to the service being called.
+		if req.Header == nil {
+			req.Header = make(http.Header)
+		}
+		req.Header.Set(requestIDHeader, g.req.data.RequestID)
+	}
+	ctx := req.Context()
+	if span := startHTTPSpan(req); span != nil {
+		ctx = context.WithValue(ctx, httpSpanKey, span)
+	}
 	if g == nil || g.req == nil || !g.req.data.Traced {
-		return req.Context(), nil
+		return ctx, nil
 	} else if req.URL == nil {
 		return nil, fmt.Errorf("http: nil Request.URL")
 	}
@@ -132,7 +143,7 @@ func httpBeginRoundTrip(req *http.Request) (context.Context, error) {
 		ReqID:  reqID,
 		SpanID: spanID,
 	}
-	ctx := context.WithValue(req.Context(), rtKey, rt)
+	ctx = context.WithValue(ctx, rtKey, rt)
 	tr := &httptrace.ClientTrace{
 		GetConn:              rt.getConn,
 		GotConn:              rt.gotConn,
@@ -152,6 +163,7 @@ func httpBeginRoundTrip(req *http.Request) (context.Context, error) {
 }
 
 func httpCompleteRoundTrip(req *http.Request, resp *http.Response, err error) {
+	endHTTPSpan(req, resp, err)
 	rt, ok := req.Context().Value(rtKey).(*httpRoundTrip)
 	if !ok {
 		return
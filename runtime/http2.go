@@ -0,0 +1,19 @@
+package runtime
+
+import (
+	"golang.org/x/net/http2"
+
+	"runtime.encore.dev/internal/h2"
+)
+
+// configureHTTP2 enables HTTP/2 on the server, for TLS connections
+// as well as cleartext connections if h2c is enabled.
+// It must be called after the TLS config has been set.
+func (srv *Server) configureHTTP2() error {
+	cfg := srv.cfg.HTTP2
+	h2s := &http2.Server{
+		MaxConcurrentStreams: cfg.MaxConcurrentStreams,
+		MaxReadFrameSize:     cfg.MaxReadFrameSize,
+	}
+	return h2.Configure(srv.httpsrv, h2s, srv.cfg.TLS != nil, cfg.H2C)
+}
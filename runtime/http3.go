@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// altSvcMaxAge is the max age, in seconds, of the Alt-Svc advertisement.
+const altSvcMaxAge = 24 * 60 * 60
+
+// listenHTTP3 starts the HTTP/3 server plugged in through the
+// config.HTTP3 hook, if any. The runtime does not implement HTTP/3.
+// It returns a handler that advertises HTTP/3 support through the
+// Alt-Svc header on responses served over TCP, for as long as the
+// HTTP/3 server is serving.
+func (srv *Server) listenHTTP3(h http.Handler) (http.Handler, error) {
+	cfg := srv.cfg.HTTP3
+	if cfg == nil {
+		return h, nil
+	} else if cfg.NewServer == nil {
+		srv.logger.Warn().Msg("http3: no server implementation configured, not advertising http3")
+		return h, nil
+	} else if srv.httpsrv.TLSConfig == nil {
+		return nil, fmt.Errorf("http3: tls must be configured")
+	}
+
+	addr := cfg.Addr
+	if addr == "" {
+		network, tcpAddr := srv.listenAddr()
+		if network != "tcp" {
+			return nil, fmt.Errorf("http3: no listen address configured")
+		}
+		addr = tcpAddr
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("http3: listen on %s: %v", addr, err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	srv.h3srv = cfg.NewServer(srv.httpsrv.TLSConfig.Clone(), h)
+	srv.logger.Info().Str("addr", conn.LocalAddr().String()).Msg("listening for incoming http3 requests")
+	serving := int32(1)
+	go func() {
+		err := srv.h3srv.Serve(conn)
+		atomic.StoreInt32(&serving, 0)
+		if err != nil {
+			srv.logger.Error().Err(err).Msg("http3 server failed")
+		}
+	}()
+
+	altSvc := `h3=":` + strconv.Itoa(port) + `"; ma=` + strconv.Itoa(altSvcMaxAge)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor < 3 && atomic.LoadInt32(&serving) == 1 {
+			w.Header().Set("Alt-Svc", altSvc)
+		}
+		h.ServeHTTP(w, req)
+	}), nil
+}
@@ -0,0 +1,243 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/idempotency"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+const (
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyMaxSize = 1 << 20
+
+	// maxIdempotencyKeyLen is the maximum length of an idempotency key.
+	maxIdempotencyKeyLen = 255
+)
+
+// newIdempotencyStore creates the store for idempotency keys,
+// or returns nil if idempotency keys are not honored.
+func (srv *Server) newIdempotencyStore() idempotency.Store {
+	cfg := srv.cfg.Idempotency
+	if cfg == nil {
+		return nil
+	}
+	switch cfg.Store {
+	case "redis":
+		if srv.redis == nil {
+			srv.logger.Fatal().Msg("idempotency: redis store configured but no redis server")
+		}
+		return idempotency.NewRedisStore(srv.redis, "encore:idempotency:")
+	case "", "memory":
+		return idempotency.NewMemoryStore()
+	default:
+		srv.logger.Fatal().Str("store", cfg.Store).Msg("idempotency: unknown store")
+		return nil
+	}
+}
+
+// idempotency returns a middleware that honors the Idempotency-Key
+// header of mutating requests, or nil if it is disabled.
+//
+// The first response for a key is recorded, keyed by the endpoint,
+// the key and the caller's identity, and replayed to retries with
+// the Idempotent-Replayed header set. Retries while the first request
+// is in progress are rejected with 409 Conflict, and reusing a key
+// for a different request with 422 Unprocessable Entity.
+// Server errors are not recorded, so the request can be retried.
+//
+// It runs after authentication, so the caller's identity is known.
+func (srv *Server) idempotency(endpoint *config.Endpoint) middleware.Middleware {
+	store := srv.idemStore
+	if store == nil || endpoint.Raw {
+		return nil
+	}
+	ttl := srv.cfg.Idempotency.TTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	maxSize := srv.cfg.Idempotency.MaxResponseSize
+	if maxSize <= 0 {
+		maxSize = defaultIdempotencyMaxSize
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			key := req.HTTP.Header.Get("Idempotency-Key")
+			if key == "" || !isMutating(req.HTTP.Method) {
+				next(w, req)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				writeErr(w, http.StatusBadRequest, errs.InvalidArgument.String(), "idempotency key too long")
+				return
+			}
+
+			// Fingerprint the request to detect keys reused for other requests.
+			body, err := ioutil.ReadAll(req.HTTP.Body)
+			if err != nil {
+				writeErr(w, http.StatusBadRequest, errs.InvalidArgument.String(), "could not read request body")
+				return
+			}
+			req.HTTP.Body = ioutil.NopCloser(bytes.NewReader(body))
+			fingerprint := hashHex(req.HTTP.Method, req.HTTP.URL.RequestURI(), string(body))
+
+			identity := "ip:" + srv.clientIP(req.HTTP).String()
+			if auth := GetCallOptions(req.HTTP.Context()).Auth; auth != nil && auth.UID != "" {
+				identity = "uid:" + string(auth.UID)
+			}
+			storeKey := hashHex(req.Service+"."+req.Endpoint, identity, key)
+
+			resp, respFingerprint, err := store.Begin(req.HTTP.Context(), storeKey, fingerprint, ttl)
+			switch {
+			case err == idempotency.ErrInProgress:
+				writeErr(w, http.StatusConflict, errs.Aborted.String(), "a request with this idempotency key is in progress")
+				return
+			case err != nil:
+				// Fail open, so a store outage does not fail requests.
+				LoggerFromContext(req.HTTP.Context()).Error().Err(err).Msg("idempotency: could not check key")
+				next(w, req)
+				return
+			case resp != nil:
+				if respFingerprint != fingerprint {
+					writeErr(w, http.StatusUnprocessableEntity, errs.InvalidArgument.String(), "idempotency key reused for a different request")
+					return
+				}
+				replayResponse(w, resp)
+				return
+			}
+
+			// Store updates must not be canceled along with the request.
+			storeCtx := func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 5*time.Second)
+			}
+			// Only record headers set by the handler, not per-request
+			// headers set by outer middleware such as the request ID.
+			before := w.Header().Clone()
+			rw := &recordWriter{ResponseWriter: w, max: maxSize}
+			defer func() {
+				if p := recover(); p != nil {
+					ctx, cancel := storeCtx()
+					store.Release(ctx, storeKey)
+					cancel()
+					panic(p)
+				}
+			}()
+			next(rw, req)
+
+			ctx, cancel := storeCtx()
+			defer cancel()
+			status := rw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if !recordable(status) || rw.tooLarge {
+				err = store.Release(ctx, storeKey)
+			} else {
+				err = store.Complete(ctx, storeKey, fingerprint, &idempotency.Response{
+					Status: status,
+					Header: headerDiff(before, w.Header()),
+					Body:   rw.buf,
+				}, ttl)
+			}
+			if err != nil {
+				LoggerFromContext(req.HTTP.Context()).Error().Err(err).Msg("idempotency: could not record response")
+			}
+		}
+	}
+}
+
+// recordable reports whether a response with the given status is recorded.
+// Server errors and responses indicating the request may succeed when
+// retried are not.
+func recordable(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return status < 500
+}
+
+func replayResponse(w http.ResponseWriter, resp *idempotency.Response) {
+	h := w.Header()
+	for k, vs := range resp.Header {
+		h[k] = vs
+	}
+	h.Set("Idempotent-Replayed", "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// headerDiff returns the headers of after that are not in before.
+// Content-Encoding and Content-Length are excluded, since they are
+// set by the compression middleware for the compressed body, while
+// the recorded body is uncompressed.
+func headerDiff(before, after http.Header) http.Header {
+	diff := make(http.Header)
+	for k, vs := range after {
+		if k == "Content-Encoding" || k == "Content-Length" {
+			continue
+		}
+		if !equalStrings(before[k], vs) {
+			diff[k] = append([]string(nil), vs...)
+		}
+	}
+	return diff
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hashHex returns the hex-encoded SHA-256 hash of parts.
+func hashHex(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordWriter records a copy of the response body,
+// up to a maximum size.
+type recordWriter struct {
+	middleware.ResponseWriter
+	max      int
+	buf      []byte
+	tooLarge bool
+}
+
+func (w *recordWriter) Write(b []byte) (int, error) {
+	if !w.tooLarge {
+		if len(w.buf)+len(b) > w.max {
+			w.tooLarge = true
+			w.buf = nil
+		} else {
+			w.buf = append(w.buf, b...)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
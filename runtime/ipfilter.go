@@ -0,0 +1,129 @@
+package runtime
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// ipFilter matches client IPs against allow and deny lists.
+type ipFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func parseIPFilter(cfg *config.IPFilter) (*ipFilter, error) {
+	allow, err := parseCIDRs(cfg.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseCIDRs(cfg.Deny)
+	if err != nil {
+		return nil, err
+	}
+	return &ipFilter{allow: allow, deny: deny}, nil
+}
+
+// parseCIDRs parses a list of IP addresses and CIDR ranges.
+func parseCIDRs(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address %q", e)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ipFilter) allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	} else if containsIP(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, ip)
+}
+
+// filterIPs returns a middleware that enforces the IP filter
+// for the endpoint, or nil if there is none.
+func (srv *Server) filterIPs(svc *config.Service, endpoint *config.Endpoint) middleware.Middleware {
+	cfg := endpoint.IPFilter
+	if cfg == nil {
+		cfg = svc.IPFilter
+	}
+	if cfg == nil {
+		return nil
+	}
+	f, err := parseIPFilter(cfg)
+	if err != nil {
+		srv.logger.Fatal().Err(err).Str("service", svc.Name).Str("endpoint", endpoint.Name).
+			Msg("invalid ip filter")
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			if !f.allowed(srv.clientIP(req.HTTP)) {
+				writeErr(w, http.StatusForbidden, errs.PermissionDenied.String(), "ip address not allowed")
+				return
+			}
+			next(w, req)
+		}
+	}
+}
+
+// clientIP determines the IP address of the client making the request.
+// If the request comes from a trusted proxy the X-Forwarded-For header
+// is consulted, skipping over any trusted proxies.
+func (srv *Server) clientIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(srv.trustedProxies, ip) {
+		return ip
+	}
+
+	// Walk the forwarded addresses from the right, since the
+	// left-most entries are controlled by the client.
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(srv.trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"net/http"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/bodylimit"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// maxBodySize reports the request body size limit for an endpoint,
+// or 0 if there is no limit.
+func (srv *Server) maxBodySize(endpoint *config.Endpoint) int64 {
+	if n := endpoint.MaxBodySize; n != 0 {
+		if n < 0 {
+			return 0
+		}
+		return n
+	}
+	return srv.cfg.MaxBodySize
+}
+
+// limitBody returns a middleware that restricts the request body to limit bytes.
+// Requests that declare a larger Content-Length are rejected immediately;
+// other bodies fail to read once the limit is exceeded, and the error
+// response of a handler failing the read is replaced with the same 413.
+// Raw endpoints write their own responses and only see the read error.
+func limitBody(limit int64, raw bool) middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			if req.HTTP.ContentLength > limit {
+				writeBodyTooLarge(w)
+				return
+			}
+			body := bodylimit.NewBody(req.HTTP.Body, limit)
+			req.HTTP.Body = body
+			if raw {
+				next(w, req)
+				return
+			}
+			next(&limitWriter{
+				Writer: &bodylimit.Writer{ResponseWriter: w, Body: body, TooLarge: writeBodyTooLarge},
+				rw:     w,
+			}, req)
+		}
+	}
+}
+
+func writeBodyTooLarge(w http.ResponseWriter) {
+	writeErr(w, http.StatusRequestEntityTooLarge, errs.ResourceExhausted.String(), "request body too large")
+}
+
+// limitWriter is a bodylimit.Writer reporting the response
+// actually written to the underlying writer.
+type limitWriter struct {
+	*bodylimit.Writer
+	rw middleware.ResponseWriter
+}
+
+func (w *limitWriter) Status() int    { return w.rw.Status() }
+func (w *limitWriter) Written() int64 { return w.rw.Written() }
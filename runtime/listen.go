@@ -0,0 +1,144 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// defaultListenAddr is the address to listen on if none is configured.
+	defaultListenAddr = "localhost:8000"
+
+	// defaultUnixSocketMode is the file mode for Unix domain sockets
+	// if none is configured.
+	defaultUnixSocketMode os.FileMode = 0660
+)
+
+// listen creates the listener for incoming requests.
+// If the process was socket-activated by systemd it uses
+// the inherited listener instead of creating a new one.
+func (srv *Server) listen() (net.Listener, error) {
+	if ln, err := systemdListener(); err != nil {
+		return nil, fmt.Errorf("socket activation: %v", err)
+	} else if ln != nil {
+		return ln, nil
+	}
+
+	network, addr := srv.listenAddr()
+	var (
+		ln  net.Listener
+		err error
+	)
+	switch network {
+	case "unix":
+		ln, err = listenUnix(addr, srv.cfg.UnixSocketMode)
+	default:
+		lc := &net.ListenConfig{}
+		if srv.cfg.ReusePort {
+			lc.Control = reusePort
+		}
+		ln, err = lc.Listen(context.Background(), network, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %v", addr, err)
+	}
+	return ln, nil
+}
+
+// listenAddr reports the network and address to listen on.
+// The ENCORE_LISTEN_ADDR environment variable takes precedence
+// over the server config.
+func (srv *Server) listenAddr() (network, addr string) {
+	addr = os.Getenv("ENCORE_LISTEN_ADDR")
+	if addr == "" {
+		addr = srv.cfg.ListenAddr
+	}
+	if addr == "" {
+		addr = defaultListenAddr
+	}
+	if strings.HasPrefix(addr, "unix:") {
+		return "unix", addr[len("unix:"):]
+	}
+	return "tcp", addr
+}
+
+// listenUnix listens on the Unix domain socket at path.
+// The socket file is removed when the listener is closed.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	// Remove any stale socket left behind by a previous process
+	// that did not shut down cleanly.
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	ln.SetUnlinkOnClose(true)
+
+	if mode == 0 {
+		mode = defaultUnixSocketMode
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// reusePort sets SO_REUSEPORT on the socket.
+func reusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+// systemdListener returns the listener passed by systemd
+// through socket activation, or nil if there is none.
+// See sd_listen_fds(3) for the protocol.
+func systemdListener() (net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n == 0 {
+		return nil, nil
+	} else if n > 1 {
+		return nil, fmt.Errorf("got %d file descriptors, expected 1", n)
+	}
+
+	fd := listenFdsStart
+	syscall.CloseOnExec(fd)
+	name := "LISTEN_FD_" + strconv.Itoa(fd)
+	if names := os.Getenv("LISTEN_FDNAMES"); names != "" {
+		name = names
+	}
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close() // net.FileListener dups the fd
+	return net.FileListener(f)
+}
@@ -0,0 +1,41 @@
+package runtime
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"runtime.encore.dev/middleware"
+)
+
+// requestLogger is a middleware that adds a logger to the request
+// context, with fields identifying the request and the caller.
+func requestLogger(next middleware.Handler) middleware.Handler {
+	return func(w middleware.ResponseWriter, req *middleware.Request) {
+		ctx := req.HTTP.Context()
+		logCtx := RootLogger.With().
+			Str("service", req.Service).
+			Str("endpoint", req.Endpoint)
+		if id := RequestID(ctx); id != "" {
+			logCtx = logCtx.Str("request_id", id)
+		}
+		if sc := spanFromContext(ctx).SpanContext(); sc.IsValid() {
+			logCtx = logCtx.Str("trace_id", sc.TraceID.String()).Str("span_id", sc.SpanID.String())
+		}
+		if a := GetCallOptions(ctx).Auth; a != nil && a.UID != "" {
+			logCtx = logCtx.Str("uid", string(a.UID))
+		}
+		logger := logCtx.Logger()
+		req.HTTP = req.HTTP.WithContext(context.WithValue(ctx, loggerKey, &logger))
+		next(w, req)
+	}
+}
+
+// LoggerFromContext reports the logger of the request associated
+// with ctx. If there is none it returns Logger().
+func LoggerFromContext(ctx context.Context) *zerolog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*zerolog.Logger); ok {
+		return l
+	}
+	return Logger()
+}
@@ -0,0 +1,108 @@
+package runtime
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"runtime.encore.dev/beta/errs"
+)
+
+const (
+	defaultLogLevelTTL    = 15 * time.Minute
+	defaultMaxLogLevelTTL = time.Hour
+)
+
+// logLevelOverride tracks a temporary change of the global log level.
+var logLevelOverride struct {
+	mu     sync.Mutex
+	base   zerolog.Level // level to revert to
+	active bool          // whether an override is active
+	gen    int           // incremented on each change, to ignore stale timers
+	timer  *time.Timer
+}
+
+type setLogLevelResponse struct {
+	Level    string    `json:"level"`
+	Previous string    `json:"previous"`
+	RevertAt time.Time `json:"revert_at"`
+}
+
+// setLogLevel changes the global log level to the level given
+// by the "level" query parameter, reverting it after the duration
+// given by the "ttl" query parameter.
+func (srv *Server) setLogLevel(w http.ResponseWriter, req *http.Request) {
+	cfg := srv.cfg.LogLevelControl
+	if cfg == nil {
+		http.Error(w, "unknown internal endpoint: __encore.SetLogLevel", http.StatusNotFound)
+		return
+	}
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeErr(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if !checkToken(w, req, cfg.Token) {
+		return
+	}
+
+	q := req.URL.Query()
+	level, err := zerolog.ParseLevel(q.Get("level"))
+	if err != nil || q.Get("level") == "" {
+		writeErr(w, http.StatusBadRequest, errs.InvalidArgument.String(), "invalid or missing level")
+		return
+	}
+	ttl, maxTTL := defaultLogLevelTTL, cfg.MaxTTL
+	if maxTTL <= 0 {
+		maxTTL = defaultMaxLogLevelTTL
+	}
+	if s := q.Get("ttl"); s != "" {
+		if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+			writeErr(w, http.StatusBadRequest, errs.InvalidArgument.String(), "invalid ttl")
+			return
+		}
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	o := &logLevelOverride
+	o.mu.Lock()
+	prev := zerolog.GlobalLevel()
+	if !o.active {
+		o.base, o.active = prev, true
+	} else {
+		o.timer.Stop()
+	}
+	zerolog.SetGlobalLevel(level)
+	o.gen++
+	gen := o.gen
+	o.timer = time.AfterFunc(ttl, func() { srv.revertLogLevel(gen) })
+	o.mu.Unlock()
+
+	srv.logger.Info().Str("level", level.String()).Str("previous", prev.String()).Dur("ttl", ttl).Msg("log level changed")
+	data, _ := json.Marshal(setLogLevelResponse{
+		Level:    level.String(),
+		Previous: prev.String(),
+		RevertAt: time.Now().Add(ttl),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// revertLogLevel reverts the global log level to what it was
+// before it was changed by setLogLevel, unless it has been
+// changed again since the change with the given generation.
+func (srv *Server) revertLogLevel(gen int) {
+	o := &logLevelOverride
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.active || o.gen != gen {
+		return
+	}
+	zerolog.SetGlobalLevel(o.base)
+	o.active = false
+	srv.logger.Info().Str("level", o.base.String()).Msg("log level reverted")
+}
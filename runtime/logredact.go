@@ -0,0 +1,46 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"runtime.encore.dev/internal/redact"
+	"runtime.encore.dev/runtime/config"
+)
+
+func newRedactRules(cfg *config.LogRedaction) (*redact.Rules, error) {
+	rules := &redact.Rules{
+		Fields:      redact.NewFields(cfg.Fields...),
+		CardNumbers: cfg.CardNumbers,
+	}
+	for _, p := range cfg.FieldPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("field pattern %q: %v", p, err)
+		}
+		rules.FieldPatterns = append(rules.FieldPatterns, re)
+	}
+	for _, p := range cfg.ValuePatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("value pattern %q: %v", p, err)
+		}
+		rules.ValuePatterns = append(rules.ValuePatterns, re)
+	}
+	return rules, nil
+}
+
+// redactWriter redacts log lines before writing them to w.
+// zerolog writes each event as a single JSON line.
+type redactWriter struct {
+	w     io.Writer
+	rules *redact.Rules
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(w.rules.JSON(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
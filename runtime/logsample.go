@@ -0,0 +1,19 @@
+package runtime
+
+import (
+	"runtime.encore.dev/internal/logsample"
+	"runtime.encore.dev/runtime/config"
+)
+
+func newLogSampler(cfg *config.LogSampling) *logsample.Sampler {
+	var def *logsample.Policy
+	if cfg.Default != nil {
+		p := logsample.Policy(*cfg.Default)
+		def = &p
+	}
+	msgs := make(map[string]logsample.Policy, len(cfg.Messages))
+	for msg, p := range cfg.Messages {
+		msgs[msg] = logsample.Policy(p)
+	}
+	return logsample.New(def, msgs)
+}
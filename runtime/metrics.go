@@ -0,0 +1,140 @@
+package runtime
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/remotewrite"
+	"runtime.encore.dev/internal/statsd"
+	"runtime.encore.dev/runtime/config"
+)
+
+// serveMetrics starts serving metrics on the standalone
+// metrics listener, if one is configured.
+func (srv *Server) serveMetrics() error {
+	cfg := srv.cfg.MetricsListener
+	if cfg == nil {
+		return nil
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/metrics"
+	}
+
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("metrics listener: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, srv.scrapeMetrics)
+	srv.metsrv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+	}
+
+	srv.logger.Info().Str("addr", ln.Addr().String()).Str("path", path).Msg("serving metrics")
+	go func() {
+		if err := srv.metsrv.Serve(ln); err != http.ErrServerClosed {
+			srv.logger.Error().Err(err).Msg("metrics listener failed")
+		}
+	}()
+	return nil
+}
+
+const defaultMetricsExportInterval = 10 * time.Second
+
+// newMetricsExporters creates the configured metrics exporters.
+// It exits on error.
+func (srv *Server) newMetricsExporters() []config.MetricsExporter {
+	cfg := srv.cfg.MetricsExport
+	if cfg == nil {
+		return nil
+	}
+	exps := append([]config.MetricsExporter(nil), cfg.Exporters...)
+	if s := cfg.StatsD; s != nil {
+		c, err := statsd.New(statsd.Config{
+			Addr:      s.Addr,
+			Prefix:    s.Prefix,
+			DogStatsD: s.DogStatsD,
+			Tags:      s.Tags,
+		})
+		if err != nil {
+			srv.logger.Fatal().Err(err).Msg("could not setup statsd")
+		}
+		exps = append(exps, c)
+	}
+	if pg := cfg.Pushgateway; pg != nil {
+		if pg.URL == "" || pg.Job == "" {
+			srv.logger.Fatal().Msg("pushgateway requires a url and job")
+		}
+		exps = append(exps, pushgateway{pg})
+	}
+	if rw := cfg.RemoteWrite; rw != nil {
+		if rw.URL == "" {
+			srv.logger.Fatal().Msg("remote write requires a url")
+		}
+		exps = append(exps, remotewrite.New(remotewrite.Config{
+			URL:     rw.URL,
+			Headers: rw.Headers,
+			Labels:  rw.Labels,
+		}))
+	}
+	return exps
+}
+
+// pushgateway pushes metrics to a Prometheus Pushgateway,
+// replacing the metrics previously pushed for its grouping key.
+type pushgateway struct {
+	cfg *config.Pushgateway
+}
+
+func (p pushgateway) Push(mfs []*dto.MetricFamily) error {
+	pusher := push.New(p.cfg.URL, p.cfg.Job).Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return mfs, nil
+	}))
+	for k, v := range p.cfg.Grouping {
+		pusher = pusher.Grouping(k, v)
+	}
+	return pusher.Push()
+}
+
+// exportMetrics periodically pushes metrics to the configured
+// exporters until stop is closed, and then pushes them a final time.
+func (srv *Server) exportMetrics(stop <-chan struct{}) {
+	interval := srv.cfg.MetricsExport.Interval
+	if interval <= 0 {
+		interval = defaultMetricsExportInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			srv.pushMetrics()
+		case <-stop:
+			srv.pushMetrics()
+			return
+		}
+	}
+}
+
+func (srv *Server) pushMetrics() {
+	mfs, err := metrics.Gather()
+	if err != nil {
+		srv.logger.Error().Err(err).Msg("could not gather metrics")
+		return
+	}
+	for _, exp := range srv.exporters {
+		if err := exp.Push(mfs); err != nil {
+			srv.logger.Error().Err(err).Msg("could not push metrics")
+		}
+	}
+}
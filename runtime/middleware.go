@@ -0,0 +1,179 @@
+package runtime
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/julienschmidt/httprouter"
+
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// endpointHandler builds the handler for an endpoint, composing
+// the runtime's built-in middleware with the configured middleware.
+func (srv *Server) endpointHandler(svc *config.Service, endpoint *config.Endpoint, cors *corsPolicy) httprouter.Handle {
+	mws := []middleware.Middleware{observeRequest, requestID}
+	if mw := srv.securityHeaders(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.cachePolicy(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.traceRequest(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.accessLog(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.versioning(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	mws = append(mws, srv.recoverPanics)
+	if mw := srv.filterIPs(svc, endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if srv.compressor != nil && !endpoint.Raw {
+		// Raw endpoints control their response encoding.
+		mws = append(mws, srv.compressor.middleware)
+	}
+	if mw := srv.conditional(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.responseHooks(svc, endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if limit := srv.maxBodySize(endpoint); limit > 0 {
+		mws = append(mws, limitBody(limit, endpoint.Raw))
+	}
+	if mw := srv.slowClients(); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.decompressRequests(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if cors != nil {
+		mws = append(mws, cors.middleware)
+	}
+	if mw := srv.csrf(); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.rateLimit(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if srv.mtlsEnabled() {
+		mws = append(mws, clientIdentity)
+	}
+	if mw := srv.authenticate(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.rateLimitByAuth(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.responseCache(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.idempotency(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	if mw := srv.audit(endpoint); mw != nil {
+		mws = append(mws, mw)
+	}
+	mws = append(mws, requestLogger)
+	mws = append(mws, srv.cfg.Middleware...)
+	mws = append(mws, svc.Middleware...)
+	mws = append(mws, endpoint.Middleware...)
+
+	h := middleware.Chain(func(w middleware.ResponseWriter, req *middleware.Request) {
+		// Pass on the underlying writer if it has not been replaced by a middleware,
+		// to expose optional interfaces like http.Flusher and http.Hijacker.
+		if rw, ok := w.(*responseWriter); ok {
+			endpoint.Handler(rw.ResponseWriter, req.HTTP, req.Params)
+		} else {
+			endpoint.Handler(w, req.HTTP, req.Params)
+		}
+	}, mws...)
+
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		h(newResponseWriter(w), &middleware.Request{
+			Service:  svc.Name,
+			Endpoint: endpoint.Name,
+			Path:     endpointPath(endpoint),
+			HTTP:     req,
+			Params:   ps,
+		})
+	}
+}
+
+// responseWriter implements middleware.ResponseWriter.
+type responseWriter struct {
+	// ResponseWriter wraps the original response writer,
+	// tracking the status code and bytes written while
+	// preserving its optional interfaces.
+	http.ResponseWriter
+
+	status  int
+	written int64
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	rw := &responseWriter{}
+	rw.ResponseWriter = httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if rw.status == 0 {
+					rw.status = code
+				}
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				if rw.status == 0 {
+					rw.status = http.StatusOK
+				}
+				n, err := next(b)
+				rw.written += int64(n)
+				return n, err
+			}
+		},
+		Hijack: func(next httpsnoop.HijackFunc) httpsnoop.HijackFunc {
+			return func() (net.Conn, *bufio.ReadWriter, error) {
+				conn, brw, err := next()
+				if err == nil && rw.status == 0 {
+					// The connection was upgraded, such as to a WebSocket.
+					rw.status = http.StatusSwitchingProtocols
+				}
+				return conn, brw, err
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				if rw.status == 0 {
+					rw.status = http.StatusOK
+				}
+				n, err := next(src)
+				rw.written += n
+				return n, err
+			}
+		},
+	})
+	return rw
+}
+
+// Flush sends any buffered data to the client,
+// if the original response writer supports flushing.
+func (w *responseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Status() int    { return w.status }
+func (w *responseWriter) Written() int64 { return w.written }
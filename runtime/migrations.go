@@ -0,0 +1,27 @@
+package runtime
+
+import (
+	"net/http"
+
+	"runtime.encore.dev/internal/migrate"
+)
+
+// serveMigrations responds with the status of migrating
+// the databases with migrations.
+func (srv *Server) serveMigrations(w http.ResponseWriter, req *http.Request) {
+	if srv.cfg.MigrationsToken == "" {
+		http.Error(w, "unknown internal endpoint: __encore.Migrations", http.StatusNotFound)
+		return
+	}
+	if req.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeErr(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if !checkToken(w, req, srv.cfg.MigrationsToken) {
+		return
+	}
+	data, _ := json.MarshalIndent(migrate.Statuses(), "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
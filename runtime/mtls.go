@@ -0,0 +1,101 @@
+package runtime
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/crypto/acme"
+
+	"runtime.encore.dev/middleware"
+)
+
+// ClientIdentity is the identity of a client authenticated
+// with a verified TLS client certificate.
+type ClientIdentity struct {
+	CommonName     string
+	DNSNames       []string
+	URIs           []string // such as SPIFFE ids
+	EmailAddresses []string
+
+	// Certificate is the verified client certificate.
+	Certificate *x509.Certificate
+}
+
+// GetClientIdentity reports the identity of the client from its
+// verified TLS client certificate, or nil if there is none.
+func GetClientIdentity(ctx context.Context) *ClientIdentity {
+	id, _ := ctx.Value(clientIDKey).(*ClientIdentity)
+	return id
+}
+
+// mtlsEnabled reports whether client certificates are verified.
+func (srv *Server) mtlsEnabled() bool {
+	cfg := srv.cfg.TLS
+	return cfg != nil && (cfg.ClientCAFile != "" || len(cfg.ClientCAPEM) > 0)
+}
+
+// configureClientAuth configures tc to verify client certificates,
+// if a client CA bundle is configured.
+func (srv *Server) configureClientAuth(tc *tls.Config) error {
+	if !srv.mtlsEnabled() {
+		return nil
+	}
+	cfg := srv.cfg.TLS
+	bundle := cfg.ClientCAPEM
+	if len(bundle) == 0 {
+		var err error
+		if bundle, err = ioutil.ReadFile(cfg.ClientCAFile); err != nil {
+			return fmt.Errorf("load client ca bundle: %v", err)
+		}
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return fmt.Errorf("load client ca bundle: no certificates found")
+	}
+
+	tc.ClientCAs = pool
+	if cfg.ClientCertOptional {
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+	} else {
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if len(cfg.AutocertHosts) > 0 {
+		// ACME TLS-ALPN challenges come without a client certificate.
+		acmeConfig := tc.Clone()
+		acmeConfig.ClientAuth = tls.NoClientCert
+		tc.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			for _, proto := range hello.SupportedProtos {
+				if proto == acme.ALPNProto {
+					return acmeConfig, nil
+				}
+			}
+			return nil, nil
+		}
+	}
+	return nil
+}
+
+// clientIdentity is a middleware that adds the identity
+// from a verified client certificate to the request context.
+func clientIdentity(next middleware.Handler) middleware.Handler {
+	return func(w middleware.ResponseWriter, req *middleware.Request) {
+		if st := req.HTTP.TLS; st != nil && len(st.VerifiedChains) > 0 && len(st.VerifiedChains[0]) > 0 {
+			cert := st.VerifiedChains[0][0]
+			id := &ClientIdentity{
+				CommonName:     cert.Subject.CommonName,
+				DNSNames:       cert.DNSNames,
+				EmailAddresses: cert.EmailAddresses,
+				Certificate:    cert,
+			}
+			for _, u := range cert.URIs {
+				id.URIs = append(id.URIs, u.String())
+			}
+			req.HTTP = req.HTTP.WithContext(context.WithValue(req.HTTP.Context(), clientIDKey, id))
+		}
+		next(w, req)
+	}
+}
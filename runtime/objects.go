@@ -0,0 +1,144 @@
+package runtime
+
+import (
+	"crypto/rand"
+	"io"
+	"net/http"
+	"strings"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/objstore"
+)
+
+// objectsPath is the path prefix of the signed URLs of local buckets,
+// followed by the bucket name and object key.
+const objectsPath = "__encore/objects/"
+
+// buckets are the drivers of the configured buckets, by name.
+// It is set by Setup.
+var buckets map[string]objstore.Driver
+
+// newBuckets creates the drivers of the configured buckets.
+func (srv *Server) newBuckets() map[string]objstore.Driver {
+	m := make(map[string]objstore.Driver)
+	for _, b := range srv.cfg.Buckets {
+		name := b.BucketName
+		if name == "" {
+			name = b.Name
+		}
+		var (
+			d   objstore.Driver
+			err error
+		)
+		switch b.Driver {
+		case "s3", "gcs":
+			cfg := objstore.S3Config{
+				Bucket:          name,
+				Region:          b.Region,
+				Endpoint:        b.Endpoint,
+				PathStyle:       b.PathStyle,
+				AccessKeyID:     b.AccessKeyID,
+				SecretAccessKey: b.SecretAccessKey,
+				SessionToken:    b.SessionToken,
+				TempDir:         srv.cfg.Uploads.TempDir,
+			}
+			if b.Driver == "gcs" {
+				if cfg.Endpoint == "" {
+					cfg.Endpoint = "https://storage.googleapis.com"
+				}
+				if cfg.Region == "" {
+					cfg.Region = "auto"
+				}
+			}
+			d, err = objstore.NewS3(cfg, nil)
+		case "local":
+			key := []byte(b.SigningKey)
+			if len(key) == 0 {
+				key = make([]byte, 32)
+				if _, err := rand.Read(key); err != nil {
+					srv.logger.Fatal().Err(err).Msg("objects: could not generate signing key")
+				}
+			}
+			prefix := strings.TrimSuffix(b.BaseURL, "/") + "/" + objectsPath + b.Name + "/"
+			d, err = objstore.NewLocal(b.Root, prefix, key)
+		default:
+			srv.logger.Fatal().Str("bucket", b.Name).Msgf("objects: unknown driver %q", b.Driver)
+		}
+		if err != nil {
+			srv.logger.Fatal().Err(err).Str("bucket", b.Name).Msg("objects: could not set up bucket")
+		}
+		m[b.Name] = d
+	}
+	return m
+}
+
+// BucketDriver returns the driver of the bucket declared with
+// the given name, or nil if it is not configured.
+func BucketDriver(name string) objstore.Driver {
+	return buckets[name]
+}
+
+// serveObject serves the signed URLs of local buckets, downloading
+// objects with GET and HEAD requests and uploading them with PUT.
+// The path is the bucket name followed by the object key.
+func (srv *Server) serveObject(w http.ResponseWriter, req *http.Request, path string) {
+	idx := strings.IndexByte(path, '/')
+	if idx == -1 {
+		writeErr(w, http.StatusNotFound, errs.NotFound.String(), "object not found")
+		return
+	}
+	name, key := path[:idx], path[idx+1:]
+	l, ok := buckets[name].(*objstore.Local)
+	if !ok {
+		writeErr(w, http.StatusNotFound, errs.NotFound.String(), "unknown bucket")
+		return
+	}
+	method := req.Method
+	if method == "HEAD" {
+		method = "GET"
+	}
+	if method != "GET" && method != "PUT" {
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		writeErr(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if !l.Verify(method, key, req.URL.Query()) {
+		writeErr(w, http.StatusForbidden, errs.PermissionDenied.String(), "invalid or expired signature")
+		return
+	}
+
+	if method == "PUT" {
+		attrs, err := l.Put(req.Context(), key, req.Body, objstore.PutOptions{
+			ContentType: req.Header.Get("Content-Type"),
+			Size:        req.ContentLength,
+		})
+		if err != nil {
+			srv.logger.Error().Err(err).Str("bucket", name).Str("key", key).Msg("objects: could not store object")
+			writeErr(w, http.StatusInternalServerError, errs.Internal.String(), "could not store object")
+			return
+		}
+		w.Header().Set("ETag", attrs.ETag)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	rc, attrs, err := l.Get(req.Context(), key)
+	if err == objstore.ErrNotExist || err == objstore.ErrInvalidKey {
+		writeErr(w, http.StatusNotFound, errs.NotFound.String(), "object not found")
+		return
+	} else if err != nil {
+		srv.logger.Error().Err(err).Str("bucket", name).Str("key", key).Msg("objects: could not open object")
+		writeErr(w, http.StatusInternalServerError, errs.Internal.String(), "could not open object")
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", attrs.ContentType)
+	if attrs.ETag != "" {
+		w.Header().Set("ETag", attrs.ETag)
+	}
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, req, "", attrs.Modified, rs)
+		return
+	}
+	io.Copy(w, rc)
+}
@@ -0,0 +1,41 @@
+package runtime
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/middleware"
+)
+
+// observeRequest is a middleware that records the rate, errors and
+// duration (RED) metrics of the request. The duration includes the
+// time spent in other middleware, and is linked to the request's
+// trace through an exemplar.
+func observeRequest(next middleware.Handler) middleware.Handler {
+	return func(w middleware.ResponseWriter, req *middleware.Request) {
+		start := time.Now()
+		next(w, req)
+		status := w.Status()
+		if status == 0 {
+			// Nothing was written; net/http responds with 200 OK.
+			status = http.StatusOK
+		}
+		dur := time.Since(start).Seconds()
+
+		// Link the observation to the trace, if it is exported.
+		// Inner middleware has replaced req.HTTP with a request
+		// whose context holds the span, if any.
+		var traceID string
+		if sc := spanFromContext(req.HTTP.Context()).SpanContext(); sc.Sampled {
+			traceID = sc.TraceID.String()
+		}
+		metrics.Request(req.Service, req.Endpoint, req.HTTP.Method, statusClass(status), dur, traceID)
+	}
+}
+
+// statusClass returns the class of an HTTP status code, such as "2xx".
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,60 @@
+package runtime
+
+import (
+	"net/http"
+
+	"runtime.encore.dev/internal/openapi"
+	"runtime.encore.dev/runtime/config"
+)
+
+// serveOpenAPI serves the OpenAPI document describing the
+// public and authenticated endpoints. Private endpoints and
+// raw endpoints' payloads are not described.
+func (srv *Server) serveOpenAPI(w http.ResponseWriter, req *http.Request) {
+	if srv.cfg.OpenAPI.Disabled {
+		http.Error(w, "unknown internal endpoint: __encore.openapi.json", http.StatusNotFound)
+		return
+	}
+	srv.openapiOnce.Do(func() {
+		srv.openapiDoc, srv.openapiErr = srv.buildOpenAPI().JSON()
+	})
+	if srv.openapiErr != nil {
+		http.Error(w, "could not build openapi document: "+srv.openapiErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(srv.openapiDoc)
+}
+
+func (srv *Server) buildOpenAPI() *openapi.Document {
+	cfg := srv.cfg.OpenAPI
+	info := openapi.Info{Title: cfg.Title, Version: cfg.Version}
+	if info.Title == "" {
+		info.Title = "Encore API"
+	}
+	if info.Version == "" {
+		info.Version = "1.0"
+	}
+
+	var eps []openapi.Endpoint
+	for _, svc := range srv.cfg.Services {
+		for _, ep := range svc.Endpoints {
+			if ep.Access == config.Private {
+				continue
+			}
+			oe := openapi.Endpoint{
+				Service: svc.Name,
+				Name:    ep.Name,
+				Path:    endpointPath(ep),
+				Methods: ep.Methods,
+				Doc:     ep.Doc,
+				Auth:    authRequired(ep),
+			}
+			if !ep.Raw {
+				oe.Request, oe.Response = ep.Request, ep.Response
+			}
+			eps = append(eps, oe)
+		}
+	}
+	return openapi.Build(info, cfg.Servers, eps)
+}
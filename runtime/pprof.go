@@ -0,0 +1,55 @@
+package runtime
+
+import (
+	"net/http"
+	"net/http/pprof"
+	goruntime "runtime"
+	"strings"
+)
+
+// setupProfiling enables the block and mutex profiles, if configured.
+func (srv *Server) setupProfiling() {
+	cfg := srv.cfg.Pprof
+	if cfg == nil {
+		return
+	}
+	if cfg.BlockProfileRate > 0 {
+		goruntime.SetBlockProfileRate(cfg.BlockProfileRate)
+	}
+	if cfg.MutexProfileFraction > 0 {
+		goruntime.SetMutexProfileFraction(cfg.MutexProfileFraction)
+	}
+}
+
+// servePprof serves the named profile, or an index of
+// the available profiles if name is empty.
+func (srv *Server) servePprof(w http.ResponseWriter, req *http.Request, name string) {
+	cfg := srv.cfg.Pprof
+	if cfg == nil {
+		http.Error(w, "unknown internal endpoint: __encore.pprof", http.StatusNotFound)
+		return
+	}
+	if !checkToken(w, req, cfg.Token) {
+		return
+	}
+
+	switch name {
+	case "":
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			// The index links to profiles relative to the current path.
+			http.Redirect(w, req, req.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		pprof.Index(w, req)
+	case "cmdline":
+		pprof.Cmdline(w, req)
+	case "profile":
+		pprof.Profile(w, req)
+	case "symbol":
+		pprof.Symbol(w, req)
+	case "trace":
+		pprof.Trace(w, req)
+	default:
+		pprof.Handler(name).ServeHTTP(w, req)
+	}
+}
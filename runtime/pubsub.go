@@ -0,0 +1,446 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/health"
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/otel"
+	"runtime.encore.dev/internal/pubsub"
+	"runtime.encore.dev/runtime/config"
+	"runtime.encore.dev/types/uuid"
+)
+
+const (
+	defaultSubConcurrency = 10
+	defaultAckDeadline    = 30 * time.Second
+	defaultMinBackoff     = time.Second
+	defaultMaxBackoff     = 10 * time.Minute
+	defaultMaxRetries     = 100
+
+	// maxMessageIDLen is the maximum length of a publisher-supplied message ID.
+	maxMessageIDLen = 255
+)
+
+// broker is the pub/sub message broker, set by Setup.
+var broker pubsub.Broker
+
+// dedupStore records the messages processed by subscriptions
+// with a dedup window, set by Setup.
+var dedupStore config.DedupStore
+
+// newBroker creates the pub/sub message broker.
+func (srv *Server) newBroker() pubsub.Broker {
+	switch store := srv.cfg.PubSub.Store; store {
+	case "redis":
+		if srv.redis == nil {
+			srv.logger.Fatal().Msg("pubsub: redis store configured but no redis server")
+		}
+		return pubsub.NewRedisBroker(srv.redis, "encore:pubsub:")
+	case "", "memory":
+		return pubsub.NewMemoryBroker()
+	default:
+		srv.logger.Fatal().Str("store", store).Msg("pubsub: unknown store")
+		return nil
+	}
+}
+
+// newDedupStore creates the store recording processed messages.
+func (srv *Server) newDedupStore() config.DedupStore {
+	if s := srv.cfg.PubSub.DedupStore; s != nil {
+		return s
+	}
+	if srv.cfg.PubSub.Store == "redis" {
+		return pubsub.NewRedisDedupStore(srv.redis, "encore:pubsub-dedup:")
+	}
+	return pubsub.NewMemoryDedupStore()
+}
+
+// PublishOptions are options for publishing a message.
+type PublishOptions struct {
+	// ID, if set, is the ID of the message instead of a generated one.
+	// Subscriptions with a dedup window handle messages with the same
+	// ID only once.
+	ID string
+
+	// OrderingKey, if set, orders the delivery of the message after
+	// the messages published before it with the same key.
+	OrderingKey string
+
+	// DeliverAt or Delay, if set, delay the delivery of the
+	// message until the given time or by the given duration.
+	// At most one of them may be set.
+	DeliverAt time.Time
+	Delay     time.Duration
+}
+
+// deliverAt returns when a message published with opts is
+// first delivered, or the zero time if it is not delayed.
+func (opts PublishOptions) deliverAt() (time.Time, error) {
+	switch {
+	case opts.Delay < 0:
+		return time.Time{}, errs.B().Code(errs.InvalidArgument).Msg("pubsub: negative delay").Err()
+	case opts.Delay > 0 && !opts.DeliverAt.IsZero():
+		return time.Time{}, errs.B().Code(errs.InvalidArgument).Msg("pubsub: both delay and delivery time given").Err()
+	case opts.Delay > 0:
+		return time.Now().Add(opts.Delay), nil
+	}
+	return opts.DeliverAt, nil
+}
+
+// Publish publishes msg, encoded as JSON, to topic,
+// and returns the ID of the published message.
+func Publish(ctx context.Context, topic string, msg interface{}) (id string, err error) {
+	return PublishWithOptions(ctx, topic, msg, PublishOptions{})
+}
+
+// PublishOrdered is like Publish, but with an ordering key: messages
+// with the same key are delivered to each subscription one at a time,
+// in the order they were published.
+func PublishOrdered(ctx context.Context, topic, orderingKey string, msg interface{}) (id string, err error) {
+	return PublishWithOptions(ctx, topic, msg, PublishOptions{OrderingKey: orderingKey})
+}
+
+// PublishWithOptions is like Publish, but with the given options.
+func PublishWithOptions(ctx context.Context, topic string, msg interface{}, opts PublishOptions) (id string, err error) {
+	if id, err = publish(ctx, topic, msg, opts); err != nil {
+		return "", err
+	}
+	metrics.PubSubPublish(topic)
+	return id, nil
+}
+
+// publish publishes msg to topic, without recording metrics.
+func publish(ctx context.Context, topic string, msg interface{}, opts PublishOptions) (id string, err error) {
+	if broker == nil {
+		return "", errs.B().Code(errs.Internal).Msg("pubsub: runtime not initialized").Err()
+	}
+	if len(opts.ID) > maxMessageIDLen {
+		return "", errs.B().Code(errs.InvalidArgument).Msg("pubsub: message id too long").Err()
+	}
+	at, err := opts.deliverAt()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return "", errs.WrapCode(err, errs.InvalidArgument, "pubsub: could not encode message")
+	}
+	id = opts.ID
+	if id == "" {
+		uid, err := uuid.NewV4()
+		if err != nil {
+			return "", errs.WrapCode(err, errs.Internal, "pubsub: could not generate message id")
+		}
+		id = uid.String()
+	}
+	m := &pubsub.Message{
+		ID:          id,
+		Data:        data,
+		PublishTime: time.Now(),
+		OrderingKey: opts.OrderingKey,
+		DeliverAt:   at,
+	}
+
+	span := StartSpan(topic+" publish", otel.Producer,
+		otel.String("messaging.system", "encore"),
+		otel.String("messaging.destination", topic),
+		otel.String("messaging.message_id", m.ID),
+	)
+	if sc := span.SpanContext(); sc.IsValid() {
+		m.Attributes = map[string]string{"traceparent": otel.FormatTraceparent(sc)}
+	}
+	err = broker.Publish(ctx, topic, m)
+	span.End(err)
+	if err != nil {
+		return "", errs.WrapCode(err, errs.Unavailable, "pubsub: could not publish message")
+	}
+	return m.ID, nil
+}
+
+// subscription handles the messages of a subscription.
+type subscription struct {
+	srv         *Server
+	cfg         *config.Subscription
+	concurrency int
+	ackDeadline time.Duration
+	retry       config.RetryPolicy
+	dedupKey    string // prefix of the dedup keys of messages
+	queue       string // name of the task queue, or "" if a subscription
+
+	wg sync.WaitGroup
+}
+
+// setupSubscriptions prepares the configured subscriptions. They are
+// created in the broker as startup tasks, so they receive messages
+// published once the application is ready, and handle them once
+// started with startSubscriptions.
+func (srv *Server) setupSubscriptions() {
+	for _, cfg := range srv.cfg.PubSub.Subscriptions {
+		srv.addSubscription(cfg, "")
+	}
+	srv.setupDeadLetters()
+	srv.setupTasks()
+}
+
+// addSubscription adds a subscription handled by the server, for
+// the given task queue if queue is non-empty.
+func (srv *Server) addSubscription(cfg *config.Subscription, queue string) *subscription {
+	s := &subscription{
+		srv:         srv,
+		cfg:         cfg,
+		concurrency: cfg.MaxConcurrency,
+		ackDeadline: cfg.AckDeadline,
+		retry:       cfg.RetryPolicy,
+		dedupKey:    cfg.Topic + "/" + cfg.Name + "/",
+		queue:       queue,
+	}
+	if s.concurrency <= 0 {
+		s.concurrency = defaultSubConcurrency
+	}
+	if s.ackDeadline <= 0 {
+		s.ackDeadline = defaultAckDeadline
+	}
+	if s.retry.MinBackoff <= 0 {
+		s.retry.MinBackoff = defaultMinBackoff
+	}
+	if s.retry.MaxBackoff <= 0 {
+		s.retry.MaxBackoff = defaultMaxBackoff
+	}
+	if s.retry.MaxRetries == 0 {
+		s.retry.MaxRetries = defaultMaxRetries
+	}
+	srv.subs = append(srv.subs, s)
+
+	health.RegisterStartup("pubsub:"+cfg.Topic+"/"+cfg.Name, func(ctx context.Context) error {
+		return broker.Subscribe(ctx, cfg.Topic, cfg.Name)
+	})
+	return s
+}
+
+// record records the result of handling a message in durSecs seconds.
+func (s *subscription) record(result string, durSecs float64) {
+	if s.queue != "" {
+		metrics.TaskRun(s.queue, result, durSecs)
+	} else {
+		metrics.PubSubMessage(s.cfg.Topic, s.cfg.Name, result, durSecs)
+	}
+}
+
+// startSubscriptions starts handling messages.
+func (srv *Server) startSubscriptions() {
+	if len(srv.subs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.stopSubs = cancel
+	for _, s := range srv.subs {
+		if s.queue != "" {
+			srv.logger.Info().Str("queue", s.queue).Msg("handling task queue")
+		} else {
+			srv.logger.Info().Str("topic", s.cfg.Topic).Str("subscription", s.cfg.Name).Msg("handling subscription")
+		}
+		for i := 0; i < s.concurrency; i++ {
+			s.wg.Add(1)
+			go s.run(ctx)
+		}
+	}
+	go srv.monitorDeadLetters(ctx)
+	go srv.monitorTaskQueues(ctx)
+}
+
+// stopSubscriptions stops receiving messages and waits for
+// the messages being handled until ctx is done.
+func (srv *Server) stopSubscriptions(ctx context.Context) {
+	if srv.stopSubs == nil {
+		return
+	}
+	srv.stopSubs()
+	done := make(chan struct{})
+	go func() {
+		for _, s := range srv.subs {
+			s.wg.Wait()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// run receives and handles messages until ctx is canceled.
+func (s *subscription) run(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		msg, err := broker.Receive(ctx, s.cfg.Topic, s.cfg.Name, s.ackDeadline)
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			s.srv.logger.Error().Err(err).Str("topic", s.cfg.Topic).Str("subscription", s.cfg.Name).
+				Msg("pubsub: could not receive message")
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		s.handle(msg)
+	}
+}
+
+// handle handles a message, acknowledging it if it was handled
+// successfully and scheduling its redelivery if not. Once its
+// retries are exhausted it is dead-lettered or discarded.
+func (s *subscription) handle(msg *pubsub.Message) {
+	dedup := s.cfg.DedupWindow > 0
+	if dedup {
+		var done bool
+		if done, dedup = s.checkDuplicate(msg); done {
+			return
+		}
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), s.ackDeadline)
+	err := s.process(ctx, msg)
+	cancel()
+	dur := time.Since(start).Seconds()
+
+	// Broker updates must not be canceled along with the handler.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	topic, name := s.cfg.Topic, s.cfg.Name
+	if dedup {
+		var derr error
+		if err == nil {
+			derr = dedupStore.Complete(ctx, s.dedupKey+msg.ID, s.cfg.DedupWindow)
+		} else {
+			derr = dedupStore.Release(ctx, s.dedupKey+msg.ID)
+		}
+		if derr != nil {
+			s.srv.logger.Error().Err(derr).Str("topic", topic).Str("subscription", name).
+				Str("message_id", msg.ID).Msg("pubsub: could not record message")
+		}
+	}
+
+	switch {
+	case err == nil:
+		s.record("ok", dur)
+		err = broker.Ack(ctx, topic, name, msg.ID)
+	case s.retry.MaxRetries >= 0 && msg.Attempt > s.retry.MaxRetries && s.cfg.DeadLetterTopic != "":
+		s.srv.logger.Error().Err(err).Str("topic", topic).Str("subscription", name).
+			Str("message_id", msg.ID).Int("attempt", msg.Attempt).Str("dead_letter_topic", s.cfg.DeadLetterTopic).
+			Msg("pubsub: dead-lettering message after too many retries")
+		if err = s.deadLetter(ctx, msg, err); err == nil {
+			s.record("dead_lettered", dur)
+			err = broker.Ack(ctx, topic, name, msg.ID)
+		} else {
+			// Retry dead-lettering once the message is redelivered.
+			s.record("error", dur)
+			if nerr := broker.Nack(ctx, topic, name, msg.ID, s.retry.MinBackoff); nerr != nil {
+				err = nerr
+			}
+		}
+	case s.retry.MaxRetries >= 0 && msg.Attempt > s.retry.MaxRetries:
+		s.record("discarded", dur)
+		s.srv.logger.Error().Err(err).Str("topic", topic).Str("subscription", name).
+			Str("message_id", msg.ID).Int("attempt", msg.Attempt).Msg("pubsub: discarding message after too many retries")
+		err = broker.Ack(ctx, topic, name, msg.ID)
+	default:
+		s.record("error", dur)
+		err = broker.Nack(ctx, topic, name, msg.ID, pubsub.Backoff(msg.Attempt, s.retry.MinBackoff, s.retry.MaxBackoff))
+	}
+	if err != nil {
+		s.srv.logger.Error().Err(err).Str("topic", topic).Str("subscription", name).
+			Str("message_id", msg.ID).Msg("pubsub: could not update message")
+	}
+}
+
+// checkDuplicate claims msg for processing in the dedup store.
+// It reports whether msg is done with, because it has already been
+// processed or is being processed by another receiver, and whether
+// it was claimed, as it is not if the store is unavailable.
+func (s *subscription) checkDuplicate(msg *pubsub.Message) (done, claimed bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	topic, name := s.cfg.Topic, s.cfg.Name
+	claimed, processed, err := dedupStore.Claim(ctx, s.dedupKey+msg.ID, s.ackDeadline)
+	switch {
+	case err != nil:
+		// Fail open, so a store outage does not stop delivery.
+		s.srv.logger.Error().Err(err).Str("topic", topic).Str("subscription", name).
+			Str("message_id", msg.ID).Msg("pubsub: could not check for duplicate message")
+		return false, false
+	case processed:
+		s.record("duplicate", 0)
+		err = broker.Ack(ctx, topic, name, msg.ID)
+	case !claimed:
+		// Another receiver is handling the message;
+		// check again once it should have finished.
+		err = broker.Nack(ctx, topic, name, msg.ID, s.ackDeadline)
+	default:
+		return false, true
+	}
+	if err != nil {
+		s.srv.logger.Error().Err(err).Str("topic", topic).Str("subscription", name).
+			Str("message_id", msg.ID).Msg("pubsub: could not update message")
+	}
+	return true, false
+}
+
+// process runs the subscription handler for msg as a request,
+// so it is logged and traced like calls to endpoints.
+func (s *subscription) process(ctx context.Context, msg *pubsub.Message) (err error) {
+	cfg := s.cfg
+	if tracer != nil {
+		parent, _ := otel.ParseTraceparent(msg.Attributes["traceparent"])
+		span := tracer.Start(parent, cfg.Topic+" process", otel.Consumer,
+			otel.String("messaging.system", "encore"),
+			otel.String("messaging.destination", cfg.Topic),
+			otel.String("messaging.message_id", msg.ID),
+			otel.String("encore.service", cfg.Service),
+			otel.String("encore.subscription", cfg.Name),
+			otel.Int("encore.attempt", int64(msg.Attempt)),
+		)
+		defer func() { span.End(err) }()
+		ctx = context.WithValue(ctx, spanKey, span)
+	}
+
+	var payload interface{} = msg.Data
+	if t := cfg.MessageType; t != nil {
+		v := reflect.New(t)
+		if err := json.Unmarshal(msg.Data, v.Interface()); err != nil {
+			return fmt.Errorf("pubsub: could not decode message: %v", err)
+		}
+		payload = v.Interface()
+	}
+
+	BeginOperation()
+	defer FinishOperation()
+	if err := BeginRequest(ctx, RequestData{
+		Type:     PubSubMessage,
+		Service:  cfg.Service,
+		Endpoint: cfg.Name,
+		Inputs:   [][]byte{msg.Data},
+	}); err != nil {
+		return err
+	}
+	req, _, _ := currentReq()
+	req.Logger = req.Logger.With().Str("topic", cfg.Topic).Str("message_id", msg.ID).Int("attempt", msg.Attempt).Logger()
+
+	defer func() {
+		if p := recover(); p != nil {
+			metrics.Panic(cfg.Service, cfg.Name)
+			err = errs.B().Code(errs.Internal).Msgf("panic handling message: %v", p).Err()
+		}
+		FinishRequest(nil, err)
+	}()
+	return cfg.Handler(ctx, payload)
+}
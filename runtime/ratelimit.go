@@ -0,0 +1,121 @@
+package runtime
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/ratelimit"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// newRateLimitStore creates the store for rate limit state.
+func (srv *Server) newRateLimitStore() ratelimit.Store {
+	switch srv.cfg.RateLimitStore {
+	case "redis":
+		if srv.redis == nil {
+			srv.logger.Fatal().Msg("rate limiting: redis store configured but no redis server")
+		}
+		return ratelimit.NewRedisStore(srv.redis, "encore:ratelimit:")
+	case "", "memory":
+		return ratelimit.NewMemoryStore()
+	default:
+		srv.logger.Fatal().Str("store", srv.cfg.RateLimitStore).Msg("rate limiting: unknown store")
+		return nil
+	}
+}
+
+// rateLimit returns a middleware that rate limits calls to the endpoint,
+// or nil if the endpoint has no rate limit or is rate limited by the
+// authenticated user, which rateLimitByAuth handles.
+func (srv *Server) rateLimit(endpoint *config.Endpoint) middleware.Middleware {
+	cfg := endpoint.RateLimit
+	if cfg == nil || cfg.Rate <= 0 || byAuth(cfg) {
+		return nil
+	}
+	keyFunc := cfg.KeyFunc
+	if keyFunc == nil {
+		keyFunc = srv.ipKey
+	}
+	return srv.rateLimiter(toLimit(cfg), keyFunc)
+}
+
+// rateLimitByAuth returns a middleware that rate limits calls to the
+// endpoint by the authenticated user, or nil if the endpoint is not
+// rate limited by it. It runs after authentication, since the
+// credentials in the request are not to be trusted before then.
+func (srv *Server) rateLimitByAuth(endpoint *config.Endpoint) middleware.Middleware {
+	cfg := endpoint.RateLimit
+	if cfg == nil || cfg.Rate <= 0 || !byAuth(cfg) {
+		return nil
+	}
+	return srv.rateLimiter(toLimit(cfg), srv.authKey)
+}
+
+func byAuth(cfg *config.RateLimit) bool {
+	return cfg.KeyFunc == nil && cfg.Key == config.RateLimitByAuth
+}
+
+// rateLimiter returns a middleware that rate limits calls by the key
+// computed by keyFunc.
+func (srv *Server) rateLimiter(limit ratelimit.Limit, keyFunc func(req *http.Request) string) middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			key := req.Service + "." + req.Endpoint + ":" + keyFunc(req.HTTP)
+			if srv.takeToken(w, req, key, limit) {
+				next(w, req)
+			}
+		}
+	}
+}
+
+// takeToken takes a token from the bucket for key and sets the
+// rate limit headers. If the limit is exceeded it responds with
+// 429 Too Many Requests and reports false.
+func (srv *Server) takeToken(w http.ResponseWriter, req *middleware.Request, key string, limit ratelimit.Limit) bool {
+	res, err := srv.rateStore.Take(req.HTTP.Context(), key, limit)
+	if err != nil {
+		// Fail open; an unavailable store should not take down the endpoint.
+		srv.logger.Error().Err(err).Str("service", req.Service).Str("endpoint", req.Endpoint).
+			Msg("rate limiting failed")
+		return true
+	}
+
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))))
+	if !res.Allowed {
+		metrics.RateLimited(req.Service, req.Endpoint)
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+		writeErr(w, http.StatusTooManyRequests, errs.ResourceExhausted.String(), "rate limit exceeded")
+		return false
+	}
+	return true
+}
+
+// toLimit converts a rate limit configuration to a token bucket limit.
+func toLimit(cfg *config.RateLimit) ratelimit.Limit {
+	limit := ratelimit.Limit{Rate: cfg.Rate, Burst: cfg.Burst}
+	if limit.Burst <= 0 {
+		limit.Burst = int(math.Ceil(cfg.Rate))
+	}
+	return limit
+}
+
+// ipKey rate limits by the client's IP address.
+func (srv *Server) ipKey(req *http.Request) string {
+	return srv.clientIP(req).String()
+}
+
+// authKey rate limits by the authenticated user ID,
+// falling back to the IP address for unauthenticated requests.
+func (srv *Server) authKey(req *http.Request) string {
+	if auth := GetCallOptions(req.Context()).Auth; auth != nil && auth.UID != "" {
+		return "uid:" + string(auth.UID)
+	}
+	return srv.ipKey(req)
+}
@@ -0,0 +1,57 @@
+package runtime
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/logring"
+)
+
+const defaultRecentLogsSize = 1000
+
+// serveRecentLogs responds with the recent log records
+// matching the filters given as query parameters.
+func (srv *Server) serveRecentLogs(w http.ResponseWriter, req *http.Request) {
+	cfg := srv.cfg.RecentLogs
+	if cfg == nil || srv.recentLogs == nil {
+		http.Error(w, "unknown internal endpoint: __encore.RecentLogs", http.StatusNotFound)
+		return
+	}
+	if !checkToken(w, req, cfg.Token) {
+		return
+	}
+
+	q := req.URL.Query()
+	f := logring.Filter{
+		MinLevel: q.Get("level"),
+		Service:  q.Get("service"),
+		Endpoint: q.Get("endpoint"),
+	}
+	if f.MinLevel != "" && !logring.ValidLevel(f.MinLevel) {
+		writeErr(w, http.StatusBadRequest, errs.InvalidArgument.String(), "invalid level")
+		return
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeErr(w, http.StatusBadRequest, errs.InvalidArgument.String(), "invalid limit")
+			return
+		}
+		f.Limit = n
+	}
+
+	recs := srv.recentLogs.Records(f)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("["))
+	for i, rec := range recs {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		w.Write([]byte("\n"))
+		w.Write(bytes.TrimSpace(rec))
+	}
+	w.Write([]byte("\n]\n"))
+}
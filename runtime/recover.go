@@ -0,0 +1,42 @@
+package runtime
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/middleware"
+)
+
+// recoverPanics is a middleware that recovers panics in the handler,
+// logging and reporting them and responding with an internal error.
+func (srv *Server) recoverPanics(next middleware.Handler) middleware.Handler {
+	return func(w middleware.ResponseWriter, req *middleware.Request) {
+		defer func() {
+			if e := recover(); e != nil {
+				if e == http.ErrAbortHandler {
+					// Used to abort the response; let net/http handle it.
+					panic(e)
+				}
+
+				metrics.Panic(req.Service, req.Endpoint)
+				reportPanic(req, e)
+				srv.logger.Error().
+					Str("service", req.Service).
+					Str("endpoint", req.Endpoint).
+					Str("request_id", RequestID(req.HTTP.Context())).
+					Str("panic", fmt.Sprint(e)).
+					Bytes("stack", debug.Stack()).
+					Msg("request panicked")
+
+				// We can only respond if the handler has not already started writing.
+				if w.Status() == 0 {
+					writeErr(w, http.StatusInternalServerError, errs.Internal.String(), "internal error")
+				}
+			}
+		}()
+		next(w, req)
+	}
+}
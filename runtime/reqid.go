@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"context"
+
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/types/uuid"
+)
+
+// requestIDHeader is the header used to pass request ids.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen is the maximum length of an inbound request id
+// for it to be honored.
+const maxRequestIDLen = 128
+
+// requestID is a middleware that assigns a request id to the request,
+// honoring an inbound X-Request-ID header. The id is added to the
+// request context and echoed in the response.
+func requestID(next middleware.Handler) middleware.Handler {
+	return func(w middleware.ResponseWriter, req *middleware.Request) {
+		id := req.HTTP.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		req.HTTP = req.HTTP.WithContext(context.WithValue(req.HTTP.Context(), requestIDKey, id))
+		next(w, req)
+	}
+}
+
+// RequestID reports the request id associated with ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
+
+// validRequestID reports whether id is a valid inbound request id:
+// non-empty, not too long, and consisting of printable ASCII characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
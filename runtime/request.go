@@ -12,6 +12,7 @@ import (
 
 	"runtime.encore.dev/beta/errs"
 	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/otel"
 	"runtime.encore.dev/internal/stack"
 	"runtime.encore.dev/runtime/config"
 
@@ -51,8 +52,9 @@ type SpanID [8]byte
 type Type byte
 
 const (
-	RPCCall     Type = 0x01
-	AuthHandler Type = 0x02
+	RPCCall       Type = 0x01
+	AuthHandler   Type = 0x02
+	PubSubMessage Type = 0x03
 )
 
 type Request struct {
@@ -62,11 +64,15 @@ type Request struct {
 	UID      UID
 	AuthData interface{}
 
-	Service  string
-	Endpoint string
-	Start    time.Time
-	Logger   zerolog.Logger
-	Traced   bool
+	Service   string
+	Endpoint  string
+	RequestID string
+	Start     time.Time
+	Logger    zerolog.Logger
+	Traced    bool
+
+	span     *otel.Span // OpenTelemetry span, or nil
+	ownsSpan bool       // whether span ends with the request
 }
 
 type RequestData struct {
@@ -79,6 +85,10 @@ type RequestData struct {
 	UID             UID
 	AuthData        interface{}
 	RequireAuth     bool
+
+	// Payload is the decoded request payload, or nil. It is validated
+	// before the request begins; see ValidateRequest.
+	Payload interface{}
 }
 
 func BeginRequest(ctx context.Context, data RequestData) error {
@@ -86,7 +96,7 @@ func BeginRequest(ctx context.Context, data RequestData) error {
 	if err != nil {
 		return err
 	}
-	return beginReq(ctx, spanID, data)
+	return beginReq(ctx, spanID, data, nil)
 }
 
 func FinishRequest(outputs [][]byte, err error) {
@@ -100,6 +110,8 @@ func FinishHTTPRequest(outputs [][]byte, err error, httpStatus int) {
 type Call struct {
 	CallID uint64
 	SpanID SpanID
+
+	span *otel.Span // client span of the call, or nil
 }
 
 type CallParams struct {
@@ -129,13 +141,21 @@ func BeginCall(params CallParams) (*Call, error) {
 		encoreTraceEvent(CallStart, tb.Buf())
 	}
 
-	return &Call{
+	c := &Call{
 		CallID: callID,
 		SpanID: spanID,
-	}, nil
+	}
+	if req, _, ok := currentReq(); ok && req.span != nil {
+		c.span = tracer.Start(req.span.SpanContext(), params.Service+"."+params.Endpoint, otel.Client,
+			otel.String("encore.service", params.Service),
+			otel.String("encore.endpoint", params.Endpoint),
+		)
+	}
+	return c, nil
 }
 
 func (c *Call) Finish(err error) {
+	c.span.End(err)
 	if g := encoreGetG(); g != nil && g.req != nil && g.req.data.Traced {
 		tb := NewTraceBuf(8 + 4 + 4 + 4)
 		tb.UVarint(c.CallID)
@@ -153,7 +173,7 @@ func (c *Call) Finish(err error) {
 }
 
 func (c *Call) BeginReq(ctx context.Context, data RequestData) error {
-	return beginReq(ctx, c.SpanID, data)
+	return beginReq(ctx, c.SpanID, data, c.span)
 }
 
 func (c *Call) FinishReq(outputs [][]byte, err error) {
@@ -208,7 +228,7 @@ func (ac *AuthCall) Finish(uid UID, err error) {
 }
 
 func (ac *AuthCall) BeginReq(ctx context.Context, data RequestData) error {
-	return beginReq(ctx, ac.SpanID, data)
+	return beginReq(ctx, ac.SpanID, data, nil)
 }
 
 func (ac *AuthCall) FinishReq(outputs [][]byte, err error) {
@@ -262,21 +282,25 @@ func CopyInputs(inputs [][]byte, outputs []interface{}) error {
 	return nil
 }
 
-func beginReq(ctx context.Context, spanID SpanID, data RequestData) error {
+func beginReq(ctx context.Context, spanID SpanID, data RequestData, parentSpan *otel.Span) error {
 	req := &Request{
-		Type:     data.Type,
-		SpanID:   spanID,
-		Service:  data.Service,
-		Endpoint: data.Endpoint,
-		Start:    time.Now(),
-		UID:      data.UID,
-		AuthData: data.AuthData,
+		Type:      data.Type,
+		SpanID:    spanID,
+		Service:   data.Service,
+		Endpoint:  data.Endpoint,
+		RequestID: RequestID(ctx),
+		Start:     time.Now(),
+		UID:       data.UID,
+		AuthData:  data.AuthData,
 	}
 
 	if prev, _, ok := currentReq(); ok {
 		req.UID = prev.UID
 		req.AuthData = prev.AuthData
 		req.ParentID = prev.SpanID
+		if req.RequestID == "" {
+			req.RequestID = prev.RequestID
+		}
 		encoreClearReq()
 	}
 
@@ -302,11 +326,24 @@ func beginReq(ctx context.Context, spanID SpanID, data RequestData) error {
 		}
 	}
 
+	if data.Payload != nil {
+		if err := ValidateRequest(data.Payload); err != nil {
+			return err
+		}
+	}
+
+	req.span, req.ownsSpan = reqSpan(ctx, parentSpan, req)
 	encoreBeginReq(spanID, req, true /* always trace */)
 
 	logCtx := RootLogger.With().
 		Str("service", req.Service).
 		Str("endpoint", req.Endpoint)
+	if req.RequestID != "" {
+		logCtx = logCtx.Str("request_id", req.RequestID)
+	}
+	if sc := req.span.SpanContext(); sc.IsValid() {
+		logCtx = logCtx.Str("trace_id", sc.TraceID.String()).Str("span_id", sc.SpanID.String())
+	}
 	if req.UID != "" {
 		logCtx = logCtx.Str("uid", string(req.UID))
 	}
@@ -358,6 +395,15 @@ func finishReq(outputs [][]byte, err error, httpStatus int) {
 				ev = ev.Interface(k, v)
 			}
 			ev.Str("error", e.ErrorMessage()).Str("code", e.Code.String()).Msg("request failed")
+
+			status := httpStatus
+			if status == 0 {
+				status = e.Code.HTTPStatus()
+			}
+			if status >= 400 {
+				metrics.HandlerError(req.Service, req.Endpoint, e.Code.String(), statusClass(status))
+			}
+			reportError(req, err, httpStatus)
 		}
 	}
 
@@ -379,6 +425,10 @@ func finishReq(outputs [][]byte, err error, httpStatus int) {
 		encoreTraceEvent(RequestEnd, tb.Buf())
 	}
 
+	if req.ownsSpan {
+		req.span.End(err)
+	}
+
 	dur := time.Since(req.Start)
 	switch req.Type {
 	case AuthHandler:
@@ -408,7 +458,14 @@ type CallOptions struct {
 
 type ctxKey string
 
-const callOptionsKey ctxKey = "call"
+const (
+	callOptionsKey ctxKey = "call"
+	requestIDKey   ctxKey = "reqid"
+	clientIDKey    ctxKey = "clientid"
+	spanKey        ctxKey = "span"
+	httpSpanKey    ctxKey = "httpspan"
+	loggerKey      ctxKey = "logger"
+)
 
 func WithCallOptions(ctx context.Context, opts *CallOptions) context.Context {
 	return context.WithValue(ctx, callOptionsKey, opts)
@@ -0,0 +1,123 @@
+package runtime
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/respcache"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+const (
+	defaultResponseCacheEntries = 10000
+	defaultResponseCacheBytes   = 64 << 20
+	defaultResponseCacheTTL     = time.Minute
+)
+
+// respCache is the cache of responses, set by Setup.
+var respCache *respcache.Cache
+
+func newResponseCache(cfg config.ResponseCache) *respcache.Cache {
+	entries, bytes := cfg.MaxEntries, cfg.MaxBytes
+	if entries <= 0 {
+		entries = defaultResponseCacheEntries
+	}
+	if bytes <= 0 {
+		bytes = defaultResponseCacheBytes
+	}
+	return respcache.New(entries, bytes)
+}
+
+// responseCache returns a middleware that caches the endpoint's
+// responses, or nil if it is not configured to.
+//
+// Successful responses to GET requests are cached by path, query
+// string and the caller's identity, unless they set cookies or have
+// "Cache-Control: no-store". Cached responses are served with the
+// X-Cache header set to HIT and an Age header. Requests with
+// "Cache-Control: no-cache" are not served from the cache, but
+// their responses are cached.
+//
+// It runs after authentication, so the caller's identity is known.
+func (srv *Server) responseCache(endpoint *config.Endpoint) middleware.Middleware {
+	cfg := endpoint.ResponseCache
+	if cfg == nil || endpoint.Raw {
+		return nil
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultResponseCacheTTL
+	}
+	maxSize := srv.cfg.ResponseCache.MaxBytes
+	if maxSize <= 0 {
+		maxSize = defaultResponseCacheBytes
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			if req.HTTP.Method != "GET" {
+				next(w, req)
+				return
+			}
+			group := req.Service + "." + req.Endpoint
+			identity := "anonymous"
+			if auth := GetCallOptions(req.HTTP.Context()).Auth; auth != nil && auth.UID != "" {
+				identity = "uid:" + string(auth.UID)
+			}
+			key := hashHex(group, identity, req.HTTP.URL.RequestURI())
+
+			result := "miss"
+			if strings.Contains(req.HTTP.Header.Get("Cache-Control"), "no-cache") {
+				result = "bypass"
+			} else if e := respCache.Get(key); e != nil {
+				metrics.ResponseCacheRequest(req.Service, req.Endpoint, "hit")
+				h := w.Header()
+				for k, vs := range e.Header {
+					h[k] = vs
+				}
+				h.Set("X-Cache", "HIT")
+				h.Set("Age", strconv.Itoa(int(time.Since(e.Created).Seconds())))
+				w.WriteHeader(e.Status)
+				w.Write(e.Body)
+				return
+			}
+			metrics.ResponseCacheRequest(req.Service, req.Endpoint, result)
+
+			w.Header().Set("X-Cache", "MISS")
+			before := w.Header().Clone()
+			rw := &recordWriter{ResponseWriter: w, max: int(maxSize)}
+			next(rw, req)
+
+			status := rw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status != http.StatusOK || rw.tooLarge {
+				return
+			}
+			header := headerDiff(before, w.Header())
+			if header.Get("Set-Cookie") != "" || strings.Contains(header.Get("Cache-Control"), "no-store") {
+				return
+			}
+			respCache.Set(key, group, req.HTTP.URL.Path, &respcache.Entry{
+				Status:  status,
+				Header:  header,
+				Body:    rw.buf,
+				Created: time.Now(),
+			}, ttl)
+		}
+	}
+}
+
+// InvalidateResponses removes the cached responses of an endpoint,
+// such as after a mutating endpoint changes the data it returns.
+// If path is non-empty only the responses for it are removed.
+func InvalidateResponses(service, endpoint, path string) {
+	if respCache != nil {
+		respCache.Invalidate(service+"."+endpoint, path)
+	}
+}
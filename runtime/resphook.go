@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// responseHooks returns a middleware that runs the server's and the
+// service's response hooks on the buffered response of the endpoint,
+// or nil if there are none or the endpoint is raw.
+//
+// It runs inside the compression and ETag middleware, so hooks see
+// uncompressed bodies and ETags are computed from transformed ones.
+func (srv *Server) responseHooks(svc *config.Service, endpoint *config.Endpoint) middleware.Middleware {
+	var hooks []middleware.ResponseHook
+	hooks = append(hooks, srv.cfg.ResponseHooks...)
+	hooks = append(hooks, svc.ResponseHooks...)
+	if len(hooks) == 0 || endpoint.Raw {
+		return nil
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			hw := &hookWriter{ResponseWriter: w}
+			next(hw, req)
+			if hw.streaming {
+				return
+			}
+
+			resp := &middleware.Response{Status: hw.status, Header: w.Header(), Body: hw.buf}
+			if resp.Status == 0 {
+				resp.Status = http.StatusOK
+			}
+			if err := runResponseHooks(hooks, req, resp); err != nil {
+				LoggerFromContext(req.HTTP.Context()).Error().Err(err).Msg("response hook failed")
+				w.Header().Del("Content-Length")
+				writeErr(w, http.StatusInternalServerError, errs.Internal.String(), "could not transform response")
+				return
+			}
+			if resp.Header.Get("Content-Length") != "" && req.HTTP.Method != "HEAD" {
+				resp.Header.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+			}
+			w.WriteHeader(resp.Status)
+			w.Write(resp.Body)
+		}
+	}
+}
+
+// runResponseHooks runs hooks in order, recovering panics as errors.
+func runResponseHooks(hooks []middleware.ResponseHook, req *middleware.Request, resp *middleware.Response) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	for _, hook := range hooks {
+		if err := hook(req, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookWriter buffers a response for the response hooks.
+// If the response is flushed it is streamed instead,
+// without running the hooks.
+type hookWriter struct {
+	middleware.ResponseWriter
+	status    int
+	written   int64
+	buf       []byte
+	streaming bool // whether writes go to the underlying writer
+}
+
+func (w *hookWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written += int64(len(b))
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
+
+// Flush switches to streaming the response, writing what has been buffered.
+func (w *hookWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.streaming {
+		w.streaming = true
+		w.ResponseWriter.WriteHeader(w.status)
+		if len(w.buf) > 0 {
+			w.ResponseWriter.Write(w.buf)
+			w.buf = nil
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *hookWriter) Status() int    { return w.status }
+func (w *hookWriter) Written() int64 { return w.written }
@@ -0,0 +1,168 @@
+package runtime
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"runtime.encore.dev/runtime/config"
+)
+
+// wildcardMethod is an internal method name we register wildcard methods under.
+const wildcardMethod = "__ENCORE_WILDCARD__"
+
+// routeTable routes requests to endpoints.
+type routeTable struct {
+	router  *httprouter.Router
+	methods []string // registered methods, excluding wildcardMethod
+
+	// preflight routes CORS preflight requests.
+	// preflightPaths tracks the paths registered with it.
+	preflight      *httprouter.Router
+	preflightPaths map[string]bool
+}
+
+func newRouteTable() *routeTable {
+	r := httprouter.New()
+	r.HandleOPTIONS = false
+	r.RedirectFixedPath = false
+	r.RedirectTrailingSlash = false
+	return &routeTable{
+		router:         r,
+		preflight:      httprouter.New(),
+		preflightPaths: make(map[string]bool),
+	}
+}
+
+func (rt *routeTable) handle(methods []string, path string, h httprouter.Handle) {
+	for _, m := range methods {
+		if m == "*" {
+			m = wildcardMethod
+		} else if !containsMethod(rt.methods, m) {
+			rt.methods = append(rt.methods, m)
+		}
+		rt.router.Handle(m, path, h)
+	}
+}
+
+// lookup looks up the handler for the given method and path,
+// falling back to wildcard routes.
+func (rt *routeTable) lookup(method, path string) (httprouter.Handle, httprouter.Params) {
+	h, p, _ := rt.router.Lookup(method, path)
+	if h == nil {
+		h, p, _ = rt.router.Lookup(wildcardMethod, path)
+	}
+	return h, p
+}
+
+// hasPath reports whether any route matches path, regardless of method.
+func (rt *routeTable) hasPath(path string) bool {
+	if h, _, _ := rt.router.Lookup(wildcardMethod, path); h != nil {
+		return true
+	}
+	return len(rt.allowedMethods(path)) > 0
+}
+
+// allowedMethods reports the HTTP methods that are
+// registered for the given path.
+func (rt *routeTable) allowedMethods(path string) []string {
+	var allow []string
+	for _, m := range rt.methods {
+		if h, _, _ := rt.router.Lookup(m, path); h != nil {
+			allow = append(allow, m)
+		}
+	}
+	return allow
+}
+
+// hostTable is a route table for endpoints restricted to a host pattern.
+type hostTable struct {
+	// pattern is the host pattern, either an exact host name
+	// or a wildcard subdomain pattern like "*.example.com".
+	pattern string
+	*routeTable
+}
+
+// routeTables returns the route tables to register an endpoint
+// restricted to the given host patterns in, creating them as necessary.
+func (srv *Server) routeTables(hosts []string) []*routeTable {
+	if len(hosts) == 0 {
+		return []*routeTable{srv.routes}
+	}
+
+	var tables []*routeTable
+outer:
+	for _, pattern := range hosts {
+		pattern = strings.ToLower(pattern)
+		for _, ht := range srv.hosts {
+			if ht.pattern == pattern {
+				tables = append(tables, ht.routeTable)
+				continue outer
+			}
+		}
+		ht := &hostTable{pattern: pattern, routeTable: newRouteTable()}
+		srv.hosts = append(srv.hosts, ht)
+		tables = append(tables, ht.routeTable)
+	}
+	return tables
+}
+
+// routesFor returns the route table to use for req.
+// Host-specific routes take precedence over routes
+// that are not restricted to any host.
+func (srv *Server) routesFor(req *http.Request) *routeTable {
+	if len(srv.hosts) == 0 {
+		return srv.routes
+	}
+	host := strings.ToLower(req.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, ht := range srv.hosts {
+		if matchHost(ht.pattern, host) && ht.hasPath(req.URL.Path) {
+			return ht.routeTable
+		}
+	}
+	return srv.routes
+}
+
+// matchHost reports whether host matches the host pattern.
+func matchHost(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		suffix := pattern[1:]
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+// routeInfo describes a registered endpoint.
+type routeInfo struct {
+	Service  string        `json:"service"`
+	Endpoint string        `json:"endpoint"`
+	Methods  []string      `json:"methods"`
+	Path     string        `json:"path"`
+	Version  int           `json:"version,omitempty"`
+	Hosts    []string      `json:"hosts"`
+	Access   config.Access `json:"access"`
+	Raw      bool          `json:"raw"`
+}
+
+// listRoutes responds with the registered endpoints.
+func (srv *Server) listRoutes(w http.ResponseWriter, req *http.Request) {
+	if srv.cfg.RoutesToken == "" {
+		http.Error(w, "unknown internal endpoint: __encore.Routes", http.StatusNotFound)
+		return
+	}
+	if !checkToken(w, req, srv.cfg.RoutesToken) {
+		return
+	}
+	data, err := json.MarshalIndent(srv.infos, "", "  ")
+	if err != nil {
+		http.Error(w, "could not marshal routes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,66 @@
+package runtime
+
+import (
+	"net/http"
+	"strconv"
+
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// Default security header values, for APIs that do not serve HTML.
+const (
+	defaultContentTypeOptions    = "nosniff"
+	defaultFrameOptions          = "DENY"
+	defaultReferrerPolicy        = "no-referrer"
+	defaultContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+)
+
+// securityHeaders returns a middleware that adds the configured
+// security headers to responses, or nil if there are none.
+// The headers are added before calling the handler, so the
+// handler can override them.
+func (srv *Server) securityHeaders(endpoint *config.Endpoint) middleware.Middleware {
+	cfg := srv.cfg.SecurityHeaders
+	if endpoint.SecurityHeaders != nil {
+		cfg = endpoint.SecurityHeaders
+	}
+	if cfg == nil {
+		return nil
+	}
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			setSecurityHeaders(w.Header(), cfg)
+			next(w, req)
+		}
+	}
+}
+
+func setSecurityHeaders(h http.Header, cfg *config.SecurityHeaders) {
+	if cfg.HSTSMaxAge > 0 {
+		v := "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge.Seconds()), 10)
+		if cfg.HSTSIncludeSubdomains {
+			v += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			v += "; preload"
+		}
+		h.Set("Strict-Transport-Security", v)
+	}
+	setHeader(h, "X-Content-Type-Options", cfg.ContentTypeOptions, defaultContentTypeOptions)
+	setHeader(h, "X-Frame-Options", cfg.FrameOptions, defaultFrameOptions)
+	setHeader(h, "Referrer-Policy", cfg.ReferrerPolicy, defaultReferrerPolicy)
+	setHeader(h, "Content-Security-Policy", cfg.ContentSecurityPolicy, defaultContentSecurityPolicy)
+}
+
+// setHeader sets the header key to val, or def if val is empty.
+// It does not set the header if val is "-".
+func setHeader(h http.Header, key, val, def string) {
+	switch val {
+	case "-":
+		return
+	case "":
+		val = def
+	}
+	h.Set(key, val)
+}
@@ -3,9 +3,15 @@ package runtime
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"sync"
 	"time"
+
+	"runtime.encore.dev/internal/health"
+	secretstore "runtime.encore.dev/internal/secrets"
+	"runtime.encore.dev/runtime/config"
 )
 
 func LoadSecret(key string) string {
@@ -33,3 +39,74 @@ func loadSecrets() {
 	}
 	secrets = s
 }
+
+// secretStore holds the secrets declared in the configuration,
+// or is nil if there are none. It is set by Setup.
+var secretStore *secretstore.Store
+
+func newSecretStore(decls []*config.Secret) *secretstore.Store {
+	sources := make([]secretstore.Source, len(decls))
+	for i, d := range decls {
+		sources[i] = secretstore.Source{Name: d.Name, Env: d.Env, File: d.File, Required: d.Required, External: d.Vault != nil}
+	}
+	return secretstore.NewStore(sources)
+}
+
+// checkSecrets loads the declared secrets, logging the required ones
+// that are missing, and registers a readiness check failing while
+// any are.
+func (srv *Server) checkSecrets() {
+	if secretStore == nil {
+		return
+	}
+	check := func(ctx context.Context) error {
+		if missing := secretStore.Load(); len(missing) > 0 {
+			return fmt.Errorf("missing required secrets: %s", strings.Join(missing, ", "))
+		}
+		return nil
+	}
+	if err := check(context.Background()); err != nil {
+		srv.logger.Error().Err(err).Msg("secrets: could not load secrets")
+	}
+	health.Register("secrets", health.Readiness, check)
+}
+
+// Secret returns the value of the declared secret with the given
+// name, reporting whether it is loaded.
+func Secret(name string) (string, bool) {
+	if secretStore == nil {
+		return "", false
+	}
+	return secretStore.Get(name)
+}
+
+// OnSecretChange registers fn to be called when the value of
+// the declared secret with the given name changes, such as when
+// Vault rotates it.
+func OnSecretChange(name string, fn func()) {
+	if secretStore != nil {
+		secretStore.OnChange(name, fn)
+	}
+}
+
+// RedactSecrets replaces the values of the declared secrets in text.
+func RedactSecrets(text string) string {
+	if secretStore == nil {
+		return text
+	}
+	return secretStore.Redact(text)
+}
+
+// secretsWriter redacts secret values from log lines
+// before writing them to w.
+type secretsWriter struct {
+	w     io.Writer
+	store *secretstore.Store
+}
+
+func (w *secretsWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.store.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -1,122 +1,477 @@
 package runtime
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
-	"github.com/julienschmidt/httprouter"
 	"github.com/prometheus/common/expfmt"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
 
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/cron"
+	"runtime.encore.dev/internal/health"
+	"runtime.encore.dev/internal/idempotency"
+	"runtime.encore.dev/internal/logring"
 	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/pagination"
+	"runtime.encore.dev/internal/ratelimit"
+	"runtime.encore.dev/internal/redis"
+	"runtime.encore.dev/internal/upload"
 	"runtime.encore.dev/runtime/config"
 )
 
 type Server struct {
-	logger zerolog.Logger
-	router *httprouter.Router
+	cfg     *config.ServerConfig
+	logger  zerolog.Logger
+	routes  *routeTable
+	hosts   []*hostTable // host-specific routes
+	infos   []*routeInfo // registered endpoints
+	httpsrv *http.Server
+	h3srv   config.HTTP3Server // or nil
+	metsrv  *http.Server       // standalone metrics server, or nil
+
+	// grpcsrv serves gRPC requests; it is nil if gRPC is disabled.
+	// grpcMethods are the endpoints it exposes, by full method name.
+	grpcsrv     *grpc.Server
+	grpcMethods map[string]*grpcMethod
+
+	exporters  []config.MetricsExporter
+	stopExport chan struct{} // closed to stop exporting metrics
+	exportDone chan struct{} // closed when exporting has stopped
+
+	trustedProxies []*net.IPNet
+
+	redis     *redis.Client // or nil if not configured
+	rateStore ratelimit.Store
+	idemStore idempotency.Store // or nil if idempotency keys are not honored
+
+	// subs are the pub/sub subscriptions handled by the server.
+	// stopSubs stops them; it is nil if they have not started.
+	subs     []*subscription
+	stopSubs context.CancelFunc
+
+	// cronJobs are the cron jobs run by the server, calling the
+	// endpoints in cronTargets. stopCron stops them; it is nil
+	// if they have not started.
+	cronJobs    []*cronJob
+	cronTargets map[string]*cronTarget
+	cronStore   cron.Store
+	stopCron    context.CancelFunc
+	cronWG      sync.WaitGroup
+
+	// openapiDoc is the OpenAPI document, built on first request.
+	openapiOnce sync.Once
+	openapiDoc  []byte
+	openapiErr  error
+
+	// recentLogs keeps recent log records; it is nil if disabled.
+	recentLogs *logring.Ring
+
+	// auditLogger writes audit records; it is nil if audit logging is disabled.
+	auditLogger *zerolog.Logger
+
+	// compressor compresses responses; it is nil if compression is disabled.
+	compressor *compressor
+
+	// inflight limits the number of concurrent requests.
+	// It is nil if there is no limit.
+	inflight chan struct{}
+
+	// started is set to 1 when dependencies have initialized,
+	// and draining is set to 1 when shutdown begins.
+	started      int32
+	draining     int32
+	shutdownOnce sync.Once
+	shutdownDone chan struct{} // closed when shutdown is complete
 }
 
-// wildcardMethod is an internal method name we register wildcard methods under.
-const wildcardMethod = "__ENCORE_WILDCARD__"
+func (srv *Server) handleRPC(svc *config.Service, endpoint *config.Endpoint) {
+	path := endpointPath(endpoint)
+	srv.logger.Info().Str("service", svc.Name).Str("endpoint", endpoint.Name).Str("path", path).Msg("registered endpoint")
+	metrics.Endpoint(svc.Name, endpoint.Name)
+	cors := srv.corsPolicy(svc)
+	h := srv.endpointHandler(svc, endpoint, cors)
+	srv.registerGRPC(svc, endpoint, h)
+	srv.registerCronTarget(svc, endpoint, h)
 
-func (srv *Server) handleRPC(service string, endpoint *config.Endpoint) {
-	srv.logger.Info().Str("service", service).Str("endpoint", endpoint.Name).Str("path", endpoint.Path).Msg("registered endpoint")
-	for _, m := range endpoint.Methods {
-		if m == "*" {
-			m = wildcardMethod
+	hosts := endpoint.Hosts
+	if len(hosts) == 0 {
+		hosts = svc.Hosts
+	}
+	srv.infos = append(srv.infos, &routeInfo{
+		Service:  svc.Name,
+		Endpoint: endpoint.Name,
+		Methods:  endpoint.Methods,
+		Path:     path,
+		Version:  endpoint.Version,
+		Hosts:    hosts,
+		Access:   endpoint.Access,
+		Raw:      endpoint.Raw,
+	})
+	for _, rt := range srv.routeTables(hosts) {
+		rt.handle(endpoint.Methods, path, h)
+		if cors != nil {
+			rt.handlePreflight(path, cors)
 		}
-		srv.router.Handle(m, endpoint.Path, endpoint.Handler)
 	}
 }
 
 func (srv *Server) ListenAndServe() error {
-	ln, err := net.Listen("tcp", "localhost:8000")
+	if err := srv.warmUp(); err != nil {
+		return err
+	}
+
+	t := srv.cfg.Timeouts
+	srv.httpsrv = &http.Server{
+		Handler:           http.HandlerFunc(srv.handler),
+		ReadTimeout:       timeout(t.Read, 0),
+		ReadHeaderTimeout: timeout(t.ReadHeader, defaultReadHeaderTimeout),
+		WriteTimeout:      timeout(t.Write, 0),
+		IdleTimeout:       timeout(t.Idle, defaultIdleTimeout),
+	}
+	if srv.cfg.SlowClients != nil {
+		srv.httpsrv.ConnContext = withConn
+	}
+	if srv.cfg.TLS != nil {
+		var err error
+		if srv.httpsrv.TLSConfig, err = srv.tlsConfig(); err != nil {
+			return err
+		}
+	}
+	if err := srv.configureHTTP2(); err != nil {
+		return err
+	}
+
+	ln, err := srv.listen()
 	if err != nil {
 		return err
 	}
-	httpsrv := &http.Server{
-		Handler: http.HandlerFunc(srv.handler),
+	srv.logger.Info().Str("addr", ln.Addr().String()).Msg("listening for incoming requests")
+	if srv.httpsrv.Handler, err = srv.listenHTTP3(srv.httpsrv.Handler); err != nil {
+		ln.Close()
+		return err
+	}
+	if srv.cfg.TLS != nil {
+		ln = tls.NewListener(ln, srv.httpsrv.TLSConfig)
+	}
+
+	if err := srv.serveMetrics(); err != nil {
+		ln.Close()
+		return err
 	}
-	return httpsrv.Serve(ln)
+	if err := srv.serveGRPC(); err != nil {
+		ln.Close()
+		return err
+	}
+
+	go srv.runStartup()
+	go srv.shutdownOnSignal()
+	if err := srv.httpsrv.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+	<-srv.shutdownDone
+	return nil
+}
+
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+// timeout returns the timeout to use given the configured value d.
+// If d is zero it returns def, and if d is negative it returns 0
+// to disable the timeout.
+func timeout(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	} else if d < 0 {
+		return 0
+	}
+	return d
 }
 
 func (srv *Server) handler(w http.ResponseWriter, req *http.Request) {
+	if srv.grpcsrv != nil && isGRPC(req) {
+		srv.grpcsrv.ServeHTTP(w, req)
+		return
+	}
+	if srv.cfg.Connect {
+		if m := srv.grpcMethods[req.URL.Path]; m != nil {
+			if proto := connectProtocol(req); proto != "" && req.Method == "POST" {
+				srv.serveConnect(w, req, m, proto)
+				return
+			} else if isPreflight(req) {
+				// Handle preflight requests as for the endpoint's path.
+				if h, p, _ := srv.routesFor(req).preflight.Lookup("OPTIONS", m.path); h != nil {
+					h(w, req, p)
+					return
+				}
+			}
+		}
+	}
+
 	ep := strings.TrimPrefix(req.URL.Path, "/")
+	switch ep {
+	case "__encore/healthz":
+		srv.serveHealth(w, req, health.Liveness)
+		return
+	case "__encore/readyz":
+		srv.serveHealth(w, req, health.Readiness)
+		return
+	case "__encore/csrf":
+		if srv.cfg.CSRF != nil {
+			srv.serveCSRFToken(w, req)
+			return
+		}
+	}
+	if strings.HasPrefix(ep, objectsPath) {
+		srv.serveObject(w, req, ep[len(objectsPath):])
+		return
+	}
 	if strings.HasPrefix(ep, "__encore.") {
 		api := ep[len("__encore."):]
-		switch api {
-		case "ScrapeMetrics":
+		switch {
+		case api == "ScrapeMetrics":
+			if ml := srv.cfg.MetricsListener; ml != nil && ml.DisableAppRoute {
+				http.Error(w, "unknown internal endpoint: "+ep, http.StatusNotFound)
+				return
+			}
 			srv.scrapeMetrics(w, req)
+		case api == "Routes":
+			srv.listRoutes(w, req)
+		case api == "Stats":
+			srv.serveStats(w, req)
+		case api == "SetLogLevel":
+			srv.setLogLevel(w, req)
+		case api == "RecentLogs":
+			srv.serveRecentLogs(w, req)
+		case api == "RedriveDeadLetters":
+			srv.redriveDeadLetters(w, req)
+		case api == "TaskQueues":
+			srv.serveTaskQueues(w, req)
+		case api == "Migrations":
+			srv.serveMigrations(w, req)
+		case api == "pprof" || strings.HasPrefix(api, "pprof/"):
+			srv.servePprof(w, req, strings.TrimPrefix(strings.TrimPrefix(api, "pprof"), "/"))
 		default:
 			http.Error(w, "unknown internal endpoint: "+ep, http.StatusNotFound)
 		}
 		return
 	}
 
-	h, p, _ := srv.router.Lookup(req.Method, req.URL.Path)
-	if h == nil {
-		h, p, _ = srv.router.Lookup(wildcardMethod, req.URL.Path)
+	if srv.cfg.Startup.GateEndpoints && !srv.isStarted() {
+		w.Header().Set("Retry-After", "1")
+		writeErr(w, http.StatusServiceUnavailable, errs.Unavailable.String(), "server is starting")
+		return
 	}
+
+	if srv.inflight != nil {
+		select {
+		case srv.inflight <- struct{}{}:
+			defer func() { <-srv.inflight }()
+		default:
+			metrics.RequestShed()
+			w.Header().Set("Retry-After", "1")
+			writeErr(w, http.StatusServiceUnavailable, errs.Unavailable.String(), "server overloaded")
+			return
+		}
+	}
+
+	rt := srv.routesFor(req)
+	srv.routeVersion(rt, req)
+	if isPreflight(req) {
+		if h, p, _ := rt.preflight.Lookup("OPTIONS", req.URL.Path); h != nil {
+			h(w, req, p)
+			return
+		}
+	}
+
+	h, p := rt.lookup(req.Method, req.URL.Path)
 	if h == nil {
+		if sh := srv.cfg.SecurityHeaders; sh != nil {
+			setSecurityHeaders(w.Header(), sh)
+		}
 		svc, api := "unknown", "Unknown"
 		if idx := strings.IndexByte(ep, '.'); idx != -1 {
 			svc, api = ep[:idx], ep[idx+1:]
 		}
+		if allow := rt.allowedMethods(req.URL.Path); len(allow) > 0 {
+			metrics.MethodNotAllowed(svc, api)
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			writeErr(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+			return
+		}
 		metrics.UnknownEndpoint(svc, api)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(404)
-		w.Write([]byte(`{
-  "code": "unknown_endpoint",
-  "message": "endpoint not found",
-  "details": null
-}
-`))
+		writeErr(w, http.StatusNotFound, "unknown_endpoint", "endpoint not found")
 		return
 	}
 	h(w, req, p)
 }
 
+// checkToken checks that the request has the bearer token
+// required by an internal endpoint, responding with an error
+// and reporting false if not. An empty token is not checked.
+func checkToken(w http.ResponseWriter, req *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	got := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		writeErr(w, http.StatusUnauthorized, errs.Unauthenticated.String(), "invalid token")
+		return false
+	}
+	return true
+}
+
+// scrapeMetrics serves the metrics in the format negotiated
+// from the Accept header: the Prometheus text or protobuf format,
+// or OpenMetrics. Requests without an Accept header get protobuf.
+// Exemplars are only included in OpenMetrics.
 func (srv *Server) scrapeMetrics(w http.ResponseWriter, req *http.Request) {
 	mfs, err := metrics.Gather()
 	if err != nil {
 		http.Error(w, "could not gather metrics: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	enc := expfmt.NewEncoder(w, expfmt.FmtProtoDelim)
+
+	format := expfmt.FmtProtoDelim
+	if req.Header.Get("Accept") != "" {
+		format = expfmt.NegotiateIncludingOpenMetrics(req.Header)
+	}
+	w.Header().Set("Content-Type", string(format))
+
+	// Encode into a buffer so encoding errors can still be reported.
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, format)
 	for _, mf := range mfs {
 		if err := enc.Encode(mf); err != nil {
 			http.Error(w, "could not encode metrics: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 	}
+	if c, ok := enc.(expfmt.Closer); ok {
+		if err := c.Close(); err != nil {
+			http.Error(w, "could not encode metrics: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Write(buf.Bytes())
 }
 
 func Setup(cfg *config.ServerConfig) *Server {
-	setupLogging()
-	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	setupLogging(cfg.LogSocket, cfg.LogFallback || os.Getenv("ENCORE_LOG_FALLBACK") == "1")
+	var out io.Writer = os.Stderr
+	var recentLogs *logring.Ring
+	if rl := cfg.RecentLogs; rl != nil {
+		size := rl.Size
+		if size <= 0 {
+			size = defaultRecentLogsSize
+		}
+		recentLogs = logring.New(size)
+		out = io.MultiWriter(out, recentLogs)
+	}
+	if len(cfg.Secrets) > 0 {
+		secretStore = newSecretStore(cfg.Secrets)
+		out = &secretsWriter{w: out, store: secretStore}
+	}
+	if lr := cfg.LogRedaction; lr != nil {
+		rules, err := newRedactRules(lr)
+		if err != nil {
+			log.Fatalln("invalid log redaction:", err)
+		}
+		out = &redactWriter{w: out, rules: rules}
+	}
+	logger := zerolog.New(out).With().Timestamp().Logger()
+	if ls := cfg.LogSampling; ls != nil {
+		logger = logger.Hook(newLogSampler(ls))
+	}
 	RootLogger = &logger
 	Config = cfg
 
-	r := httprouter.New()
-	r.HandleOPTIONS = false
-	r.RedirectFixedPath = false
-	r.RedirectTrailingSlash = false
-
 	srv := &Server{
-		logger: logger,
-		router: r,
+		cfg:          cfg,
+		logger:       logger,
+		routes:       newRouteTable(),
+		recentLogs:   recentLogs,
+		shutdownDone: make(chan struct{}),
+	}
+	if proxies, err := parseCIDRs(cfg.TrustedProxies); err != nil {
+		logger.Fatal().Err(err).Msg("invalid trusted proxies")
+	} else {
+		srv.trustedProxies = proxies
+	}
+	if r := cfg.Redis; r != nil {
+		srv.redis = newRedisClient(r)
+	}
+	errs.SetDebugResponses(debugErrors(cfg))
+	if b := cfg.LatencyBuckets; b != nil {
+		metrics.SetLatencyBuckets(b)
+	}
+	srv.rateStore = srv.newRateLimitStore()
+	srv.idemStore = srv.newIdempotencyStore()
+	respCache = newResponseCache(cfg.ResponseCache)
+	srv.compressor = srv.newCompressor()
+	srv.auditLogger = srv.newAuditLogger()
+	tracer = srv.newTracer()
+	reporter = srv.newErrorReporter()
+	broker = srv.newBroker()
+	dedupStore = srv.newDedupStore()
+	cacheClient = srv.newCacheClient()
+	buckets = srv.newBuckets()
+	srv.startVault()
+	srv.checkSecrets()
+	srv.setupSubscriptions()
+	wsConfig = cfg.WebSocket
+	uploadConfig = upload.Config{
+		TempDir:      cfg.Uploads.TempDir,
+		Store:        cfg.Uploads.Store,
+		KeyPrefix:    cfg.Uploads.KeyPrefix,
+		MaxFileSize:  cfg.Uploads.MaxFileSize,
+		MaxParts:     cfg.Uploads.MaxParts,
+		AllowedTypes: cfg.Uploads.AllowedTypes,
+	}
+	pagination.Configure(pagination.Config{
+		Key:         []byte(cfg.Pagination.CursorKey),
+		DefaultSize: cfg.Pagination.DefaultPageSize,
+		MaxSize:     cfg.Pagination.MaxPageSize,
+	})
+	srv.setupProfiling()
+	if srv.exporters = srv.newMetricsExporters(); len(srv.exporters) > 0 {
+		srv.stopExport = make(chan struct{})
+		srv.exportDone = make(chan struct{})
+		go func() {
+			defer close(srv.exportDone)
+			srv.exportMetrics(srv.stopExport)
+		}()
+	}
+	srv.grpcsrv = srv.newGRPCServer()
+	if srv.grpcsrv != nil || cfg.Connect {
+		srv.grpcMethods = make(map[string]*grpcMethod)
+	}
+	if n := cfg.MaxConcurrentRequests; n > 0 {
+		srv.inflight = make(chan struct{}, n)
+	}
+	if len(cfg.Cron.Jobs) > 0 {
+		srv.cronTargets = make(map[string]*cronTarget)
+		srv.cronStore = srv.newCronStore()
 	}
 	for _, svc := range cfg.Services {
 		for _, endpoint := range svc.Endpoints {
-			srv.handleRPC(svc.Name, endpoint)
+			srv.handleRPC(svc, endpoint)
 		}
 	}
+	srv.setupCron()
 	return srv
 }
 
@@ -130,32 +485,12 @@ func (dummyAddr) String() string {
 	return "encore://localhost"
 }
 
-// setupLogging redirects stdout/stderr to /var/run/encore-log.sock
-// for log forwarding. It exits on error.
-func setupLogging() {
-	var sock *net.UnixConn
-	for i := 0; ; i++ {
-		var err error
-		sock, err = net.DialUnix("unix", nil, &net.UnixAddr{
-			Name: "/var/lib/encore/applog.sock",
-			Net:  "unix",
-		})
-		if err == nil {
-			break
-		} else if i == 120 {
-			log.Fatalln("could not setup logging:", err)
-		}
-		log.Printf("could not dial logging socket: %v", err)
-		time.Sleep(1 * time.Second)
-	}
-	// Postcondition: sock != nil
-
-	out, err := sock.File()
-	if err != nil {
-		log.Fatalf("could not setup logging: %v", err)
-	} else if err := syscall.Dup2(int(out.Fd()), 1); err != nil {
-		log.Fatalln("could not redirect stdout:", err)
-	} else if err := syscall.Dup2(int(out.Fd()), 2); err != nil {
-		log.Fatalln("could not redirect stderr:", err)
-	}
+func newRedisClient(r *config.Redis) *redis.Client {
+	return redis.New(redis.Config{
+		Addr:        r.Addr,
+		Password:    r.Password,
+		DB:          r.DB,
+		MaxIdle:     r.MaxIdle,
+		DialTimeout: r.DialTimeout,
+	})
 }
@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout is how long to wait for in-flight requests
+// to complete when shutting down due to a signal.
+const shutdownTimeout = 10 * time.Second
+
+// Shutdown gracefully shuts down the server, waiting for in-flight
+// requests to complete until ctx is canceled. Readiness checks fail
+// from when it is called, and listeners stay open for the configured
+// drain delay. Functions registered with OnShutdown run once
+// in-flight requests have completed.
+// Listeners are closed and Unix domain sockets are removed.
+func (srv *Server) Shutdown(ctx context.Context) (err error) {
+	srv.shutdownOnce.Do(func() {
+		defer close(srv.shutdownDone)
+
+		// Fail readiness checks and keep serving for the drain delay,
+		// so load balancers stop routing requests to the server.
+		atomic.StoreInt32(&srv.draining, 1)
+		if d := srv.cfg.DrainDelay; d > 0 {
+			srv.logger.Info().Dur("delay", d).Msg("draining before shutdown")
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+			}
+		}
+
+		if srv.h3srv != nil {
+			srv.h3srv.Close()
+		}
+		if srv.metsrv != nil {
+			srv.metsrv.Close()
+		}
+		// Hijacked connections are not tracked by the HTTP server.
+		closeWebSockets()
+		if srv.httpsrv != nil {
+			err = srv.httpsrv.Shutdown(ctx)
+		}
+		srv.stopGRPC(ctx)
+		srv.stopSubscriptions(ctx)
+		srv.stopCronJobs(ctx)
+		srv.runShutdownHooks(ctx)
+		if tracer != nil {
+			tracer.Shutdown(ctx)
+		}
+		reporter.Shutdown(ctx)
+		if srv.stopExport != nil {
+			close(srv.stopExport)
+			select {
+			case <-srv.exportDone:
+			case <-ctx.Done():
+			}
+		}
+	})
+	return err
+}
+
+// shutdownOnSignal shuts down the server when the process
+// receives SIGINT or SIGTERM.
+func (srv *Server) shutdownOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-ch
+	signal.Stop(ch)
+
+	srv.logger.Info().Str("signal", sig.String()).Msg("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout+srv.cfg.DrainDelay)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.logger.Error().Err(err).Msg("graceful shutdown failed")
+	}
+}
@@ -0,0 +1,165 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/middleware"
+)
+
+const (
+	defaultSlowClientGrace = 5 * time.Second
+
+	// slowClientCheckInterval is how often body rates are checked.
+	slowClientCheckInterval = time.Second
+)
+
+// errSlowClient is returned when reading a request body
+// that was aborted for being received too slowly.
+var errSlowClient = errors.New("request body received too slowly")
+
+type connKey struct{}
+
+// withConn adds the connection c to ctx.
+// It is used as the http.Server's ConnContext.
+func withConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// slowClients returns a middleware that aborts requests whose bodies
+// are received slower than the configured minimum rate, or nil if
+// slow clients are not aborted.
+//
+// The rate is measured over the time the handler spends waiting
+// for the body, so handlers processing the body as it arrives
+// are not penalized for their own processing time.
+func (srv *Server) slowClients() middleware.Middleware {
+	cfg := srv.cfg.SlowClients
+	if cfg == nil || cfg.MinBodyRate <= 0 {
+		return nil
+	}
+	grace := cfg.GracePeriod
+	if grace <= 0 {
+		grace = defaultSlowClientGrace
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			r := req.HTTP
+			if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+				next(w, req)
+				return
+			}
+			body := &rateBody{ReadCloser: r.Body, minRate: float64(cfg.MinBodyRate), grace: grace}
+			r.Body = body
+
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() {
+				t := time.NewTicker(slowClientCheckInterval)
+				defer t.Stop()
+				for {
+					select {
+					case <-stop:
+						return
+					case now := <-t.C:
+						if !body.tooSlow(now) {
+							continue
+						}
+						metrics.SlowClientAborted(req.Service, req.Endpoint)
+						LoggerFromContext(r.Context()).Warn().Str("remote_addr", r.RemoteAddr).
+							Int64("bytes", body.bytesRead()).Msg("aborting slow client")
+						abortBody(r, body)
+						return
+					}
+				}
+			}()
+			next(w, req)
+		}
+	}
+}
+
+// abortBody aborts reading the body of r, unblocking pending reads.
+// HTTP/1 connections are closed, since closing the body does not
+// interrupt reads; HTTP/2 and HTTP/3 streams are reset instead.
+func abortBody(r *http.Request, body *rateBody) {
+	body.abort()
+	if r.ProtoMajor == 1 {
+		if c, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+			c.Close()
+			return
+		}
+	}
+	body.ReadCloser.Close()
+}
+
+// rateBody is a request body that tracks the rate it is read at.
+type rateBody struct {
+	io.ReadCloser
+	minRate float64
+	grace   time.Duration
+
+	mu        sync.Mutex
+	n         int64         // bytes read
+	waited    time.Duration // time spent in completed reads
+	readStart time.Time     // start of the pending read, if any
+	done      bool          // whether the body has been read fully
+	aborted   bool
+}
+
+func (b *rateBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.aborted {
+		b.mu.Unlock()
+		return 0, errSlowClient
+	}
+	b.readStart = time.Now()
+	b.mu.Unlock()
+
+	n, err := b.ReadCloser.Read(p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.waited += time.Since(b.readStart)
+	b.readStart = time.Time{}
+	b.n += int64(n)
+	if err == io.EOF {
+		b.done = true
+	}
+	if b.aborted {
+		return n, errSlowClient
+	}
+	return n, err
+}
+
+// tooSlow reports whether the body is being received below the minimum rate.
+func (b *rateBody) tooSlow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	waited := b.waited
+	if !b.readStart.IsZero() {
+		waited += now.Sub(b.readStart)
+	}
+	if b.done || b.aborted || waited < b.grace {
+		return false
+	}
+	return float64(b.n) < b.minRate*waited.Seconds()
+}
+
+func (b *rateBody) abort() {
+	b.mu.Lock()
+	b.aborted = true
+	b.mu.Unlock()
+}
+
+func (b *rateBody) bytesRead() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.n
+}
@@ -0,0 +1,200 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"runtime.encore.dev/internal/metrics"
+)
+
+// sseKeepAlive is how often a keep-alive comment is sent on idle
+// event streams, to keep proxies from closing the connection.
+const sseKeepAlive = 15 * time.Second
+
+// Event is a Server-Sent Event.
+type Event struct {
+	// ID is the event ID, which clients send back in the
+	// Last-Event-ID header when reconnecting. It is optional.
+	ID string
+
+	// Event is the event type. If empty clients treat it as "message".
+	Event string
+
+	// Data is the event data. Strings and byte slices are sent as is;
+	// other values are encoded as JSON.
+	Data interface{}
+
+	// Retry, if non-zero, sets how long clients wait before reconnecting.
+	Retry time.Duration
+}
+
+// EventSource produces the events of a Server-Sent Events endpoint,
+// calling send for each event until ctx is canceled or it is done.
+// lastEventID is the ID of the last event the client received,
+// or "" if it is not reconnecting.
+type EventSource func(ctx context.Context, lastEventID string, send func(Event) error) error
+
+// ServeEvents serves req with the Server-Sent Events produced by src.
+// It is meant to be called by raw endpoint handlers.
+func ServeEvents(w http.ResponseWriter, req *http.Request, src EventSource) {
+	es := NewEventStream(w, req)
+	defer es.Close()
+	err := src(es.Context(), es.LastEventID(), es.Send)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		LoggerFromContext(req.Context()).Error().Err(err).Msg("event stream failed")
+	}
+}
+
+// EventStream is a Server-Sent Events response. It sends keep-alive
+// comments while idle, and its context is canceled when the client
+// disconnects.
+type EventStream struct {
+	s           *Stream
+	logger      *zerolog.Logger
+	lastEventID string
+	service     string
+	endpoint    string
+	start       time.Time
+	sent        chan struct{} // signals the keep-alive loop
+	done        chan struct{}
+}
+
+// NewEventStream starts a Server-Sent Events response to req.
+// Close must be called when the stream is done.
+func NewEventStream(w http.ResponseWriter, req *http.Request) *EventStream {
+	w.Header().Set("Cache-Control", "no-cache")
+	es := &EventStream{
+		s:           NewStream(w, req, http.StatusOK, "text/event-stream"),
+		logger:      LoggerFromContext(req.Context()),
+		lastEventID: lastEventID(req),
+		start:       time.Now(),
+		sent:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	if r, _, ok := currentReq(); ok {
+		es.service, es.endpoint = r.Service, r.Endpoint
+	}
+	metrics.SSEConnect(es.service, es.endpoint)
+	go es.keepAlive()
+	return es
+}
+
+// lastEventID returns the ID of the last event a reconnecting client
+// received. Clients that cannot set headers, such as EventSource
+// polyfills, may send it as the lastEventId query parameter.
+func lastEventID(req *http.Request) string {
+	if id := req.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return req.URL.Query().Get("lastEventId")
+}
+
+// LastEventID reports the ID of the last event the client received,
+// or "" if it is not reconnecting.
+func (es *EventStream) LastEventID() string {
+	return es.lastEventID
+}
+
+// Context returns the stream's context, which is canceled
+// when the client disconnects or the stream is closed.
+func (es *EventStream) Context() context.Context {
+	return es.s.Context()
+}
+
+// Send sends an event to the client.
+func (es *EventStream) Send(ev Event) error {
+	var buf bytes.Buffer
+	if ev.ID != "" {
+		writeEventField(&buf, "id", ev.ID)
+	}
+	if ev.Event != "" {
+		writeEventField(&buf, "event", ev.Event)
+	}
+	if ev.Retry > 0 {
+		writeEventField(&buf, "retry", strconv.FormatInt(ev.Retry.Milliseconds(), 10))
+	}
+	var data string
+	switch d := ev.Data.(type) {
+	case nil:
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	// Multi-line data is sent as one data field per line.
+	for _, line := range strings.Split(data, "\n") {
+		writeEventField(&buf, "data", line)
+	}
+	buf.WriteByte('\n')
+
+	if _, err := es.s.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := es.s.Flush(); err != nil {
+		return err
+	}
+	metrics.SSEEvent(es.service, es.endpoint)
+	select {
+	case es.sent <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// writeEventField writes a field of an event. Newlines in
+// value are removed, since they would end the field.
+func writeEventField(buf *bytes.Buffer, name, value string) {
+	value = strings.NewReplacer("\r\n", "", "\r", "", "\n", "").Replace(value)
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// keepAlive sends a comment whenever the stream
+// has been idle for sseKeepAlive.
+func (es *EventStream) keepAlive() {
+	t := time.NewTimer(sseKeepAlive)
+	defer t.Stop()
+	for {
+		select {
+		case <-es.done:
+			return
+		case <-es.s.Context().Done():
+			return
+		case <-es.sent:
+			if !t.Stop() {
+				<-t.C
+			}
+		case <-t.C:
+			if _, err := es.s.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+			if err := es.s.Flush(); err != nil {
+				es.logger.Error().Err(err).Msg("could not send event stream keep-alive")
+				return
+			}
+		}
+		t.Reset(sseKeepAlive)
+	}
+}
+
+// Close ends the stream.
+func (es *EventStream) Close() error {
+	close(es.done)
+	metrics.SSEDisconnect(es.service, es.endpoint, time.Since(es.start).Seconds())
+	return es.s.Close()
+}
@@ -0,0 +1,56 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventsFlushThroughMiddleware(t *testing.T) {
+	for _, raw := range []bool{false, true} {
+		release := make(chan struct{})
+		sendErr := make(chan error, 1)
+		ts := serveEndpoint(t, raw, func(w http.ResponseWriter, req *http.Request) {
+			ServeEvents(w, req, func(ctx context.Context, lastEventID string, send func(Event) error) error {
+				sendErr <- send(Event{ID: "1", Data: "hello"})
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+				return nil
+			})
+		})
+
+		// The source only returns once the event has been read,
+		// so reading it times out unless it was flushed.
+		c := &http.Client{Timeout: 5 * time.Second}
+		resp, err := c.Get(ts.URL + "/test")
+		if err != nil {
+			t.Fatalf("raw=%v: %v", raw, err)
+		}
+		if err := <-sendErr; err != nil {
+			t.Errorf("raw=%v: send: %v", raw, err)
+		}
+		var event []string
+		r := bufio.NewReader(resp.Body)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Errorf("raw=%v: reading event: %v", raw, err)
+				break
+			} else if line == "\n" {
+				break
+			}
+			event = append(event, strings.TrimSuffix(line, "\n"))
+		}
+		if got, want := strings.Join(event, "|"), "id: 1|data: hello"; got != want {
+			t.Errorf("raw=%v: got event %q, want %q", raw, got, want)
+		}
+		close(release)
+		resp.Body.Close()
+		ts.Close()
+	}
+}
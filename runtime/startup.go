@@ -0,0 +1,39 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"runtime.encore.dev/internal/health"
+)
+
+const defaultStartupTimeout = time.Minute
+
+// runStartup initializes the registered dependencies and marks
+// the server as started. It exits if they fail to initialize
+// within the startup timeout.
+func (srv *Server) runStartup() {
+	timeout := srv.cfg.Startup.Timeout
+	if timeout <= 0 {
+		timeout = defaultStartupTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := health.RunStartup(ctx, func(name string, err error) {
+		srv.logger.Warn().Err(err).Str("dependency", name).Msg("could not initialize dependency, retrying")
+	})
+	if err != nil {
+		srv.logger.Fatal().Str("pending", strings.Join(health.Pending(), ", ")).Msg("dependencies did not initialize in time")
+	}
+	atomic.StoreInt32(&srv.started, 1)
+	srv.logger.Info().Msg("dependencies initialized")
+	srv.startSubscriptions()
+	srv.startCron()
+}
+
+func (srv *Server) isStarted() bool {
+	return atomic.LoadInt32(&srv.started) != 0
+}
@@ -0,0 +1,75 @@
+package runtime
+
+import (
+	"io/ioutil"
+	"net/http"
+	goruntime "runtime"
+	"time"
+)
+
+// processStart is the approximate time the process started.
+var processStart = time.Now()
+
+// maxGCPauses is the maximum number of recent GC pauses reported.
+const maxGCPauses = 10
+
+type runtimeStats struct {
+	Goroutines  int       `json:"goroutines"`
+	HeapInUse   uint64    `json:"heap_in_use_bytes"`
+	HeapObjects uint64    `json:"heap_objects"`
+	Sys         uint64    `json:"sys_bytes"`
+	NumGC       uint32    `json:"num_gc"`
+	GCPauseTot  float64   `json:"gc_pause_total_secs"`
+	GCPauses    []float64 `json:"gc_pauses_secs"` // most recent first
+	OpenFDs     int       `json:"open_fds"`       // -1 if unknown
+	Uptime      float64   `json:"uptime_secs"`
+}
+
+// serveStats responds with runtime statistics for operational triage.
+func (srv *Server) serveStats(w http.ResponseWriter, req *http.Request) {
+	if srv.cfg.StatsToken == "" {
+		http.Error(w, "unknown internal endpoint: __encore.Stats", http.StatusNotFound)
+		return
+	}
+	if !checkToken(w, req, srv.cfg.StatsToken) {
+		return
+	}
+	var ms goruntime.MemStats
+	goruntime.ReadMemStats(&ms)
+
+	stats := runtimeStats{
+		Goroutines:  goruntime.NumGoroutine(),
+		HeapInUse:   ms.HeapInuse,
+		HeapObjects: ms.HeapObjects,
+		Sys:         ms.Sys,
+		NumGC:       ms.NumGC,
+		GCPauseTot:  time.Duration(ms.PauseTotalNs).Seconds(),
+		GCPauses:    []float64{},
+		OpenFDs:     openFDs(),
+		Uptime:      time.Since(processStart).Seconds(),
+	}
+	// PauseNs is a circular buffer with the most recent pause
+	// at (NumGC+255)%256.
+	for i := uint32(0); i < ms.NumGC && i < maxGCPauses; i++ {
+		p := ms.PauseNs[(ms.NumGC-i+255)%256]
+		stats.GCPauses = append(stats.GCPauses, time.Duration(p).Seconds())
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		http.Error(w, "could not marshal stats: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// openFDs reports the number of open file descriptors,
+// or -1 if it cannot be determined.
+func openFDs() int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(fds)
+}
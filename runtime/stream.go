@@ -0,0 +1,137 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrNotFlushable is returned by Stream.Flush if the response
+// writer, such as one wrapped by a middleware, cannot be flushed.
+var ErrNotFlushable = errors.New("runtime: response writer does not support flushing")
+
+// contentTypeNDJSON is the content type of newline-delimited JSON streams.
+const contentTypeNDJSON = "application/x-ndjson"
+
+// Stream streams a response body to the client as it is written,
+// instead of buffering it. Responses without a known length are sent
+// with chunked transfer encoding, and data is sent when flushed.
+//
+// The stream's context is canceled when the client disconnects or a
+// write fails, so that handlers producing the response can stop early.
+// Streams are still subject to the server's write timeout.
+type Stream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu  sync.Mutex
+	err error // first write error
+}
+
+// NewStream starts streaming the response to req with the given status
+// and content type, writing the response header. An empty content type
+// defaults to newline-delimited JSON, as written by Encode.
+// Close must be called when the response is complete.
+func NewStream(w http.ResponseWriter, req *http.Request, status int, contentType string) *Stream {
+	if contentType == "" {
+		contentType = contentTypeNDJSON
+	}
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Del("Content-Length")
+	// Ask reverse proxies like nginx not to buffer the response.
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(status)
+
+	s := &Stream{w: w}
+	s.flusher, _ = w.(http.Flusher)
+	s.ctx, s.cancel = context.WithCancel(req.Context())
+	s.Flush() // send the header right away
+	return s
+}
+
+// Context returns the stream's context, which is canceled when the
+// client disconnects, a write fails or the stream is closed.
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// Write writes p to the response. Data may be buffered until
+// Flush is called. Once the client has disconnected or a write
+// has failed, Write returns an error without writing.
+func (s *Stream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkLocked(); err != nil {
+		return 0, err
+	}
+	n, err := s.w.Write(p)
+	if err != nil {
+		s.failLocked(err)
+	}
+	return n, err
+}
+
+// Encode writes v as a line of newline-delimited JSON and flushes it.
+func (s *Stream) Encode(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.Flush()
+}
+
+// Flush sends any buffered data to the client.
+func (s *Stream) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkLocked(); err != nil {
+		return err
+	}
+	if s.flusher == nil {
+		return ErrNotFlushable
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Close flushes any buffered data and cancels the stream's context.
+// It returns the first error encountered while writing, if any.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	if s.err == nil && s.ctx.Err() == nil && s.flusher != nil {
+		s.flusher.Flush()
+	}
+	err := s.err
+	s.mu.Unlock()
+	s.cancel()
+	return err
+}
+
+// checkLocked returns an error if the stream can no longer be written to.
+// s.mu must be held.
+func (s *Stream) checkLocked() error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return err
+	}
+	return nil
+}
+
+// failLocked records a write error and cancels the stream's context.
+// s.mu must be held.
+func (s *Stream) failLocked(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+	s.cancel()
+}
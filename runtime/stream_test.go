@@ -0,0 +1,74 @@
+package runtime
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"runtime.encore.dev/runtime/config"
+)
+
+// serveEndpoint sets up a server with a single public GET endpoint at
+// /test served by handler, with the built-in middleware that wraps
+// the response writer enabled.
+func serveEndpoint(t *testing.T, raw bool, handler func(w http.ResponseWriter, req *http.Request)) *httptest.Server {
+	t.Helper()
+	srv := Setup(&config.ServerConfig{
+		LogFallback: true,
+		MaxBodySize: 1 << 20,
+		Compression: config.Compression{Enabled: true, MinSize: 1},
+		ETags:       config.ETags{Enabled: true},
+		Services: []*config.Service{{
+			Name: "svc",
+			Endpoints: []*config.Endpoint{{
+				Name:        "Test",
+				Path:        "/test",
+				Methods:     []string{"GET"},
+				Access:      config.Public,
+				Raw:         raw,
+				CachePolicy: &config.CachePolicy{MaxAge: time.Minute},
+				Handler: func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+					handler(w, req)
+				},
+			}},
+		}},
+	})
+	return httptest.NewServer(http.HandlerFunc(srv.handler))
+}
+
+func TestStreamFlushesThroughMiddleware(t *testing.T) {
+	for _, raw := range []bool{false, true} {
+		release := make(chan struct{})
+		ts := serveEndpoint(t, raw, func(w http.ResponseWriter, req *http.Request) {
+			s := NewStream(w, req, http.StatusOK, "")
+			defer s.Close()
+			if err := s.Encode(struct {
+				N int `json:"n"`
+			}{1}); err != nil {
+				t.Errorf("raw=%v: Encode: %v", raw, err)
+			}
+			<-release
+		})
+
+		// The handler only returns once the first line has been read,
+		// so reading it times out unless it was flushed.
+		c := &http.Client{Timeout: 5 * time.Second}
+		resp, err := c.Get(ts.URL + "/test")
+		if err != nil {
+			t.Fatalf("raw=%v: %v", raw, err)
+		}
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		if err != nil {
+			t.Errorf("raw=%v: reading first line: %v", raw, err)
+		} else if line != `{"n":1}`+"\n" {
+			t.Errorf("raw=%v: got line %q", raw, line)
+		}
+		close(release)
+		resp.Body.Close()
+		ts.Close()
+	}
+}
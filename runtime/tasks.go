@@ -0,0 +1,165 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/runtime/config"
+)
+
+const (
+	// taskTopicPrefix prefixes the names of the pub/sub
+	// topics holding the tasks of task queues.
+	taskTopicPrefix = "__encore.tasks/"
+
+	defaultTaskMaxAttempts       = 25
+	defaultTaskDepthPollInterval = 30 * time.Second
+)
+
+// taskQueues are the configured task queues by name, set by Setup.
+var taskQueues map[string]*subscription
+
+// setupTasks prepares the configured task queues. Each queue is a
+// pub/sub topic with a single subscription, whose workers handle
+// the tasks.
+func (srv *Server) setupTasks() {
+	taskQueues = make(map[string]*subscription)
+	for _, q := range srv.cfg.Tasks.Queues {
+		if q.Name == "" || taskQueues[q.Name] != nil {
+			srv.logger.Fatal().Str("queue", q.Name).Msg("tasks: queue names must be unique and non-empty")
+		}
+		s := srv.addSubscription(&config.Subscription{
+			Topic:          taskTopicPrefix + q.Name,
+			Name:           q.Name,
+			Service:        q.Service,
+			MessageType:    q.PayloadType,
+			Handler:        q.Handler,
+			MaxConcurrency: q.Workers,
+			AckDeadline:    q.Timeout,
+			RetryPolicy: config.RetryPolicy{
+				MinBackoff: q.MinBackoff,
+				MaxBackoff: q.MaxBackoff,
+			},
+		}, q.Name)
+		switch n := q.MaxAttempts; {
+		case n == 0:
+			s.retry.MaxRetries = defaultTaskMaxAttempts - 1
+		case n < 0:
+			s.retry.MaxRetries = -1
+		default:
+			s.retry.MaxRetries = n - 1
+		}
+		taskQueues[q.Name] = s
+	}
+}
+
+// TaskOptions are options for enqueuing a task.
+type TaskOptions struct {
+	// RunAt or Delay, if set, delay the task until the given
+	// time or by the given duration. At most one of them may be set.
+	RunAt time.Time
+	Delay time.Duration
+}
+
+// EnqueueTask enqueues a task with the given payload, encoded
+// as JSON, to queue, and returns the ID of the task.
+func EnqueueTask(ctx context.Context, queue string, payload interface{}) (id string, err error) {
+	return EnqueueTaskWithOptions(ctx, queue, payload, TaskOptions{})
+}
+
+// EnqueueTaskWithOptions is like EnqueueTask, but with the given options.
+func EnqueueTaskWithOptions(ctx context.Context, queue string, payload interface{}, opts TaskOptions) (id string, err error) {
+	if taskQueues[queue] == nil {
+		return "", errs.B().Code(errs.NotFound).Msgf("tasks: unknown queue %q", queue).Err()
+	}
+	popts := PublishOptions{DeliverAt: opts.RunAt, Delay: opts.Delay}
+	if id, err = publish(ctx, taskTopicPrefix+queue, payload, popts); err != nil {
+		return "", err
+	}
+	metrics.TaskEnqueued(queue)
+	return id, nil
+}
+
+// monitorTaskQueues periodically measures the depth
+// of the task queues until ctx is canceled.
+func (srv *Server) monitorTaskQueues(ctx context.Context) {
+	if len(taskQueues) == 0 {
+		return
+	}
+	interval := srv.cfg.Tasks.DepthPollInterval
+	if interval <= 0 {
+		interval = defaultTaskDepthPollInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for name, s := range taskQueues {
+			n, err := broker.Depth(ctx, s.cfg.Topic, s.cfg.Name)
+			if ctx.Err() != nil {
+				return
+			} else if err != nil {
+				srv.logger.Error().Err(err).Str("queue", name).Msg("tasks: could not measure queue depth")
+				continue
+			}
+			metrics.TaskQueueDepth(name, n)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type taskQueueInfo struct {
+	Queue       string `json:"queue"`
+	Service     string `json:"service"`
+	Depth       int64  `json:"depth"`
+	Workers     int    `json:"workers"`
+	MaxAttempts int    `json:"max_attempts"` // or -1 if unlimited
+}
+
+// serveTaskQueues responds with the task queues and their depth,
+// the number of tasks pending or in progress.
+func (srv *Server) serveTaskQueues(w http.ResponseWriter, req *http.Request) {
+	if srv.cfg.Tasks.Token == "" {
+		http.Error(w, "unknown internal endpoint: __encore.TaskQueues", http.StatusNotFound)
+		return
+	}
+	if req.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeErr(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if !checkToken(w, req, srv.cfg.Tasks.Token) {
+		return
+	}
+
+	infos := []taskQueueInfo{}
+	for _, q := range srv.cfg.Tasks.Queues {
+		s := taskQueues[q.Name]
+		depth, err := broker.Depth(req.Context(), s.cfg.Topic, s.cfg.Name)
+		if err != nil {
+			srv.logger.Error().Err(err).Str("queue", q.Name).Msg("tasks: could not measure queue depth")
+			writeErr(w, http.StatusServiceUnavailable, errs.Unavailable.String(), "could not measure queue depth")
+			return
+		}
+		maxAttempts := s.retry.MaxRetries + 1
+		if s.retry.MaxRetries < 0 {
+			maxAttempts = -1
+		}
+		infos = append(infos, taskQueueInfo{
+			Queue:       q.Name,
+			Service:     q.Service,
+			Depth:       depth,
+			Workers:     s.concurrency,
+			MaxAttempts: maxAttempts,
+		})
+	}
+	data, _ := json.MarshalIndent(infos, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
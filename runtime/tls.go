@@ -0,0 +1,133 @@
+package runtime
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certCheckInterval is how often to check the certificate files
+// for changes.
+const certCheckInterval = 10 * time.Second
+
+// tlsConfig returns the TLS configuration for serving HTTPS.
+func (srv *Server) tlsConfig() (*tls.Config, error) {
+	tc, err := srv.certConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := srv.configureClientAuth(tc); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// certConfig returns the TLS configuration for the server certificate.
+func (srv *Server) certConfig() (*tls.Config, error) {
+	cfg := srv.cfg.TLS
+	switch {
+	case len(cfg.AutocertHosts) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertHosts...),
+			Email:      cfg.AutocertEmail,
+		}
+		if cfg.AutocertCache != "" {
+			m.Cache = autocert.DirCache(cfg.AutocertCache)
+		}
+		return m.TLSConfig(), nil
+
+	case len(cfg.CertPEM) > 0:
+		cert, err := tls.X509KeyPair(cfg.CertPEM, cfg.KeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("parse tls certificate: %v", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+
+	case cfg.CertFile != "":
+		r := &certReloader{
+			certFile: cfg.CertFile,
+			keyFile:  cfg.KeyFile,
+			logger:   srv.logger,
+		}
+		if err := r.reload(); err != nil {
+			return nil, err
+		}
+		return &tls.Config{GetCertificate: r.getCertificate}, nil
+
+	default:
+		return nil, fmt.Errorf("tls: no certificate configured")
+	}
+}
+
+// certReloader loads a certificate from disk and reloads it
+// when the certificate or key file is modified.
+type certReloader struct {
+	certFile, keyFile string
+	logger            zerolog.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time // latest mod time of the loaded files
+	lastCheck time.Time
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) >= certCheckInterval {
+		r.lastCheck = time.Now()
+		if modTime, err := r.latestModTime(); err == nil && modTime.After(r.modTime) {
+			if err := r.load(); err != nil {
+				// Keep serving the old certificate; the files may be mid-update.
+				r.logger.Error().Err(err).Msg("could not reload tls certificate")
+			} else {
+				r.logger.Info().Msg("reloaded tls certificate")
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastCheck = time.Now()
+	return r.load()
+}
+
+// load loads the certificate from disk.
+// r.mu must be held.
+func (r *certReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %v", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %v", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range [...]string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t := fi.ModTime(); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,221 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"runtime.encore.dev/internal/otel"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+var (
+	// tracer is the OpenTelemetry tracer, or nil if tracing is disabled.
+	tracer *otel.Tracer
+
+	// propagators are the formats the trace context
+	// is propagated in on outbound requests.
+	propagators = []string{otel.TraceContext}
+)
+
+// newTracer creates the OpenTelemetry tracer,
+// or returns nil if tracing is disabled.
+func (srv *Server) newTracer() *otel.Tracer {
+	cfg := srv.cfg.Tracing
+	if cfg == nil {
+		return nil
+	}
+
+	var exp otel.Exporter
+	switch cfg.Protocol {
+	case "", "http/protobuf":
+		exp = &otel.HTTPExporter{URL: cfg.Endpoint, Headers: cfg.Headers}
+	case "grpc":
+		e, err := otel.NewGRPCExporter(cfg.Endpoint, cfg.Insecure, cfg.Headers)
+		if err != nil {
+			srv.logger.Fatal().Err(err).Msg("tracing: could not create exporter")
+		}
+		exp = e
+	default:
+		srv.logger.Fatal().Str("protocol", cfg.Protocol).Msg("tracing: unknown protocol")
+	}
+
+	if len(cfg.Propagators) > 0 {
+		for _, p := range cfg.Propagators {
+			switch p {
+			case otel.TraceContext, otel.B3, otel.B3Multi:
+				// ok
+			default:
+				srv.logger.Fatal().Str("propagator", p).Msg("tracing: unknown propagator")
+			}
+		}
+		propagators = cfg.Propagators
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = "encore"
+	}
+	resource := []otel.Attr{otel.String("service.name", name)}
+	keys := make([]string, 0, len(cfg.ResourceAttributes))
+	for k := range cfg.ResourceAttributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		resource = append(resource, otel.String(k, cfg.ResourceAttributes[k]))
+	}
+
+	return otel.NewTracer(otel.Config{
+		Exporter:     exp,
+		Resource:     resource,
+		Sampler:      newSampler(cfg.Sampling),
+		SampleErrors: cfg.SampleErrors,
+		OnError: func(err error) {
+			srv.logger.Error().Err(err).Msg("tracing: could not export spans")
+		},
+	})
+}
+
+// newSampler creates a trace sampler from its configuration.
+func newSampler(cfg config.TraceSampling) otel.Sampler {
+	if cfg.Disabled {
+		return otel.NeverSample
+	}
+	var samplers []otel.Sampler
+	if p := cfg.Probability; p > 0 && p < 1 {
+		samplers = append(samplers, otel.Probability(p))
+	}
+	if r := cfg.RateLimit; r > 0 {
+		samplers = append(samplers, otel.RateLimited(r))
+	}
+	switch len(samplers) {
+	case 0:
+		return otel.AlwaysSample
+	case 1:
+		return samplers[0]
+	default:
+		return otel.All(samplers...)
+	}
+}
+
+// traceRequest returns a middleware that records a server span for the
+// request, continuing the trace propagated by the caller, if any, or nil
+// if tracing is disabled. The span is added to the request context,
+// and adopted by the request when it begins.
+func (srv *Server) traceRequest(endpoint *config.Endpoint) middleware.Middleware {
+	if tracer == nil {
+		return nil
+	}
+	var sampler otel.Sampler // nil means the tracer's sampler
+	if endpoint.TraceSampling != nil {
+		sampler = newSampler(*endpoint.TraceSampling)
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			r := req.HTTP
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			parent, _ := otel.Extract(r.Header)
+			span := tracer.StartWith(sampler, parent, r.Method+" "+req.Path, otel.Server,
+				otel.String("http.method", r.Method),
+				otel.String("http.route", req.Path),
+				otel.String("http.target", r.URL.RequestURI()),
+				otel.String("http.scheme", scheme),
+				otel.String("http.user_agent", r.UserAgent()),
+				otel.String("net.peer.ip", srv.clientIP(r).String()),
+				otel.String("encore.service", req.Service),
+				otel.String("encore.endpoint", req.Endpoint),
+			)
+			req.HTTP = r.WithContext(context.WithValue(r.Context(), spanKey, span))
+			next(w, req)
+
+			status := w.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttrs(otel.Int("http.status_code", int64(status)))
+			if status >= 500 {
+				span.SetStatus(otel.StatusError, http.StatusText(status))
+			}
+			span.End(nil)
+		}
+	}
+}
+
+// spanFromContext reports the span in ctx, or nil.
+func spanFromContext(ctx context.Context) *otel.Span {
+	span, _ := ctx.Value(spanKey).(*otel.Span)
+	return span
+}
+
+// reqSpan returns the span of a request that is beginning.
+//
+// A request with no parent adopts the server span of the incoming
+// HTTP request in ctx, if any. Requests with a parent, such as
+// in-process calls, get a span of their own, reported as owned.
+func reqSpan(ctx context.Context, parent *otel.Span, req *Request) (span *otel.Span, owned bool) {
+	if tracer == nil {
+		return nil, false
+	} else if parent == nil {
+		return spanFromContext(ctx), false
+	}
+	span = tracer.Start(parent.SpanContext(), req.Service+"."+req.Endpoint, otel.Server,
+		otel.String("encore.service", req.Service),
+		otel.String("encore.endpoint", req.Endpoint),
+	)
+	return span, true
+}
+
+// StartSpan starts an OpenTelemetry span as a child of the current
+// request's span. It returns nil if tracing is disabled or there is no
+// current request; the methods of a nil span are no-ops.
+func StartSpan(name string, kind otel.SpanKind, attrs ...otel.Attr) *otel.Span {
+	if tracer == nil {
+		return nil
+	}
+	req, _, ok := currentReq()
+	if !ok || req.span == nil {
+		return nil
+	}
+	return tracer.Start(req.span.SpanContext(), name, kind, attrs...)
+}
+
+// startHTTPSpan starts a client span for an outbound HTTP request made
+// during the current request, and injects its context into the request
+// headers. It returns nil if tracing is disabled.
+func startHTTPSpan(req *http.Request) *otel.Span {
+	if req.URL == nil {
+		return nil
+	}
+	span := StartSpan("HTTP "+req.Method, otel.Client,
+		otel.String("http.method", req.Method),
+		otel.String("http.url", req.URL.Redacted()),
+	)
+	if span != nil {
+		if req.Header == nil {
+			req.Header = make(http.Header)
+		}
+		otel.Inject(req.Header, span.SpanContext(), propagators)
+	}
+	return span
+}
+
+// endHTTPSpan ends the span of an outbound HTTP request, if any.
+func endHTTPSpan(req *http.Request, resp *http.Response, err error) {
+	span, _ := req.Context().Value(httpSpanKey).(*otel.Span)
+	if span == nil {
+		return
+	}
+	if resp != nil {
+		span.SetAttrs(otel.Int("http.status_code", int64(resp.StatusCode)))
+		if resp.StatusCode >= 500 {
+			span.SetStatus(otel.StatusError, resp.Status)
+		}
+	}
+	span.End(err)
+}
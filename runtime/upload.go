@@ -0,0 +1,153 @@
+package runtime
+
+import (
+	"encoding"
+	"errors"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/upload"
+)
+
+const contentTypeMultipart = "multipart/form-data"
+
+// File is a file uploaded in a multipart/form-data request. Request
+// payloads receive uploaded files in fields of type *File or []*File.
+type File = upload.File
+
+// uploadConfig is the upload configuration, set by Setup.
+var uploadConfig upload.Config
+
+var (
+	fileType        = reflect.TypeOf((*File)(nil))
+	fileSliceType   = reflect.TypeOf([]*File(nil))
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decodeMultipart decodes a multipart/form-data request into v,
+// a pointer to a struct. Form values and files are assigned to the
+// fields named by their "json" tags. Temporary files are removed
+// when the request completes.
+func decodeMultipart(req *http.Request, v interface{}) error {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return &errs.Error{Code: errs.InvalidArgument, Message: "invalid multipart content type"}
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return &errs.Error{Code: errs.InvalidArgument, Message: "endpoint does not support multipart payloads"}
+	}
+
+	form, err := upload.Parse(req.Context(), req.Body, params["boundary"], uploadConfig)
+	if err != nil {
+		var te *upload.TypeError
+		switch {
+		case errors.As(err, &te):
+			return errs.WrapCode(err, errs.InvalidArgument, "disallowed file type")
+		case err == upload.ErrFileTooLarge || err == upload.ErrTooManyParts || err == upload.ErrValueTooLarge:
+			return errs.WrapCode(err, errs.ResourceExhausted, "upload too large")
+		}
+		return errs.WrapCode(err, errs.InvalidArgument, "invalid multipart payload")
+	}
+	// The request context is canceled once the handler returns.
+	go func() {
+		<-req.Context().Done()
+		form.RemoveAll()
+	}()
+
+	sv := rv.Elem()
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Name
+		if tag := sf.Tag.Get("json"); tag == "-" {
+			continue
+		} else if n := strings.Split(tag, ",")[0]; n != "" {
+			name = n
+		}
+
+		fv := sv.Field(i)
+		switch sf.Type {
+		case fileType:
+			if files := form.Files[name]; len(files) > 0 {
+				fv.Set(reflect.ValueOf(files[0]))
+			}
+			continue
+		case fileSliceType:
+			fv.Set(reflect.ValueOf(form.Files[name]))
+			continue
+		}
+		vals, ok := form.Values[name]
+		if !ok {
+			continue
+		}
+		if err := setFormValue(fv, vals); err != nil {
+			return &errs.Error{Code: errs.InvalidArgument, Message: "invalid value for form field " + name + ": " + err.Error()}
+		}
+	}
+	return nil
+}
+
+// setFormValue sets v from form values.
+func setFormValue(v reflect.Value, vals []string) error {
+	if v.Kind() == reflect.Slice && !reflect.PtrTo(v.Type()).Implements(textUnmarshaler) {
+		s := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setFormString(s.Index(i), val); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setFormString(v, vals[0])
+}
+
+func setFormString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		// Decode other types, such as structs, from JSON.
+		return json.Unmarshal([]byte(s), v.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/validate"
+)
+
+// ValidateRequest validates a request payload according to the
+// "validate" tags of its fields, and the Validate method of values
+// implementing it. Invalid payloads are reported as InvalidArgument
+// errors with ValidationDetails describing the invalid fields.
+// Errors returned by Validate methods are reported as is if they
+// are *errs.Error.
+func ValidateRequest(payload interface{}) error {
+	violations, err := validate.Validate(payload)
+	if err != nil {
+		var verr *validate.Error
+		if !errors.As(err, &verr) {
+			// Invalid validation tags.
+			return &errs.Error{Code: errs.Internal, Message: err.Error()}
+		}
+		if e, ok := verr.Err.(*errs.Error); ok {
+			return e
+		}
+		e := &errs.Error{Code: errs.InvalidArgument, Message: "invalid request: " + verr.Error()}
+		if verr.Field != "" {
+			e.Details = &errs.ValidationDetails{Fields: []errs.FieldViolation{
+				{Field: verr.Field, Description: verr.Err.Error()},
+			}}
+		}
+		return e
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	details := &errs.ValidationDetails{Fields: make([]errs.FieldViolation, len(violations))}
+	for i, v := range violations {
+		details.Fields[i] = errs.FieldViolation{Field: v.Field, Description: v.Description}
+	}
+	msg := "invalid request: " + violations[0].Field + " " + violations[0].Description
+	if n := len(violations) - 1; n > 0 {
+		msg += fmt.Sprintf(" (and %d more)", n)
+	}
+	return &errs.Error{Code: errs.InvalidArgument, Message: msg, Details: details}
+}
@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"runtime.encore.dev/internal/vault"
+	"runtime.encore.dev/runtime/config"
+)
+
+const (
+	defaultVaultAppRoleMount    = "approle"
+	defaultVaultKubernetesMount = "kubernetes"
+	defaultVaultTokenFile       = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	vaultStartTimeout = 10 * time.Second
+)
+
+// startVault reads the secrets stored in Vault and keeps
+// them up to date until shutdown.
+func (srv *Server) startVault() {
+	var targets []vault.Target
+	for _, s := range srv.cfg.Secrets {
+		if s.Vault != nil {
+			targets = append(targets, vault.Target{Name: s.Name, Path: s.Vault.Path, Field: s.Vault.Field})
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	cfg := srv.cfg.Vault
+	if cfg == nil || cfg.Address == "" {
+		srv.logger.Fatal().Msg("vault: secrets stored in vault but no vault server configured")
+	}
+
+	hc := &http.Client{Timeout: 30 * time.Second}
+	if cfg.TLS != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = cfg.TLS
+		hc.Transport = t
+	}
+	client := vault.New(cfg.Address, cfg.Namespace, hc)
+	wcfg := vault.WatchConfig{
+		Refresh: cfg.RefreshInterval,
+		OnValue: secretStore.Set,
+		OnError: func(name string, err error) {
+			if name == "" {
+				srv.logger.Error().Err(err).Msg("vault: could not log in")
+			} else {
+				srv.logger.Error().Err(err).Str("secret", name).Msg("vault: could not read secret")
+			}
+		},
+	}
+	switch {
+	case cfg.Token != "":
+		client.SetToken(cfg.Token)
+	case cfg.AppRole != nil:
+		wcfg.Login = vaultAppRoleLogin(cfg.AppRole)
+	case cfg.Kubernetes != nil:
+		wcfg.Login = vaultKubernetesLogin(cfg.Kubernetes)
+	default:
+		srv.logger.Fatal().Msg("vault: no auth method configured")
+	}
+
+	w := vault.NewWatcher(client, targets, wcfg)
+	ctx, cancel := context.WithTimeout(context.Background(), vaultStartTimeout)
+	defer cancel()
+	// Errors are reported through OnError, and secrets that could
+	// not be read are retried until they are.
+	w.Start(ctx)
+	OnShutdown(func(ctx context.Context) { w.Stop() })
+}
+
+func vaultAppRoleLogin(cfg *config.VaultAppRole) vault.LoginFunc {
+	mount := cfg.Mount
+	if mount == "" {
+		mount = defaultVaultAppRoleMount
+	}
+	return func(ctx context.Context, c *vault.Client) (*vault.Auth, error) {
+		secretID := cfg.SecretID
+		if cfg.SecretIDFile != "" {
+			data, err := ioutil.ReadFile(cfg.SecretIDFile)
+			if err != nil {
+				return nil, err
+			}
+			secretID = strings.TrimSpace(string(data))
+		}
+		return c.Login(ctx, mount, map[string]string{"role_id": cfg.RoleID, "secret_id": secretID})
+	}
+}
+
+func vaultKubernetesLogin(cfg *config.VaultKubernetes) vault.LoginFunc {
+	mount, tokenFile := cfg.Mount, cfg.TokenFile
+	if mount == "" {
+		mount = defaultVaultKubernetesMount
+	}
+	if tokenFile == "" {
+		tokenFile = defaultVaultTokenFile
+	}
+	return func(ctx context.Context, c *vault.Client) (*vault.Auth, error) {
+		// The token is read each time, since it is rotated by Kubernetes.
+		data, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return c.Login(ctx, mount, map[string]string{"role": cfg.Role, "jwt": strings.TrimSpace(string(data))})
+	}
+}
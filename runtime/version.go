@@ -0,0 +1,124 @@
+package runtime
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/middleware"
+	"runtime.encore.dev/runtime/config"
+)
+
+// endpointPath returns the path the endpoint is served at,
+// prefixed with its version if it is versioned.
+func endpointPath(endpoint *config.Endpoint) string {
+	if endpoint.Version > 0 {
+		return versionPrefix(endpoint.Version) + endpoint.Path
+	}
+	return endpoint.Path
+}
+
+func versionPrefix(version int) string {
+	return "/v" + strconv.Itoa(version)
+}
+
+// routeVersion routes requests for paths without a version prefix to
+// a versioned endpoint by rewriting their path: to the version in the
+// Accept header's version parameter if given, and otherwise to the
+// default version if no unversioned endpoint matches the path.
+func (srv *Server) routeVersion(rt *routeTable, req *http.Request) {
+	path := req.URL.Path
+	if pathVersion(path) > 0 {
+		return
+	}
+	version := acceptVersion(req.Header.Get("Accept"))
+	if version == 0 {
+		version = srv.cfg.APIVersions.Default
+		if version == 0 || rt.hasPath(path) {
+			return
+		}
+	}
+	prefix := versionPrefix(version)
+	if !rt.hasPath(prefix + path) {
+		return
+	}
+	req.URL.Path = prefix + path
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = prefix + req.URL.RawPath
+	}
+}
+
+// pathVersion returns the version of a path with
+// a "/v<version>/" prefix, or 0 if it has none.
+func pathVersion(path string) int {
+	if !strings.HasPrefix(path, "/v") {
+		return 0
+	}
+	s := path[len("/v"):]
+	if i := strings.IndexByte(s, '/'); i != -1 {
+		s = s[:i]
+	}
+	return parseVersion(s)
+}
+
+// acceptVersion returns the version parameter of the
+// first media range in an Accept header that has one,
+// such as "application/json; version=2", or 0.
+func acceptVersion(accept string) int {
+	if !strings.Contains(accept, "version") {
+		return 0
+	}
+	for _, mr := range strings.Split(accept, ",") {
+		_, params, err := mime.ParseMediaType(mr)
+		if err != nil {
+			continue
+		}
+		if v, ok := params["version"]; ok {
+			return parseVersion(strings.TrimPrefix(v, "v"))
+		}
+	}
+	return 0
+}
+
+func parseVersion(s string) int {
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 || s[0] == '0' || s[0] == '+' {
+		return 0
+	}
+	return v
+}
+
+// versioning returns a middleware that records requests to a versioned
+// endpoint and marks responses of deprecated versions with the
+// Deprecation, Sunset and Link headers, or nil if the endpoint is
+// not versioned.
+func (srv *Server) versioning(endpoint *config.Endpoint) middleware.Middleware {
+	if endpoint.Version == 0 {
+		return nil
+	}
+	version := strconv.Itoa(endpoint.Version)
+	dep, deprecated := srv.cfg.APIVersions.Deprecated[endpoint.Version]
+
+	return func(next middleware.Handler) middleware.Handler {
+		return func(w middleware.ResponseWriter, req *middleware.Request) {
+			metrics.APIVersionRequest(req.Service, req.Endpoint, version, deprecated)
+			if deprecated {
+				h := w.Header()
+				if dep.Since.IsZero() {
+					h.Set("Deprecation", "true")
+				} else {
+					h.Set("Deprecation", "@"+strconv.FormatInt(dep.Since.Unix(), 10))
+				}
+				if !dep.Sunset.IsZero() {
+					h.Set("Sunset", dep.Sunset.UTC().Format(http.TimeFormat))
+				}
+				if dep.Link != "" {
+					h.Add("Link", "<"+dep.Link+`>; rel="deprecation"`)
+				}
+			}
+			next(w, req)
+		}
+	}
+}
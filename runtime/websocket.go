@@ -0,0 +1,269 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/otel"
+	"runtime.encore.dev/internal/websocket"
+	"runtime.encore.dev/runtime/config"
+)
+
+// WebSocket message types.
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+)
+
+// WebSocket close codes.
+const (
+	CloseNormal          = websocket.CloseNormal
+	CloseGoingAway       = websocket.CloseGoingAway
+	ClosePolicyViolation = websocket.ClosePolicyViolation
+	CloseInternalError   = websocket.CloseInternalError
+)
+
+// defaultWSPingInterval is the default interval for pinging clients.
+const defaultWSPingInterval = 30 * time.Second
+
+var (
+	// wsConfig is the WebSocket configuration, set by Setup.
+	wsConfig config.WebSocket
+
+	// wsConns tracks open connections to close them on shutdown.
+	wsConns = struct {
+		sync.Mutex
+		m       map[*WebSocket]struct{}
+		closing bool
+	}{m: make(map[*WebSocket]struct{})}
+)
+
+// WebSocket is a WebSocket connection. Reads must be done by a
+// single goroutine; writes are safe for concurrent use.
+type WebSocket struct {
+	conn     *websocket.Conn
+	ctx      context.Context
+	cancel   context.CancelFunc
+	service  string
+	endpoint string
+	start    time.Time
+
+	received, sent int64 // message counts, accessed atomically
+	closeOnce      sync.Once
+}
+
+// UpgradeWebSocket upgrades the connection of req, a request to a raw
+// endpoint, to a WebSocket connection, negotiating one of the given
+// subprotocols if the client requests any. Requests have been
+// authenticated by the auth handler before reaching the endpoint, so
+// browser clients, which cannot set headers, pass credentials in a
+// way the auth handler accepts, such as a query parameter.
+//
+// On failure the error has been written as the response.
+// Close must be called when the connection is done; open
+// connections are closed when the server shuts down.
+func UpgradeWebSocket(w http.ResponseWriter, req *http.Request, subprotocols ...string) (*WebSocket, error) {
+	cfg := wsConfig
+	opts := websocket.Options{
+		Subprotocols:   subprotocols,
+		MaxMessageSize: cfg.MaxMessageSize,
+	}
+	if len(cfg.AllowedOrigins) > 0 {
+		opts.CheckOrigin = func(req *http.Request) bool {
+			return allowedOrigin(req, cfg.AllowedOrigins)
+		}
+	}
+	ping := cfg.PingInterval
+	if ping == 0 {
+		ping = defaultWSPingInterval
+	}
+	if ping > 0 {
+		opts.IdleTimeout = 2 * ping
+	}
+
+	wsConns.Lock()
+	closing := wsConns.closing
+	wsConns.Unlock()
+	if closing {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return nil, websocket.ErrClosed
+	}
+
+	conn, err := websocket.Upgrade(w, req, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &WebSocket{conn: conn, start: time.Now()}
+	ws.ctx, ws.cancel = context.WithCancel(req.Context())
+	if r, _, ok := currentReq(); ok {
+		ws.service, ws.endpoint = r.Service, r.Endpoint
+	}
+	metrics.WebSocketConnect(ws.service, ws.endpoint)
+
+	wsConns.Lock()
+	wsConns.m[ws] = struct{}{}
+	wsConns.Unlock()
+	if ping > 0 {
+		go ws.pingLoop(ping)
+	}
+	return ws, nil
+}
+
+// allowedOrigin reports whether the request's origin
+// is its own or one of the allowed origins.
+func allowedOrigin(req *http.Request, allowed []string) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if i := strings.Index(origin, "://"); i != -1 && strings.EqualFold(origin[i+3:], req.Host) {
+		return true
+	}
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Context returns the connection's context, which
+// is canceled when the connection is closed.
+func (ws *WebSocket) Context() context.Context {
+	return ws.ctx
+}
+
+// Subprotocol reports the negotiated subprotocol, or "".
+func (ws *WebSocket) Subprotocol() string {
+	return ws.conn.Subprotocol
+}
+
+// ReadMessage reads the next message, returning its type (TextMessage
+// or BinaryMessage) and data. Once the connection is closed it returns
+// an error, and the connection must be closed with Close.
+func (ws *WebSocket) ReadMessage() (messageType int, data []byte, err error) {
+	messageType, data, err = ws.conn.ReadMessage()
+	if err != nil {
+		ws.cancel()
+		return 0, nil, err
+	}
+	atomic.AddInt64(&ws.received, 1)
+	ws.observe(true, messageType, len(data))
+	return messageType, data, nil
+}
+
+// WriteMessage writes a message of the given type.
+func (ws *WebSocket) WriteMessage(messageType int, data []byte) error {
+	if err := ws.conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	atomic.AddInt64(&ws.sent, 1)
+	ws.observe(false, messageType, len(data))
+	return nil
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (ws *WebSocket) ReadJSON(v interface{}) error {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteJSON writes v encoded as JSON as a text message.
+func (ws *WebSocket) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(TextMessage, data)
+}
+
+// observe records a message in metrics and calls the OnMessage hook.
+func (ws *WebSocket) observe(inbound bool, messageType, size int) {
+	direction := "out"
+	if inbound {
+		direction = "in"
+	}
+	metrics.WebSocketMessage(ws.service, ws.endpoint, direction, size)
+	if hook := wsConfig.OnMessage; hook != nil {
+		hook(ws.ctx, config.WebSocketMessage{
+			Service:  ws.service,
+			Endpoint: ws.endpoint,
+			Inbound:  inbound,
+			Binary:   messageType == BinaryMessage,
+			Size:     size,
+		})
+	}
+}
+
+// pingLoop pings the client until the connection is closed.
+// Unresponsive clients fail the connection's idle timeout.
+func (ws *WebSocket) pingLoop(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ws.ctx.Done():
+			return
+		case <-t.C:
+			ws.conn.SetWriteDeadline(time.Now().Add(interval))
+			err := ws.conn.Ping(nil)
+			ws.conn.SetWriteDeadline(time.Time{})
+			if err != nil {
+				ws.cancel()
+				return
+			}
+		}
+	}
+}
+
+// Close closes the connection with the given close code and reason.
+// Calls after the first have no effect.
+func (ws *WebSocket) Close(code int, reason string) error {
+	var err error
+	ws.closeOnce.Do(func() {
+		err = ws.conn.Close(code, reason)
+		ws.cancel()
+
+		wsConns.Lock()
+		delete(wsConns.m, ws)
+		wsConns.Unlock()
+
+		metrics.WebSocketDisconnect(ws.service, ws.endpoint, time.Since(ws.start).Seconds())
+		spanFromContext(ws.ctx).SetAttrs(
+			otel.Int("websocket.messages_received", atomic.LoadInt64(&ws.received)),
+			otel.Int("websocket.messages_sent", atomic.LoadInt64(&ws.sent)),
+		)
+	})
+	return err
+}
+
+// closeWebSockets closes open WebSocket connections with the
+// "going away" close code, and rejects new ones.
+func closeWebSockets() {
+	wsConns.Lock()
+	wsConns.closing = true
+	conns := make([]*WebSocket, 0, len(wsConns.m))
+	for ws := range wsConns.m {
+		conns = append(conns, ws)
+	}
+	wsConns.Unlock()
+
+	var wg sync.WaitGroup
+	for _, ws := range conns {
+		wg.Add(1)
+		go func(ws *WebSocket) {
+			defer wg.Done()
+			ws.Close(CloseGoingAway, "server shutting down")
+		}(ws)
+	}
+	wg.Wait()
+}
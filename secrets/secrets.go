@@ -0,0 +1,139 @@
+// Package secrets provides typed access to secrets, such as API keys
+// and passwords. Secrets are typically declared as package-level
+// variables:
+//
+//	var stripeKey = secrets.Named("StripeKey")
+//
+// Secrets are declared in the server configuration's Secrets field,
+// and loaded from environment variables or files at startup, or read
+// from HashiCorp Vault and kept up to date as they are rotated. While
+// required secrets are missing the readiness check fails.
+//
+// Secret values are redacted from the runtime's logs and error
+// reports, and formatting a Secret prints a placeholder rather
+// than its value.
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/redact"
+	"runtime.encore.dev/runtime"
+)
+
+// Secret is a declared secret.
+type Secret struct {
+	name string
+}
+
+// Named returns the secret declared with the given name.
+func Named(name string) *Secret {
+	if name == "" {
+		panic("secrets: secret name must not be empty")
+	}
+	return &Secret{name: name}
+}
+
+// Name returns the name of the secret.
+func (s *Secret) Name() string { return s.name }
+
+// Lookup returns the value of the secret, reporting whether it is set.
+func (s *Secret) Lookup() (string, bool) {
+	return runtime.Secret(s.name)
+}
+
+// Value returns the value of the secret, or "" if it is not set.
+func (s *Secret) Value() string {
+	v, _ := s.Lookup()
+	return v
+}
+
+// Int returns the value of the secret parsed as an integer.
+func (s *Secret) Int() (int64, error) {
+	v, err := s.get()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, s.invalid("an integer")
+	}
+	return n, nil
+}
+
+// Bool returns the value of the secret parsed as a boolean.
+func (s *Secret) Bool() (bool, error) {
+	v, err := s.get()
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, s.invalid("a boolean")
+	}
+	return b, nil
+}
+
+// Bytes returns the value of the secret decoded from base64,
+// such as for encryption keys.
+func (s *Secret) Bytes() ([]byte, error) {
+	v, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, s.invalid("base64")
+	}
+	return b, nil
+}
+
+// Decode decodes the value of the secret as JSON into v.
+func (s *Secret) Decode(v interface{}) error {
+	data, err := s.get()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return s.invalid("JSON")
+	}
+	return nil
+}
+
+// OnRotate registers fn to be called when the value of the
+// secret changes, such as when Vault rotates it, so that clients
+// using it can be recreated without restarting.
+func (s *Secret) OnRotate(fn func()) {
+	runtime.OnSecretChange(s.name, fn)
+}
+
+// String returns a placeholder, so that formatting
+// the secret does not reveal its value.
+func (s *Secret) String() string { return redact.Placeholder }
+
+// GoString is like String, for the %#v verb.
+func (s *Secret) GoString() string { return redact.Placeholder }
+
+func (s *Secret) get() (string, error) {
+	v, ok := s.Lookup()
+	if !ok {
+		return "", errs.B().Code(errs.FailedPrecondition).Msgf("secrets: secret %s not set", s.name).Err()
+	}
+	return v, nil
+}
+
+// invalid returns the error for a value that is not of the given
+// format. The parse error is not included, since it may quote the
+// value.
+func (s *Secret) invalid(format string) error {
+	return errs.B().Code(errs.Internal).Msgf("secrets: secret %s is not %s", s.name, format).Err()
+}
+
+// Redact replaces the values of the declared secrets in text,
+// such as before logging a configuration dump.
+func Redact(text string) string {
+	return runtime.RedactSecrets(text)
+}
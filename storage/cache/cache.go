@@ -0,0 +1,124 @@
+// Package cache provides caches stored in Redis.
+//
+// Caches are organized in keyspaces, each holding values of one
+// type under string keys, with an optional time to live. Keyspaces
+// are typically declared as package-level variables:
+//
+//	var sessions = cache.NewStructKeyspace("sessions", cache.KeyspaceConfig{
+//		DefaultTTL: time.Hour,
+//	})
+//
+// The Redis server is configured by the server configuration's
+// Cache field. Operations are measured and traced by keyspace.
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/otel"
+	"runtime.encore.dev/internal/redis"
+	"runtime.encore.dev/runtime"
+)
+
+// Miss is returned when getting a key that is not in the cache.
+var Miss = errors.New("cache: miss")
+
+// KeyspaceConfig configures a keyspace.
+type KeyspaceConfig struct {
+	// DefaultTTL is how long values are kept after being set.
+	// If zero they are kept until evicted by Redis.
+	DefaultTTL time.Duration
+}
+
+// keyspace implements the operations common to all keyspaces.
+type keyspace struct {
+	name string
+	cfg  KeyspaceConfig
+}
+
+func newKeyspace(name string, cfg KeyspaceConfig) *keyspace {
+	if name == "" {
+		panic("cache: keyspace name must not be empty")
+	}
+	return &keyspace{name: name, cfg: cfg}
+}
+
+// do runs the Redis command named op on key, followed by args,
+// recording it in metrics and traces. It returns Miss if the
+// reply is nil.
+func (ks *keyspace) do(ctx context.Context, op, key string, args ...interface{}) (interface{}, error) {
+	client, prefix := runtime.CacheClient()
+	if client == nil {
+		return nil, errs.B().Code(errs.Internal).Msg("cache: caching not configured").Err()
+	}
+	cmd := append([]interface{}{op, prefix + ks.name + ":" + key}, args...)
+	return ks.run(ctx, op, client, cmd)
+}
+
+// eval runs script on key with args, like do.
+func (ks *keyspace) eval(ctx context.Context, op, script, key string, args ...interface{}) (interface{}, error) {
+	client, prefix := runtime.CacheClient()
+	if client == nil {
+		return nil, errs.B().Code(errs.Internal).Msg("cache: caching not configured").Err()
+	}
+	cmd := append([]interface{}{"EVAL", script, 1, prefix + ks.name + ":" + key}, args...)
+	return ks.run(ctx, op, client, cmd)
+}
+
+func (ks *keyspace) run(ctx context.Context, op string, client *redis.Client, cmd []interface{}) (interface{}, error) {
+	span := runtime.StartSpan("cache "+op, otel.Client,
+		otel.String("db.system", "redis"),
+		otel.String("db.operation", op),
+		otel.String("cache.keyspace", ks.name),
+	)
+	start := time.Now()
+	reply, err := client.Do(ctx, cmd...)
+	dur := time.Since(start)
+
+	var result string
+	switch {
+	case err == redis.Nil:
+		result, err = "miss", Miss
+	case err != nil:
+		result = "error"
+		err = errs.WrapCode(err, errs.Unavailable, "cache: "+op+" failed")
+	case op == "GET":
+		result = "hit"
+	default:
+		result = "ok"
+	}
+	if err == Miss {
+		span.End(nil)
+	} else {
+		span.End(err)
+	}
+	metrics.CacheOperation(ks.name, op, result, dur.Seconds())
+	return reply, err
+}
+
+// set sets key to value with the keyspace's TTL.
+func (ks *keyspace) set(ctx context.Context, key string, value interface{}) error {
+	var err error
+	if ttl := ks.cfg.DefaultTTL; ttl > 0 {
+		_, err = ks.do(ctx, "SET", key, value, "PX", ttl.Milliseconds())
+	} else {
+		_, err = ks.do(ctx, "SET", key, value)
+	}
+	return err
+}
+
+// Delete deletes key from the keyspace, reporting whether it existed.
+func (ks *keyspace) Delete(ctx context.Context, key string) (bool, error) {
+	n, err := redis.Int64(ks.do(ctx, "DEL", key))
+	return n > 0, err
+}
+
+// Expire sets key to expire after ttl, reporting whether it exists.
+func (ks *keyspace) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	n, err := redis.Int64(ks.do(ctx, "PEXPIRE", key, ttl.Milliseconds()))
+	return n > 0, err
+}
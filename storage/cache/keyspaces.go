@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/redis"
+)
+
+// StringKeyspace is a keyspace of strings.
+type StringKeyspace struct {
+	*keyspace
+}
+
+// NewStringKeyspace returns the keyspace of strings with the given name.
+func NewStringKeyspace(name string, cfg KeyspaceConfig) *StringKeyspace {
+	return &StringKeyspace{newKeyspace(name, cfg)}
+}
+
+// Get returns the value of key, or Miss if it is not cached.
+func (ks *StringKeyspace) Get(ctx context.Context, key string) (string, error) {
+	return redis.String(ks.do(ctx, "GET", key))
+}
+
+// Set sets key to value.
+func (ks *StringKeyspace) Set(ctx context.Context, key, value string) error {
+	return ks.set(ctx, key, value)
+}
+
+// IntKeyspace is a keyspace of integers.
+type IntKeyspace struct {
+	*keyspace
+}
+
+// NewIntKeyspace returns the keyspace of integers with the given name.
+func NewIntKeyspace(name string, cfg KeyspaceConfig) *IntKeyspace {
+	return &IntKeyspace{newKeyspace(name, cfg)}
+}
+
+// Get returns the value of key, or Miss if it is not cached.
+func (ks *IntKeyspace) Get(ctx context.Context, key string) (int64, error) {
+	return redis.Int64(ks.do(ctx, "GET", key))
+}
+
+// Set sets key to value.
+func (ks *IntKeyspace) Set(ctx context.Context, key string, value int64) error {
+	return ks.set(ctx, key, value)
+}
+
+// incrScript increments KEYS[1] by ARGV[1], setting it
+// to expire after ARGV[2] milliseconds if it has no TTL.
+const incrScript = `
+local v = redis.call("INCRBY", KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return v
+`
+
+// Increment increments the value of key by delta, treating a key
+// that is not cached as 0, and returns the new value. A key created
+// by incrementing it expires after the keyspace's TTL.
+func (ks *IntKeyspace) Increment(ctx context.Context, key string, delta int64) (int64, error) {
+	return redis.Int64(ks.eval(ctx, "INCRBY", incrScript, key, delta, ks.cfg.DefaultTTL.Milliseconds()))
+}
+
+// StructKeyspace is a keyspace of values encoded as JSON,
+// such as structs.
+type StructKeyspace struct {
+	*keyspace
+}
+
+// NewStructKeyspace returns the keyspace of JSON-encoded
+// values with the given name.
+func NewStructKeyspace(name string, cfg KeyspaceConfig) *StructKeyspace {
+	return &StructKeyspace{newKeyspace(name, cfg)}
+}
+
+// Get decodes the value of key into dst, which must be a pointer,
+// or returns Miss if it is not cached.
+func (ks *StructKeyspace) Get(ctx context.Context, key string, dst interface{}) error {
+	data, err := redis.String(ks.do(ctx, "GET", key))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(data), dst); err != nil {
+		return errs.WrapCode(err, errs.Internal, "cache: could not decode value")
+	}
+	return nil
+}
+
+// Set sets key to value, encoded as JSON.
+func (ks *StructKeyspace) Set(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return errs.WrapCode(err, errs.InvalidArgument, "cache: could not encode value")
+	}
+	return ks.set(ctx, key, data)
+}
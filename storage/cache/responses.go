@@ -0,0 +1,11 @@
+package cache
+
+import "runtime.encore.dev/runtime"
+
+// InvalidateResponses removes the cached responses of the endpoint
+// service.endpoint, so that they reflect changes made by a mutating
+// endpoint. If path is non-empty only the responses to requests
+// for it are removed.
+func InvalidateResponses(service, endpoint, path string) {
+	runtime.InvalidateResponses(service, endpoint, path)
+}
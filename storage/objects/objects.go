@@ -0,0 +1,359 @@
+// Package objects provides object storage buckets.
+//
+// Buckets store objects, such as uploaded files, under string keys.
+// They are typically declared as package-level variables:
+//
+//	var avatars = objects.NewBucket("avatars")
+//
+// Buckets are stored in S3, GCS or a local directory, as configured
+// by the server configuration's Buckets field. Operations are
+// measured and traced by bucket.
+package objects
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/objstore"
+	"runtime.encore.dev/internal/otel"
+	"runtime.encore.dev/runtime"
+)
+
+// ErrNotFound is returned for objects that do not exist.
+var ErrNotFound = &errs.Error{Code: errs.NotFound, Message: "object not found"}
+
+const (
+	defaultListLimit = 100
+	defaultURLExpiry = 15 * time.Minute
+)
+
+// Bucket is an object storage bucket.
+type Bucket struct {
+	name string
+}
+
+// NewBucket returns the bucket declared with the given name.
+func NewBucket(name string) *Bucket {
+	if name == "" {
+		panic("objects: bucket name must not be empty")
+	}
+	return &Bucket{name: name}
+}
+
+// Name returns the name of the bucket.
+func (b *Bucket) Name() string { return b.name }
+
+// ObjectAttrs are the attributes of an object.
+type ObjectAttrs struct {
+	Key         string
+	Size        int64
+	ContentType string // not set by List
+	ETag        string
+	Modified    time.Time
+}
+
+func convertAttrs(a *objstore.Attrs) *ObjectAttrs {
+	return &ObjectAttrs{
+		Key:         a.Key,
+		Size:        a.Size,
+		ContentType: a.ContentType,
+		ETag:        a.ETag,
+		Modified:    a.Modified,
+	}
+}
+
+// UploadOptions are options for uploading an object.
+type UploadOptions struct {
+	// ContentType is the content type of the object.
+	// If empty it defaults to "application/octet-stream".
+	ContentType string
+
+	// Size is the size of the object in bytes. If zero it is
+	// determined by reading the object, which S3 and GCS buckets
+	// buffer in a temporary file to do.
+	Size int64
+}
+
+// Upload stores the data read from r under key, replacing any
+// object stored under it.
+func (b *Bucket) Upload(ctx context.Context, key string, r io.Reader, opts UploadOptions) (*ObjectAttrs, error) {
+	d, err := b.driver()
+	if err != nil {
+		return nil, err
+	}
+	size := opts.Size
+	if size == 0 {
+		size = -1
+	}
+	cr := &countingReader{r: r}
+	var attrs *objstore.Attrs
+	err = b.run(ctx, "upload", key, func() (err error) {
+		attrs, err = d.Put(ctx, key, cr, objstore.PutOptions{ContentType: opts.ContentType, Size: size})
+		return err
+	})
+	metrics.ObjectBytes(b.name, "upload", cr.n)
+	if err != nil {
+		return nil, err
+	}
+	return convertAttrs(attrs), nil
+}
+
+// Reader reads an object. It must be closed.
+type Reader struct {
+	// Attrs are the attributes of the object.
+	Attrs *ObjectAttrs
+
+	bucket string
+	rc     io.ReadCloser
+	n      int64
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// Close closes the reader.
+func (r *Reader) Close() error {
+	metrics.ObjectBytes(r.bucket, "download", r.n)
+	r.n = 0
+	return r.rc.Close()
+}
+
+// Download opens the object stored under key, returning
+// ErrNotFound if there is none.
+func (b *Bucket) Download(ctx context.Context, key string) (*Reader, error) {
+	d, err := b.driver()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		rc    io.ReadCloser
+		attrs *objstore.Attrs
+	)
+	err = b.run(ctx, "download", key, func() (err error) {
+		rc, attrs, err = d.Get(ctx, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{Attrs: convertAttrs(attrs), bucket: b.name, rc: rc}, nil
+}
+
+// Attrs returns the attributes of the object stored under key,
+// returning ErrNotFound if there is none.
+func (b *Bucket) Attrs(ctx context.Context, key string) (*ObjectAttrs, error) {
+	d, err := b.driver()
+	if err != nil {
+		return nil, err
+	}
+	var attrs *objstore.Attrs
+	err = b.run(ctx, "attrs", key, func() (err error) {
+		attrs, err = d.Stat(ctx, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertAttrs(attrs), nil
+}
+
+// Delete deletes the object stored under key. Deleting an
+// object that does not exist is not an error.
+func (b *Bucket) Delete(ctx context.Context, key string) error {
+	d, err := b.driver()
+	if err != nil {
+		return err
+	}
+	return b.run(ctx, "delete", key, func() error {
+		return d.Delete(ctx, key)
+	})
+}
+
+// ListOptions are options for listing objects.
+type ListOptions struct {
+	// Prefix limits the objects listed to those with keys
+	// starting with it.
+	Prefix string
+
+	// After limits the objects listed to those with keys sorting
+	// after it, such as the last key of the previous page.
+	After string
+
+	// Limit is the maximum number of objects to list.
+	// If zero it defaults to 100, and it is at most 1000.
+	Limit int
+}
+
+// ListResult is a page of objects.
+type ListResult struct {
+	Objects []*ObjectAttrs
+
+	// More reports whether there are more objects, listed
+	// by setting ListOptions.After to the last key.
+	More bool
+}
+
+// List lists objects in key order.
+func (b *Bucket) List(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	d, err := b.driver()
+	if err != nil {
+		return nil, err
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	} else if limit > 1000 {
+		limit = 1000
+	}
+	var (
+		objs []*objstore.Attrs
+		more bool
+	)
+	err = b.run(ctx, "list", opts.Prefix, func() (err error) {
+		objs, more, err = d.List(ctx, opts.Prefix, opts.After, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := &ListResult{Objects: make([]*ObjectAttrs, len(objs)), More: more}
+	for i, o := range objs {
+		res.Objects[i] = convertAttrs(o)
+	}
+	return res, nil
+}
+
+// SignedURLOptions are options for signed URLs.
+type SignedURLOptions struct {
+	// Method is the method the URL grants, "GET" to download the
+	// object or "PUT" to upload it. If empty it defaults to "GET".
+	Method string
+
+	// Expiry is how long the URL is valid.
+	// If zero it defaults to 15 minutes.
+	Expiry time.Duration
+}
+
+// SignedURL returns a URL granting access to the object stored
+// under key without credentials, such as for clients to download
+// or upload it directly.
+func (b *Bucket) SignedURL(key string, opts SignedURLOptions) (string, error) {
+	d, err := b.driver()
+	if err != nil {
+		return "", err
+	}
+	method, expiry := opts.Method, opts.Expiry
+	if method == "" {
+		method = "GET"
+	} else if method != "GET" && method != "PUT" {
+		return "", errs.B().Code(errs.InvalidArgument).Msgf("objects: cannot sign method %s", method).Err()
+	}
+	if expiry == 0 {
+		expiry = defaultURLExpiry
+	}
+	url, err := d.SignURL(method, key, expiry)
+	if err == objstore.ErrInvalidKey {
+		return "", errs.B().Code(errs.InvalidArgument).Msg("objects: invalid key").Err()
+	} else if err != nil {
+		return "", errs.WrapCode(err, errs.InvalidArgument, "objects: could not sign url")
+	}
+	return url, nil
+}
+
+// Serve responds to req with the object stored under key, such as
+// from a raw endpoint, streaming it without buffering. It answers
+// conditional requests matching the object's ETag with 304 Not
+// Modified, and responds with an error if the object cannot be
+// read.
+func (b *Bucket) Serve(w http.ResponseWriter, req *http.Request, key string) {
+	r, err := b.Download(req.Context(), key)
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+	defer r.Close()
+
+	h := w.Header()
+	if r.Attrs.ETag != "" {
+		h.Set("ETag", r.Attrs.ETag)
+		if inm := req.Header.Get("If-None-Match"); inm == r.Attrs.ETag || inm == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	h.Set("Content-Type", r.Attrs.ContentType)
+	if r.Attrs.Size >= 0 {
+		h.Set("Content-Length", strconv.FormatInt(r.Attrs.Size, 10))
+	}
+	if !r.Attrs.Modified.IsZero() {
+		h.Set("Last-Modified", r.Attrs.Modified.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+	if req.Method != "HEAD" {
+		io.Copy(w, r)
+	}
+}
+
+func (b *Bucket) driver() (objstore.Driver, error) {
+	d := runtime.BucketDriver(b.name)
+	if d == nil {
+		return nil, errs.B().Code(errs.Internal).Msgf("objects: bucket %s not configured", b.name).Err()
+	}
+	return d, nil
+}
+
+// run runs the operation op on key, recording it in metrics and
+// traces and converting its error.
+func (b *Bucket) run(ctx context.Context, op, key string, fn func() error) error {
+	span := runtime.StartSpan("objects "+op, otel.Client,
+		otel.String("objects.bucket", b.name),
+		otel.String("objects.operation", op),
+		otel.String("objects.key", key),
+	)
+	start := time.Now()
+	err := fn()
+	dur := time.Since(start)
+
+	result := "ok"
+	switch {
+	case err == nil:
+	case err == objstore.ErrNotExist:
+		result, err = "not_found", ErrNotFound
+	case err == objstore.ErrInvalidKey:
+		result = "error"
+		err = errs.B().Code(errs.InvalidArgument).Msg("objects: invalid key").Err()
+	case ctx.Err() != nil:
+		result = "error"
+		err = errs.WrapCode(err, errs.Canceled, "objects: "+op+" canceled")
+	default:
+		result = "error"
+		err = errs.WrapCode(err, errs.Unavailable, "objects: "+op+" failed")
+	}
+	if err == ErrNotFound {
+		span.End(nil)
+	} else {
+		span.End(err)
+	}
+	metrics.ObjectOperation(b.name, op, result, dur.Seconds())
+	return err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
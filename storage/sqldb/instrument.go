@@ -0,0 +1,56 @@
+package sqldb
+
+import (
+	"sync"
+	"time"
+
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/internal/sqlfp"
+)
+
+// maxFingerprints is the maximum number of cached fingerprints.
+const maxFingerprints = 10000
+
+var (
+	fpMu         sync.RWMutex
+	fingerprints = make(map[string]string) // by query
+)
+
+// fingerprint returns the fingerprint of query, which identifies
+// it in metrics and spans without including its values.
+func fingerprint(query string) string {
+	fpMu.RLock()
+	fp, ok := fingerprints[query]
+	fpMu.RUnlock()
+	if ok {
+		return fp
+	}
+	fp = sqlfp.Fingerprint(query)
+	fpMu.Lock()
+	if len(fingerprints) < maxFingerprints {
+		fingerprints[query] = fp
+	}
+	fpMu.Unlock()
+	return fp
+}
+
+// queryObserver records the metrics of a query.
+type queryObserver struct {
+	db    string
+	stmt  string
+	start time.Time
+}
+
+func observeQuery(db, query string) *queryObserver {
+	return &queryObserver{db: db, stmt: fingerprint(query), start: time.Now()}
+}
+
+// done records the query completing with err.
+func (o *queryObserver) done(err error) {
+	metrics.SQLQuery(o.db, o.stmt, err != nil, time.Since(o.start).Seconds())
+}
+
+// rows records the number of rows returned or affected by the query.
+func (o *queryObserver) rows(n int64) {
+	metrics.SQLQueryRows(o.db, o.stmt, n)
+}
@@ -0,0 +1,122 @@
+package sqldb
+
+import (
+	"context"
+	"fmt"
+
+	"runtime.encore.dev/internal/migrate"
+	"runtime.encore.dev/runtime"
+	"runtime.encore.dev/runtime/config"
+)
+
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS encore_schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// setupMigrations loads the migrations of the database configured
+// by c, which are applied as a warm-up.
+func setupMigrations(c *config.SQLDatabase) {
+	migs, err := migrate.Load(c.Migrations)
+	if err != nil {
+		panic(fmt.Sprintf("sqldb: could not load migrations of database %s: %v", c.Name, err))
+	}
+	status := migrate.Status{Database: c.Name, State: migrate.Pending}
+	for _, m := range migs {
+		status.Pending = append(status.Pending, m.Version)
+	}
+	migrate.SetStatus(status)
+
+	runtime.OnWarmUp("sqldb migrations "+c.Name, func(ctx context.Context) error {
+		if err := applyMigrations(ctx, database(c.Name), migs, status); err != nil {
+			return fmt.Errorf("sqldb: could not migrate database %s: %v", c.Name, err)
+		}
+		return nil
+	})
+}
+
+// applyMigrations applies the migrations of db not yet applied, each
+// in its own transaction. A session-level advisory lock is held while
+// doing so, so that only one instance migrates the database at a time;
+// others wait and then find the migrations applied.
+func applyMigrations(ctx context.Context, db *Database, migs []*migrate.Migration, status migrate.Status) (err error) {
+	defer func() {
+		if err != nil {
+			status.State, status.Error = migrate.Failed, err.Error()
+			migrate.SetStatus(status)
+		}
+	}()
+	status.State = migrate.Running
+	migrate.SetStatus(status)
+
+	db.init()
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock(hashtext('encore_schema_migrations'))"); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext('encore_schema_migrations'))")
+
+	if _, err := conn.Exec(ctx, createMigrationsTable); err != nil {
+		return err
+	}
+	applied := make(map[uint64]bool)
+	rows, err := conn.Query(ctx, "SELECT version FROM encore_schema_migrations")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[uint64(v)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	status.Pending = nil
+	for _, m := range migs {
+		if applied[m.Version] {
+			status.Version = m.Version
+		} else {
+			status.Pending = append(status.Pending, m.Version)
+		}
+	}
+	migrate.SetStatus(status)
+
+	for _, m := range migs {
+		if applied[m.Version] {
+			continue
+		}
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, m.SQL); err != nil {
+			tx.Rollback(context.Background())
+			return fmt.Errorf("migration %d_%s: %v", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO encore_schema_migrations (version, name) VALUES ($1, $2)", int64(m.Version), m.Name); err != nil {
+			tx.Rollback(context.Background())
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+		status.Version, status.Pending = m.Version, status.Pending[1:]
+		migrate.SetStatus(status)
+		runtime.RootLogger.Info().Str("database", db.name).Uint64("version", m.Version).Str("name", m.Name).Msg("applied migration")
+	}
+	status.State = migrate.Done
+	migrate.SetStatus(status)
+	return nil
+}
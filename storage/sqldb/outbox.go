@@ -0,0 +1,248 @@
+package sqldb
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/runtime"
+	"runtime.encore.dev/runtime/config"
+	"runtime.encore.dev/types/uuid"
+)
+
+const (
+	outboxTable = "encore_outbox"
+
+	defaultOutboxPollInterval = 10 * time.Second
+	defaultOutboxBatchSize    = 100
+)
+
+const createOutboxTable = `
+CREATE TABLE IF NOT EXISTS encore_outbox (
+	id BIGSERIAL PRIMARY KEY,
+	message_id TEXT NOT NULL,
+	topic TEXT NOT NULL,
+	data BYTEA NOT NULL,
+	ordering_key TEXT NOT NULL DEFAULT '',
+	deliver_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// outboxRelay relays the messages in the outbox of a database
+// to the pub/sub broker.
+type outboxRelay struct {
+	db       *Database
+	kick     chan struct{}
+	interval time.Duration
+	batch    int
+}
+
+var (
+	outboxRelays = make(map[string]*outboxRelay) // by database name
+	outboxStop   context.CancelFunc
+	outboxWG     sync.WaitGroup
+)
+
+// setupOutbox prepares the relays of the configured outboxes. Their
+// tables are created as a warm-up, after which they are relayed until
+// shutdown.
+func setupOutbox(cfg config.Outbox) {
+	interval, batch := cfg.PollInterval, cfg.BatchSize
+	if interval <= 0 {
+		interval = defaultOutboxPollInterval
+	}
+	if batch <= 0 {
+		batch = defaultOutboxBatchSize
+	}
+	for _, name := range cfg.Databases {
+		outboxRelays[name] = &outboxRelay{
+			db:       database(name),
+			kick:     make(chan struct{}, 1),
+			interval: interval,
+			batch:    batch,
+		}
+	}
+	if len(outboxRelays) == 0 {
+		return
+	}
+
+	runtime.OnWarmUp("sqldb outbox", func(ctx context.Context) error {
+		for _, r := range outboxRelays {
+			r.db.init()
+			if _, err := r.db.pool.Exec(ctx, createOutboxTable); err != nil {
+				return errs.Wrap(err, "sqldb: could not create outbox of database "+r.db.name)
+			}
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		outboxStop = cancel
+		for _, r := range outboxRelays {
+			outboxWG.Add(1)
+			go r.run(ctx)
+		}
+		return nil
+	})
+	runtime.OnShutdown(func(ctx context.Context) {
+		if outboxStop == nil {
+			return
+		}
+		outboxStop()
+		done := make(chan struct{})
+		go func() {
+			outboxWG.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// Publish publishes msg, encoded as JSON, to topic once tx commits,
+// and returns the ID the message is published with. The message is
+// written to the outbox of the transaction's database, which must be
+// configured to have one, and is not published if tx rolls back.
+func (tx *Tx) Publish(ctx context.Context, topic string, msg interface{}, opts runtime.PublishOptions) (id string, err error) {
+	if outboxRelays[tx.db] == nil {
+		return "", errs.B().Code(errs.FailedPrecondition).Msgf("sqldb: database %s has no outbox", tx.db).Err()
+	}
+	if len(opts.ID) > 255 {
+		return "", errs.B().Code(errs.InvalidArgument).Msg("sqldb: message id too long").Err()
+	}
+	if opts.Delay < 0 || (opts.Delay > 0 && !opts.DeliverAt.IsZero()) {
+		return "", errs.B().Code(errs.InvalidArgument).Msg("sqldb: invalid delivery time").Err()
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return "", errs.WrapCode(err, errs.InvalidArgument, "sqldb: could not encode message")
+	}
+	id = opts.ID
+	if id == "" {
+		uid, err := uuid.NewV4()
+		if err != nil {
+			return "", errs.WrapCode(err, errs.Internal, "sqldb: could not generate message id")
+		}
+		id = uid.String()
+	}
+	var deliverAt *time.Time
+	if opts.Delay > 0 {
+		t := time.Now().Add(opts.Delay)
+		deliverAt = &t
+	} else if !opts.DeliverAt.IsZero() {
+		deliverAt = &opts.DeliverAt
+	}
+
+	_, err = tx.exec(ctx, "INSERT INTO "+outboxTable+" (message_id, topic, data, ordering_key, deliver_at) VALUES ($1, $2, $3, $4, $5)",
+		id, topic, data, opts.OrderingKey, deliverAt)
+	if err != nil {
+		return "", err
+	}
+	tx.outbox = true
+	return id, nil
+}
+
+// relayOutbox relays the messages in the outbox of the
+// database named db without waiting for the next poll.
+func relayOutbox(db string) {
+	if r := outboxRelays[db]; r != nil {
+		select {
+		case r.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run relays the outbox whenever kicked or polled until ctx is canceled.
+func (r *outboxRelay) run(ctx context.Context) {
+	defer outboxWG.Done()
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		for {
+			n, err := r.relay(ctx)
+			if ctx.Err() != nil {
+				return
+			} else if err != nil {
+				runtime.RootLogger.Error().Err(err).Str("database", r.db.name).Msg("sqldb: could not relay outbox")
+			}
+			if err != nil || n < r.batch {
+				break
+			}
+		}
+		select {
+		case <-t.C:
+		case <-r.kick:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// relay publishes a batch of messages from the outbox in the order
+// they were written, deleting those published, and returns the
+// number published. Relays of the same outbox are serialized with
+// an advisory lock so that ordering keys are respected. Messages are
+// published at least once: if deleting them fails they are published
+// again with the same ID, which subscriptions with a dedup window
+// handle only once.
+func (r *outboxRelay) relay(ctx context.Context) (n int, err error) {
+	tx, err := r.db.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var locked bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock(hashtext($1))", outboxTable).Scan(&locked); err != nil {
+		return 0, err
+	} else if !locked {
+		return 0, nil // relayed by another instance
+	}
+
+	rows, err := tx.Query(ctx, "SELECT id, message_id, topic, data, ordering_key, deliver_at FROM "+outboxTable+" ORDER BY id LIMIT $1", r.batch)
+	if err != nil {
+		return 0, err
+	}
+	type entry struct {
+		id    int64
+		topic string
+		data  []byte
+		at    *time.Time
+		opts  runtime.PublishOptions
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.opts.ID, &e.topic, &e.data, &e.opts.OrderingKey, &e.at); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var published []int64
+	for _, e := range entries {
+		if e.at != nil {
+			e.opts.DeliverAt = *e.at
+		}
+		if _, err = runtime.PublishWithOptions(ctx, e.topic, json.RawMessage(e.data), e.opts); err != nil {
+			break
+		}
+		published = append(published, e.id)
+	}
+	if len(published) > 0 {
+		if _, err := tx.Exec(ctx, "DELETE FROM "+outboxTable+" WHERE id = ANY($1)", published); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return len(published), err
+}
@@ -0,0 +1,205 @@
+package sqldb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"runtime.encore.dev/internal/metrics"
+	"runtime.encore.dev/runtime"
+	"runtime.encore.dev/runtime/config"
+)
+
+const (
+	defaultCredentialsTTL = 5 * time.Minute
+	defaultMaxConns       = 30
+)
+
+// errAcquireTimeout is returned when no connection
+// could be acquired within the acquire timeout.
+var errAcquireTimeout = errors.New("sqldb: timed out acquiring connection")
+
+// dbConfigs are the configured databases by name, set by Setup.
+var dbConfigs = make(map[string]*config.SQLDatabase)
+
+// setupDatabases records the configured databases, whose pools are
+// created when first used, and prepares applying their migrations.
+func setupDatabases(cfgs []*config.SQLDatabase) {
+	dbMu.Lock()
+	for _, c := range cfgs {
+		if c.Name == "" || dbConfigs[c.Name] != nil {
+			dbMu.Unlock()
+			panic("sqldb: database names must be unique and non-empty")
+		}
+		dbConfigs[c.Name] = c
+	}
+	dbMu.Unlock()
+
+	for _, c := range cfgs {
+		if c.Migrations != nil {
+			setupMigrations(c)
+		}
+	}
+}
+
+// poolConfig returns the configuration of the pool of the database
+// named name, from the server configuration if it is configured
+// there and from the environment otherwise.
+func poolConfig(name string) (*pgxpool.Config, error) {
+	dbMu.RLock()
+	c := dbConfigs[name]
+	dbMu.RUnlock()
+	if c == nil {
+		addr := os.Getenv("ENCORE_SQLDB_ADDRESS")
+		passwd := os.Getenv("ENCORE_SQLDB_PASSWORD")
+		if addr == "" {
+			return nil, fmt.Errorf("database %s not configured and ENCORE_SQLDB_ADDRESS not set", name)
+		}
+		uri := fmt.Sprintf("postgresql://encore:%s@%s/%s?sslmode=disable", passwd, addr, name)
+		cfg, err := pgxpool.ParseConfig(uri)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MaxConns = defaultMaxConns
+		return cfg, nil
+	}
+	return hostPoolConfig(c, c.Host)
+}
+
+// hostPoolConfig returns the configuration of a pool of
+// connections to the database configured by c on host.
+func hostPoolConfig(c *config.SQLDatabase, host string) (*pgxpool.Config, error) {
+	dbName := c.DatabaseName
+	if dbName == "" {
+		dbName = c.Name
+	}
+	uri := fmt.Sprintf("postgresql://%s/%s?sslmode=disable", host, url.PathEscape(dbName))
+	cfg, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ConnConfig.User = c.User
+	cfg.ConnConfig.Password = c.Password
+	cfg.ConnConfig.TLSConfig = c.TLS
+	cfg.MaxConns = defaultMaxConns
+	if c.MaxConns > 0 {
+		cfg.MaxConns = int32(c.MaxConns)
+	}
+	if c.MinConns > 0 {
+		cfg.MinConns = int32(c.MinConns)
+	}
+	if c.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = c.MaxConnLifetime
+	}
+	if c.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	if c.CredentialsSecret != "" {
+		creds := &credentials{fetch: secretCredentials(c.CredentialsSecret)}
+		runtime.OnSecretChange(c.CredentialsSecret, creds.expire)
+		cfg.BeforeConnect = creds.apply
+	} else if c.Credentials != nil {
+		creds := &credentials{fetch: c.Credentials, ttl: c.CredentialsTTL}
+		if creds.ttl <= 0 {
+			creds.ttl = defaultCredentialsTTL
+		}
+		cfg.BeforeConnect = creds.apply
+	}
+	return cfg, nil
+}
+
+// credentials caches the credentials of a database returned
+// by its configured Credentials function or read from its
+// CredentialsSecret.
+type credentials struct {
+	fetch func(ctx context.Context) (user, password string, err error)
+	ttl   time.Duration // or 0 to use them until expired
+
+	mu       sync.Mutex
+	user     string
+	password string
+	fetched  time.Time
+	expired  bool
+}
+
+// apply sets the credentials of a connection being opened,
+// fetching them again once they are older than the TTL or expired.
+// If fetching them fails the previous credentials are used, if any.
+func (c *credentials) apply(ctx context.Context, cc *pgx.ConnConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fetched.IsZero() || c.expired || (c.ttl > 0 && time.Since(c.fetched) >= c.ttl) {
+		user, password, err := c.fetch(ctx)
+		if err == nil {
+			c.user, c.password, c.fetched, c.expired = user, password, time.Now(), false
+		} else if c.fetched.IsZero() {
+			return fmt.Errorf("sqldb: could not get credentials: %v", err)
+		}
+	}
+	cc.User, cc.Password = c.user, c.password
+	return nil
+}
+
+// expire makes the credentials be fetched again
+// when the next connection is opened.
+func (c *credentials) expire() {
+	c.mu.Lock()
+	c.expired = true
+	c.mu.Unlock()
+}
+
+// secretCredentials returns a function reading credentials from the
+// secret with the given name, holding JSON with "username" and
+// "password" fields.
+func secretCredentials(name string) func(ctx context.Context) (user, password string, err error) {
+	return func(ctx context.Context) (user, password string, err error) {
+		v, ok := runtime.Secret(name)
+		if !ok {
+			return "", "", fmt.Errorf("secret %s not set", name)
+		}
+		var creds struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.Unmarshal([]byte(v), &creds); err != nil {
+			return "", "", fmt.Errorf("secret %s does not hold valid credentials", name)
+		}
+		return creds.Username, creds.Password, nil
+	}
+}
+
+// acquire acquires a connection from pool, one of the pools
+// of the database, waiting at most its acquire timeout.
+func (db *Database) acquire(ctx context.Context, pool *pgxpool.Pool) (*pgxpool.Conn, error) {
+	actx := ctx
+	if db.acquireTimeout > 0 {
+		var cancel context.CancelFunc
+		actx, cancel = context.WithTimeout(ctx, db.acquireTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	conn, err := pool.Acquire(actx)
+	timedOut := err != nil && actx.Err() != nil && ctx.Err() == nil
+	metrics.SQLPoolAcquire(db.name, time.Since(start).Seconds(), timedOut)
+	if timedOut {
+		return nil, errAcquireTimeout
+	}
+	return conn, err
+}
+
+// registerPoolMetrics reports the statistics of pool,
+// such as "primary", when metrics are gathered.
+func registerPoolMetrics(db, name string, pool *pgxpool.Pool) {
+	metrics.RegisterSQLPool(db, name, func() metrics.SQLPoolStats {
+		s := pool.Stat()
+		return metrics.SQLPoolStats{InUse: s.AcquiredConns(), Idle: s.IdleConns(), Max: s.MaxConns()}
+	})
+}
@@ -0,0 +1,166 @@
+package sqldb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"runtime.encore.dev/runtime"
+)
+
+const (
+	defaultMaxReplicaLag = 10 * time.Second
+
+	// replicaCheckInterval is how often the lag of replicas is measured.
+	// Replicas not measured for three intervals are not queried.
+	replicaCheckInterval = 5 * time.Second
+)
+
+// replicaLagQuery measures how far a replica lags behind the primary.
+// It is not lagging if it has replayed all it has received, even if
+// the primary has not written anything recently.
+const replicaLagQuery = `
+SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+type readOnlyKey struct{}
+
+// ReadOnly returns a copy of ctx marking queries made with it as only
+// reading data, so that they can be made to a read replica of the
+// database. Such queries may not see the latest writes, including
+// those made just before by the same request.
+//
+// Only queries made with Query and QueryRow are routed to replicas;
+// Exec and transactions always use the primary.
+func ReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+func isReadOnly(ctx context.Context) bool {
+	ro, _ := ctx.Value(readOnlyKey{}).(bool)
+	return ro
+}
+
+// replicaSet is the read replicas of a database.
+type replicaSet struct {
+	replicas []*replica
+	maxLag   time.Duration
+	next     uint32 // for round-robin selection
+}
+
+// replica is a read replica of a database.
+type replica struct {
+	addr string
+	pool *pgxpool.Pool
+
+	mu      sync.Mutex
+	lag     time.Duration
+	checked time.Time // when the lag was last measured
+}
+
+// newReplicaSet creates pools for the configured replicas of the
+// database named name and starts measuring their lag. It returns
+// nil if there are none.
+func newReplicaSet(name string) *replicaSet {
+	dbMu.RLock()
+	c := dbConfigs[name]
+	dbMu.RUnlock()
+	if c == nil || len(c.Replicas) == 0 {
+		return nil
+	}
+
+	rs := &replicaSet{maxLag: c.MaxReplicaLag}
+	if rs.maxLag <= 0 {
+		rs.maxLag = defaultMaxReplicaLag
+	}
+	for _, addr := range c.Replicas {
+		cfg, err := hostPoolConfig(c, addr)
+		if err != nil {
+			panic("sqldb: invalid replica config: " + err.Error())
+		}
+		cfg.LazyConnect = true
+		pool, err := pgxpool.ConnectConfig(context.Background(), cfg)
+		if err != nil {
+			panic("sqldb: setup replica: " + err.Error())
+		}
+		registerPoolMetrics(name, addr, pool)
+		r := &replica{addr: addr, pool: pool}
+		rs.replicas = append(rs.replicas, r)
+		go r.monitor(name)
+	}
+	return rs
+}
+
+// pick returns the pool of a replica, selected round-robin among
+// those lagging at most maxLag, or nil if there is none.
+func (rs *replicaSet) pick() *pgxpool.Pool {
+	n := uint32(len(rs.replicas))
+	start := atomic.AddUint32(&rs.next, 1)
+	for i := uint32(0); i < n; i++ {
+		if r := rs.replicas[(start+i)%n]; r.fresh(rs.maxLag) {
+			return r.pool
+		}
+	}
+	return nil
+}
+
+// fresh reports whether the replica has recently
+// been measured to lag at most maxLag.
+func (r *replica) fresh(maxLag time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Since(r.checked) < 3*replicaCheckInterval && r.lag <= maxLag
+}
+
+// monitor periodically measures the lag of the replica.
+func (r *replica) monitor(db string) {
+	t := time.NewTicker(replicaCheckInterval)
+	defer t.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaCheckInterval)
+		var secs float64
+		err := r.pool.QueryRow(ctx, replicaLagQuery).Scan(&secs)
+		cancel()
+		if err != nil {
+			runtime.RootLogger.Warn().Err(err).Str("database", db).Str("replica", r.addr).Msg("sqldb: could not measure replica lag")
+		} else {
+			r.mu.Lock()
+			r.lag, r.checked = time.Duration(secs*float64(time.Second)), time.Now()
+			r.mu.Unlock()
+		}
+		<-t.C
+	}
+}
+
+// readPool returns the pool to make a query with ctx to: a replica
+// if ctx is marked read-only and one is fresh enough, or the primary.
+func (db *Database) readPool(ctx context.Context) *pgxpool.Pool {
+	if db.replicas != nil && isReadOnly(ctx) {
+		if p := db.replicas.pick(); p != nil {
+			return p
+		}
+	}
+	return db.pool
+}
+
+// poolQuery makes a query on a connection acquired from the pool to
+// make it to, returning the connection to release once the rows are
+// closed.
+func (db *Database) poolQuery(ctx context.Context, query string, args ...interface{}) (pgx.Rows, *pgxpool.Conn, error) {
+	conn, err := db.acquire(ctx, db.readPool(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		conn.Release()
+		return nil, nil, err
+	}
+	return rows, conn, nil
+}
@@ -4,16 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
-	"fmt"
-	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/jackc/pgx/v4/stdlib"
 
 	"runtime.encore.dev/beta/errs"
+	"runtime.encore.dev/internal/health"
+	"runtime.encore.dev/internal/otel"
 	"runtime.encore.dev/internal/stack"
 	"runtime.encore.dev/runtime"
 	"runtime.encore.dev/runtime/config"
@@ -49,8 +50,11 @@ func QueryRow(ctx context.Context, query string, args ...interface{}) *Row {
 }
 
 type Tx struct {
-	txid uint64
-	std  pgx.Tx
+	txid   uint64
+	db     string
+	std    pgx.Tx
+	conn   *pgxpool.Conn // released once the transaction completes
+	outbox bool          // whether messages were written to the outbox
 }
 
 func Begin(ctx context.Context) (*Tx, error) {
@@ -72,16 +76,21 @@ func (tx *Tx) Rollback() error { return tx.rollback() }
 func (tx *Tx) commit() error {
 	err := tx.std.Commit(context.Background())
 	err = convertErr(err)
+	tx.release()
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceCompleteTxEnd(req.SpanID, uint64(goid), tx.txid, true, err, 4)
 	}
+	if err == nil && tx.outbox {
+		relayOutbox(tx.db)
+	}
 	return err
 }
 
 func (tx *Tx) rollback() error {
 	err := tx.std.Rollback(context.Background())
 	err = convertErr(err)
+	tx.release()
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceCompleteTxEnd(req.SpanID, uint64(goid), tx.txid, false, err, 4)
@@ -89,6 +98,14 @@ func (tx *Tx) rollback() error {
 	return err
 }
 
+// release releases the connection of the transaction.
+func (tx *Tx) release() {
+	if tx.conn != nil {
+		tx.conn.Release()
+		tx.conn = nil
+	}
+}
+
 func ExecTx(tx *Tx, ctx context.Context, query string, args ...interface{}) (ExecResult, error) {
 	return tx.exec(ctx, query, args...)
 }
@@ -99,6 +116,8 @@ func (tx *Tx) Exec(ctx context.Context, query string, args ...interface{}) (Exec
 
 func (tx *Tx) exec(ctx context.Context, query string, args ...interface{}) (ExecResult, error) {
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery(tx.db, query)
+	span := startQuerySpan(tx.db, query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, tx.txid, 4)
@@ -107,6 +126,11 @@ func (tx *Tx) exec(ctx context.Context, query string, args ...interface{}) (Exec
 	res, err := tx.std.Exec(ctx, query, args...)
 	err = convertErr(err)
 
+	span.End(err)
+	obs.done(err)
+	if err == nil {
+		obs.rows(res.RowsAffected())
+	}
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, err)
 	}
@@ -124,6 +148,8 @@ func (tx *Tx) Query(ctx context.Context, query string, args ...interface{}) (*Ro
 
 func (tx *Tx) query(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery(tx.db, query)
+	span := startQuerySpan(tx.db, query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, tx.txid, 4)
@@ -132,6 +158,8 @@ func (tx *Tx) query(ctx context.Context, query string, args ...interface{}) (*Ro
 	rows, err := tx.std.Query(ctx, query, args...)
 	err = convertErr(err)
 
+	span.End(err)
+	obs.done(err)
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, err)
 	}
@@ -139,7 +167,7 @@ func (tx *Tx) query(ctx context.Context, query string, args ...interface{}) (*Ro
 	if err != nil {
 		return nil, err
 	}
-	return &Rows{std: rows}, nil
+	return &Rows{std: rows, obs: obs}, nil
 }
 
 func QueryRowTx(tx *Tx, ctx context.Context, query string, args ...interface{}) *Row {
@@ -152,6 +180,8 @@ func (tx *Tx) QueryRow(ctx context.Context, query string, args ...interface{}) *
 
 func (tx *Tx) queryRow(ctx context.Context, query string, args ...interface{}) *Row {
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery(tx.db, query)
+	span := startQuerySpan(tx.db, query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, tx.txid, 4)
@@ -161,8 +191,10 @@ func (tx *Tx) queryRow(ctx context.Context, query string, args ...interface{}) *
 	// Work around this by using Query.
 	rows, err := tx.std.Query(ctx, query, args...)
 	err = convertErr(err)
-	r := &Row{rows: rows, err: err}
+	r := &Row{rows: rows, err: err, obs: obs}
 
+	span.End(r.err)
+	obs.done(r.err)
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, r.Err())
 	}
@@ -171,34 +203,68 @@ func (tx *Tx) queryRow(ctx context.Context, query string, args ...interface{}) *
 }
 
 type Rows struct {
-	std pgx.Rows
+	std  pgx.Rows
+	conn *pgxpool.Conn // released once closed, or nil
+	obs  *queryObserver
+	n    int64 // rows returned so far
 }
 
-func (r *Rows) Close()                         { r.std.Close() }
 func (r *Rows) Scan(dest ...interface{}) error { return r.std.Scan(dest...) }
 func (r *Rows) Err() error                     { return r.std.Err() }
-func (r *Rows) Next() bool                     { return r.std.Next() }
+
+func (r *Rows) Close() {
+	r.std.Close()
+	if r.conn != nil {
+		r.conn.Release()
+		r.conn = nil
+	}
+	if r.obs != nil {
+		r.obs.rows(r.n)
+		r.obs = nil
+	}
+}
+
+func (r *Rows) Next() bool {
+	if !r.std.Next() {
+		r.Close()
+		return false
+	}
+	r.n++
+	return true
+}
 
 type Row struct {
 	rows pgx.Rows
+	conn *pgxpool.Conn // released once scanned, or nil
 	err  error
+	obs  *queryObserver
 }
 
 func (r *Row) Scan(dest ...interface{}) error {
 	if r.err != nil {
 		return r.err
 	}
+	defer r.release()
 	if !r.rows.Next() {
+		r.obs.rows(0)
 		if err := r.rows.Err(); err != nil {
 			return convertErr(err)
 		}
 		return errs.DropStackFrame(errs.WrapCode(sql.ErrNoRows, errs.NotFound, ""))
 	}
+	r.obs.rows(1)
 	r.rows.Scan(dest...)
 	r.rows.Close()
 	return convertErr(r.rows.Err())
 }
 
+func (r *Row) release() {
+	if r.conn != nil {
+		r.conn.Release()
+		r.conn = nil
+	}
+}
+
 func (r *Row) Err() error {
 	if r.err != nil {
 		return r.err
@@ -216,8 +282,46 @@ func getDB() *Database {
 	if req == nil {
 		panic("sqldb: no current request")
 	}
-	name := req.Service
+	return database(defaultDB(req.Service))
+}
+
+// serviceDBs are the databases declared by each service, set by Setup.
+var serviceDBs = make(map[string][]string)
+
+// defaultDB returns the name of the default database of the
+// service svc: the first it declares, or the one named after it.
+func defaultDB(svc string) string {
+	if dbs := serviceDBs[svc]; len(dbs) > 0 {
+		return dbs[0]
+	}
+	return svc
+}
+
+// Lookup returns the database with the given name. If called during
+// a request to a service declaring the databases it uses, the
+// database must be among them. Unlike Named, the name need not
+// be a constant.
+func Lookup(name string) (*Database, error) {
+	if req, _, _ := runtime.CurrentRequest(); req != nil {
+		if dbs := serviceDBs[req.Service]; len(dbs) > 0 && !contains(dbs, name) {
+			return nil, errs.B().Code(errs.PermissionDenied).
+				Msgf("sqldb: service %s does not declare database %s", req.Service, name).Err()
+		}
+	}
+	return database(name), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
 
+// database returns the database with the given name.
+func database(name string) *Database {
 	dbMu.RLock()
 	db, ok := dbMap[name]
 	dbMu.RUnlock()
@@ -227,33 +331,48 @@ func getDB() *Database {
 
 	dbMu.Lock()
 	defer dbMu.Unlock()
-	db = &Database{name: name, pool: getPool(name)}
+	db = &Database{name: name} // connected to when first used
 	dbMap[name] = db
 	return db
 }
 
 func getPool(name string) *pgxpool.Pool {
-	addr := os.Getenv("ENCORE_SQLDB_ADDRESS")
-	passwd := os.Getenv("ENCORE_SQLDB_PASSWORD")
-	if addr == "" {
-		panic("sqldb: ENCORE_SQLDB_ADDRESS not set")
-	}
-
-	uri := fmt.Sprintf("postgresql://encore:%s@%s/%s?sslmode=disable", passwd, addr, name)
-	cfg, err := pgxpool.ParseConfig(uri)
+	cfg, err := poolConfig(name)
 	if err != nil {
-		panic("sqldb: invalid database uri: " + err.Error())
+		panic("sqldb: invalid database config: " + err.Error())
 	}
 	cfg.LazyConnect = true
-	cfg.MaxConns = 30
 	pool, err := pgxpool.ConnectConfig(context.Background(), cfg)
 	if err != nil {
 		panic("sqldb: setup db: " + err.Error())
 	}
+	registerPoolMetrics(name, "primary", pool)
+	health.Register("sqldb:"+name, health.Readiness, func(ctx context.Context) error {
+		return ping(ctx, pool)
+	})
 	return pool
 }
 
-func Setup(cfg *config.ServerConfig) {}
+// ping checks that a connection to the database can be acquired
+// from pool and responds.
+func ping(ctx context.Context, pool *pgxpool.Pool) error {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+	return c.Conn().Ping(ctx)
+}
+
+func Setup(cfg *config.ServerConfig) {
+	for _, svc := range cfg.Services {
+		if len(svc.Databases) > 0 {
+			serviceDBs[svc.Name] = svc.Databases
+		}
+	}
+	setupDatabases(cfg.SQLDatabases)
+	setupOutbox(cfg.PubSub.Outbox)
+}
 
 func convertErr(err error) error {
 	switch err {
@@ -269,8 +388,16 @@ func convertErr(err error) error {
 
 type constStr string
 
+// Named returns the database with the given name, sharing its
+// pools with other uses of the database, and connects to it
+// at startup.
 func Named(name constStr) *Database {
-	return &Database{name: string(name)}
+	db := database(string(name))
+	health.RegisterStartup("sqldb:"+db.name, func(ctx context.Context) error {
+		db.init()
+		return ping(ctx, db.pool)
+	})
+	return db
 }
 
 type Database struct {
@@ -279,11 +406,19 @@ type Database struct {
 	initOnce sync.Once
 	pool     *pgxpool.Pool
 	connStr  string
+	replicas *replicaSet // or nil if there are no replicas
+
+	acquireTimeout time.Duration
 
 	stdlibOnce sync.Once
 	stdlib     *sql.DB
 }
 
+// Name returns the name of the database.
+func (db *Database) Name() string {
+	return db.name
+}
+
 func (db *Database) Exec(ctx context.Context, query string, args ...interface{}) (ExecResult, error) {
 	return db.exec(ctx, query, args...)
 }
@@ -291,14 +426,26 @@ func (db *Database) Exec(ctx context.Context, query string, args ...interface{})
 func (db *Database) exec(ctx context.Context, query string, args ...interface{}) (ExecResult, error) {
 	db.init()
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery(db.name, query)
+	span := startQuerySpan(db.name, query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, 0, 4)
 	}
 
-	res, err := db.pool.Exec(ctx, query, args...)
+	var res ExecResult
+	conn, err := db.acquire(ctx, db.pool)
+	if err == nil {
+		res, err = conn.Exec(ctx, query, args...)
+		conn.Release()
+	}
 	err = convertErr(err)
 
+	span.End(err)
+	obs.done(err)
+	if err == nil {
+		obs.rows(res.RowsAffected())
+	}
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, err)
 	}
@@ -317,14 +464,18 @@ func (db *Database) QueryRow(ctx context.Context, query string, args ...interfac
 func (db *Database) query(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
 	db.init()
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery(db.name, query)
+	span := startQuerySpan(db.name, query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, 0, 4)
 	}
 
-	rows, err := db.pool.Query(ctx, query, args...)
+	rows, conn, err := db.poolQuery(ctx, query, args...)
 	err = convertErr(err)
 
+	span.End(err)
+	obs.done(err)
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, err)
 	}
@@ -332,21 +483,25 @@ func (db *Database) query(ctx context.Context, query string, args ...interface{}
 	if err != nil {
 		return nil, err
 	}
-	return &Rows{std: rows}, nil
+	return &Rows{std: rows, conn: conn, obs: obs}, nil
 }
 
 func (db *Database) queryRow(ctx context.Context, query string, args ...interface{}) *Row {
 	db.init()
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery(db.name, query)
+	span := startQuerySpan(db.name, query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, 0, 4)
 	}
 
-	rows, err := db.pool.Query(ctx, query, args...)
+	rows, conn, err := db.poolQuery(ctx, query, args...)
 	err = convertErr(err)
-	r := &Row{rows: rows, err: err}
+	r := &Row{rows: rows, conn: conn, err: err, obs: obs}
 
+	span.End(r.err)
+	obs.done(r.err)
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, r.Err())
 	}
@@ -360,7 +515,13 @@ func (db *Database) Begin(ctx context.Context) (*Tx, error) {
 
 func (db *Database) begin(ctx context.Context) (*Tx, error) {
 	db.init()
-	tx, err := db.pool.Begin(ctx)
+	conn, err := db.acquire(ctx, db.pool)
+	var tx pgx.Tx
+	if err == nil {
+		if tx, err = conn.Begin(ctx); err != nil {
+			conn.Release()
+		}
+	}
 	err = convertErr(err)
 	if err != nil {
 		return nil, err
@@ -371,7 +532,7 @@ func (db *Database) begin(ctx context.Context) (*Tx, error) {
 		traceBeginTxEnd(req.SpanID, uint64(goid), txid, 4)
 	}
 
-	return &Tx{txid: txid, std: tx}, nil
+	return &Tx{txid: txid, db: db.name, std: tx, conn: conn}, nil
 }
 
 func (db *Database) init() {
@@ -380,6 +541,12 @@ func (db *Database) init() {
 			db.pool = getPool(db.name)
 		}
 		db.connStr = stdlib.RegisterConnConfig(db.pool.Config().ConnConfig)
+		db.replicas = newReplicaSet(db.name)
+		dbMu.RLock()
+		if c := dbConfigs[db.name]; c != nil {
+			db.acquireTimeout = c.AcquireTimeout
+		}
+		dbMu.RUnlock()
 	})
 }
 
@@ -412,11 +579,15 @@ var _ middleware = (*interceptor)(nil)
 
 func (*interceptor) ConnQuery(ctx context.Context, conn driver.QueryerContext, query string, args []driver.NamedValue) (driver.Rows, error) {
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery("", query)
+	span := startQuerySpan("", query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, 0, 5)
 	}
 	rows, err := conn.QueryContext(ctx, query, args)
+	span.End(err)
+	obs.done(err)
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, err)
 	}
@@ -425,11 +596,20 @@ func (*interceptor) ConnQuery(ctx context.Context, conn driver.QueryerContext, q
 
 func (*interceptor) ConnExec(ctx context.Context, conn driver.ExecerContext, query string, args []driver.NamedValue) (driver.Result, error) {
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery("", query)
+	span := startQuerySpan("", query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, 0, 5)
 	}
 	res, err := conn.ExecContext(ctx, query, args)
+	span.End(err)
+	obs.done(err)
+	if err == nil {
+		if n, err := res.RowsAffected(); err == nil {
+			obs.rows(n)
+		}
+	}
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, err)
 	}
@@ -438,11 +618,15 @@ func (*interceptor) ConnExec(ctx context.Context, conn driver.ExecerContext, que
 
 func (*interceptor) StmtQuery(ctx context.Context, conn driver.StmtQueryContext, query string, args []driver.NamedValue) (driver.Rows, error) {
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery("", query)
+	span := startQuerySpan("", query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, 0, 5)
 	}
 	rows, err := conn.QueryContext(ctx, args)
+	span.End(err)
+	obs.done(err)
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, err)
 	}
@@ -451,11 +635,20 @@ func (*interceptor) StmtQuery(ctx context.Context, conn driver.StmtQueryContext,
 
 func (*interceptor) StmtExec(ctx context.Context, conn driver.StmtExecContext, query string, args []driver.NamedValue) (driver.Result, error) {
 	qid := atomic.AddUint64(&queryCounter, 1)
+	obs := observeQuery("", query)
+	span := startQuerySpan("", query)
 	req, goid, _ := runtime.CurrentRequest()
 	if req != nil && req.Traced {
 		traceQueryStart(query, req.SpanID, uint64(goid), qid, 0, 5)
 	}
 	res, err := conn.ExecContext(ctx, args)
+	span.End(err)
+	obs.done(err)
+	if err == nil {
+		if n, err := res.RowsAffected(); err == nil {
+			obs.rows(n)
+		}
+	}
 	if req != nil && req.Traced {
 		traceQueryEnd(qid, err)
 	}
@@ -518,6 +711,20 @@ var (
 
 const driverName = "__encore_stdlib"
 
+// startQuerySpan starts an OpenTelemetry span for a query, whose
+// statement is fingerprinted so that the span does not include any
+// values in it. The span is nil if tracing is disabled.
+func startQuerySpan(dbName, query string) *otel.Span {
+	attrs := []otel.Attr{
+		otel.String("db.system", "postgresql"),
+		otel.String("db.statement", fingerprint(query)),
+	}
+	if dbName != "" {
+		attrs = append(attrs, otel.String("db.name", dbName))
+	}
+	return runtime.StartSpan("query", otel.Client, attrs...)
+}
+
 func traceQueryStart(query string, spanID runtime.SpanID, goid, qid, txid uint64, skipFrames int) {
 	var tb runtime.TraceBuf
 	tb.UVarint(qid)
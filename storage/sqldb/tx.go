@@ -0,0 +1,102 @@
+package sqldb
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxTxAttempts is the maximum number of attempts
+	// at running a transaction with InTx.
+	maxTxAttempts = 5
+
+	minTxBackoff = 10 * time.Millisecond
+	maxTxBackoff = time.Second
+)
+
+// InTx runs fn in a transaction of the current service's database,
+// committing it if fn returns nil and rolling it back otherwise.
+// See (*Database).InTx for details.
+func InTx(ctx context.Context, fn func(tx *Tx) error) error {
+	return getDB().InTx(ctx, fn)
+}
+
+// InTx runs fn in a transaction, committing it if fn returns nil and
+// rolling it back otherwise, and returns the error of fn or of
+// committing. If the transaction fails due to a serialization
+// failure or a deadlock it is retried with backoff, running fn
+// again, so fn must not have side effects outside the transaction.
+//
+// If ctx has a deadline, such as that of the current request, the
+// statements of the transaction time out with it.
+func (db *Database) InTx(ctx context.Context, fn func(tx *Tx) error) error {
+	backoff := minTxBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.runTx(ctx, fn)
+		if err == nil || !isRetryable(err) || attempt >= maxTxAttempts {
+			return err
+		}
+
+		// Wait for a random duration up to the backoff
+		// so that conflicting transactions spread out.
+		t := time.NewTimer(time.Duration(rand.Int63n(int64(backoff))) + time.Millisecond)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		if backoff *= 2; backoff > maxTxBackoff {
+			backoff = maxTxBackoff
+		}
+	}
+}
+
+// runTx makes a single attempt at running fn in a transaction.
+func (db *Database) runTx(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			tx.rollback()
+			panic(e)
+		}
+	}()
+
+	if dl, ok := ctx.Deadline(); ok {
+		ms := time.Until(dl).Milliseconds()
+		if ms < 1 {
+			ms = 1
+		}
+		if _, err := tx.exec(ctx, "SET LOCAL statement_timeout = "+strconv.FormatInt(ms, 10)); err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit()
+}
+
+// isRetryable reports whether err is due to a serialization
+// failure or a deadlock, after which a transaction can be retried.
+func isRetryable(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.SQLState() {
+	case "40001", // serialization_failure
+		"40P01": // deadlock_detected
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+// Package tasks provides durable background tasks.
+//
+// Tasks are enqueued to queues, whose handlers are declared in the
+// application's configuration, and are handled by a pool of workers
+// in each instance. Handlers run like calls to endpoints: they are
+// logged, traced and measured, and a task whose handler fails is
+// retried with exponential backoff, up to a maximum number of
+// attempts. Tasks can be delayed to run at a later time.
+//
+// Since tasks may be attempted more than once,
+// handlers should be idempotent.
+package tasks
+
+import (
+	"context"
+	"time"
+
+	"runtime.encore.dev/runtime"
+)
+
+// Enqueue enqueues a task with the given payload, which must be
+// JSON-encodable, to the named queue, and returns the ID of the task.
+func Enqueue(ctx context.Context, queue string, payload interface{}) (id string, err error) {
+	return runtime.EnqueueTask(ctx, queue, payload)
+}
+
+// EnqueueOptions are options for enqueuing a task.
+type EnqueueOptions struct {
+	// RunAt or Delay, if set, delay the task until the given
+	// time or by the given duration. At most one of them may be set.
+	RunAt time.Time
+	Delay time.Duration
+}
+
+// EnqueueWithOptions is like Enqueue, but with the given options.
+func EnqueueWithOptions(ctx context.Context, queue string, payload interface{}, opts EnqueueOptions) (id string, err error) {
+	return runtime.EnqueueTaskWithOptions(ctx, queue, payload, runtime.TaskOptions{
+		RunAt: opts.RunAt,
+		Delay: opts.Delay,
+	})
+}